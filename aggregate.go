@@ -0,0 +1,51 @@
+package dump
+
+// CountWhere returns the number of items in the dump for which pred returns
+// true.
+func (d *Dump) CountWhere(pred func(item Item) bool) int {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	count := 0
+	for _, item := range d.items {
+		if pred(item) {
+			count++
+		}
+	}
+	return count
+}
+
+// Reduce calls f with every item in the dump in id order, passing the value
+// f returned for the previous item (init for the first one), and returns the
+// value returned for the last item (init if the dump is empty). For example,
+// summing the ages of users:
+//
+//	total := users.Reduce(0, func(acc interface{}, item dump.Item) interface{} {
+//		return acc.(int) + item.(*User).Age
+//	}).(int)
+func (d *Dump) Reduce(init interface{}, f func(acc interface{}, item Item) interface{}) interface{} {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	acc := init
+	for _, item := range d.items {
+		acc = f(acc, item)
+	}
+	return acc
+}
+
+// GroupBy returns the items in the dump grouped by the key key returns for
+// them, each group in id order. Like Filter(), the returned items are the
+// same values held by the dump, so they shouldn't be modified outside of
+// Update().
+func (d *Dump) GroupBy(key func(item Item) string) map[string][]Item {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	groups := make(map[string][]Item)
+	for _, item := range d.items {
+		k := key(item)
+		groups[k] = append(groups[k], item)
+	}
+	return groups
+}
@@ -0,0 +1,36 @@
+package dump
+
+import (
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	test, _ := NewDump("aggregate.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+
+	length := func(acc interface{}, item Item) interface{} {
+		return acc.(int) + len(item.(*Blob).Data)
+	}
+	if total := test.Reduce(0, length).(int); total != 0 {
+		t.Fatal("reduced an empty dump", total)
+	}
+
+	test.AddAll(&Blob{"apple"}, &Blob{"banana"}, &Blob{"avocado"})
+
+	if count := test.CountWhere(func(item Item) bool {
+		return item.(*Blob).Data[0] == 'a'
+	}); count != 2 {
+		t.Fatal("bad count", count)
+	}
+
+	if total := test.Reduce(0, length).(int); total != 18 {
+		t.Fatal("bad reduce", total)
+	}
+
+	groups := test.GroupBy(func(item Item) string {
+		return item.(*Blob).Data[:1]
+	})
+	if len(groups) != 2 || len(groups["b"]) != 1 ||
+		groups["a"][1].(*Blob).Data != "avocado" {
+		t.Fatal("bad groups", groups)
+	}
+}
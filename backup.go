@@ -0,0 +1,164 @@
+package dump
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// WithBackups is an option that keeps the previous n versions of the dump
+// file around. On each successful save the current file is rotated to
+// "filename.1", "filename.1" to "filename.2" and so on, with the oldest
+// backup being dropped. The new version is written to a temporary file first
+// so a failed save never touches the existing files.
+func WithBackups(n int) Option {
+	return func(d *Dump) error {
+		if n < 0 {
+			return ErrInvalidBackups
+		}
+		d.backups = n
+		return nil
+	}
+}
+
+// WithBackupFallback is an option that makes Load() fall back to the newest
+// backup that loads successfully when the dump file is missing, truncated or
+// corrupt. It only has an effect together with WithBackups().
+func WithBackupFallback() Option {
+	return func(d *Dump) error {
+		d.fallback = true
+		return nil
+	}
+}
+
+// recoverable reports whether a Load() error is one that a backup might be
+// able to recover from.
+func recoverable(err error) bool {
+	return err == ErrCorrupt ||
+		err == io.ErrUnexpectedEOF ||
+		os.IsNotExist(err)
+}
+
+// backupName returns the filename of the nth most recent backup.
+func (d *Dump) backupName(n int) string {
+	return fmt.Sprintf("%s.%d", d.filename, n)
+}
+
+// rotate writes data as the new version of the dump file, shifting the
+// existing versions down the list of backups.
+func (d *Dump) rotate(data []byte) error {
+	tmp := d.filename + ".tmp"
+
+	if err := d.writeFile(tmp, data); err != nil {
+		return err
+	}
+
+	return d.promote(tmp)
+}
+
+// promote renames tmp to the dump file, shifting the existing versions down
+// the list of backups first (if WithBackups() is enabled). The dump file
+// stays in place until tmp replaces it, so a crash in between leaves both.
+func (d *Dump) promote(tmp string) error {
+	for i := d.backups - 1; i > 0; i-- {
+		err := d.storage.Rename(d.backupName(i), d.backupName(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if d.backups > 0 {
+		err := d.copyFile(d.filename, d.backupName(1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return d.storage.Rename(tmp, d.filename)
+}
+
+// copyFile makes newname a copy of oldname, as a hard link if the storage
+// implements Linker.
+func (d *Dump) copyFile(oldname, newname string) error {
+	if l, ok := d.linker(); ok {
+		return l.Link(oldname, newname)
+	}
+
+	data, err := d.storage.Read(oldname)
+	if err != nil {
+		return err
+	}
+	return d.storage.Write(newname, data)
+}
+
+// Backup writes a copy of the dump file to w, like bbolt's Tx.WriteTo(). The
+// copy is a consistent snapshot of the dump (with its collections), which
+// can be loaded like any dump file or restored with Restore(). The dump stays
+// usable during the backup: it is encoded in memory while writes wait, then
+// written to w without holding the dump, so a slow w (such as an
+// http.ResponseWriter) only blocks writes for as long as saving would. It
+// returns the number of bytes written.
+func (d *Dump) Backup(w io.Writer) (int64, error) {
+	if d.parent != nil {
+		return d.parent.Backup(w)
+	}
+
+	d.rlock()
+	buffer, _, err := d.encode(nil)
+	d.mutex.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+	defer putBuffer(buffer)
+
+	return buffer.WriteTo(w)
+}
+
+// Restore replaces the items of the dump (and its collections) with the ones
+// in the dump file read from r, as written by Backup() or Save(). Unlike
+// Load(), the restored items are changes to the dump: they are saved if
+// PERSIST_WRITES is enabled and recorded by WithCommandLog(). The dump is
+// left unchanged if the file is corrupt or can't be decoded.
+func (d *Dump) Restore(r io.Reader) (err error) {
+	if d.parent != nil {
+		return d.parent.Restore(r)
+	}
+
+	span := d.trace("Restore")
+	defer func() { span.End(err) }()
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	span.Locked()
+	defer d.mutex.Unlock()
+
+	// the backup's place in the command log isn't this dump's
+	var seq uint64
+	if d.events != nil {
+		seq = d.events.seq
+	}
+
+	d.skipped(0)
+	if _, err := d.decodeFrom(r); err != nil {
+		return err
+	}
+	if d.events != nil {
+		d.events.seq = seq
+	}
+
+	d.touch()
+	d.reindex()
+	d.generated()
+	d.afterReset()
+
+	if err := d.onLoad(); err != nil {
+		return err
+	}
+
+	if d.autosave() {
+		return d.save()
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package dump
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestBackups(t *testing.T) {
+	if _, err := New("backup.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithBackups(-1)); err != ErrInvalidBackups {
+		t.Fatal("accepted negative backups")
+	}
+
+	test, err := New("backup.db", PERSIST_WRITES,
+		[]Type{{"dump.Blob", &Blob{}}}, WithBackups(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"one", "two", "three"} {
+		if _, err = test.Add(&Blob{data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = os.Stat("backup.db.3"); !os.IsNotExist(err) {
+		t.Fatal("kept too many backups")
+	}
+
+	for name, count := range map[string]int{
+		"backup.db":   3,
+		"backup.db.1": 2,
+		"backup.db.2": 1,
+	} {
+		other, _ := NewDump(name, PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+		if err = other.Load(); err != nil {
+			t.Fatal(err)
+		}
+		other.View(func(items []Item) error {
+			if len(items) != count {
+				t.Fatalf("%s has %d items, expected %d", name, len(items), count)
+			}
+			return nil
+		})
+	}
+
+	os.Mkdir("backup.db.1.tmp", 0755)
+	defer os.Remove("backup.db.1.tmp")
+
+	broken, _ := New("backup.db.1", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithBackups(1))
+	if err = broken.Save(); err == nil {
+		t.Fatal("didn't fail writing temporary file")
+	}
+}
+
+func TestBackupFallback(t *testing.T) {
+	test, err := New("fallback.db", PERSIST_WRITES,
+		[]Type{{"dump.Blob", &Blob{}}}, WithBackups(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"one", "two", "three"} {
+		if _, err = test.Add(&Blob{data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	corrupt := func(name string) {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-1] ^= 0xff
+		if err = ioutil.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	corrupt("fallback.db")
+
+	strict, _ := New("fallback.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithBackups(2))
+	if err = strict.Load(); err != ErrCorrupt {
+		t.Fatal("fell back without WithBackupFallback")
+	}
+
+	other, _ := New("fallback.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithBackups(2), WithBackupFallback())
+	if err = other.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if other.LoadedFrom() != "fallback.db.1" {
+		t.Fatal("loaded from wrong file", other.LoadedFrom())
+	}
+
+	other.View(func(items []Item) error {
+		if len(items) != 2 {
+			t.Fatal("fallback loaded wrong backup")
+		}
+		return nil
+	})
+
+	corrupt("fallback.db.1")
+	corrupt("fallback.db.2")
+
+	if err = other.Load(); err != ErrCorrupt {
+		t.Fatal("expected original error when all backups are corrupt")
+	}
+
+	if err = test.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = other.Load(); err != nil || other.LoadedFrom() != "fallback.db" {
+		t.Fatal("didn't load primary file")
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	test, err := New("hot.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{"one", "two", "three"} {
+		test.Add(&Blob{data})
+	}
+
+	// writes go on during the backup
+	var (
+		backup bytes.Buffer
+		wg     sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			test.Add(&Blob{"more"})
+		}
+	}()
+	n, err := test.Backup(&backup)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(backup.Len()) {
+		t.Fatalf("reported %d bytes, wrote %d", n, backup.Len())
+	}
+
+	restored, _ := New("restored.db", PERSIST_WRITES, []Type{{"dump.Blob", &Blob{}}})
+	restored.Add(&Blob{"gone"})
+	if err = restored.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Len() < 3 || restored.Len() > 103 {
+		t.Fatalf("restored %d items", restored.Len())
+	}
+	if item, _ := restored.Get(0); item.(*Blob).Data != "one" {
+		t.Fatal("didn't restore the items")
+	}
+
+	// the restored items were saved
+	saved, _ := New("restored.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}})
+	if err = saved.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Len() != restored.Len() {
+		t.Fatal("didn't save the restored items")
+	}
+
+	// a corrupt backup leaves the dump as it was
+	data := backup.Bytes()
+	data[len(data)-1]++
+	if err = restored.Restore(bytes.NewReader(data)); err != ErrCorrupt {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+	if restored.Len() != saved.Len() {
+		t.Fatal("changed the dump")
+	}
+
+	restored.Close()
+	if err = restored.Restore(bytes.NewReader(backup.Bytes())); err != ErrClosed {
+		t.Fatal("restored a closed dump")
+	}
+}
+
+// crashingStorage fails to rename files over name, like a crash would.
+type crashingStorage struct {
+	memoryStorage
+	name string
+}
+
+func (c *crashingStorage) Rename(oldname, newname string) error {
+	if newname == c.name {
+		return errors.New("crashed")
+	}
+	return c.memoryStorage.Rename(oldname, newname)
+}
+
+func TestBackupsCrash(t *testing.T) {
+	storage := &crashingStorage{memoryStorage: memoryStorage{files: make(map[string][]byte)}}
+	test, _ := New("crash.db", PERSIST_WRITES, []Type{{"dump.Blob", &Blob{}}},
+		WithStorage(storage), WithBackups(1))
+	test.Add(&Blob{"one"})
+
+	storage.name = "crash.db"
+	if _, err := test.Add(&Blob{"two"}); err == nil {
+		t.Fatal("didn't fail replacing the dump file")
+	}
+
+	// the dump file is still there, along with its backup
+	for _, name := range []string{"crash.db", "crash.db.1"} {
+		other, _ := New(name, PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}}, WithStorage(storage))
+		if err := other.Load(); err != nil || other.Len() != 1 {
+			t.Fatal("lost", name, err)
+		}
+	}
+}
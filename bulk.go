@@ -0,0 +1,161 @@
+package dump
+
+// UpdateWhere calls mutate with every item in the dump for which pred returns
+// true, under a single lock and (if PERSIST_WRITES is enabled) a single save.
+// It returns the number of items passed to mutate and an error if there was a
+// problem persisting the dump on the disk. If mutate returns an error (which
+// stops the update), or a changed item fails validation (see WithValidator())
+// or violates a unique index, every change is undone, metadata included, and
+// the error is returned.
+func (d *Dump) UpdateWhere(pred func(item Item) bool, mutate func(item Item) error) (int, error) {
+	if err := d.lock(); err != nil {
+		return 0, err
+	}
+	defer d.mutex.Unlock()
+
+	var (
+		ids   []int
+		items []Item
+		metas []meta
+		err   error
+	)
+
+	for id, item := range d.items {
+		if !pred(item) {
+			continue
+		}
+
+		if err = d.thaw(id); err != nil {
+			break
+		}
+
+		// the item is changed in place, so a copy is kept to undo it
+		var original Item
+		if original, err = copyItem(d.items[id]); err != nil {
+			break
+		}
+		ids, items, metas = append(ids, id), append(items, original), append(metas, d.meta[id])
+
+		err = mutate(d.items[id])
+		d.replaced(id)
+
+		if err == nil {
+			err = d.validate(d.items[id])
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil && d.hasUnique() {
+		err = d.checkIndexes()
+	}
+
+	updated := len(ids)
+
+	if err != nil {
+		d.undo(ids, items, metas)
+		return updated, err
+	}
+
+	d.afterUpdate(ids...)
+
+	if updated > 0 && d.autosave() {
+		return updated, d.save()
+	}
+
+	return updated, nil
+}
+
+// undo puts back the items with the provided ids and their metadata, as they
+// were before being changed in place.
+//
+// no mutex
+func (d *Dump) undo(ids []int, items []Item, metas []meta) {
+	if len(ids) == 0 {
+		return
+	}
+
+	for i, id := range ids {
+		d.items[id], d.meta[id] = items[i], metas[i]
+	}
+	d.changed()
+}
+
+// DeleteWhere removes every item in the dump for which pred returns true,
+// under a single lock and (if PERSIST_WRITES is enabled) a single save. The
+// remaining items keep their order, but their ids shift down to fill the
+// gaps. It returns the number of items removed and an error if there was a
+// problem persisting the dump on the disk.
+func (d *Dump) DeleteWhere(pred func(item Item) bool) (int, error) {
+	if err := d.lock(); err != nil {
+		return 0, err
+	}
+	defer d.mutex.Unlock()
+
+	removed, err := d.remove(func(id int) bool { return pred(d.items[id]) })
+	if err != nil {
+		return 0, err
+	}
+
+	if removed > 0 && d.autosave() {
+		return removed, d.save()
+	}
+
+	return removed, nil
+}
+
+// remove removes every item for whose id pred returns true along with its
+// metadata, and returns the number of items removed. It returns an error,
+// without removing anything, if an item referencing them can't be thawed
+// (see thawReferencing()).
+//
+// no mutex
+func (d *Dump) remove(pred func(id int) bool) (int, error) {
+	var (
+		ids   []int
+		items []Item
+		metas []meta
+	)
+
+	for id, item := range d.items {
+		if pred(id) {
+			ids = append(ids, id)
+			items = append(items, item)
+			metas = append(metas, d.meta[id])
+		}
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := d.thawReferencing(metas); err != nil {
+		return 0, err
+	}
+
+	kept, next := 0, 0
+	for id, item := range d.items {
+		if next < len(ids) && ids[next] == id {
+			next++
+			continue
+		}
+		d.items[kept] = item
+		d.meta[kept] = d.meta[id]
+		kept++
+	}
+
+	removed := len(d.items) - kept
+
+	for id := kept; id < len(d.items); id++ {
+		d.items[id] = nil
+	}
+
+	d.items = d.items[:kept]
+	d.meta = d.meta[:kept]
+	d.generated()
+	d.shifted(ids[0])
+	d.reindex()
+	d.afterDelete(ids, items, metas)
+
+	return removed, nil
+}
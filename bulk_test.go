@@ -0,0 +1,115 @@
+package dump
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpdateWhere(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+	test.AddAll(&Blob{"a"}, &Blob{"b"}, &Blob{"a"})
+
+	updated, err := test.UpdateWhere(func(item Item) bool {
+		return item.(*Blob).Data == "a"
+	}, func(item Item) error {
+		item.(*Blob).Data = "c"
+		return nil
+	})
+	if err != nil || updated != 2 {
+		t.Fatal("bad update", updated, err)
+	}
+
+	other, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	other.Load()
+	other.View(func(items []Item) error {
+		for i, data := range []string{"c", "b", "c"} {
+			if items[i].(*Blob).Data != data {
+				t.Fatal("update didn't persist")
+			}
+		}
+		return nil
+	})
+
+	var errTest = errors.New("update where")
+	if updated, err = test.UpdateWhere(func(Item) bool { return true }, func(Item) error {
+		return errTest
+	}); err != errTest || updated != 1 {
+		t.Fatal("didn't stop at the first error")
+	}
+}
+
+func TestUpdateWhereUnique(t *testing.T) {
+	test, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}},
+		WithUniqueIndex("data", func(item Item) string { return item.(*Blob).Data }))
+	test.AddAll(&Blob{"a"}, &Blob{"b"})
+
+	if _, err := test.UpdateWhere(func(Item) bool { return true }, func(item Item) error {
+		item.(*Blob).Data = "same"
+		return nil
+	}); err != ErrDuplicate {
+		t.Fatal("expected ErrDuplicate")
+	}
+
+	if item, _ := test.Get(1); item.(*Blob).Data != "b" {
+		t.Fatal("duplicate wasn't rolled back")
+	}
+}
+
+func TestDeleteWhere(t *testing.T) {
+	test, _ := New("test.db", PERSIST_WRITES, []Type{{"dump.Blob", &Blob{}}},
+		WithIndex("data", func(item Item) string { return item.(*Blob).Data }))
+	test.AddAll(&Blob{"a"}, &Blob{"b"}, &Blob{"a"}, &Blob{"c"})
+
+	_, next, _ := test.Page("", 2)
+
+	removed, err := test.DeleteWhere(func(item Item) bool {
+		return item.(*Blob).Data == "a"
+	})
+	if err != nil || removed != 2 || test.Len() != 2 {
+		t.Fatal("bad delete", removed, err)
+	}
+
+	if ids, _, _ := test.GetByIndex("data", "c"); len(ids) != 1 || ids[0] != 1 {
+		t.Fatal("index wasn't updated", ids)
+	}
+
+	if items, _, _ := test.Page(next, 2); len(items) != 1 || items[0].(*Blob).Data != "c" {
+		t.Fatal("cursor broke after delete")
+	}
+
+	other, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	other.Load()
+	if item, _ := other.Get(0); other.Len() != 2 || item.(*Blob).Data != "b" {
+		t.Fatal("delete didn't persist")
+	}
+
+	if removed, err = other.DeleteWhere(func(Item) bool { return false }); err != nil || removed != 0 {
+		t.Fatal("bad empty delete")
+	}
+}
+
+func TestUpdateWhereUndo(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	test.AddAll(&Blob{"a"}, &Blob{"b"})
+	before, _ := test.GetMeta(0)
+
+	errTest := errors.New("update where")
+	updated, err := test.UpdateWhere(func(Item) bool { return true }, func(item Item) error {
+		if item.(*Blob).Data == "b" {
+			return errTest
+		}
+		item.(*Blob).Data = "c"
+		return nil
+	})
+	if err != errTest || updated != 2 {
+		t.Fatal("didn't return the error", updated, err)
+	}
+
+	// the first item was changed before the error, and is put back
+	if item, _ := test.Get(0); item.(*Blob).Data != "a" {
+		t.Fatal("change wasn't undone")
+	}
+	if after, _ := test.GetMeta(0); after != before {
+		t.Fatal("metadata wasn't restored", before, after)
+	}
+}
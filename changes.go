@@ -0,0 +1,242 @@
+package dump
+
+import (
+	"sync"
+)
+
+// Change describes an item that was added, updated or deleted. Changes are
+// numbered in the order they happened, starting at 1.
+type Change struct {
+	// Seq is the number of the change.
+	Seq uint64
+
+	// Op is "add", "update" or "delete", or "reset" when the items were
+	// reordered or replaced as a whole (by Sort(), Load() or LoadJSON()), after
+	// which followers have to start over from a snapshot of the dump.
+	Op string
+
+	// ID is the id of the item at the time of the change (for deleted items,
+	// the id it had before it was deleted). It is -1 for resets.
+	ID int
+
+	// StableID is the stable id of the item, which unlike ID never changes
+	// and is never reused for another item.
+	StableID uint64
+
+	// Data is the JSON encoding of the item at the time of the change, with
+	// its fields redacted (see WithRedaction()), or null if it couldn't be
+	// marshaled.
+	Data []byte
+
+	// raw is the JSON encoding of the item without redaction, which is what
+	// is replicated.
+	raw []byte
+}
+
+// feed keeps the most recent changes and the channels subscribed to new ones.
+type feed struct {
+	size        int
+	seq         uint64
+	changes     []Change
+	subscribers map[chan Change]*subscriber
+	mutex       sync.Mutex
+}
+
+// subscriber only receives the changes to items matching pred (if it isn't
+// nil). visible holds the stable ids of the items it has been sent, so items
+// that stop matching are sent as deleted and items that start matching are
+// sent as added.
+type subscriber struct {
+	pred    func(item Item) bool
+	visible map[uint64]bool
+}
+
+// subscriberBuffer is how many changes a subscriber can fall behind before it
+// is dropped.
+const subscriberBuffer = 256
+
+// WithChanges is an option that keeps track of the changes made to the dump
+// so they can be followed with Changes() (or ChangesHandler()). The n most
+// recent changes are kept in memory so subscribers can resume where they
+// left off.
+func WithChanges(n int) Option {
+	return func(d *Dump) error {
+		if n < 0 {
+			return ErrInvalidFeed
+		}
+
+		d.feed = &feed{
+			size:        n,
+			subscribers: make(map[chan Change]*subscriber),
+		}
+		return nil
+	}
+}
+
+// Changes returns a channel receiving every change made to the dump after the
+// change numbered since, along with a function that unsubscribes and closes
+// the channel. If since is 0 only new changes are received. Changes older
+// than the ones kept by WithChanges() are skipped.
+//
+// The channel is closed if the receiver falls too far behind, after which
+// Changes() can be called again with the last change received. It returns
+// ErrNoFeed if the dump wasn't created with WithChanges().
+func (d *Dump) Changes(since uint64) (<-chan Change, func(), error) {
+	if d.feed == nil {
+		return nil, nil, ErrNoFeed
+	}
+	return d.feed.subscribe(since, nil)
+}
+
+// subscribe subscribes to the changes after since, or to the changes made
+// from now on if since is 0. If s isn't nil, changes are filtered by s (see
+// subscriber).
+func (f *feed) subscribe(since uint64, s *subscriber) (<-chan Change, func(), error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if since == 0 {
+		since = f.seq
+	}
+	ch, cancel := f.add(since, s)
+	return ch, cancel, nil
+}
+
+// tail subscribes to the changes made from now on, and returns the number of
+// the latest change, which they follow.
+func (f *feed) tail() (<-chan Change, func(), uint64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	ch, cancel := f.add(f.seq, nil)
+	return ch, cancel, f.seq
+}
+
+// after subscribes to the changes after since. Unlike subscribe(), since 0
+// means every change, starting with the oldest one kept.
+func (f *feed) after(since uint64) (<-chan Change, func()) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.add(since, nil)
+}
+
+// add subscribes s to the changes after since, sending it the ones that are
+// kept right away.
+//
+// no mutex
+func (f *feed) add(since uint64, s *subscriber) (<-chan Change, func()) {
+	var missed []Change
+	for _, change := range f.changes {
+		if change.Seq > since {
+			missed = append(missed, change)
+		}
+	}
+
+	ch := make(chan Change, len(missed)+subscriberBuffer)
+	for _, change := range missed {
+		ch <- change
+	}
+	f.subscribers[ch] = s
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mutex.Lock()
+			defer f.mutex.Unlock()
+
+			if _, ok := f.subscribers[ch]; ok {
+				delete(f.subscribers, ch)
+				close(ch)
+			}
+		})
+	}
+}
+
+// publish sends a change to the subscribers of the feed.
+//
+// no mutex (the dump has to be locked)
+func (d *Dump) publish(op string, id int, item Item, m meta) {
+	raw, err := marshalItem(item)
+	if err != nil {
+		raw = []byte("null")
+	}
+
+	data := raw
+	if d.root().redaction != nil {
+		if data, err = d.marshalJSON(item); err != nil {
+			data = []byte("null")
+		}
+	}
+
+	d.feed.publish(Change{Op: op, ID: id, StableID: m.ID, Data: data, raw: raw}, item)
+}
+
+// publish numbers a change and sends it to the subscribers.
+func (f *feed) publish(change Change, item Item) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.seq++
+	change.Seq = f.seq
+
+	if f.size > 0 {
+		if len(f.changes) == f.size {
+			f.changes = append(f.changes[:0], f.changes[1:]...)
+		}
+		f.changes = append(f.changes, change)
+	}
+
+	for ch, s := range f.subscribers {
+		sent := change
+		if s != nil {
+			if sent.Op = s.filter(change, item); sent.Op == "" {
+				continue
+			}
+		}
+
+		select {
+		case ch <- sent:
+		default:
+			// too far behind, the subscriber has to resume
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// resume reports whether every change after since is still kept, so a
+// follower can resume from it, and returns the number of the latest change.
+func (f *feed) resume(since uint64) (bool, uint64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if since == 0 || since > f.seq {
+		return false, f.seq
+	}
+	return since == f.seq || (len(f.changes) > 0 && f.changes[0].Seq <= since+1), f.seq
+}
+
+// filter returns the op the change should be sent to the subscriber as, or
+// an empty string if it shouldn't be sent.
+func (s *subscriber) filter(change Change, item Item) string {
+	if change.Op == "reset" {
+		s.visible = make(map[uint64]bool)
+		return "reset"
+	}
+
+	was := s.visible[change.StableID]
+	if change.Op == "delete" || !s.pred(item) {
+		if !was {
+			return ""
+		}
+		delete(s.visible, change.StableID)
+		return "delete"
+	}
+
+	s.visible[change.StableID] = true
+	if was {
+		return "update"
+	}
+	return "add"
+}
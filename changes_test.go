@@ -0,0 +1,62 @@
+package dump
+
+import "testing"
+
+func TestChanges(t *testing.T) {
+	if _, err := New("test.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}},
+		WithChanges(-1)); err != ErrInvalidFeed {
+		t.Fatal("expected ErrInvalidFeed")
+	}
+
+	plain, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	if _, _, err := plain.Changes(0); err != ErrNoFeed {
+		t.Fatal("expected ErrNoFeed")
+	}
+
+	test, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}},
+		WithChanges(2))
+
+	live, cancel, err := test.Changes(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Add(&Blob{"a"})
+	test.Set(0, &Blob{"b"})
+	test.DeleteWhere(func(Item) bool { return true })
+
+	for i, expected := range []Change{
+		{Seq: 1, Op: "add", ID: 0, Data: []byte(`{"data":"a"}`)},
+		{Seq: 2, Op: "update", ID: 0, Data: []byte(`{"data":"b"}`)},
+		{Seq: 3, Op: "delete", ID: 0, Data: []byte(`{"data":"b"}`)},
+	} {
+		change := <-live
+		if change.Seq != expected.Seq || change.Op != expected.Op ||
+			change.ID != expected.ID || string(change.Data) != string(expected.Data) {
+			t.Fatal("bad change", i, change)
+		}
+	}
+
+	cancel()
+	cancel()
+	if _, ok := <-live; ok {
+		t.Fatal("channel wasn't closed")
+	}
+
+	// only the two most recent changes are kept
+	resumed, cancel, _ := test.Changes(1)
+	defer cancel()
+	if change := <-resumed; change.Seq != 2 {
+		t.Fatal("didn't resume", change)
+	}
+	if change := <-resumed; change.Seq != 3 {
+		t.Fatal("didn't resume", change)
+	}
+
+	slow, _, _ := test.Changes(0)
+	for i := 0; i <= subscriberBuffer; i++ {
+		test.Add(&Blob{"spam"})
+	}
+	for range slow {
+	}
+}
@@ -0,0 +1,10 @@
+// Command dumpctl inspects and converts dump files. It doesn't know the types
+// of any application, so the commands decoding items report the types they
+// would need; see package dumpctl for building a tool that knows them.
+package main
+
+import "github.com/karlmcguire/dump/dumpctl"
+
+func main() {
+	dumpctl.Main()
+}
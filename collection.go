@@ -0,0 +1,124 @@
+package dump
+
+// WithCollection is an option that creates a collection of the dump (see
+// Collection()) configured with the provided options, such as indexes or
+// hooks. Options about persistence (such as WithBackups()) have no effect on
+// collections, which are persisted by the dump.
+func WithCollection(name string, options ...Option) Option {
+	return func(d *Dump) error {
+		_, err := d.collection(name, options)
+		return err
+	}
+}
+
+// Collection returns the collection of the dump with the provided name,
+// creating it if needed. A collection is a dump of its own, holding items of
+// any of the registered types, which is persisted in the dump file together
+// with the dump and its other collections: saving any of them saves all of
+// them at the same instant, and loading any of them loads all of them.
+//
+// The dump and its collections share a lock, so each of them is only changed
+// while the others aren't. Collection() returns ErrInvalidCollection if name
+// is empty or the dump was created with WithRecordStore().
+func (d *Dump) Collection(name string) (*Dump, error) {
+	if d.parent != nil {
+		return d.parent.Collection(name)
+	}
+
+	if err := d.lock(); err != nil {
+		return nil, err
+	}
+	defer d.mutex.Unlock()
+
+	return d.collection(name, nil)
+}
+
+// collection returns the collection with the provided name, creating it with
+// the provided options if needed.
+//
+// no mutex
+func (d *Dump) collection(name string, options []Option) (*Dump, error) {
+	if c, ok := d.collections[name]; ok {
+		return c, nil
+	}
+
+	if name == "" || d.records != nil {
+		return nil, ErrInvalidCollection
+	}
+
+	c := &Dump{
+		filename: d.filename,
+		types:    d.types,
+		storage:  d.storage,
+		items:    make([]Item, 0),
+		persist:  d.persist,
+		instance: d.instance,
+		parent:   d,
+		closed:   d.closed,
+		mutex:    d.mutex,
+	}
+
+	for _, option := range options {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.records != nil {
+		return nil, ErrInvalidCollection
+	}
+
+	if err := c.retain(); err != nil {
+		return nil, err
+	}
+
+	if c.hybridClock {
+		if c.crdt == nil {
+			return nil, ErrInvalidCRDT
+		}
+		c.crdt.hybrid = true
+	}
+
+	if d.collections == nil {
+		d.collections = make(map[string]*Dump)
+	}
+	d.collections[name] = c
+
+	c.startSweeper()
+
+	return c, nil
+}
+
+// loadCollections replaces the items of the collections with the ones
+// persisted in files, creating the collections that don't exist yet.
+// Collections missing from files are emptied.
+//
+// no mutex
+func (d *Dump) loadCollections(files map[string]file) error {
+	for name := range files {
+		if _, err := d.collection(name, nil); err != nil {
+			return err
+		}
+	}
+
+	for name, c := range d.collections {
+		f, ok := files[name]
+		if !ok {
+			c.items, c.meta = make([]Item, 0), nil
+			c.reset()
+		} else if err := c.decodeFile(f); err != nil {
+			return err
+		} else {
+			c.reindex()
+		}
+
+		c.generated()
+		c.afterReset()
+
+		if err := c.onLoad(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
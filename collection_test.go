@@ -0,0 +1,84 @@
+package dump
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCollection(t *testing.T) {
+	defer os.Remove("collections.db")
+	defer os.Remove("collections.log")
+
+	types := []Type{{"dump.Plain", &Plain{}}, {"dump.Counter", &Counter{}}}
+	byName := WithIndex("name", func(item Item) string { return item.(*Plain).Name })
+
+	log, _ := OpenLogStore("collections.log")
+	defer log.Close()
+
+	if _, err := New("collections.db", PERSIST_WRITES, types,
+		WithCollection("users"), WithRecordStore(log)); err != ErrInvalidCollection {
+		t.Fatal("accepted collections with a record store")
+	}
+
+	test, err := New("collections.db", PERSIST_WRITES, types,
+		WithCollection("users", byName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = test.Collection(""); err != ErrInvalidCollection {
+		t.Fatal("accepted empty name")
+	}
+
+	users, _ := test.Collection("users")
+	counters, _ := test.Collection("counters")
+	if again, _ := counters.Collection("counters"); again != counters {
+		t.Fatal("expected the same collection")
+	}
+
+	test.Add(&Plain{"root"})
+	users.AddAll(&Plain{"karl"}, &Plain{"santa"})
+	counters.Add(&Counter{"visits", 1})
+
+	if ids, _, _ := users.GetByIndex("name", "santa"); len(ids) != 1 || ids[0] != 1 {
+		t.Fatal("collection not indexed")
+	}
+
+	// collections of the same dump can take part in a transaction together
+	txn, _ := NewTxn(users, counters)
+	err = txn.Update(func(items [][]Item) error {
+		items[0][0].(*Plain).Name = "claus"
+		items[1][0].(*Counter).Count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, _ := New("collections.db", PERSIST_MANUAL, types,
+		WithCollection("users", byName))
+	if err = loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(d *Dump, n int, check func(items []Item) bool) {
+		d.View(func(items []Item) error {
+			if len(items) != n || !check(items) {
+				t.Fatal("bad collection", items)
+			}
+			return nil
+		})
+	}
+
+	expect(loaded, 1, func(items []Item) bool { return items[0].(*Plain).Name == "root" })
+
+	users, _ = loaded.Collection("users")
+	expect(users, 2, func(items []Item) bool { return items[0].(*Plain).Name == "claus" })
+
+	counters, _ = loaded.Collection("counters")
+	expect(counters, 1, func(items []Item) bool { return items[0].(*Counter).Count == 2 })
+
+	if ids, _, _ := users.GetByIndex("name", "claus"); len(ids) != 1 {
+		t.Fatal("loaded collection not indexed")
+	}
+}
@@ -0,0 +1,68 @@
+package dump
+
+// Command kinds, see Command.
+const (
+	CommandAdd    = "add"
+	CommandSet    = "set"
+	CommandRemove = "remove"
+	CommandClear  = "clear"
+
+	// CommandReplace replaces every item, as recorded when the items are
+	// reordered or replaced as a whole (see WithCommandLog()).
+	CommandReplace = "replace"
+)
+
+// Command is a change to a dump that can be recorded (it can be encoded with
+// encoding/gob once the types of the items are registered) and applied again
+// with Apply(), for example by another process replicating the dump.
+type Command struct {
+	// Kind is one of the Command constants.
+	Kind string
+
+	// ID is the id of the item for CommandSet and CommandRemove.
+	ID int
+
+	// Item is the item added by CommandAdd or set by CommandSet.
+	Item Item
+
+	// Items are the items of CommandReplace.
+	Items []Item
+}
+
+// Apply applies the command to the dump, calling Add(), Set(), Remove() or
+// Clear(), or replacing every item like LoadJSON() does. It returns the id of
+// the item (for CommandAdd, the id it was given) and the error returned by
+// the method, or ErrInvalidCommand if the kind of the command is unknown.
+func (d *Dump) Apply(c Command) (int, error) {
+	switch c.Kind {
+	case CommandAdd:
+		return d.Add(c.Item)
+	case CommandSet:
+		return c.ID, d.Set(c.ID, c.Item)
+	case CommandRemove:
+		return c.ID, d.Remove(c.ID)
+	case CommandClear:
+		return 0, d.Clear()
+	case CommandReplace:
+		return 0, d.replaceAll(c.Items)
+	}
+	return 0, ErrInvalidCommand
+}
+
+// replaceAll replaces every item with items.
+func (d *Dump) replaceAll(items []Item) error {
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer d.mutex.Unlock()
+
+	if err := d.replace(append(make([]Item, 0), items...)); err != nil {
+		return err
+	}
+
+	if d.autosave() {
+		return d.save()
+	}
+
+	return nil
+}
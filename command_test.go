@@ -0,0 +1,51 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	for _, c := range []Command{
+		{Kind: CommandAdd, Item: &Blob{"a"}},
+		{Kind: CommandAdd, Item: &Blob{"b"}},
+		{Kind: CommandSet, ID: 0, Item: &Blob{"c"}},
+		{Kind: CommandRemove, ID: 1},
+	} {
+		if err := encoder.Encode(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	decoder := gob.NewDecoder(&buffer)
+	for i, expected := range []int{0, 1, 0, 1} {
+		var c Command
+		if err := decoder.Decode(&c); err != nil {
+			t.Fatal(err)
+		}
+		if id, err := test.Apply(c); err != nil || id != expected {
+			t.Fatal("bad apply", i, id, err)
+		}
+	}
+
+	if item, _ := test.Get(0); test.Len() != 1 || item.(*Blob).Data != "c" {
+		t.Fatal("commands weren't applied")
+	}
+
+	if _, err := test.Apply(Command{Kind: CommandRemove, ID: 5}); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound")
+	}
+
+	if _, err := test.Apply(Command{Kind: CommandClear}); err != nil || test.Len() != 0 {
+		t.Fatal("bad clear")
+	}
+
+	if _, err := test.Apply(Command{Kind: "nope"}); err != ErrInvalidCommand {
+		t.Fatal("expected ErrInvalidCommand")
+	}
+}
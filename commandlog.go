@@ -0,0 +1,255 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// CommandLog is an ordered log of the commands applied to a dump, used by
+// WithCommandLog(). Commands are numbered in the order they were appended,
+// starting at 1, and each one is written as a frame:
+//
+//	seq      uint64
+//	length   uint32  length of data
+//	checksum uint32  CRC-32 (Castagnoli) of data
+//	data     []byte  gob encoded Command
+//
+// A frame without data only records the number of the last command, so the
+// numbering survives the log being truncated after a snapshot. A frame that
+// was interrupted by a crash is dropped when the log is opened.
+type CommandLog struct {
+	filename string
+	file     *os.File
+	seq      uint64
+	size     int64
+	mutex    sync.Mutex
+}
+
+const commandFrameSize = 8 + 4 + 4
+
+// OpenCommandLog opens (or creates) the command log with the provided
+// filename. It returns ErrCorrupt if a frame fails its checksum.
+func OpenCommandLog(filename string) (*CommandLog, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &CommandLog{filename: filename}
+
+	err = readCommands(file, func(seq uint64, data []byte) error {
+		l.seq = seq
+		l.size += int64(commandFrameSize + len(data))
+		return nil
+	})
+	if err == nil {
+		// drop an interrupted frame so new frames follow the last good one
+		err = file.Truncate(l.size)
+	}
+	if err == nil {
+		_, err = file.Seek(l.size, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	l.file = file
+	return l, nil
+}
+
+// Seq returns the number of the last command appended to the log.
+func (l *CommandLog) Seq() uint64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.seq
+}
+
+// Append appends the commands to the log and syncs the file. Either all of
+// the commands are appended or none of them are.
+func (l *CommandLog) Append(commands ...Command) error {
+	encoded := make([][]byte, len(commands))
+	for i, c := range commands {
+		data, err := encodeCommand(c)
+		if err != nil {
+			return err
+		}
+		encoded[i] = data
+	}
+
+	_, err := l.append(encoded)
+	return err
+}
+
+// append appends the encoded commands to the log and returns its size.
+func (l *CommandLog) append(encoded [][]byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(encoded) == 0 {
+		return int(l.size), nil
+	}
+
+	var (
+		buffer []byte
+		seq    = l.seq
+	)
+
+	for _, data := range encoded {
+		seq++
+		buffer = appendCommandFrame(buffer, seq, data)
+	}
+
+	if err := l.write(buffer); err != nil {
+		return 0, err
+	}
+
+	l.seq = seq
+	return int(l.size), nil
+}
+
+// Read calls f with every command in the log numbered after since, in order.
+// It returns the first error returned by f.
+func (l *CommandLog) Read(since uint64, f func(seq uint64, c Command) error) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	file, err := os.Open(l.filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return readCommands(io.LimitReader(file, l.size), func(seq uint64, data []byte) error {
+		if seq <= since || len(data) == 0 {
+			return nil
+		}
+
+		var c Command
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&c); err != nil {
+			return decodeError(err)
+		}
+		return f(seq, c)
+	})
+}
+
+// Close closes the log file.
+func (l *CommandLog) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.file.Close()
+}
+
+// truncate removes every command from the log, keeping their numbering.
+func (l *CommandLog) truncate() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	tmp := l.filename + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	buffer := appendCommandFrame(nil, l.seq, nil)
+	if _, err = file.Write(buffer); err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = rename(tmp, l.filename)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	l.file.Close()
+	l.file = file
+	l.size = int64(len(buffer))
+
+	return nil
+}
+
+// write appends buffer to the log file, truncating what was written of it if
+// it can't be written as a whole.
+//
+// no mutex
+func (l *CommandLog) write(buffer []byte) error {
+	_, err := l.file.Write(buffer)
+	if err == nil {
+		err = l.file.Sync()
+	}
+
+	if err != nil {
+		l.file.Truncate(l.size)
+		l.file.Seek(l.size, io.SeekStart)
+		return err
+	}
+
+	l.size += int64(len(buffer))
+	return nil
+}
+
+func encodeCommand(c Command) ([]byte, error) {
+	buffer := getBuffer(0)
+	defer putBuffer(buffer)
+
+	if err := gob.NewEncoder(buffer).Encode(&c); err != nil {
+		return nil, encodeError(err, append([]Item{c.Item}, c.Items...)...)
+	}
+	return append([]byte{}, buffer.Bytes()...), nil
+}
+
+// readCommands calls f with the number and data of every complete frame read
+// from r.
+func readCommands(r io.Reader, f func(seq uint64, data []byte) error) error {
+	var (
+		reader = bufio.NewReader(r)
+		frame  = make([]byte, commandFrameSize)
+	)
+
+	for {
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			// a partial frame at the end is an interrupted append
+			return nil
+		}
+
+		var (
+			seq    = binary.BigEndian.Uint64(frame)
+			length = binary.BigEndian.Uint32(frame[8:])
+			sum    = binary.BigEndian.Uint32(frame[12:])
+			data   = make([]byte, length)
+		)
+
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil
+		}
+
+		if crc32.Checksum(data, crc) != sum {
+			return ErrCorrupt
+		}
+
+		if err := f(seq, data); err != nil {
+			return err
+		}
+	}
+}
+
+func appendCommandFrame(buffer []byte, seq uint64, data []byte) []byte {
+	var frame [commandFrameSize]byte
+
+	binary.BigEndian.PutUint64(frame[:], seq)
+	binary.BigEndian.PutUint32(frame[8:], uint32(len(data)))
+	binary.BigEndian.PutUint32(frame[12:], crc32.Checksum(data, crc))
+
+	return append(append(buffer, frame[:]...), data...)
+}
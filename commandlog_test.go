@@ -0,0 +1,72 @@
+package dump
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCommandLog(t *testing.T) {
+	defer os.Remove("commands.log")
+
+	NewDump("commands.db", PERSIST_MANUAL, Type{"dump.Plain", &Plain{}})
+
+	log, err := OpenCommandLog("commands.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = log.Append(
+		Command{Kind: CommandAdd, Item: &Plain{"a"}},
+		Command{Kind: CommandSet, ID: 0, Item: &Plain{"b"}},
+	)
+	if err != nil || log.Seq() != 2 {
+		t.Fatal("bad append", err)
+	}
+	log.Append(Command{Kind: CommandRemove, ID: 0})
+	log.Close()
+
+	// an interrupted append
+	file, _ := os.OpenFile("commands.log", os.O_WRONLY|os.O_APPEND, 0644)
+	file.Write(appendCommandFrame(nil, 4, []byte("torn"))[:10])
+	file.Close()
+
+	if log, err = OpenCommandLog("commands.log"); err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if log.Seq() != 3 {
+		t.Fatal("expected seq 3", log.Seq())
+	}
+
+	var kinds []string
+	log.Read(1, func(seq uint64, c Command) error {
+		kinds = append(kinds, c.Kind)
+		return nil
+	})
+	if len(kinds) != 2 || kinds[0] != CommandSet || kinds[1] != CommandRemove {
+		t.Fatal("bad commands", kinds)
+	}
+
+	if err = log.truncate(); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	if log, err = OpenCommandLog("commands.log"); err != nil || log.Seq() != 3 {
+		t.Fatal("lost the numbering", err)
+	}
+
+	log.Append(Command{Kind: CommandClear})
+	n := 0
+	log.Read(0, func(seq uint64, c Command) error {
+		if seq != 4 || c.Kind != CommandClear {
+			t.Fatal("bad command", seq, c)
+		}
+		n++
+		return nil
+	})
+	if n != 1 {
+		t.Fatal("expected one command")
+	}
+}
@@ -0,0 +1,88 @@
+package dump
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+)
+
+// Compression is used to compress the dump before it is written to disk and
+// to decompress it when it is read back. Gzip is provided by this package;
+// other algorithms (zstd, snappy, etc.) can be used by implementing this
+// interface.
+type Compression interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// Gzip is a Compression using compress/gzip with the default compression
+// level.
+var Gzip Compression = GzipLevel(gzip.DefaultCompression)
+
+// GzipLevel returns a Compression using compress/gzip with the provided
+// compression level (one of the compress/gzip level constants).
+func GzipLevel(level int) Compression {
+	return gzipCompression{level}
+}
+
+type gzipCompression struct {
+	level int
+}
+
+func (g gzipCompression) Compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	w, err := gzip.NewWriterLevel(&buffer, g.level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (g gzipCompression) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// streamCompression is implemented by the compressions that can compress and
+// decompress streams, so dumps don't have to hold both the compressed and the
+// uncompressed version of their file in memory.
+type streamCompression interface {
+	writer(w io.Writer) (io.WriteCloser, error)
+	reader(r io.Reader) (io.Reader, error)
+}
+
+func (g gzipCompression) writer(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, g.level)
+}
+
+func (g gzipCompression) reader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// WithCompression is an option that compresses the dump with c whenever it is
+// saved to disk and decompresses it whenever it is loaded. Files are marked as
+// compressed, so files written without compression can still be loaded by a
+// dump with compression enabled (and are compressed the next time it saves),
+// while compressed files can't be loaded without it (see ErrCompressed).
+func WithCompression(c Compression) Option {
+	return func(d *Dump) error {
+		d.compression = c
+		return nil
+	}
+}
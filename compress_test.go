@@ -0,0 +1,75 @@
+package dump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	test, err := New("compress.db", PERSIST_WRITES,
+		[]Type{{"dump.Blob", &Blob{}}}, WithCompression(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := test.Add(&Blob{"compressed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile("compress.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data[5]&flagCompressed == 0 ||
+		!bytes.HasPrefix(data[headerSize:], []byte{0x1f, 0x8b}) {
+		t.Fatal("file isn't gzipped")
+	}
+
+	other, err := New("compress.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithCompression(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = other.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = other.View(func(items []Item) error {
+		if items[id].(*Blob).Data != "compressed" {
+			t.Fatal("compressed load error")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := New("compress.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = plain.Load(); err == nil {
+		t.Fatal("loaded compressed file without compression")
+	}
+
+	if err = plain.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = other.Load(); err != nil {
+		t.Fatal("couldn't load uncompressed file with compression", err)
+	}
+
+	if _, err = Gzip.Decompress([]byte("nope")); err == nil {
+		t.Fatal("decompressed garbage")
+	}
+
+	if _, err = GzipLevel(42).Compress(nil); err == nil {
+		t.Fatal("accepted invalid gzip level")
+	}
+}
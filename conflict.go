@@ -0,0 +1,89 @@
+package dump
+
+import "reflect"
+
+// ConflictResolver decides which item is kept when two versions of an item
+// meet: duplicates merged by MergeFile(), items changed on both sides of a
+// Merge(), and items of a replica changed locally when the primary changes
+// them too (see Replicate()). It is set per dump with
+// WithConflictResolver(), so the policy can be chosen per deployment.
+type ConflictResolver interface {
+	// Resolve returns the item that replaces both versions, or an error to
+	// abort the operation.
+	Resolve(c Conflict) (Item, error)
+}
+
+// Conflict describes two versions of an item.
+type Conflict struct {
+	// Existing is the item held by the dump and Incoming the item it
+	// conflicts with.
+	Existing, Incoming Item
+
+	// ExistingMeta and IncomingMeta are the metadata of the items, where
+	// known (the zero value otherwise).
+	ExistingMeta, IncomingMeta Meta
+}
+
+// ResolverFunc is a function used as a ConflictResolver.
+type ResolverFunc func(c Conflict) (Item, error)
+
+// Resolve calls f.
+func (f ResolverFunc) Resolve(c Conflict) (Item, error) {
+	return f(c)
+}
+
+var (
+	// Ours resolves conflicts by keeping the existing item.
+	Ours ConflictResolver = ResolverFunc(func(c Conflict) (Item, error) {
+		return c.Existing, nil
+	})
+
+	// Theirs resolves conflicts by keeping the incoming item.
+	Theirs ConflictResolver = ResolverFunc(func(c Conflict) (Item, error) {
+		return c.Incoming, nil
+	})
+)
+
+// MergeFields returns a ConflictResolver that merges items that are pointers
+// to structs of the same type field by field: the exported fields of the
+// incoming item that aren't the zero value of their type replace the fields
+// of a (shallow) copy of the existing item. Other conflicts are resolved
+// with the incoming item.
+func MergeFields() ConflictResolver {
+	return ResolverFunc(func(c Conflict) (Item, error) {
+		existing, incoming := reflect.ValueOf(c.Existing), reflect.ValueOf(c.Incoming)
+		if existing.Kind() != reflect.Ptr || existing.Type() != incoming.Type() ||
+			existing.Elem().Kind() != reflect.Struct || existing.IsNil() || incoming.IsNil() {
+			return c.Incoming, nil
+		}
+
+		merged := reflect.New(existing.Type().Elem())
+		merged.Elem().Set(existing.Elem())
+		for i := 0; i < incoming.Elem().NumField(); i++ {
+			field := incoming.Elem().Field(i)
+			if existing.Type().Elem().Field(i).PkgPath != "" || field.IsZero() {
+				continue
+			}
+			merged.Elem().Field(i).Set(field)
+		}
+		return merged.Interface(), nil
+	})
+}
+
+// WithConflictResolver is an option that sets how the dump resolves
+// conflicts between two versions of an item (see ConflictResolver):
+//
+//   - MergeFile() uses it when it isn't passed a conflict function,
+//   - Merge() uses it for items changed by both dumps, instead of keeping the
+//     latest change (merging is then only deterministic if r is),
+//   - a replica uses it when the primary changes an item that was changed
+//     locally, instead of taking the primary's.
+func WithConflictResolver(r ConflictResolver) Option {
+	return func(d *Dump) error {
+		if r == nil {
+			return ErrInvalidResolver
+		}
+		d.resolver = r
+		return nil
+	}
+}
@@ -0,0 +1,73 @@
+package dump
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestMergeFields(t *testing.T) {
+	merged, err := MergeFields().Resolve(Conflict{Existing: &Counter{"a", 1}, Incoming: &Counter{"", 2}})
+	if err != nil || *merged.(*Counter) != (Counter{"a", 2}) {
+		t.Fatal("bad merge", merged, err)
+	}
+
+	if merged, _ := MergeFields().Resolve(Conflict{Existing: &Counter{"a", 1}, Incoming: &Plain{"b"}}); merged.(*Plain).Name != "b" {
+		t.Fatal("didn't keep the incoming item", merged)
+	}
+	if merged, _ := Ours.Resolve(Conflict{Existing: &Plain{"a"}, Incoming: &Plain{"b"}}); merged.(*Plain).Name != "a" {
+		t.Fatal("didn't keep the existing item", merged)
+	}
+}
+
+func TestConflictResolver(t *testing.T) {
+	defer os.Remove("shard.db")
+
+	types := []Type{{"dump.Counter", &Counter{}}}
+	if _, err := New("merged.db", PERSIST_MANUAL, types, WithConflictResolver(nil)); err != ErrInvalidResolver {
+		t.Fatal("accepted a nil resolver")
+	}
+
+	shard, _ := New("shard.db", PERSIST_MANUAL, types)
+	shard.AddAll(&Counter{"a", 1}, &Counter{"b", 2})
+	shard.Save()
+
+	key := WithKey("key", func(item Item) string { return item.(*Counter).Key })
+	ours, _ := New("merged.db", PERSIST_MANUAL, types, key, WithConflictResolver(Ours))
+	ours.Add(&Counter{"a", 10})
+	if merged, err := ours.MergeFile("shard.db", nil); err != nil || merged != 2 {
+		t.Fatal("didn't merge", merged, err)
+	}
+	if item, _ := ours.Get(0); item.(*Counter).Count != 10 {
+		t.Fatal("didn't keep the existing item", item)
+	}
+
+	// items changed by both dumps are resolved instead of the latest winning
+	crdtTypes := []Type{{"dump.Plain", &Plain{}}}
+	edge, _ := New("edge.db", PERSIST_MANUAL, crdtTypes, WithCRDT("edge"), WithConflictResolver(Ours))
+	server, _ := New("server.db", PERSIST_MANUAL, crdtTypes, WithCRDT("server"))
+	edge.Add(&Plain{"a"})
+	server.Merge(edge)
+	server.Set(0, &Plain{"server"})
+	if err := edge.Merge(server); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := edge.Get(0); item.(*Plain).Name != "a" {
+		t.Fatal("didn't keep the existing item", item)
+	}
+
+	// a replica keeps items changed locally
+	replica, _ := New("replica.db", PERSIST_MANUAL, crdtTypes, WithConflictResolver(Ours),
+		WithFactory(func() Item { return &Plain{} }))
+	r := &Replica{d: replica}
+	r.apply(syncMessage{Op: "snapshot", Items: []syncItem{{ID: 1, Data: json.RawMessage(`{"name":"a"}`)}}})
+	r.apply(syncMessage{Op: "update", ID: 1, Data: json.RawMessage(`{"name":"b"}`)})
+	if item, _ := replica.Get(0); item.(*Plain).Name != "b" {
+		t.Fatal("didn't apply the update", item)
+	}
+	replica.Set(0, &Plain{"local"})
+	r.apply(syncMessage{Op: "update", ID: 1, Data: json.RawMessage(`{"name":"c"}`)})
+	if item, _ := replica.Get(0); item.(*Plain).Name != "local" {
+		t.Fatal("didn't keep the local change", item)
+	}
+}
@@ -0,0 +1,172 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"sync/atomic"
+)
+
+// Cloner is implemented by items that can make deep copies of themselves.
+// The dump copies items with Clone() when they implement it, which is usually
+// much faster than round-tripping them through encoding/gob. The copy must
+// share nothing that can be changed with the item.
+type Cloner interface {
+	Clone() Item
+}
+
+// WithCopyOnRead is an option that makes Get(), View(), GetByIndex() and
+// Page() hand out deep copies of the items instead of the items held by the
+// dump, so they can be used after the call returns (such as when rendering
+// them) without racing with the writes that change items in place. Items are
+// copied with Clone() if they implement Cloner, and with encoding/gob
+// otherwise.
+func WithCopyOnRead() Option {
+	return func(d *Dump) error {
+		d.copyReads = true
+		return nil
+	}
+}
+
+// copyItem returns a deep copy of item, made by Clone() if it implements
+// Cloner or by round-tripping it through gob, so the item's type has to be
+// registered.
+func copyItem(item Item) (Item, error) {
+	if c, ok := item.(Cloner); ok {
+		return c.Clone(), nil
+	}
+
+	buffer := getBuffer(0)
+	defer putBuffer(buffer)
+
+	if err := gob.NewEncoder(buffer).Encode(&item); err != nil {
+		return nil, encodeError(err, item)
+	}
+
+	var copied Item
+	if err := gob.NewDecoder(buffer).Decode(&copied); err != nil {
+		return nil, err
+	}
+
+	return copied, nil
+}
+
+// copyItems returns a deep copy of every item in items.
+func copyItems(items []Item) ([]Item, error) {
+	var (
+		c      = newCopier()
+		copied = make([]Item, len(items))
+		err    error
+	)
+
+	for i := range items {
+		if copied[i], err = c.copy(items[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return copied, nil
+}
+
+// copier makes deep copies of items one at a time, sharing a gob encoder and
+// decoder so each type is only sent once.
+type copier struct {
+	buffer  bytes.Buffer
+	encoder *gob.Encoder
+	decoder *gob.Decoder
+}
+
+func newCopier() *copier {
+	c := &copier{}
+	c.encoder = gob.NewEncoder(&c.buffer)
+	c.decoder = gob.NewDecoder(&c.buffer)
+	return c
+}
+
+// copy returns a deep copy of item, made by Clone() if it implements Cloner.
+func (c *copier) copy(item Item) (Item, error) {
+	if cloner, ok := item.(Cloner); ok {
+		return cloner.Clone(), nil
+	}
+
+	if err := c.encoder.Encode(&item); err != nil {
+		return nil, encodeError(err, item)
+	}
+
+	var copied Item
+	if err := c.decoder.Decode(&copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// sameItem reports whether copied, a deep copy of item, still holds what item
+// holds. gob doesn't copy unexported fields and turns empty slices and maps
+// into nil ones, so copies that aren't deeply equal to item are compared
+// after both went through gob.
+func sameItem(item, copied Item) bool {
+	if reflect.DeepEqual(item, copied) {
+		return true
+	}
+
+	c := newCopier()
+	a, err := c.copy(item)
+	if err != nil {
+		return false
+	}
+	b, err := c.copy(copied)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// reading returns items, or deep copies of them if WithCopyOnRead() is
+// enabled.
+func (d *Dump) reading(items []Item) ([]Item, error) {
+	if !d.copyReads {
+		return items, nil
+	}
+	return copyItems(items)
+}
+
+// Clone returns a new dump persisted to filename, holding deep copies of the
+// items (and collections) of the dump along with their metadata. The clone
+// has the types and persist mode of the dump, but only the options provided
+// to Clone(), and it's saved right away if PERSIST_WRITES is enabled. Changes
+// to either dump don't affect the other. It returns ErrInvalidFilename if
+// filename is the dump's own file.
+func (d *Dump) Clone(filename string, options ...Option) (*Dump, error) {
+	if d.parent != nil {
+		return d.parent.Clone(filename, options...)
+	}
+	if filename == d.filename {
+		return nil, ErrInvalidFilename
+	}
+
+	// the items are copied through an uncompressed dump file, which the
+	// clone can read whatever its options are
+	payload := getBuffer(int(atomic.LoadInt64(&d.fileSize)))
+	defer putBuffer(payload)
+
+	d.rlock()
+	_, err := d.encodePayload(payload, nil)
+	d.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	clone, err := New(filename, d.persist, d.types, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	data := clone.seal(header{version: formatVersion}, payload.Bytes())
+	if err := clone.Restore(bytes.NewReader(data)); err != nil {
+		// stops the clone without saving it
+		clone.closeOnce.Do(func() { close(clone.closed) })
+		return nil, err
+	}
+
+	return clone, nil
+}
@@ -0,0 +1,149 @@
+package dump
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCopyItem(t *testing.T) {
+	item, err := copyItem(&Blob{"copy"})
+	if err != nil || item.(*Blob).Data != "copy" {
+		t.Fatal("bad copy")
+	}
+
+	if _, err = copyItem(func() {}); err == nil {
+		t.Fatal("copied a func")
+	}
+
+	items, err := copyItems([]Item{&Blob{"one"}, &Blob{"two"}})
+	if err != nil || len(items) != 2 || items[1].(*Blob).Data != "two" {
+		t.Fatal("bad copies")
+	}
+}
+
+func TestClone(t *testing.T) {
+	test, err := New("original.db", PERSIST_WRITES,
+		[]Type{{"dump.Blob", &Blob{}}}, WithCompression(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Add(&Blob{"one"})
+	test.Add(&Blob{"two"})
+	test.UpdateAt(1, func(item Item) error {
+		item.(*Blob).Data = "TWO"
+		return nil
+	})
+
+	if _, err = test.Clone("original.db"); err != ErrInvalidFilename {
+		t.Fatal("cloned to the dump's own file")
+	}
+
+	clone, err := test.Clone("clone.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone.Len() != 2 {
+		t.Fatalf("cloned %d items", clone.Len())
+	}
+	if m, _ := clone.GetMeta(1); m.Version != 2 {
+		t.Fatal("didn't keep the metadata")
+	}
+
+	// the items are copies
+	clone.UpdateAt(0, func(item Item) error {
+		item.(*Blob).Data = "changed"
+		return nil
+	})
+	if item, _ := test.Get(0); item.(*Blob).Data != "one" {
+		t.Fatal("changed the original")
+	}
+
+	// the clone has its own file
+	saved, _ := New("clone.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}})
+	if err = saved.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := saved.Get(0); item.(*Blob).Data != "changed" {
+		t.Fatal("didn't save the clone")
+	}
+	original, _ := New("original.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithCompression(Gzip))
+	if err = original.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := original.Get(0); item.(*Blob).Data != "one" {
+		t.Fatal("saved the clone to the original file")
+	}
+}
+
+// Sheep counts its clones.
+type Sheep struct {
+	Name   string
+	clones *int
+}
+
+func (s *Sheep) Clone() Item {
+	*s.clones++
+	return &Sheep{Name: s.Name, clones: s.clones}
+}
+
+func TestCopyOnRead(t *testing.T) {
+	test, err := New("copies.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithCopyOnRead())
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Add(&Blob{"one"})
+
+	item, err := test.Get(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.(*Blob).Data = "changed"
+
+	test.View(func(items []Item) error {
+		if items[0].(*Blob).Data != "one" {
+			t.Fatal("Get() returned the item of the dump")
+		}
+		items[0].(*Blob).Data = "changed"
+		return nil
+	})
+
+	items, _, err := test.Page("", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items[0].(*Blob).Data != "one" {
+		t.Fatal("View() gave the items of the dump")
+	}
+
+	// items implementing Cloner copy themselves
+	var clones int
+	sheep, _ := New("sheep.db", PERSIST_MANUAL,
+		[]Type{{"dump.Sheep", &Sheep{}}}, WithCopyOnRead())
+	sheep.Add(&Sheep{Name: "dolly", clones: &clones})
+
+	if item, _ := sheep.Get(0); item.(*Sheep).Name != "dolly" || clones != 1 {
+		t.Fatal("didn't clone the item")
+	}
+	sheep.View(func(items []Item) error { return nil })
+	if clones != 2 {
+		t.Fatal("didn't clone the items")
+	}
+}
+
+func TestMapCopies(t *testing.T) {
+	var clones int
+	sheep, _ := New("sheep.db", PERSIST_MANUAL, []Type{{"dump.Sheep", &Sheep{}}})
+	sheep.AddAll(&Sheep{Name: "dolly", clones: &clones}, &Sheep{Name: "polly", clones: &clones})
+
+	// the items after the one failing aren't copied
+	errStop := errors.New("stop")
+	if err := sheep.Map(func(item Item) error { return errStop }); err != errStop || clones != 1 {
+		t.Fatal("copied every item", err, clones)
+	}
+
+	if err := sheep.Map(func(item Item) error { return nil }); err != nil || clones != 3 {
+		t.Fatal("bad copies", err, clones)
+	}
+}
@@ -0,0 +1,129 @@
+package dump
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS configures the cross-origin requests allowed by Handler() (see
+// HandlerOptions.CORS), so browser applications served from other origins
+// can use the API.
+type CORS struct {
+	// AllowedOrigins are the origins allowed to make requests, such as
+	// "https://app.example.com". "*" allows every origin.
+	AllowedOrigins []string
+
+	// AllowedMethods are the methods allowed in cross-origin requests (GET,
+	// HEAD, POST, PUT and DELETE by default).
+	AllowedMethods []string
+
+	// AllowedHeaders are the request headers allowed in cross-origin
+	// requests (Content-Type, Authorization and If-None-Match by default).
+	AllowedHeaders []string
+
+	// ExposedHeaders are the response headers exposed to the browser
+	// application (ETag and X-Total-Count by default).
+	ExposedHeaders []string
+
+	// AllowCredentials lets requests from the allowed origins carry cookies
+	// and HTTP authentication. It is ignored if "*" is one of the allowed
+	// origins, since every site could then make requests as the user.
+	AllowCredentials bool
+
+	// MaxAge is how long browsers can cache the answer to a preflight
+	// request (not sent if it isn't positive).
+	MaxAge time.Duration
+}
+
+// cors is the CORS configuration of a handler, with its lists joined.
+type cors struct {
+	CORS
+
+	all     bool
+	origins map[string]bool
+	methods string
+	headers string
+	exposed string
+}
+
+func newCORS(c CORS) *cors {
+	if c.AllowedMethods == nil {
+		c.AllowedMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE"}
+	}
+	if c.AllowedHeaders == nil {
+		c.AllowedHeaders = []string{"Content-Type", "Authorization", "If-None-Match"}
+	}
+	if c.ExposedHeaders == nil {
+		c.ExposedHeaders = []string{"ETag", "X-Total-Count"}
+	}
+
+	s := &cors{
+		CORS:    c,
+		origins: make(map[string]bool, len(c.AllowedOrigins)),
+		methods: strings.Join(c.AllowedMethods, ", "),
+		headers: strings.Join(c.AllowedHeaders, ", "),
+		exposed: strings.Join(c.ExposedHeaders, ", "),
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			s.all = true
+		}
+		s.origins[strings.ToLower(origin)] = true
+	}
+
+	// browsers refuse credentials with "*", and echoing every origin instead
+	// would let any site use them
+	if s.all {
+		s.AllowCredentials = false
+	}
+	return s
+}
+
+// handle sets the CORS headers of the response to a request from an allowed
+// origin. It reports whether the request was a preflight request, which it
+// responds to.
+func (c *cors) handle(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+
+	header := w.Header()
+	if !c.all {
+		header.Add("Vary", "Origin")
+	}
+
+	allowed := origin != "" && (c.all || c.origins[strings.ToLower(origin)])
+	if allowed {
+		if c.all {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+
+	if !preflight {
+		if allowed && c.exposed != "" {
+			header.Set("Access-Control-Expose-Headers", c.exposed)
+		}
+		return false
+	}
+
+	// preflight requests don't carry credentials, so they aren't authorized
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	if allowed {
+		header.Set("Access-Control-Allow-Methods", c.methods)
+		if c.headers != "" {
+			header.Set("Access-Control-Allow-Headers", c.headers)
+		}
+		if c.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge/time.Second)))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
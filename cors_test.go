@@ -0,0 +1,71 @@
+package dump
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerCORS(t *testing.T) {
+	types := []Type{{"dump.Plain", &Plain{}}}
+	test, _ := New("test.db", PERSIST_MANUAL, types)
+	test.Add(&Plain{"a"})
+
+	request := func(h http.Handler, method, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/", nil)
+		r.Header.Set("Origin", origin)
+		if method == "OPTIONS" {
+			r.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	h := Handler(test, HandlerOptions{
+		CORS: &CORS{AllowedOrigins: []string{"https://app.example.com"}, MaxAge: time.Hour},
+		Auth: func(r *http.Request, op Operation) error { return ErrUnauthorized },
+	})
+
+	// preflight requests are answered before being authorized
+	w := request(h, "OPTIONS", "https://app.example.com")
+	if w.Code != http.StatusNoContent ||
+		w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "GET, HEAD, POST, PUT, DELETE" ||
+		w.Header().Get("Access-Control-Max-Age") != "3600" {
+		t.Fatal("bad preflight response", w.Code, w.Header())
+	}
+	if w := request(h, "OPTIONS", "https://evil.example.com"); w.Header().Get("Access-Control-Allow-Origin") != "" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Fatal("allowed another origin", w.Header())
+	}
+
+	w = request(h, "GET", "https://app.example.com")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Vary") != "Origin" {
+		t.Fatal("bad response", w.Code, w.Header())
+	}
+
+	open := Handler(test, HandlerOptions{CORS: &CORS{AllowedOrigins: []string{"*"}}})
+	w = request(open, "GET", "https://any.example.com")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "*" ||
+		w.Header().Get("Access-Control-Expose-Headers") != "ETag, X-Total-Count" {
+		t.Fatal("bad response", w.Code, w.Header())
+	}
+
+	credentials := Handler(test, HandlerOptions{CORS: &CORS{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true}})
+	w = request(credentials, "GET", "https://app.example.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatal("bad response", w.Header())
+	}
+
+	// every origin can't make requests with credentials
+	wildcard := Handler(test, HandlerOptions{CORS: &CORS{AllowedOrigins: []string{"*"}, AllowCredentials: true}})
+	w = request(wildcard, "GET", "https://evil.example.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatal("allowed credentials from every origin", w.Header())
+	}
+}
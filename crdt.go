@@ -0,0 +1,292 @@
+package dump
+
+import (
+	"reflect"
+	"sort"
+	"time"
+)
+
+// WithCRDT is an option that lets dumps modified independently (such as the
+// copies of a dump on an edge device and on a server) be merged with Merge().
+// Every item remembers the replica that added it and the Lamport timestamp
+// of its last change (see Meta.Clock and WithHybridClock()), and removed
+// items leave a tombstone behind so merging doesn't bring them back. replica
+// identifies the dump among the dumps being merged and must be unique to it.
+//
+// Tombstones are kept forever, and the option can't be combined with
+// WithRecordStore() (New() returns ErrInvalidCRDT).
+func WithCRDT(replica string) Option {
+	return func(d *Dump) error {
+		if replica == "" {
+			return ErrInvalidCRDT
+		}
+
+		d.crdt = &crdt{replica: replica, tombstones: make(map[crdtKey]bool)}
+		return nil
+	}
+}
+
+// WithHybridClock is an option that makes the timestamps of a dump created
+// with WithCRDT() hybrid logical clocks: the wall clock in Unix nanoseconds,
+// moved past every timestamp seen on other replicas like a Lamport clock.
+// The latest change then wins by wall clock time (give or take the skew
+// between the clocks of the machines), rather than the replica having made
+// the most changes, while timestamps still never go backwards. New()
+// returns ErrInvalidCRDT if WithCRDT() isn't enabled.
+func WithHybridClock() Option {
+	return func(d *Dump) error {
+		d.hybridClock = true
+		return nil
+	}
+}
+
+// crdt holds the state of a dump created with WithCRDT().
+type crdt struct {
+	replica    string
+	clock      uint64
+	hybrid     bool
+	tombstones map[crdtKey]bool
+}
+
+// crdtKey identifies an item across merged dumps.
+type crdtKey struct {
+	Origin  string
+	Created uint64
+}
+
+func keyOf(m meta) crdtKey {
+	return crdtKey{Origin: m.Origin, Created: m.Created}
+}
+
+// tick advances the Lamport clock of the replica, or its hybrid logical
+// clock (see WithHybridClock()).
+func (c *crdt) tick() uint64 {
+	if now := uint64(time.Now().UnixNano()); c.hybrid && now > c.clock {
+		c.clock = now
+	} else {
+		c.clock++
+	}
+	return c.clock
+}
+
+// bury records tombstones for the removed items.
+func (c *crdt) bury(metas []meta) {
+	for _, m := range metas {
+		c.tombstones[keyOf(m)] = true
+	}
+}
+
+// graveyard returns the tombstones so they can be persisted.
+func (c *crdt) graveyard() []crdtKey {
+	keys := make([]crdtKey, 0, len(c.tombstones))
+	for key := range c.tombstones {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// restore restores the clock and tombstones persisted with the items. Items
+// persisted without WithCRDT() are considered added by this replica.
+func (c *crdt) restore(clock uint64, tombstones []crdtKey, metas []meta) {
+	c.clock = clock
+	for _, m := range metas {
+		c.witness(m.Modified)
+	}
+
+	for i := range metas {
+		if metas[i].Origin == "" {
+			metas[i].Origin, metas[i].Created = c.replica, c.tick()
+			metas[i].Writer, metas[i].Modified = metas[i].Origin, metas[i].Created
+		}
+	}
+
+	c.tombstones = make(map[crdtKey]bool, len(tombstones))
+	for _, key := range tombstones {
+		c.tombstones[key] = true
+	}
+}
+
+// witness moves the clock past a timestamp seen on another replica.
+func (c *crdt) witness(clock uint64) {
+	if clock > c.clock {
+		c.clock = clock
+	}
+}
+
+// newer reports whether the change described by a wins over the one
+// described by b: the later one wins, with ties broken by replica.
+func newer(a, b meta) bool {
+	if a.Modified != b.Modified {
+		return a.Modified > b.Modified
+	}
+	return a.Writer > b.Writer
+}
+
+// Merge merges the items of other into the dump. Both dumps have to be
+// created with WithCRDT() and can't be collections of the same dump (it
+// returns ErrNoCRDT otherwise). Items added to
+// either dump are kept, the latest change to an item wins over the others
+// (unless the dump has a ConflictResolver, see WithConflictResolver()), and
+// items removed from either dump are removed, even if they were changed
+// concurrently. Merging is deterministic: two dumps merged with each other
+// end up with the same items, in the same order.
+//
+// The items are ordered by when they were added, so merging changes the ids
+// of items. Hooks aren't called for the merged changes, and the change feed
+// (see WithChanges()) reports a reset. If the merge violates a unique index
+// the dump is left unchanged and ErrDuplicate is returned. It also returns an
+// error if there was a problem persisting the dump on the disk (if
+// PERSIST_WRITES is enabled).
+func (d *Dump) Merge(other *Dump) error {
+	if other == nil || d.mutex == other.mutex || d.crdt == nil || other.crdt == nil {
+		return ErrNoCRDT
+	}
+
+	// a consistent locking order prevents deadlocks between two dumps merging
+	// each other
+	if reflect.ValueOf(d).Pointer() < reflect.ValueOf(other).Pointer() {
+		d.mutex.Lock()
+		other.mutex.RLock()
+	} else {
+		other.mutex.RLock()
+		d.mutex.Lock()
+	}
+	defer d.mutex.Unlock()
+	defer other.mutex.RUnlock()
+
+	if d.isClosed() {
+		return ErrClosed
+	}
+
+	copied, err := copyItems(other.items)
+	if err != nil {
+		return err
+	}
+
+	var (
+		items      = append([]Item{}, d.items...)
+		metas      = append([]meta{}, d.meta...)
+		nextID     = d.nextID
+		unordered  = d.unordered
+		clock      = d.crdt.clock
+		tombstones = make(map[crdtKey]bool, len(d.crdt.tombstones))
+	)
+	for key := range d.crdt.tombstones {
+		tombstones[key] = true
+	}
+
+	d.crdt.witness(other.crdt.clock)
+	for key := range other.crdt.tombstones {
+		d.crdt.tombstones[key] = true
+	}
+
+	positions := make(map[crdtKey]int, len(d.items))
+	for id, m := range d.meta {
+		positions[keyOf(m)] = id
+	}
+
+	for i, item := range copied {
+		m := other.meta[i]
+
+		id, ok := positions[keyOf(m)]
+		if !ok {
+			d.items = append(d.items, item)
+			d.meta = append(d.meta, meta{
+				ID:       d.nextID,
+				Version:  1,
+				Origin:   m.Origin,
+				Created:  m.Created,
+				Modified: m.Modified,
+				Writer:   m.Writer,
+			})
+			d.nextID++
+			continue
+		}
+
+		if d.resolver != nil && (m.Modified != d.meta[id].Modified || m.Writer != d.meta[id].Writer) {
+			resolved, rerr := d.resolver.Resolve(Conflict{
+				Existing:     d.items[id],
+				Incoming:     item,
+				ExistingMeta: d.meta[id].public(),
+				IncomingMeta: m.public(),
+			})
+			if rerr != nil {
+				d.items, d.meta, d.nextID, d.unordered = items, metas, nextID, unordered
+				d.crdt.clock, d.crdt.tombstones = clock, tombstones
+				return rerr
+			}
+
+			d.items[id] = resolved
+			d.meta[id].Version++
+			if newer(m, d.meta[id]) {
+				d.meta[id].Modified, d.meta[id].Writer = m.Modified, m.Writer
+			}
+			continue
+		}
+
+		if newer(m, d.meta[id]) {
+			d.items[id] = item
+			d.meta[id].Version++
+			d.meta[id].Modified, d.meta[id].Writer = m.Modified, m.Writer
+		}
+	}
+
+	kept := 0
+	for id := range d.items {
+		if d.crdt.tombstones[keyOf(d.meta[id])] {
+			continue
+		}
+		d.items[kept], d.meta[kept] = d.items[id], d.meta[id]
+		kept++
+	}
+	d.items, d.meta = d.items[:kept], d.meta[:kept]
+
+	sort.Sort(byCreation{d})
+
+	d.unordered = false
+	for i := 1; i < len(d.meta); i++ {
+		if d.meta[i].ID <= d.meta[i-1].ID {
+			d.unordered = true
+			break
+		}
+	}
+
+	d.changed()
+
+	if err = d.checkIndexes(); err != nil {
+		d.items, d.meta, d.nextID, d.unordered = items, metas, nextID, unordered
+		d.crdt.clock, d.crdt.tombstones = clock, tombstones
+		d.changed()
+		return err
+	}
+
+	d.afterReset()
+
+	if d.autosave() {
+		return d.save()
+	}
+
+	return nil
+}
+
+// byCreation sorts the items of a dump by when they were added.
+type byCreation struct {
+	d *Dump
+}
+
+func (b byCreation) Len() int {
+	return len(b.d.items)
+}
+
+func (b byCreation) Less(i, j int) bool {
+	x, y := b.d.meta[i], b.d.meta[j]
+	if x.Created != y.Created {
+		return x.Created < y.Created
+	}
+	return x.Origin < y.Origin
+}
+
+func (b byCreation) Swap(i, j int) {
+	b.d.items[i], b.d.items[j] = b.d.items[j], b.d.items[i]
+	b.d.meta[i], b.d.meta[j] = b.d.meta[j], b.d.meta[i]
+}
@@ -0,0 +1,116 @@
+package dump
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	defer os.Remove("edge.db")
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	if _, err := New("edge.db", PERSIST_MANUAL, types, WithCRDT("")); err != ErrInvalidCRDT {
+		t.Fatal("accepted empty replica")
+	}
+
+	edge, _ := New("edge.db", PERSIST_MANUAL, types, WithCRDT("edge"))
+	server, _ := New("server.db", PERSIST_MANUAL, types, WithCRDT("server"))
+	plain, _ := New("plain.db", PERSIST_MANUAL, types)
+
+	if edge.Merge(plain) != ErrNoCRDT || edge.Merge(edge) != ErrNoCRDT {
+		t.Fatal("expected ErrNoCRDT")
+	}
+
+	names := func(d *Dump) (names []string) {
+		d.View(func(items []Item) error {
+			for _, item := range items {
+				names = append(names, item.(*Plain).Name)
+			}
+			return nil
+		})
+		return
+	}
+
+	edge.AddAll(&Plain{"x"}, &Plain{"y"})
+	if err := server.Merge(edge); err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent changes on both sides
+	edge.Set(0, &Plain{"x from edge"})
+	edge.Set(1, &Plain{"y from edge"})
+	edge.Add(&Plain{"z"})
+
+	server.Set(0, &Plain{"x from server"})
+	server.Remove(1)
+	server.Add(&Plain{"w"})
+
+	edge.Merge(server)
+	server.Merge(edge)
+
+	expected := "x from server|w|z"
+	for _, d := range []*Dump{edge, server} {
+		got := names(d)
+		if len(got) != 3 || got[0]+"|"+got[1]+"|"+got[2] != expected {
+			t.Fatal("didn't converge", got)
+		}
+	}
+
+	// tombstones survive restarts
+	edge.Save()
+	reloaded, _ := New("edge.db", PERSIST_MANUAL, types, WithCRDT("edge"))
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	stale, _ := New("stale.db", PERSIST_MANUAL, types, WithCRDT("server"))
+	stale.Merge(edge)
+	reloaded.Remove(0)
+	reloaded.Merge(stale)
+
+	if got := names(reloaded); len(got) != 2 || got[0] != "w" {
+		t.Fatal("removed item came back", got)
+	}
+}
+
+func TestHybridClock(t *testing.T) {
+	defer os.Remove("edge.db")
+	defer os.Remove("server.db")
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+	if _, err := New("edge.db", PERSIST_MANUAL, types, WithHybridClock()); err != ErrInvalidCRDT {
+		t.Fatal("accepted a hybrid clock without WithCRDT()")
+	}
+
+	before := uint64(time.Now().UnixNano())
+	edge, _ := New("edge.db", PERSIST_MANUAL, types, WithCRDT("edge"), WithHybridClock())
+	server, _ := New("server.db", PERSIST_MANUAL, types, WithCRDT("server"), WithHybridClock())
+	edge.Add(&Plain{"a"})
+
+	m, _ := edge.GetMeta(0)
+	if m.Clock < before || m.Writer != "edge" {
+		t.Fatal("not a hybrid timestamp", m)
+	}
+
+	// the change made last by wall clock wins, however many changes the
+	// other replica made
+	server.Merge(edge)
+	for i := 0; i < 3; i++ {
+		server.Set(0, &Plain{"server"})
+	}
+	time.Sleep(time.Millisecond)
+	edge.Set(0, &Plain{"edge"})
+	server.Merge(edge)
+	if item, _ := server.Get(0); item.(*Plain).Name != "edge" {
+		t.Fatal("the last change didn't win", item)
+	}
+
+	// the clock never goes backwards, even ahead of the wall clock
+	m, _ = edge.GetMeta(0)
+	edge.crdt.clock += uint64(time.Hour)
+	edge.Set(0, &Plain{"b"})
+	if updated, _ := edge.GetMeta(0); updated.Clock != edge.crdt.clock || !updated.After(m) || m.After(updated) {
+		t.Fatal("clock went backwards", updated, m)
+	}
+}
@@ -3,11 +3,17 @@
 package dump
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
-	"io/ioutil"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,6 +31,23 @@ const (
 	PERSIST_INTERVAL
 )
 
+// persistBatch marks the disk-persistence settings returned by
+// PERSIST_BATCH(), which hold the number of changes in the other bits.
+const persistBatch = 1 << 30
+
+// PERSIST_BATCH returns a disk-persistence setting that saves the dump after
+// every nth change (where PERSIST_WRITES saves it after every change), and
+// when Close() or Flush() is called. A method changing several items (such
+// as AddAll() or UpdateWhere()) is a single change. Methods document
+// PERSIST_WRITES as the setting making them save; they count as a change
+// with it. New() returns ErrInvalidPersist if n is less than 1.
+func PERSIST_BATCH(n int) int {
+	if n < 1 || n >= persistBatch {
+		return -1
+	}
+	return persistBatch | n
+}
+
 var (
 	// ErrInvalidPersist is thrown when an invalid disk-persistence setting is
 	// provided when calling NewDump().
@@ -38,14 +61,374 @@ var (
 	// ErrInvalidFilename is thrown when NewDump() is called with an empty
 	// filename - making persistence impossible.
 	ErrInvalidFilename = errors.New("invalid filename")
+
+	// ErrCorrupt is thrown by Load() when the dump file is truncated or its
+	// checksum doesn't match the contents.
+	ErrCorrupt = errors.New("dump file is corrupt")
+
+	// ErrUnsupportedFormat is thrown by Load() when the dump file was written
+	// with a newer (or unknown) version of the file format.
+	ErrUnsupportedFormat = errors.New("unsupported dump file format")
+
+	// ErrCompressed is thrown by Load() when the dump file is compressed but
+	// the dump wasn't created with WithCompression().
+	ErrCompressed = errors.New("dump file is compressed")
+
+	// ErrInvalidBackups is thrown when a negative number of backups is passed
+	// to WithBackups(), or WithScheduledBackups() is passed an interval that
+	// isn't positive or a negative number of copies.
+	ErrInvalidBackups = errors.New("invalid number of backups")
+
+	// ErrInvalidSchema is thrown when a negative schema version or a nil
+	// migration is passed to WithSchema() or WithMigration().
+	ErrInvalidSchema = errors.New("invalid schema version")
+
+	// ErrInvalidTypeMigration is thrown by WithTypeMigration() when passed a
+	// nil value or function, an old type whose name or Go type is registered
+	// with New(), or an old type that already has a migration.
+	ErrInvalidTypeMigration = errors.New("invalid type migration")
+
+	// ErrSchemaTooNew is thrown by Load() when the dump file was written with
+	// a newer schema version than the one set with WithSchema().
+	ErrSchemaTooNew = errors.New("dump file has a newer schema version")
+
+	// ErrInvalidStorage is thrown when a nil Storage is passed to
+	// WithStorage().
+	ErrInvalidStorage = errors.New("invalid storage")
+
+	// ErrInvalidMapper is thrown by ExportSQL() when the Mapper has no
+	// columns or returns the wrong number of values for an item.
+	ErrInvalidMapper = errors.New("invalid mapper")
+
+	// ErrNoFactory is thrown by UnmarshalJSON() and Replicate() when the dump
+	// wasn't created with WithFactory().
+	ErrNoFactory = errors.New("no item factory was provided")
+
+	// ErrNotList is thrown by LoadJSON() when the JSON being loaded isn't a
+	// list (or an object with a list of items, see WithJSONEnvelope()).
+	ErrNotList = errors.New("json is not a list")
+
+	// ErrInvalidEnvelope is thrown by MarshalJSON() and WriteJSONTo() when
+	// the envelope returned by the function passed to WithJSONEnvelope()
+	// isn't a JSON object.
+	ErrInvalidEnvelope = errors.New("json envelope is not an object")
+
+	// ErrNotFound is thrown when there is no item with the provided id
+	// (including ids out of range).
+	ErrNotFound = errors.New("item not found")
+
+	// ErrClosed is thrown by the methods changing the items of a dump once
+	// it was closed with Close().
+	ErrClosed = errors.New("dump is closed")
+
+	// ErrUnknownType is matched by the *UnknownTypeError thrown by Load()
+	// when the dump file holds items of types that weren't registered.
+	ErrUnknownType = errors.New("unknown type in dump file")
+
+	// ErrNotRegistered matches (with errors.Is()) the errors saving or loading
+	// a dump with an item whose type wasn't registered with it.
+	ErrNotRegistered = errors.New("type not registered")
+
+	// ErrInvalidIndex is thrown by WithIndex() when the index has no name or
+	// key function, or an index with the same name already exists.
+	ErrInvalidIndex = errors.New("invalid index")
+
+	// ErrNoIndex is thrown when looking up items in an index that doesn't
+	// exist.
+	ErrNoIndex = errors.New("no index with that name")
+
+	// ErrDuplicate is thrown when a write would give two items the same key
+	// in a unique index.
+	ErrDuplicate = errors.New("duplicate key in unique index")
+
+	// ErrInvalidResolver is thrown by WithConflictResolver() when passed a
+	// nil resolver.
+	ErrInvalidResolver = errors.New("invalid conflict resolver")
+
+	// ErrInvalidCursor is thrown by Page() when the cursor is malformed.
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrInvalidLimit is thrown by Page() when the limit isn't positive.
+	ErrInvalidLimit = errors.New("invalid limit")
+
+	// ErrNoKey is thrown by Upsert() when the dump wasn't created with
+	// WithKey().
+	ErrNoKey = errors.New("no key was provided")
+
+	// ErrInvalidKey is thrown by Upsert() when the key doesn't match the key
+	// of the item.
+	ErrInvalidKey = errors.New("key doesn't match item")
+
+	// ErrConflict is thrown by CompareAndUpdate() when the item was changed
+	// since the expected version was read.
+	ErrConflict = errors.New("item version conflict")
+
+	// ErrInvalidTxn is thrown by NewTxn() when no dumps, a nil dump, the same
+	// dump twice, or a dump with a record store is provided.
+	ErrInvalidTxn = errors.New("invalid transaction")
+
+	// ErrInvalidFeed is thrown when a negative number of changes is passed to
+	// WithChanges().
+	ErrInvalidFeed = errors.New("invalid number of changes")
+
+	// ErrNoFeed is thrown by Changes() when the dump wasn't created with
+	// WithChanges().
+	ErrNoFeed = errors.New("changes aren't tracked")
+
+	// ErrUnauthorized can be returned by HandlerOptions.Auth to refuse a
+	// request with 401 Unauthorized.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrInvalidCommand is thrown by Apply() when the kind of the command is
+	// unknown.
+	ErrInvalidCommand = errors.New("invalid command")
+
+	// ErrInvalidCRDT is thrown when WithCRDT() is passed an empty replica id
+	// or combined with WithRecordStore(), or when WithHybridClock() is used
+	// without it.
+	ErrInvalidCRDT = errors.New("invalid crdt replica")
+
+	// ErrNoCRDT is thrown by Merge() when either dump wasn't created with
+	// WithCRDT(), or a dump is merged with itself (or with another collection
+	// of the same dump), and by Gossip() when the dump wasn't.
+	ErrNoCRDT = errors.New("dumps can't be merged")
+
+	// ErrInvalidCollection is thrown by Collection() and WithCollection()
+	// when the name of the collection is empty, or the dump or collection
+	// uses a RecordStore.
+	ErrInvalidCollection = errors.New("invalid collection")
+
+	// ErrShutdown is thrown by Manager.Get() after the manager was shut down.
+	ErrShutdown = errors.New("manager was shut down")
+
+	// ErrInvalidTTL is thrown when a negative duration is passed to WithTTL().
+	ErrInvalidTTL = errors.New("invalid ttl")
+
+	// ErrInvalidRetention is thrown when WithMaxItems() or WithMaxAge() is
+	// passed a limit that isn't positive, or WithMaxAge() is combined with
+	// WithTTL().
+	ErrInvalidRetention = errors.New("invalid retention limit")
+
+	// ErrNoTTL is thrown by ExpireAt() when the dump wasn't created with
+	// WithTTL().
+	ErrNoTTL = errors.New("items don't expire")
+
+	// ErrPublished is thrown by Publish() when a variable with the same name
+	// was already published.
+	ErrPublished = errors.New("name is already published")
+
+	// ErrInvalidCommandLog is thrown when WithCommandLog() is passed a nil log
+	// or combined with WithRecordStore() or WithCollection(), and by
+	// Snapshot() and Replay() when the dump wasn't created with
+	// WithCommandLog().
+	ErrInvalidCommandLog = errors.New("invalid command log")
+
+	// ErrSnapshotted is thrown by Replay() when the commands to replay up to
+	// were replaced by a snapshot.
+	ErrSnapshotted = errors.New("commands were snapshotted")
+
+	// ErrNoHistory is thrown by GetRevision() and ViewAt() when the dump
+	// wasn't created with WithRevisions().
+	ErrNoHistory = errors.New("revisions aren't kept")
+
+	// ErrNoRevision is thrown by GetRevision() and ViewAt() when the revision
+	// of an item they need was dropped or pruned.
+	ErrNoRevision = errors.New("revision isn't kept")
+
+	// ErrInvalidShards is thrown by NewSharded() when the number of shards
+	// isn't positive.
+	ErrInvalidShards = errors.New("invalid number of shards")
+
+	// ErrInvalidSegments is thrown when WithSegments() is passed a number of
+	// segments that isn't positive, or combined with WithRecordStore() or
+	// WithBackups().
+	ErrInvalidSegments = errors.New("invalid number of segments")
+
+	// ErrInvalidReload is thrown when WithReload() is passed an interval
+	// that isn't positive.
+	ErrInvalidReload = errors.New("invalid reload interval")
+
+	// ErrInvalidValidator is thrown when WithValidator() is passed a nil
+	// value or validator.
+	ErrInvalidValidator = errors.New("invalid validator")
+
+	// ErrInvalidTag is thrown when WithTagValidation() can't parse the
+	// validate tag of a field.
+	ErrInvalidTag = errors.New("invalid validate tag")
+
+	// ErrInvalidReference is thrown when WithReference() is passed a
+	// reference without a Get function, a valid OnDelete action, or the Clear
+	// function SetNull needs.
+	ErrInvalidReference = errors.New("invalid reference")
+
+	// ErrDangling is thrown when an item references an item that doesn't
+	// exist (see WithReference()).
+	ErrDangling = errors.New("item references a missing item")
+
+	// ErrNoOrder is thrown by PopMin() and PopMax() when the dump wasn't
+	// created with WithOrder(), and by WithOrder() when passed a nil
+	// function.
+	ErrNoOrder = errors.New("items aren't ordered")
+
+	// ErrInvalidTimeSeries is thrown when WithTimeSeries() is passed a nil
+	// timestamp function, a window that isn't positive or a negative
+	// retention, or combined with WithSegments(), WithRecordStore() or
+	// WithBackups().
+	ErrInvalidTimeSeries = errors.New("invalid time series")
+
+	// ErrNoTimeSeries is thrown by Range() when the dump wasn't created with
+	// WithTimeSeries().
+	ErrNoTimeSeries = errors.New("dump isn't a time series")
+
+	// ErrInvalidProtobuf is thrown when WithProtobuf() is passed a nil
+	// function, or combined with WithSegments(), WithRecordStore() or
+	// WithTimeSeries().
+	ErrInvalidProtobuf = errors.New("invalid protobuf codec")
+
+	// ErrProtobuf is thrown by Load() when the dump file is protobuf encoded
+	// but the dump wasn't created with WithProtobuf().
+	ErrProtobuf = errors.New("dump file is protobuf encoded")
+
+	// ErrInvalidSigning is thrown when WithSigning() is passed an empty key,
+	// or combined with WithRecordStore() or WithCommandLog().
+	ErrInvalidSigning = errors.New("invalid signing key")
+
+	// ErrBadSignature is thrown by Load() and Restore() when the dump was
+	// created with WithSigning() and the dump file isn't signed, or its
+	// signature doesn't verify with the key.
+	ErrBadSignature = errors.New("bad dump file signature")
+
+	// ErrInvalidEmergencyFile is thrown when WithEmergencyFile() is passed an
+	// empty filename or the filename of the dump, or combined with
+	// WithRecordStore() or WithCommandLog().
+	ErrInvalidEmergencyFile = errors.New("invalid emergency file")
+
+	// ErrInvalidPolicy is thrown by WithPersistence() when AfterWrites() is
+	// passed a number of changes less than 1, or AfterQuiet() or Every() a
+	// duration that isn't positive.
+	ErrInvalidPolicy = errors.New("invalid persistence policy")
+
+	// ErrInvalidItemCodec is thrown by WithItemCodec() when passed nil, a
+	// type that wasn't registered with New() or that already has an item
+	// codec, or when combined with WithProtobuf().
+	ErrInvalidItemCodec = errors.New("invalid item codec")
+
+	// ErrInvalidRedaction is thrown by WithRedaction() when it can't parse
+	// the redact tag of a field, and by WithMask() when passed a nil value
+	// or mask.
+	ErrInvalidRedaction = errors.New("invalid redaction")
+
+	// ErrInvalidWebhook is thrown by WithWebhook() when the URL of the webhook
+	// isn't an absolute URL.
+	ErrInvalidWebhook = errors.New("invalid webhook")
 )
 
+// EncodeError is returned when saving a dump (or recording a change to it)
+// fails because one of its items can't be gob encoded, usually because the
+// type of the item wasn't registered with the dump.
+type EncodeError struct {
+	// Type is the Go type of the item, such as "*main.User".
+	Type string
+
+	// Err is the error returned by gob (or by the marshal function passed to
+	// WithProtobuf()).
+	Err error
+}
+
+func (e *EncodeError) Error() string {
+	return "can't encode item of type " + e.Type + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error returned by gob.
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the type of the item wasn't registered, so the error
+// matches ErrNotRegistered.
+func (e *EncodeError) Is(target error) bool {
+	return target == ErrNotRegistered && notRegistered(e.Err)
+}
+
 // Dump represents a collection of items that persist on disk.
 type Dump struct {
-	filename string
-	items    []Item
-	persist  int
-	mutex    sync.RWMutex
+	// sizes of the last encoded file and JSON list, and the number of
+	// changes since the last save with PERSIST_BATCH(), accessed atomically
+	// (and first for the alignment of 64-bit atomics)
+	fileSize int64
+	jsonSize int64
+	unsaved  int64
+
+	filename    string
+	types       []Type
+	storage     Storage
+	items       []Item
+	persist     int
+	compression Compression
+	backups     int
+	fallback    bool
+	loadedFrom  string
+	schema      int
+	migrations  map[int]Migration
+	conversions map[reflect.Type]func(Item) (Item, error)
+	records     RecordStore
+	committed   map[uint64][]byte
+	stale       map[uint64]bool
+	allStale    bool
+	clean       int
+	recordMutex sync.Mutex
+	factory     func() Item
+	stats       Stats
+	statsMutex  sync.Mutex
+	indexes     map[string]*index
+	hooks       []Hooks
+	feed        *feed
+	crdt        *crdt
+	hybridClock bool
+	ttl         *expiry
+	maxItems    int
+	maxAge      time.Duration
+	lru         *lru
+	tracer      Tracer
+	progress    func(p Progress)
+	jsonMeta    bool
+	envelope    func(count int) interface{}
+	events      *events
+	history     *history
+	frozen      int32
+	skipUnknown bool
+	reload      *reloader
+	schedule    *schedule
+	copyReads   bool
+	validators  map[reflect.Type][]func(Item) error
+	references  []Reference
+	order       func(a, b Item) bool
+	resolver    ConflictResolver
+	series      *series
+	protobuf    *protobuf
+	codecs      map[reflect.Type]*itemCodec
+	redaction   *redaction
+	webhooks    []*webhook
+	signing     []byte
+	emergency   *emergency
+	policy      *policy
+	segments    int
+	slot        int
+	slotMutex   sync.Mutex
+	fileMutex   sync.Mutex
+	instance    string
+	generation  uint64
+	key         string
+	meta        []meta
+	nextID      uint64
+	unordered   bool
+	parent      *Dump
+	collections map[string]*Dump
+	closed      chan struct{}
+	closeOnce   sync.Once
+
+	// mutex is shared with the collections of the dump
+	mutex *sync.RWMutex
 }
 
 // Type is used to register types from outside packages so that they are
@@ -63,12 +446,24 @@ type Type struct {
 
 // NewDump is the primary constructor function for creating dumps. The
 // provided filename is where the dump will persist to disk (and read from
-// disk). The persist int is one of the dump.PERSIST_ constants. The provided
-// types register the types that will be held in the dump.
+// disk). The persist int is one of the dump.PERSIST_ constants (or
+// PERSIST_BATCH(n)). The provided types register the types that will be held
+// in the dump.
 //
 // NewDump will return an error if the persist parameter is not a valid
 // dump.PERSIST_ constant.
 func NewDump(filename string, persist int, types ...Type) (*Dump, error) {
+	return New(filename, persist, types)
+}
+
+// Option configures optional behavior of a dump. Options are passed to New()
+// and applied in order before the dump is returned.
+type Option func(*Dump) error
+
+// New works exactly like NewDump() but also accepts a list of options (such
+// as WithCompression()) that configure the dump. It returns an error if any
+// of the options return an error.
+func New(filename string, persist int, types []Type, options ...Option) (*Dump, error) {
 	if len(filename) == 0 {
 		return nil, ErrInvalidFilename
 	}
@@ -83,33 +478,111 @@ func NewDump(filename string, persist int, types ...Type) (*Dump, error) {
 
 	if persist != PERSIST_MANUAL &&
 		persist != PERSIST_WRITES &&
-		persist != PERSIST_INTERVAL {
+		persist != PERSIST_INTERVAL &&
+		(persist < 0 || persist&persistBatch == 0 || persist == persistBatch) {
 		return nil, ErrInvalidPersist
 	}
 
 	dump := &Dump{
 		filename: filename,
+		types:    types,
+		storage:  fileStorage{},
 		items:    make([]Item, 0),
 		persist:  persist,
-		mutex:    sync.RWMutex{},
+		instance: strconv.FormatInt(time.Now().UnixNano(), 36),
+		closed:   make(chan struct{}),
+		mutex:    &sync.RWMutex{},
+	}
+
+	for _, option := range options {
+		if err := option(dump); err != nil {
+			return nil, err
+		}
+	}
+
+	if dump.crdt != nil && dump.records != nil {
+		return nil, ErrInvalidCRDT
+	}
+
+	if err := dump.retain(); err != nil {
+		return nil, err
+	}
+
+	if dump.hybridClock {
+		if dump.crdt == nil {
+			return nil, ErrInvalidCRDT
+		}
+		dump.crdt.hybrid = true
+	}
+
+	if dump.codecs != nil && dump.protobuf != nil {
+		return nil, ErrInvalidItemCodec
+	}
+
+	if len(dump.collections) > 0 && dump.records != nil {
+		return nil, ErrInvalidCollection
+	}
+
+	if dump.events != nil && (dump.records != nil || len(dump.collections) > 0) {
+		return nil, ErrInvalidCommandLog
+	}
+
+	if dump.segments > 0 && (dump.records != nil || dump.backups > 0) {
+		return nil, ErrInvalidSegments
+	}
+
+	if dump.series != nil && (dump.segments > 0 || dump.records != nil || dump.backups > 0) {
+		return nil, ErrInvalidTimeSeries
+	}
+
+	if dump.protobuf != nil && (dump.segments > 0 || dump.records != nil || dump.series != nil) {
+		return nil, ErrInvalidProtobuf
+	}
+
+	if dump.signing != nil && (dump.records != nil || dump.events != nil) {
+		return nil, ErrInvalidSigning
+	}
+
+	if dump.emergency != nil && (dump.records != nil || dump.events != nil) {
+		return nil, ErrInvalidEmergencyFile
 	}
 
 	if persist == PERSIST_INTERVAL {
 		go dump.persistInterval()
 	}
 
+	dump.startSweeper()
+	dump.startReloader()
+	dump.startSchedule()
+	dump.startPolicies()
+
 	return dump, nil
 }
 
-// Item implements the json.Marshaler interface and is used so that the dump
-// itself can implement the json.Marshaler function by aggregating all items.
-type Item interface {
-	MarshalJSON() ([]byte, error)
+// Item is a value held in the dump. Items are usually pointers to structs
+// (such as &User{}) and must be registered with a Type so they can be
+// persisted.
+//
+// When the dump is marshaled to JSON, items implementing json.Marshaler are
+// marshaled using their MarshalJSON method and all other items are marshaled
+// with encoding/json.
+type Item interface{}
+
+// marshalItem returns the JSON encoding of item.
+func marshalItem(item Item) ([]byte, error) {
+	if m, ok := item.(json.Marshaler); ok {
+		return m.MarshalJSON()
+	}
+	return json.Marshal(item)
 }
 
 func (d *Dump) persistInterval() {
 	for {
-		time.Sleep(time.Second * 60)
+		select {
+		case <-d.closed:
+			return
+		case <-time.After(time.Second * 60):
+		}
 
 		if err := d.Save(); err != nil {
 			println(err.Error())
@@ -117,132 +590,1205 @@ func (d *Dump) persistInterval() {
 	}
 }
 
+// Close stops the dump from persisting on an interval (if PERSIST_INTERVAL is
+// enabled) and, unless PERSIST_MANUAL is used without WithPersistence(),
+// saves it one last time, then waits for the webhooks (see WithWebhook()) to
+// send their queued batches. The items stay available in memory for
+// reading, but methods changing them return ErrClosed from then on. It
+// returns an error if there was a problem persisting the dump on the disk.
+func (d *Dump) Close() error {
+	if d.parent != nil {
+		return d.parent.Close()
+	}
+
+	d.closeOnce.Do(func() { close(d.closed) })
+
+	var err error
+	if d.persist != PERSIST_MANUAL || d.policy != nil {
+		err = d.Save()
+	}
+
+	for _, w := range d.webhooks {
+		w.wait()
+	}
+	return err
+}
+
+// Flush saves the changes made to the dump since it was last saved, if there
+// are any, such as the changes of a dump created with PERSIST_BATCH() that
+// don't fill a batch yet. It returns an error if there was a problem
+// persisting the dump on the disk.
+func (d *Dump) Flush() error {
+	if d.parent != nil {
+		return d.parent.Flush()
+	}
+
+	if atomic.LoadInt64(&d.unsaved) == 0 {
+		return nil
+	}
+	return d.Save()
+}
+
+// autosave counts a change and reports whether the dump should be saved
+// after it: always with PERSIST_WRITES, and once every n changes with
+// PERSIST_BATCH(n) or AfterWrites(n).
+func (d *Dump) autosave() bool {
+	if d.parent != nil {
+		return d.parent.autosave()
+	}
+
+	changes := atomic.AddInt64(&d.unsaved, 1)
+
+	batch := 0
+	switch {
+	case d.persist == PERSIST_WRITES:
+		batch = 1
+	case d.persist&persistBatch != 0:
+		batch = d.persist &^ persistBatch
+	}
+	if d.policy != nil && d.policy.batch > 0 && (batch == 0 || d.policy.batch < batch) {
+		batch = d.policy.batch
+	}
+
+	if batch > 0 && changes >= int64(batch) {
+		return true
+	}
+	d.restartQuiet()
+	return false
+}
+
+// lock locks the dump for writing. It returns ErrClosed (and doesn't lock)
+// if the dump was closed.
+func (d *Dump) lock() error {
+	d.mutex.Lock()
+	if d.isClosed() {
+		d.mutex.Unlock()
+		return ErrClosed
+	}
+	return nil
+}
+
+// isClosed returns whether the dump (or the dump of the collection) was
+// closed.
+func (d *Dump) isClosed() bool {
+	if d.parent != nil {
+		return d.parent.isClosed()
+	}
+
+	select {
+	case <-d.closed:
+		return true
+	default:
+		return false
+	}
+}
+
 // Add appends an Item on the end of the dump. It returns the id of the item
 // and an error if there was a problem persisting the dump on the disk (if
 // PERSIST_WRITE is enabled).
-func (d *Dump) Add(item Item) (int, error) {
-	d.mutex.Lock()
+func (d *Dump) Add(item Item) (id int, err error) {
+	span := d.trace("Add")
+	defer func() { span.End(err) }()
+
+	if err := d.lock(); err != nil {
+		return -1, err
+	}
+	span.Locked()
 	defer d.mutex.Unlock()
 
-	d.items = append(d.items, item)
+	stable, err := d.add(item)
+	if err != nil {
+		return -1, err
+	}
+
+	id = len(d.items) - 1
+	if d.order != nil {
+		id = d.positions([]uint64{stable})[0]
+	}
 
-	if d.persist == PERSIST_WRITES {
-		return len(d.items) - 1, d.save()
+	if d.autosave() {
+		return id, d.save()
 	}
 
-	return len(d.items) - 1, nil
+	return id, nil
 }
 
-// MarshalJSON returns the dump as a JSON list. It returns an error if there
-// was an error marshaling one of the items.
-func (d *Dump) MarshalJSON() ([]byte, error) {
-	d.mutex.RLock()
-	defer d.mutex.RUnlock()
+// add appends the item on the end of the dump and returns its stable id.
+//
+// no mutex
+func (d *Dump) add(item Item) (uint64, error) {
+	if err := d.beforeAdd([]Item{item}); err != nil {
+		return 0, err
+	}
+
+	if err := d.checkAppend([]Item{item}); err != nil {
+		return 0, err
+	}
 
-	var buffer bytes.Buffer
+	d.items = append(d.items, item)
+	ids := d.appended(len(d.items) - 1)
 
-	buffer.WriteString(`[`)
-	for i, item := range d.items {
-		da, err := item.MarshalJSON()
-		if err != nil {
-			return nil, err
-		}
-		buffer.Write(da)
-		if i != len(d.items)-1 {
-			buffer.WriteString(`,`)
+	stable := d.meta[ids[0]].ID
+	d.evict()
+	return stable, nil
+}
+
+// AddAll appends all of the items on the end of the dump under a single lock
+// and (if PERSIST_WRITES is enabled) a single save. It returns the ids of the
+// items in the same order as they were provided (-1 for items removed right
+// away by WithMaxItems()) and an error if there was a problem persisting the
+// dump on the disk.
+func (d *Dump) AddAll(items ...Item) (ids []int, err error) {
+	span := d.trace("AddAll")
+	defer func() { span.End(err) }()
+
+	if err := d.lock(); err != nil {
+		return nil, err
+	}
+	span.Locked()
+	defer d.mutex.Unlock()
+
+	if err := d.beforeAdd(items); err != nil {
+		return nil, err
+	}
+
+	if err := d.checkAppend(items); err != nil {
+		return nil, err
+	}
+
+	d.items = append(d.items, items...)
+	ids = d.appended(len(d.items) - len(items))
+
+	stables := d.stables(ids)
+	if removed := d.evict(); d.order != nil {
+		ids = d.positions(stables)
+	} else if removed > 0 {
+		for i := range ids {
+			if ids[i] -= removed; ids[i] < 0 {
+				ids[i] = -1
+			}
 		}
 	}
-	buffer.WriteString(`]`)
 
-	return buffer.Bytes(), nil
-}
+	if d.autosave() {
+		return ids, d.save()
+	}
 
-func (d *Dump) encodeGob() []byte {
-	var buffer bytes.Buffer
-	gob.NewEncoder(&buffer).Encode(d.items)
-	return buffer.Bytes()
+	return ids, nil
 }
 
-func (d *Dump) decodeGob(data []byte) error {
-	return gob.NewDecoder(bytes.NewBuffer(data)).Decode(&d.items)
+// Clear removes every item from the dump. It returns an error if there was a
+// problem persisting the dump on the disk (if PERSIST_WRITES is enabled).
+func (d *Dump) Clear() error {
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer d.mutex.Unlock()
+
+	ids := make([]int, len(d.items))
+	for id := range ids {
+		ids[id] = id
+	}
+	items, metas := d.items, d.meta
+	if err := d.thawReferencing(metas); err != nil {
+		return err
+	}
+
+	d.items, d.meta = make([]Item, 0), nil
+	d.reset()
+	d.afterDelete(ids, items, metas)
+
+	if d.autosave() {
+		return d.save()
+	}
+
+	return nil
 }
 
-// Save persists the dump on disk using the filename provided when NewDump()
-// was called.
-func (d *Dump) Save() error {
-	d.mutex.RLock()
+// Get returns the item with the provided id (a deep copy of it if
+// WithCopyOnRead() is enabled). It returns ErrNotFound if there is no item
+// with that id.
+func (d *Dump) Get(id int) (item Item, err error) {
+	span := d.trace("Get")
+	defer func() { span.End(err) }()
+
+	d.rlock()
+	span.Locked()
 	defer d.mutex.RUnlock()
 
-	return d.save()
-}
+	if id < 0 || id >= len(d.items) {
+		return nil, ErrNotFound
+	}
 
-// no mutex
-func (d *Dump) save() error {
-	return ioutil.WriteFile(d.filename, d.encodeGob(), 0644)
+	d.used(id)
+	if d.copyReads {
+		return copyItem(d.items[id])
+	}
+	return d.items[id], nil
 }
 
-// Load reads the dump from disk using the filename provided when NewDump()
-// was called.
-func (d *Dump) Load() error {
-	d.mutex.Lock()
+// Set replaces the item with the provided id. It returns ErrNotFound if there
+// is no item with that id and an error if there was a problem persisting the
+// dump on the disk (if PERSIST_WRITES is enabled).
+func (d *Dump) Set(id int, item Item) (err error) {
+	span := d.trace("Set")
+	defer func() { span.End(err) }()
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	span.Locked()
 	defer d.mutex.Unlock()
 
-	var (
-		data []byte
-		err  error
-	)
+	if err := d.set(id, item); err != nil {
+		return err
+	}
+
+	if d.autosave() {
+		return d.save()
+	}
+
+	return nil
+}
+
+// set replaces the item with the provided id.
+//
+// no mutex
+func (d *Dump) set(id int, item Item) error {
+	if id < 0 || id >= len(d.items) {
+		return ErrNotFound
+	}
+
+	if err := d.validate(item); err != nil {
+		return err
+	}
 
-	if data, err = ioutil.ReadFile(d.filename); err != nil {
+	if err := d.checkSet(id, item); err != nil {
 		return err
 	}
 
-	return d.decodeGob(data)
+	d.items[id] = item
+	d.replaced(id)
+	d.afterUpdate(id)
+	return nil
 }
 
-// Update is used to manipulate an item (or items) in the dump. It returns
-// an error if there is an error saving the dump (if PERSIST_WRITES is
-// enabled) or if there is an error inside the f function.
-func (d *Dump) Update(f func(items []Item) error) error {
-	d.mutex.Lock()
+// Remove removes the item with the provided id. The ids of the items after it
+// shift down by one. It returns ErrNotFound if there is no item with that id
+// and an error if there was a problem persisting the dump on the disk (if
+// PERSIST_WRITES is enabled).
+func (d *Dump) Remove(id int) (err error) {
+	span := d.trace("Remove")
+	defer func() { span.End(err) }()
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	span.Locked()
 	defer d.mutex.Unlock()
 
-	if err := f(d.items); err != nil {
+	if id < 0 || id >= len(d.items) {
+		return ErrNotFound
+	}
+
+	if _, err := d.remove(func(other int) bool { return other == id }); err != nil {
 		return err
 	}
 
-	if d.persist == PERSIST_WRITES {
+	if d.autosave() {
 		return d.save()
 	}
 
 	return nil
 }
 
-// Map applies the function f to each item in the dump. It returns an error if
-// f returns an error for one of the items. If PERSIST_WRITES is enabled Map
-// might also return an error if there is an error saving the dump to disk.
-func (d *Dump) Map(f func(item Item) error) error {
-	d.mutex.Lock()
+// UpdateAt calls f with the item with the provided id so it can be changed in
+// place. It returns ErrNotFound if there is no item with that id, the error
+// returned by f, and an error if there was a problem persisting the dump on
+// the disk (if PERSIST_WRITES is enabled).
+func (d *Dump) UpdateAt(id int, f func(item Item) error) (err error) {
+	span := d.trace("UpdateAt")
+	defer func() { span.End(err) }()
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	span.Locked()
 	defer d.mutex.Unlock()
 
-	var err error
-	for _, i := range d.items {
-		if err = f(i); err != nil {
-			return err
-		}
+	if id < 0 || id >= len(d.items) {
+		return ErrNotFound
+	}
+
+	if err := d.updateAt(id, f); err != nil {
+		return err
 	}
 
-	if d.persist == PERSIST_WRITES {
+	d.afterUpdate(id)
+
+	if d.autosave() {
 		return d.save()
 	}
 
 	return nil
 }
 
-// View is used to read an item (or items) in the dump. It returns an error
-// if there is an error inside the f function.
-func (d *Dump) View(f func(items []Item) error) error {
-	d.mutex.RLock()
-	defer d.mutex.RUnlock()
+// updateAt calls f with the item with the provided id, undoing the changes
+// made by f if they fail validation or violate a unique index.
+//
+// no mutex
+func (d *Dump) updateAt(id int, f func(item Item) error) error {
+	var (
+		backup Item
+		m      = d.meta[id]
+		err    error
+	)
 
-	return f(d.items)
+	if err = d.thaw(id); err != nil {
+		return err
+	}
+
+	if d.hasUnique() || d.validating() {
+		if backup, err = copyItem(d.items[id]); err != nil {
+			return err
+		}
+	}
+
+	err = f(d.items[id])
+	d.replaced(id)
+
+	if err == nil && backup != nil {
+		if err = d.validate(d.items[id]); err == nil {
+			err = d.checkIndexes()
+		}
+		if err != nil {
+			d.items[id], d.meta[id] = backup, m
+			d.dirty(id)
+			d.indexSet(id)
+		}
+	}
+
+	return err
+}
+
+// MarshalJSON returns the dump as a JSON list. It returns an error if there
+// was an error marshaling one of the items.
+func (d *Dump) MarshalJSON() ([]byte, error) {
+	// the list is usually about as long as the last one
+	buffer := bytes.NewBuffer(make([]byte, 0, atomic.LoadInt64(&d.jsonSize)))
+
+	if err := d.WriteJSONTo(buffer); err != nil {
+		return nil, err
+	}
+
+	atomic.StoreInt64(&d.jsonSize, int64(buffer.Len()))
+	return buffer.Bytes(), nil
+}
+
+// WriteJSONTo writes the dump to w as a JSON list, one item at a time, so the
+// whole list never has to be held in memory (useful for writing directly to
+// an http.ResponseWriter). The items are written from a frozen view (see
+// Freeze()), so a slow writer doesn't block writes to the dump. It returns
+// an error if there was an error marshaling one of the items or writing to w,
+// in which case w may have received part of the list.
+func (d *Dump) WriteJSONTo(w io.Writer) error {
+	f := d.Freeze()
+	defer f.Release()
+
+	return f.WriteJSONTo(w)
+}
+
+// MarshalItemJSON returns the item with the provided id as JSON (along with
+// its metadata if WithJSONMeta() is enabled). The item is marshaled under the
+// read lock, so unlike marshaling an item returned by Get() it doesn't race
+// with changes made to it in place. It returns ErrNotFound if there is no
+// item with that id.
+func (d *Dump) MarshalItemJSON(id int) ([]byte, error) {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	return d.itemJSON(id, d.jsonMeta)
+}
+
+// itemJSON returns the item with the provided id as JSON, along with its
+// metadata if withMetadata is true.
+//
+// no mutex
+func (d *Dump) itemJSON(id int, withMetadata bool) ([]byte, error) {
+	if id < 0 || id >= len(d.items) {
+		return nil, ErrNotFound
+	}
+
+	d.used(id)
+	data, err := d.marshalJSON(d.items[id])
+	if err != nil || !withMetadata {
+		return data, err
+	}
+	return json.Marshal(withMeta{Meta: d.meta[id].public(), Item: data})
+}
+
+// WriteItemJSONTo writes the item with the provided id to w as
+// MarshalItemJSON() returns it. The dump is unlocked before writing to w, so a
+// slow writer doesn't block writes to the dump.
+func (d *Dump) WriteItemJSONTo(id int, w io.Writer) error {
+	data, err := d.MarshalItemJSON(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// writeJSON writes items to w as a JSON list.
+func (d *Dump) writeJSON(w io.Writer, items []Item) error {
+	writer := bufio.NewWriter(w)
+
+	writer.WriteString(`[`)
+	for i, item := range items {
+		da, err := d.marshalJSON(item)
+		if err != nil {
+			return err
+		}
+		writer.Write(da)
+		if i != len(items)-1 {
+			writer.WriteString(`,`)
+		}
+	}
+	writer.WriteString(`]`)
+
+	return writer.Flush()
+}
+
+// writeJSONMeta writes items to w as a JSON list, along with their metadata.
+func (d *Dump) writeJSONMeta(w io.Writer, items []Item, metas []meta) error {
+	writer := bufio.NewWriter(w)
+
+	writer.WriteString(`[`)
+	for i, item := range items {
+		data, err := d.marshalJSON(item)
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(withMeta{Meta: metas[i].public(), Item: data}); err != nil {
+			return err
+		}
+		writer.Write(data)
+		if i != len(items)-1 {
+			writer.WriteString(`,`)
+		}
+	}
+	writer.WriteString(`]`)
+
+	return writer.Flush()
+}
+
+// file returns the items of the dump (but not of its collections) in the
+// format they are persisted in.
+func (d *Dump) file() file {
+	f := file{
+		Schema: d.schema,
+		Items:  d.items,
+		Meta:   d.meta,
+		NextID: d.nextID,
+	}
+	if d.crdt != nil {
+		f.Clock, f.Tombstones = d.crdt.clock, d.crdt.graveyard()
+	}
+	if d.events != nil {
+		f.Seq = d.events.seq
+	}
+	if d.history != nil {
+		// the dump is saved with the history as of the save
+		d.history.prune()
+		f.Revisions, f.Deleted = d.history.persisted()
+	}
+	return f
+}
+
+// decodeGob decodes the payload of a version 1 dump file.
+func (d *Dump) decodeGob(data []byte) error {
+	var f file
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&f); err != nil {
+		return decodeError(err)
+	}
+
+	if err := d.decodeFile(f); err != nil {
+		return err
+	}
+
+	return d.loadCollections(f.Collections)
+}
+
+// decodeFile replaces the items of the dump with the ones persisted in f.
+func (d *Dump) decodeFile(f file) error {
+	if f.Segmented != nil {
+		items, err := d.readSegments(f.Segmented)
+		if err != nil {
+			return err
+		}
+		f.Items = items
+	}
+
+	if err := d.decodeItems(f.Items); err != nil {
+		return err
+	}
+
+	items, err := d.migrate(f.Schema, f.Items)
+	if err != nil {
+		return err
+	}
+
+	d.items = items
+	if d.items == nil {
+		d.items = make([]Item, 0)
+	}
+	d.restore(f.Meta, f.NextID)
+	if d.crdt != nil {
+		d.crdt.restore(f.Clock, f.Tombstones, d.meta)
+	}
+	if d.events != nil {
+		d.events.seq = f.Seq
+	}
+	if d.history != nil {
+		d.history.restore(f.Revisions, f.Deleted)
+	}
+
+	return nil
+}
+
+// decodeLegacy decodes a payload written before dump files had a header.
+func (d *Dump) decodeLegacy(data []byte) error {
+	var items []Item
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&items); err != nil {
+		return decodeError(err)
+	}
+
+	items, err := d.migrate(0, items)
+	if err != nil {
+		return err
+	}
+
+	d.items = items
+	d.restore(nil, 0)
+	return nil
+}
+
+// encode returns the dump in its on-disk format along with the size of the
+// uncompressed payload. seg describes the segments the items were written to,
+// if they were. The payload is encoded (and compressed, if the compression
+// supports streams) straight into the returned buffer, which comes from the
+// pool and is sized after the last file encoded; it should be returned with
+// putBuffer() once written.
+func (d *Dump) encode(seg *segmented) (*bytes.Buffer, int, error) {
+	var (
+		h      = header{version: formatVersion}
+		buffer = getBuffer(int(atomic.LoadInt64(&d.fileSize)))
+		memory int
+		err    error
+	)
+
+	buffer.Write(make([]byte, headerSize))
+
+	switch c := d.compression.(type) {
+	case nil:
+		memory, err = d.encodePayload(buffer, seg)
+	case streamCompression:
+		var w io.WriteCloser
+		if w, err = c.writer(buffer); err == nil {
+			if memory, err = d.encodePayload(w, seg); err == nil {
+				err = w.Close()
+			}
+		}
+	default:
+		payload := getBuffer(buffer.Cap())
+		if memory, err = d.encodePayload(payload, seg); err == nil {
+			var compressed []byte
+			if compressed, err = c.Compress(payload.Bytes()); err == nil {
+				buffer.Write(compressed)
+			}
+		}
+		putBuffer(payload)
+	}
+
+	if err != nil {
+		putBuffer(buffer)
+		return nil, 0, err
+	}
+
+	if d.compression != nil {
+		h.flags |= flagCompressed
+	}
+	if d.protobuf != nil {
+		h.flags |= flagProtobuf
+	}
+	if d.signing != nil {
+		h.flags |= flagSigned
+	}
+
+	putHeader(h, buffer.Bytes())
+	if d.signing != nil {
+		buffer.Write(d.signature(buffer.Bytes()))
+	}
+	atomic.StoreInt64(&d.fileSize, int64(buffer.Len()))
+	return buffer, memory, nil
+}
+
+// pack compresses payload (if WithCompression() is enabled) and adds the
+// header (and signature) of the on-disk format.
+func (d *Dump) pack(payload []byte) ([]byte, error) {
+	var (
+		h   = header{version: formatVersion}
+		err error
+	)
+
+	if d.compression != nil {
+		if payload, err = d.compression.Compress(payload); err != nil {
+			return nil, err
+		}
+		h.flags |= flagCompressed
+	}
+
+	return d.seal(h, payload), nil
+}
+
+// decode replaces the items of the dump with the ones in data, which is in
+// the on-disk format. It returns the size of the uncompressed payload.
+func (d *Dump) decode(data []byte) (int, error) {
+	h, payload, legacy, err := decodeFile(data)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.verify(h, data); err != nil {
+		return 0, err
+	}
+
+	if legacy {
+		if d.compression != nil {
+			if payload, err = d.compression.Decompress(payload); err != nil {
+				return 0, err
+			}
+		}
+		return len(payload), d.decodeLegacy(payload)
+	}
+
+	if h.version > 1 {
+		return d.decodeFrom(bytes.NewReader(data))
+	}
+
+	if payload, err = d.unpack(h, payload); err != nil {
+		return 0, err
+	}
+
+	return len(payload), d.decodeGob(payload)
+}
+
+// unpack decompresses the payload of a file in the on-disk format, if it is
+// compressed.
+func (d *Dump) unpack(h header, payload []byte) ([]byte, error) {
+	if h.flags&flagCompressed == 0 {
+		return payload, nil
+	}
+	if d.compression == nil {
+		return nil, ErrCompressed
+	}
+	return d.compression.Decompress(payload)
+}
+
+// Save persists the dump on disk using the filename provided when NewDump()
+// was called. The collections of a dump are saved together with it.
+func (d *Dump) Save() (err error) {
+	if d.parent != nil {
+		return d.parent.Save()
+	}
+
+	span := d.trace("Save")
+	defer func() { span.End(err) }()
+
+	d.mutex.RLock()
+	span.Locked()
+	defer d.mutex.RUnlock()
+
+	return d.save()
+}
+
+// no mutex
+func (d *Dump) save() error {
+	if d.parent != nil {
+		return d.parent.save()
+	}
+
+	if d.events != nil {
+		return d.appendCommands()
+	}
+
+	var (
+		memory, disk int
+		err          error
+	)
+
+	if d.records != nil {
+		memory, err = d.saveRecords()
+		disk = memory
+	} else if memory, disk, err = d.write(); err != nil && d.emergency != nil {
+		memory, disk, err = d.writeEmergency(err)
+	}
+
+	d.saved(memory, disk, err)
+	return err
+}
+
+// write writes the dump file and returns the size of the uncompressed
+// payload and of the file.
+//
+// no mutex
+func (d *Dump) write() (int, int, error) {
+	// saves only hold the read lock, so they could otherwise write the same
+	// temporary file at once
+	d.fileMutex.Lock()
+	defer d.fileMutex.Unlock()
+
+	var seg *segmented
+	if d.segments > 0 || d.series != nil {
+		d.slotMutex.Lock()
+		defer d.slotMutex.Unlock()
+
+		var err error
+		if d.series != nil {
+			seg, err = d.writeChunks()
+		} else {
+			seg, err = d.writeSegments()
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var (
+		memory, disk int
+		err          error
+	)
+	if d.streams() {
+		memory, disk, err = d.writeStream(seg)
+	} else {
+		memory, disk, err = d.writeBuffered(seg)
+	}
+
+	if err == nil && d.series != nil {
+		d.wroteChunks(seg)
+	} else if err == nil && seg != nil {
+		d.slot = seg.Slot
+	}
+
+	return memory, disk, err
+}
+
+// writeBuffered encodes the dump file in memory before writing it, for the
+// storages and options that need all of it at once (see streams()).
+//
+// no mutex
+func (d *Dump) writeBuffered(seg *segmented) (int, int, error) {
+	buffer, memory, err := d.encode(seg)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer putBuffer(buffer)
+
+	data := buffer.Bytes()
+
+	if d.backups > 0 {
+		err = d.rotate(data)
+	} else {
+		err = d.writeFile(d.filename, data)
+	}
+	if err == nil {
+		d.afterWrite(d.filename, data)
+	}
+
+	return memory, len(data), err
+}
+
+// Load reads the dump from disk using the filename provided when NewDump()
+// was called, along with its collections. It returns ErrCorrupt if the file
+// is truncated or fails its checksum.
+//
+// If WithBackupFallback() is enabled and the file is missing or corrupt, the
+// backups are tried from newest to oldest and the first one that loads is
+// used instead. LoadedFrom() reports which file that was.
+func (d *Dump) Load() (err error) {
+	if d.parent != nil {
+		return d.parent.Load()
+	}
+
+	span := d.trace("Load")
+	defer func() { span.End(err) }()
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	span.Locked()
+	defer d.mutex.Unlock()
+
+	if err := d.load(); err != nil {
+		return err
+	}
+
+	d.generated()
+	d.afterReset()
+	if d.events != nil {
+		// the loaded items are already logged
+		d.events.pending, d.events.err = nil, nil
+	}
+
+	return d.onLoad()
+}
+
+// no mutex
+func (d *Dump) load() error {
+	if d.events != nil {
+		return d.replay(0)
+	}
+
+	if d.records != nil {
+		size, err := d.loadRecords()
+		if err == nil {
+			d.loaded(size, size)
+			d.reindex()
+		}
+		return err
+	}
+
+	err := d.loadFile(d.filename)
+	if err == nil {
+		d.loadedFrom = d.filename
+		d.reindex()
+		return nil
+	}
+
+	if !d.fallback || !recoverable(err) {
+		return err
+	}
+
+	for i := 1; i <= d.backups; i++ {
+		if d.loadFile(d.backupName(i)) == nil {
+			d.loadedFrom = d.backupName(i)
+			d.reindex()
+			return nil
+		}
+	}
+
+	return err
+}
+
+// no mutex
+func (d *Dump) loadFile(filename string) error {
+	r, size, err := d.openFile(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	d.skipped(0)
+	memory, err := d.decodeFrom(r)
+	if e, ok := err.(*UnknownTypeError); ok {
+		e.File = filename
+	}
+	if err != nil {
+		return err
+	}
+
+	d.loaded(memory, int(size))
+	d.decoded(int(size))
+	return nil
+}
+
+// LoadedFrom returns the filename the dump was last successfully loaded
+// from. It is either the filename provided when NewDump() was called or, if
+// WithBackupFallback() is enabled, the name of a backup file. It returns an
+// empty string if the dump hasn't been loaded.
+func (d *Dump) LoadedFrom() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.loadedFrom
+}
+
+// Update is used to manipulate an item (or items) in the dump. It returns
+// an error if there is an error saving the dump (if PERSIST_WRITES is
+// enabled) or if there is an error inside the f function.
+//
+// f is given deep copies of the items, which replace the items in the dump
+// only if f returns nil, so an Update either applies all of its changes or
+// none of them. Items that f didn't change are left as they were. If the
+// dump has unique indexes and f gives two items the same key, the changes
+// are dropped and ErrDuplicate is returned.
+//
+// Copying every item takes a while in large dumps: UpdateAt() and
+// UpdateWhere() only copy the items they change, and items implementing
+// Cloner are copied much faster than through encoding/gob.
+func (d *Dump) Update(f func(items []Item) error) (err error) {
+	span := d.trace("Update")
+	defer func() { span.End(err) }()
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	span.Locked()
+	defer d.mutex.Unlock()
+
+	copied, err := copyItems(d.items)
+	if err != nil {
+		return err
+	}
+
+	if err = f(copied); err != nil {
+		return err
+	}
+
+	ids, err := d.swap(copied)
+	if err != nil {
+		return err
+	}
+
+	d.afterUpdate(ids...)
+
+	if d.autosave() {
+		return d.save()
+	}
+
+	return nil
+}
+
+// Map applies the function f to each item in the dump. It returns an error if
+// f returns an error for one of the items. If PERSIST_WRITES is enabled Map
+// might also return an error if there is an error saving the dump to disk.
+// Like Update(), f is given deep copies of the items (made as f reaches
+// them) and the changes are only applied if f never returns an error and no
+// unique index is violated.
+func (d *Dump) Map(f func(item Item) error) (err error) {
+	span := d.trace("Map")
+	defer func() { span.End(err) }()
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	span.Locked()
+	defer d.mutex.Unlock()
+
+	// items are copied as f reaches them, so an error stops the copying too
+	var (
+		c      = newCopier()
+		copied = make([]Item, len(d.items))
+	)
+	for id, item := range d.items {
+		if copied[id], err = c.copy(item); err != nil {
+			return err
+		}
+		if err = f(copied[id]); err != nil {
+			return err
+		}
+	}
+
+	ids, err := d.swap(copied)
+	if err != nil {
+		return err
+	}
+
+	d.afterUpdate(ids...)
+
+	if d.autosave() {
+		return d.save()
+	}
+
+	return nil
+}
+
+// Sort reorders the items in the dump using less, keeping equal items in
+// their current order. Because the id of an item is its position in the dump,
+// sorting changes ids: the returned mapping holds the new id of every item at
+// the index of its old id (newID := mapping[oldID]). It returns an error if
+// there is an error saving the dump (if PERSIST_WRITES is enabled).
+func (d *Dump) Sort(less func(a, b Item) bool) ([]int, error) {
+	if err := d.lock(); err != nil {
+		return nil, err
+	}
+	defer d.mutex.Unlock()
+
+	mapping := d.sort(less)
+
+	if d.autosave() {
+		return mapping, d.save()
+	}
+
+	return mapping, nil
+}
+
+// sort reorders the items using less like Sort() does, and returns the
+// mapping from their old ids to their new ones.
+//
+// no mutex
+func (d *Dump) sort(less func(a, b Item) bool) []int {
+	mapping, moved := d.arrange(less)
+	if moved {
+		d.afterReset()
+	}
+	return mapping
+}
+
+// arrange reorders the items using less without the side effects of a reset
+// (see afterReset()), and returns the mapping from their old ids to their new
+// ones and whether any item moved.
+//
+// no mutex
+func (d *Dump) arrange(less func(a, b Item) bool) ([]int, bool) {
+	order := make([]int, len(d.items))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return less(d.items[order[i]], d.items[order[j]])
+	})
+
+	var (
+		items   = make([]Item, len(d.items))
+		mapping = make([]int, len(d.items))
+	)
+
+	sorted := make([]meta, len(d.meta))
+
+	moved := false
+	for newID, oldID := range order {
+		items[newID] = d.items[oldID]
+		sorted[newID] = d.meta[oldID]
+		mapping[oldID] = newID
+		if newID != oldID {
+			d.unordered = true
+			moved = true
+		}
+	}
+
+	d.items = items
+	d.meta = sorted
+	d.changed()
+
+	return mapping, moved
+}
+
+// View is used to read an item (or items) in the dump. It returns an error
+// if there is an error inside the f function. The items must not be changed
+// or used after f returns, unless WithCopyOnRead() is enabled, in which case
+// f is given deep copies of them.
+func (d *Dump) View(f func(items []Item) error) (err error) {
+	span := d.trace("View")
+	defer func() { span.End(err) }()
+
+	d.rlock()
+	span.Locked()
+	defer d.mutex.RUnlock()
+
+	items, err := d.reading(d.items)
+	if err != nil {
+		return err
+	}
+	return f(items)
+}
+
+// appended is called after items were appended to the dump, starting at the
+// provided id. It returns the ids of the items, which WithOrder() may have
+// moved.
+//
+// no mutex
+func (d *Dump) appended(from int) []int {
+	d.generated()
+	d.assign(from)
+	d.indexFrom(from)
+
+	ids, _ := d.reorder(idsFrom(from, len(d.items)))
+	d.afterAdd(ids...)
+	return ids
+}
+
+// idsFrom returns the ids from from up to (but not including) to.
+func idsFrom(from, to int) []int {
+	ids := make([]int, 0, to-from)
+	for id := from; id < to; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// replaced is called after the item with the provided id was replaced.
+//
+// no mutex
+func (d *Dump) replaced(id int) {
+	d.generated()
+	d.bump(id)
+	d.dirty(id)
+	d.indexSet(id)
+}
+
+// reset is called after the list of items was replaced with new items.
+//
+// no mutex
+func (d *Dump) reset() {
+	d.unordered = false
+	d.assign(0)
+	d.changed()
+}
+
+// swap replaces the items with the copies that were changed (see sameItem())
+// and returns their ids. If a copy fails validation, or the
+// copies violate a unique index, the replaced items are put back and the
+// error is returned.
+//
+// no mutex
+func (d *Dump) swap(copied []Item) ([]int, error) {
+	var (
+		ids   []int
+		items []Item
+		metas []meta
+		err   error
+	)
+
+	for id := range copied {
+		if sameItem(d.items[id], copied[id]) {
+			continue
+		}
+
+		if err = d.validate(copied[id]); err != nil {
+			break
+		}
+
+		ids = append(ids, id)
+		items = append(items, d.items[id])
+		metas = append(metas, d.meta[id])
+
+		d.items[id] = copied[id]
+		d.replaced(id)
+	}
+
+	if err == nil {
+		err = d.checkIndexes()
+	}
+	if err != nil {
+		for i, id := range ids {
+			d.items[id], d.meta[id] = items[i], metas[i]
+			d.dirty(id)
+			d.indexSet(id)
+		}
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// changed is called after any of the items may have changed, either in place
+// or by replacing the list of items.
+//
+// no mutex
+func (d *Dump) changed() {
+	d.generated()
+	d.touch()
+	d.reindex()
 }
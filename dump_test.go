@@ -256,3 +256,480 @@ func TestMap(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestWriteJSONTo(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+
+	var buffer bytes.Buffer
+	if err := test.WriteJSONTo(&buffer); err != nil || buffer.String() != `[]` {
+		t.Fatal("bad empty json encoding")
+	}
+
+	test.Add(&Blob{"one"})
+	test.Add(&Blob{"two"})
+
+	buffer.Reset()
+	if err := test.WriteJSONTo(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	if buffer.String() != `[{"data":"one"},{"data":"two"}]` {
+		t.Fatal("bad json encoding", buffer.String())
+	}
+
+	if err := test.WriteJSONTo(errWriter{}); err == nil {
+		t.Fatal("ignored write error")
+	}
+
+	test.Add(&Blob{"bad"})
+	if err := test.WriteJSONTo(&buffer); err == nil {
+		t.Fatal("not handling marshal errors")
+	}
+}
+
+func TestMarshalItemJSON(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	test.AddAll(&Blob{"one"}, &Blob{"bad"})
+
+	if data, err := test.MarshalItemJSON(0); err != nil || string(data) != `{"data":"one"}` {
+		t.Fatal("bad json encoding", string(data), err)
+	}
+	if _, err := test.MarshalItemJSON(2); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound", err)
+	}
+	if _, err := test.MarshalItemJSON(1); err == nil {
+		t.Fatal("not handling marshal errors")
+	}
+
+	var buffer bytes.Buffer
+	if err := test.WriteItemJSONTo(0, &buffer); err != nil || buffer.String() != `{"data":"one"}` {
+		t.Fatal("bad json encoding", buffer.String(), err)
+	}
+	if err := test.WriteItemJSONTo(0, errWriter{}); err == nil {
+		t.Fatal("ignored write error")
+	}
+
+	meta, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}}, WithJSONMeta())
+	meta.Add(&Blob{"one"})
+	if data, _ := meta.MarshalItemJSON(0); !bytes.HasPrefix(data, []byte(`{"meta":`)) {
+		t.Fatal("missing metadata", string(data))
+	}
+}
+
+// Plain doesn't implement json.Marshaler.
+type Plain struct {
+	Name string `json:"name"`
+}
+
+func TestMarshalPlain(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Plain", &Plain{}})
+
+	test.Add(&Plain{`quote"d`})
+
+	data, err := test.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `[{"name":"quote\"d"}]` {
+		t.Fatal("bad json encoding", string(data))
+	}
+
+	test.Add(func() {})
+	if _, err = test.MarshalJSON(); err == nil {
+		t.Fatal("marshaled unsupported type")
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+
+	id, _ := test.Add(&Blob{"hi"})
+
+	item, err := test.Get(id)
+	if err != nil || item.(*Blob).Data != "hi" {
+		t.Fatal("bad get")
+	}
+
+	for _, bad := range []int{-1, id + 1} {
+		if _, err = test.Get(bad); err != ErrNotFound {
+			t.Fatal("expected ErrNotFound for get", bad)
+		}
+		if err = test.Set(bad, &Blob{}); err != ErrNotFound {
+			t.Fatal("expected ErrNotFound for set", bad)
+		}
+	}
+
+	if err = test.Set(id, &Blob{"new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	if err = other.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if item, _ = other.Get(id); item.(*Blob).Data != "new" {
+		t.Fatal("set didn't persist")
+	}
+
+	if err = other.Set(id, &Blob{"manual"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClear(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+
+	test.Add(&Blob{"one"})
+	test.Add(&Blob{"two"})
+
+	if err := test.Clear(); err != nil {
+		t.Fatal(err)
+	}
+
+	if test.Len() != 0 {
+		t.Fatal("dump wasn't cleared")
+	}
+
+	if id, _ := test.Add(&Blob{"three"}); id != 0 {
+		t.Fatal("ids didn't restart")
+	}
+
+	other, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	other.Load()
+	if other.Len() != 1 {
+		t.Fatal("clear didn't persist")
+	}
+
+	if err := other.Clear(); err != nil || other.Len() != 0 {
+		t.Fatal("manual dump wasn't cleared")
+	}
+}
+
+func TestAddAll(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+
+	test.Add(&Blob{"zero"})
+
+	ids, err := test.AddAll(&Blob{"one"}, &Blob{"two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Fatal("bad ids", ids)
+	}
+
+	other, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	other.Load()
+	if item, _ := other.Get(2); other.Len() != 3 || item.(*Blob).Data != "two" {
+		t.Fatal("add all didn't persist")
+	}
+
+	if ids, err = other.AddAll(); err != nil || len(ids) != 0 {
+		t.Fatal("bad empty add all")
+	}
+}
+
+func TestSort(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+	test.AddAll(&Blob{"c"}, &Blob{"a"}, &Blob{"b"}, &Blob{"a"})
+
+	second, _ := test.Get(3)
+
+	mapping, err := test.Sort(func(a, b Item) bool {
+		return a.(*Blob).Data < b.(*Blob).Data
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int{3, 0, 2, 1}
+	for i := range expected {
+		if mapping[i] != expected[i] {
+			t.Fatal("bad mapping", mapping)
+		}
+	}
+
+	if item, _ := test.Get(mapping[3]); item != second {
+		t.Fatal("mapping doesn't point to the moved item")
+	}
+
+	other, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	other.Load()
+	other.View(func(items []Item) error {
+		for i, data := range []string{"a", "a", "b", "c"} {
+			if items[i].(*Blob).Data != data {
+				t.Fatal("sort didn't persist")
+			}
+		}
+		return nil
+	})
+
+	if mapping, err = other.Sort(func(a, b Item) bool { return false }); err != nil ||
+		mapping[3] != 3 {
+		t.Fatal("unstable sort")
+	}
+}
+
+func TestUpdateAt(t *testing.T) {
+	test, _ := New("test.db", PERSIST_WRITES, []Type{{"dump.Blob", &Blob{}}},
+		WithUniqueIndex("data", func(item Item) string { return item.(*Blob).Data }))
+
+	ids, _ := test.AddAll(&Blob{"one"}, &Blob{"two"})
+
+	if err := test.UpdateAt(ids[1], func(item Item) error {
+		item.(*Blob).Data = "three"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _, _ := test.GetByIndex("data", "three"); len(got) != 1 || got[0] != ids[1] {
+		t.Fatal("index wasn't updated")
+	}
+
+	other, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	other.Load()
+	if item, _ := other.Get(ids[1]); item.(*Blob).Data != "three" {
+		t.Fatal("update didn't persist")
+	}
+
+	if err := test.UpdateAt(ids[1], func(item Item) error {
+		item.(*Blob).Data = "one"
+		return nil
+	}); err != ErrDuplicate {
+		t.Fatal("expected ErrDuplicate")
+	}
+
+	if item, _ := test.Get(ids[1]); item.(*Blob).Data != "three" {
+		t.Fatal("duplicate wasn't rolled back")
+	}
+
+	var errTest = errors.New("update at")
+	if err := test.UpdateAt(ids[0], func(item Item) error {
+		return errTest
+	}); err != errTest {
+		t.Fatal("bad error")
+	}
+
+	for _, bad := range []int{-1, len(ids)} {
+		if err := test.UpdateAt(bad, func(Item) error { return nil }); err != ErrNotFound {
+			t.Fatal("expected ErrNotFound", bad)
+		}
+	}
+}
+
+func TestUpdateRollback(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+	ids, _ := test.AddAll(&Blob{"a"}, &Blob{"b"})
+
+	unchanged, _ := test.Get(ids[1])
+
+	var errTest = errors.New("rollback")
+	if err := test.Update(func(items []Item) error {
+		items[ids[0]].(*Blob).Data = "partial"
+		return errTest
+	}); err != errTest {
+		t.Fatal("bad error")
+	}
+
+	if err := test.Map(func(item Item) error {
+		if item.(*Blob).Data == "b" {
+			return errTest
+		}
+		item.(*Blob).Data = "partial"
+		return nil
+	}); err != errTest {
+		t.Fatal("bad error")
+	}
+
+	if item, _ := test.Get(ids[0]); item.(*Blob).Data != "a" {
+		t.Fatal("failed update wasn't rolled back")
+	}
+
+	if err := test.Update(func(items []Item) error {
+		items[ids[0]].(*Blob).Data = "c"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if item, _ := test.Get(ids[0]); item.(*Blob).Data != "c" {
+		t.Fatal("update wasn't applied")
+	}
+
+	if item, _ := test.Get(ids[1]); item != unchanged {
+		t.Fatal("unchanged item was replaced")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+	test.AddAll(&Blob{"a"}, &Blob{"b"})
+
+	if err := test.Remove(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := test.Remove(1); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound")
+	}
+
+	other, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	other.Load()
+	if item, _ := other.Get(0); other.Len() != 1 || item.(*Blob).Data != "b" {
+		t.Fatal("remove didn't persist")
+	}
+}
+
+func TestClose(t *testing.T) {
+	defer os.Remove("close.db")
+
+	test, _ := New("close.db", PERSIST_INTERVAL, []Type{{"dump.Plain", &Plain{}}})
+	test.Add(&Plain{"karl"})
+
+	if err := test.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat("close.db"); err != nil {
+		t.Fatal("didn't save on close")
+	}
+}
+
+func TestEncodeError(t *testing.T) {
+	defer os.Remove("encode.db")
+
+	test, _ := New("encode.db", PERSIST_WRITES, []Type{{"dump.Plain", &Plain{}}})
+	test.Add(&Plain{"karl"})
+
+	_, err := test.Add(&Unregistered{"data"})
+
+	var encodeErr *EncodeError
+	if !errors.As(err, &encodeErr) || encodeErr.Type != "*dump.Unregistered" {
+		t.Fatal("expected EncodeError", err)
+	}
+
+	// the file from the last successful save is kept
+	other, _ := NewDump("encode.db", PERSIST_MANUAL, Type{"dump.Plain", &Plain{}})
+	if err := other.Load(); err != nil || other.Len() != 1 {
+		t.Fatal("bad file", err)
+	}
+
+	segmented, _ := New("encode.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}},
+		WithSegments(2))
+	segmented.Add(&Plain{"karl"})
+	segmented.Add(&Unregistered{"data"})
+
+	if err := segmented.Save(); !errors.As(err, &encodeErr) {
+		t.Fatal("expected EncodeError", err)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	defer os.Remove("closed.db")
+
+	test, _ := New("closed.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}})
+	test.Add(&Plain{"karl"})
+	users, _ := test.Collection("users")
+	test.Close()
+
+	if _, err := test.Add(&Plain{"other"}); err != ErrClosed {
+		t.Fatal("expected ErrClosed", err)
+	}
+	if err := test.Set(0, &Plain{"other"}); err != ErrClosed {
+		t.Fatal("expected ErrClosed", err)
+	}
+	if _, err := users.Add(&Plain{"other"}); err != ErrClosed {
+		t.Fatal("expected ErrClosed for collection", err)
+	}
+
+	if item, err := test.Get(0); err != nil || item.(*Plain).Name != "karl" {
+		t.Fatal("can't read closed dump", err)
+	}
+	if _, err := test.Get(1); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound", err)
+	}
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotRegistered(t *testing.T) {
+	defer os.Remove("registered.db")
+
+	test, _ := New("registered.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}})
+	test.Add(&Unregistered{"data"})
+	if err := test.Save(); !errors.Is(err, ErrNotRegistered) {
+		t.Fatal("expected ErrNotRegistered", err)
+	}
+
+	// a file with a type that was never registered
+	test, _ = New("registered.db", PERSIST_MANUAL, []Type{{"dump.Stranger", &Stranger{}}})
+	test.Add(&Stranger{"data"})
+	test.Save()
+
+	data, _ := os.ReadFile("registered.db")
+	payload := bytes.Replace(data[headerSize:], []byte("dump.Stranger"), []byte("dump.Nobodyyy"), -1)
+	os.WriteFile("registered.db", encodeFile(header{version: formatVersion}, payload), 0644)
+
+	other, _ := New("registered.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}})
+	if err := other.Load(); !errors.Is(err, ErrNotRegistered) {
+		t.Fatal("expected ErrNotRegistered", err)
+	}
+}
+
+// Stranger is only registered by TestNotRegistered.
+type Stranger struct {
+	Data string
+}
+
+func TestPersistBatch(t *testing.T) {
+	defer os.Remove("batch.db")
+
+	types := []Type{{"dump.Blob", &Blob{}}}
+	if _, err := New("batch.db", PERSIST_BATCH(0), types); err != ErrInvalidPersist {
+		t.Fatal("accepted a batch of 0")
+	}
+
+	test, err := New("batch.db", PERSIST_BATCH(3), types)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Add(&Blob{"one"})
+	test.AddAll(&Blob{"two"}, &Blob{"three"})
+	if saves := test.Stats().Saves; saves != 0 {
+		t.Fatal("saved before the batch was full", saves)
+	}
+	test.Remove(0)
+	if saves := test.Stats().Saves; saves != 1 {
+		t.Fatal("didn't save the batch", saves)
+	}
+
+	// a manual save starts a new batch
+	test.Add(&Blob{"four"})
+	test.Save()
+	test.Add(&Blob{"five"})
+	test.Add(&Blob{"six"})
+	if saves := test.Stats().Saves; saves != 2 {
+		t.Fatal("bad number of saves", saves)
+	}
+
+	if err := test.Flush(); err != nil || test.Stats().Saves != 3 {
+		t.Fatal("didn't flush", err)
+	}
+	if test.Flush(); test.Stats().Saves != 3 {
+		t.Fatal("flushed without changes")
+	}
+
+	other, _ := New("batch.db", PERSIST_MANUAL, types)
+	if err := other.Load(); err != nil || other.Len() != 5 {
+		t.Fatal("bad items", err, other.Len())
+	}
+}
@@ -0,0 +1,359 @@
+// Package dumpctl implements a command-line tool for inspecting and
+// converting dump files.
+//
+// The items of a dump file can only be decoded if their types are registered,
+// so the commands decoding items (cat, stats, compact, split and merge) need
+// the types of the dump. The generic tool in cmd/dumpctl doesn't know any,
+// and reports the types it would need; a tool knowing the types of an
+// application is a few lines long:
+//
+//	func main() {
+//		dumpctl.Main(
+//			dump.Type{Name: "main.User", Value: User{}},
+//			dump.Type{Name: "main.Post", Value: Post{}},
+//		)
+//	}
+package dumpctl
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/karlmcguire/dump"
+)
+
+var (
+	// ErrUsage is thrown by Run() when the arguments are invalid, after
+	// writing the usage to the output.
+	ErrUsage = errors.New("invalid arguments")
+
+	// ErrExists is thrown by Run() when a file it would create already
+	// exists.
+	ErrExists = errors.New("file already exists")
+)
+
+const usage = `usage: dumpctl <command> [arguments]
+
+commands:
+  cat FILE               print the items as a JSON list
+  stats FILE             print the size, format and number of items by type
+  verify FILE...         check the checksums (and the types, if registered)
+  convert [-gzip] IN OUT rewrite IN as OUT, compressed with gzip or not
+  compact IN OUT         rewrite IN as OUT in the current format, keeping the
+                         items and their metadata only
+  split -n N FILE        spread the items across N shard files, the way
+                         dump.NewSharded() does
+  merge OUT FILE...      write the items of every FILE to OUT
+
+Files are read whether they are compressed with gzip or not, and files
+written by compact, split and merge are compressed like the first one read.
+Collections and revisions aren't copied.
+`
+
+// Main runs the tool with the arguments of the process, writing to standard
+// output, and exits with status 1 if it fails.
+func Main(types ...dump.Type) {
+	if err := Run(os.Args[1:], os.Stdout, types...); err != nil {
+		if err != ErrUsage {
+			fmt.Fprintln(os.Stderr, "dumpctl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// Run runs the command in args (without the name of the tool), writing its
+// output to w. The types are registered with the dumps it reads.
+func Run(args []string, w io.Writer, types ...dump.Type) error {
+	if len(args) == 0 {
+		fmt.Fprint(w, usage)
+		return ErrUsage
+	}
+
+	// dumps need at least one type, even to report the ones they lack
+	if len(types) == 0 {
+		types = []dump.Type{{Name: "dumpctl.none", Value: none{}}}
+	}
+	c := &ctl{w: w, types: types}
+
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(w)
+	gzip := flags.Bool("gzip", false, "compress the output with gzip (convert)")
+	shards := flags.Int("n", 0, "number of shards (split)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return ErrUsage
+	}
+	args = flags.Args()
+
+	switch command := flags.Name(); {
+	case command == "cat" && len(args) == 1:
+		return c.cat(args[0])
+	case command == "stats" && len(args) == 1:
+		return c.stats(args[0])
+	case command == "verify" && len(args) > 0:
+		return c.verify(args)
+	case command == "convert" && len(args) == 2:
+		return c.convert(args[0], args[1], *gzip)
+	case command == "compact" && len(args) == 2:
+		return c.compact(args[0], args[1])
+	case command == "split" && len(args) == 1 && *shards > 0:
+		return c.split(args[0], *shards)
+	case command == "merge" && len(args) > 1:
+		return c.merge(args[0], args[1:])
+	}
+
+	fmt.Fprint(w, usage)
+	return ErrUsage
+}
+
+// none is the type registered when no types are provided.
+type none struct{}
+
+type ctl struct {
+	w     io.Writer
+	types []dump.Type
+}
+
+// open loads the named dump file.
+func (c *ctl) open(filename string, options ...dump.Option) (*dump.Dump, error) {
+	options = append([]dump.Option{dump.WithCompression(dump.Gzip)}, options...)
+
+	d, err := dump.New(filename, dump.PERSIST_MANUAL, c.types, options...)
+	if err != nil {
+		return nil, err
+	}
+	return d, d.Load()
+}
+
+// create returns a new dump persisted to filename, compressed like the file
+// from.
+func (c *ctl) create(filename, from string) (*dump.Dump, error) {
+	if err := c.absent(filename); err != nil {
+		return nil, err
+	}
+
+	options, err := c.options(from)
+	if err != nil {
+		return nil, err
+	}
+	return dump.New(filename, dump.PERSIST_MANUAL, c.types, options...)
+}
+
+// options returns the options for writing files compressed like the named
+// file.
+func (c *ctl) options(filename string) ([]dump.Option, error) {
+	info, err := dump.Inspect(filename)
+	if err != nil || !info.Compressed {
+		return nil, err
+	}
+	return []dump.Option{dump.WithCompression(dump.Gzip)}, nil
+}
+
+// absent returns ErrExists if the named file exists.
+func (c *ctl) absent(filename string) error {
+	if _, err := os.Stat(filename); err == nil {
+		return fmt.Errorf("%s: %w", filename, ErrExists)
+	}
+	return nil
+}
+
+// items returns the items of the named dump file.
+func (c *ctl) items(filename string) ([]dump.Item, error) {
+	d, err := c.open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []dump.Item
+	return items, d.View(func(all []dump.Item) error {
+		items = all
+		return nil
+	})
+}
+
+func (c *ctl) cat(filename string) error {
+	d, err := c.open(filename)
+	if err != nil {
+		return err
+	}
+
+	if err = d.WriteJSONTo(c.w); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.w)
+	return err
+}
+
+func (c *ctl) stats(filename string) error {
+	info, err := dump.Inspect(filename)
+	if err != nil {
+		return err
+	}
+
+	format := fmt.Sprint(info.Version)
+	if info.Compressed {
+		format += " (gzip)"
+	}
+	fmt.Fprintf(c.w, "file:    %s\nsize:    %d bytes\nformat:  %s\n", filename, info.Size, format)
+
+	// the types that aren't registered are listed, and the others counted
+	d, err := c.open(filename)
+	var unknown *dump.UnknownTypeError
+	if errors.As(err, &unknown) {
+		d, err = c.open(filename, dump.WithSkipUnknown())
+	}
+	if err != nil {
+		return err
+	}
+
+	names := make(map[reflect.Type]string, len(c.types))
+	for _, t := range c.types {
+		names[reflect.TypeOf(t.Value)] = t.Name
+	}
+
+	counts := make(map[string]int)
+	d.View(func(items []dump.Item) error {
+		for _, item := range items {
+			name, ok := names[reflect.TypeOf(item)]
+			if !ok {
+				name = fmt.Sprintf("%T", item)
+			}
+			counts[name]++
+		}
+		return nil
+	})
+
+	fmt.Fprintf(c.w, "items:   %d\n", d.Len())
+	for _, name := range sortedKeys(counts) {
+		fmt.Fprintf(c.w, "  %s: %d\n", name, counts[name])
+	}
+	if unknown != nil {
+		fmt.Fprintf(c.w, "unknown: %d items of %v\n", d.Stats().Skipped, unknown.Types)
+	}
+	return nil
+}
+
+func (c *ctl) verify(filenames []string) error {
+	var failed bool
+	for _, filename := range filenames {
+		_, err := dump.Inspect(filename)
+		if err == nil && len(c.types) > 0 {
+			_, err = c.open(filename)
+		}
+
+		if err != nil {
+			failed = true
+			fmt.Fprintf(c.w, "%s: %v\n", filename, err)
+			continue
+		}
+		fmt.Fprintf(c.w, "%s: ok\n", filename)
+	}
+
+	if failed {
+		return dump.ErrCorrupt
+	}
+	return nil
+}
+
+func (c *ctl) convert(in, out string, gzip bool) error {
+	if err := c.absent(out); err != nil {
+		return err
+	}
+
+	var to dump.Compression
+	if gzip {
+		to = dump.Gzip
+	}
+	return dump.ConvertFile(in, out, dump.Gzip, to)
+}
+
+func (c *ctl) compact(in, out string) error {
+	data, err := ioutil.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	if err := c.absent(out); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(out, data, 0644); err != nil {
+		return err
+	}
+
+	// loading a copy keeps the metadata of the items
+	options, err := c.options(in)
+	if err != nil {
+		return err
+	}
+	d, err := dump.New(out, dump.PERSIST_MANUAL, c.types, options...)
+	if err == nil {
+		err = d.Load()
+	}
+	if err == nil {
+		err = d.Save()
+	}
+	if err != nil {
+		os.Remove(out)
+	}
+	return err
+}
+
+func (c *ctl) split(filename string, n int) error {
+	items, err := c.items(filename)
+	if err != nil {
+		return err
+	}
+
+	options, err := c.options(filename)
+	if err != nil {
+		return err
+	}
+
+	s, err := dump.NewSharded(filename, n, dump.PERSIST_MANUAL, c.types, options...)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if err := s.Shard(i).Load(); !os.IsNotExist(err) {
+			return fmt.Errorf("shard %d: %w", i, ErrExists)
+		}
+	}
+
+	for _, item := range items {
+		if _, err := s.Add(item); err != nil {
+			return err
+		}
+	}
+	return s.Save()
+}
+
+func (c *ctl) merge(out string, filenames []string) error {
+	merged, err := c.create(out, filenames[0])
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range filenames {
+		items, err := c.items(filename)
+		if err != nil {
+			return err
+		}
+		if _, err := merged.AddAll(items...); err != nil {
+			return err
+		}
+	}
+	return merged.Save()
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,105 @@
+package dumpctl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/karlmcguire/dump"
+)
+
+type User struct {
+	Name string `json:"name"`
+}
+
+var types = []dump.Type{{Name: "dumpctl.User", Value: &User{}}}
+
+func run(t *testing.T, args string, types ...dump.Type) (string, error) {
+	var out bytes.Buffer
+	err := Run(strings.Fields(args), &out, types...)
+	return out.String(), err
+}
+
+func TestRun(t *testing.T) {
+	files := []string{"users.db", "unknown.db", "users.gz.db", "compact.db", "merged.db", "users.0.db", "users.1.db"}
+	for _, name := range files {
+		defer os.Remove(name)
+	}
+
+	d, _ := dump.New("users.db", dump.PERSIST_MANUAL, types)
+	d.AddAll(&User{"karl"}, &User{"carl"}, &User{"kyle"})
+	d.Save()
+
+	if out, err := run(t, "cat users.db", types...); err != nil ||
+		out != `[{"name":"karl"},{"name":"carl"},{"name":"kyle"}]`+"\n" {
+		t.Fatal("bad cat", out, err)
+	}
+
+	// gob knows every type registered in the process, so the type of the
+	// items is renamed for them to be unknown
+	data, _ := os.ReadFile("users.db")
+	data = bytes.Replace(data, []byte("dumpctl.User"), []byte("dumpctl.Uxer"), -1)
+	binary.BigEndian.PutUint32(data[14:], crc32.Checksum(data[18:], crc32.MakeTable(crc32.Castagnoli)))
+	os.WriteFile("unknown.db", data, 0644)
+
+	if _, err := run(t, "cat unknown.db", types...); !errors.Is(err, dump.ErrUnknownType) {
+		t.Fatal("expected ErrUnknownType", err)
+	}
+
+	out, err := run(t, "stats unknown.db")
+	if err != nil || !strings.Contains(out, "items:   0") ||
+		!strings.Contains(out, "unknown: 3 items of [dumpctl.Uxer]") {
+		t.Fatal("bad stats", out, err)
+	}
+	if out, _ = run(t, "stats users.db", types...); !strings.Contains(out, "dumpctl.User: 3") {
+		t.Fatal("bad stats", out)
+	}
+
+	if _, err = run(t, "convert -gzip users.db users.gz.db"); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ = run(t, "stats users.gz.db", types...); !strings.Contains(out, "format:  2 (gzip)") {
+		t.Fatal("bad convert", out)
+	}
+
+	if out, err = run(t, "verify users.db users.gz.db", types...); err != nil || strings.Count(out, ": ok") != 2 {
+		t.Fatal("bad verify", out, err)
+	}
+
+	if _, err = run(t, "compact users.gz.db compact.db", types...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = run(t, "compact users.gz.db compact.db", types...); !errors.Is(err, ErrExists) {
+		t.Fatal("expected ErrExists", err)
+	}
+
+	if _, err = run(t, "split -n 2 users.db", types...); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ = run(t, "cat users.1.db", types...); out != `[{"name":"carl"}]`+"\n" {
+		t.Fatal("bad split", out)
+	}
+
+	if _, err = run(t, "merge merged.db users.0.db users.1.db compact.db", types...); err != nil {
+		t.Fatal(err)
+	}
+	merged, _ := dump.New("merged.db", dump.PERSIST_MANUAL, types)
+	if merged.Load(); merged.Len() != 6 {
+		t.Fatal("bad merge", merged.Len())
+	}
+
+	if out, err = run(t, "split users.db"); err != ErrUsage || !strings.HasPrefix(out, "usage:") {
+		t.Fatal("expected usage", err)
+	}
+
+	data, _ = os.ReadFile("users.db")
+	data[len(data)-1]++
+	os.WriteFile("users.db", data, 0644)
+	if out, err = run(t, "verify users.db"); err != dump.ErrCorrupt || !strings.Contains(out, "corrupt") {
+		t.Fatal("expected corrupt file", out, err)
+	}
+}
@@ -0,0 +1,106 @@
+// Package dumptest provides an in-memory dump.Storer for testing code that
+// uses dumps.
+package dumptest
+
+import (
+	"sync"
+
+	"github.com/karlmcguire/dump"
+)
+
+// Fake is a dump.Storer keeping its items in memory. Save() and Load() don't
+// touch the disk; they only count calls and return SaveErr and LoadErr.
+//
+// Unlike a Dump, Update() and Map() don't copy the items, so changes made to
+// them in place are kept even if f returns an error.
+type Fake struct {
+	// SaveErr and LoadErr are returned by Save() and Load().
+	SaveErr error
+	LoadErr error
+
+	// Saves and Loads count the calls to Save() and Load().
+	Saves int
+	Loads int
+
+	items []dump.Item
+	mutex sync.RWMutex
+}
+
+var _ dump.Storer = (*Fake)(nil)
+
+// New returns a Fake holding items.
+func New(items ...dump.Item) *Fake {
+	return &Fake{items: append([]dump.Item{}, items...)}
+}
+
+// Add appends item and returns its id.
+func (f *Fake) Add(item dump.Item) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.items = append(f.items, item)
+	return len(f.items) - 1, nil
+}
+
+// View calls fn with the items.
+func (f *Fake) View(fn func(items []dump.Item) error) error {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	return fn(f.items)
+}
+
+// Update calls fn with a copy of the list of items, which replaces the items
+// if fn returns nil.
+func (f *Fake) Update(fn func(items []dump.Item) error) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	items := append([]dump.Item{}, f.items...)
+	if err := fn(items); err != nil {
+		return err
+	}
+
+	f.items = items
+	return nil
+}
+
+// Map calls fn with each item, stopping at the first error.
+func (f *Fake) Map(fn func(item dump.Item) error) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, item := range f.items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save counts the call and returns SaveErr.
+func (f *Fake) Save() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.Saves++
+	return f.SaveErr
+}
+
+// Load counts the call and returns LoadErr.
+func (f *Fake) Load() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.Loads++
+	return f.LoadErr
+}
+
+// Items returns a copy of the list of items, for checking what the code under
+// test did.
+func (f *Fake) Items() []dump.Item {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	return append([]dump.Item{}, f.items...)
+}
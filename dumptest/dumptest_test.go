@@ -0,0 +1,70 @@
+package dumptest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/karlmcguire/dump"
+)
+
+type User struct {
+	Name string
+}
+
+// rename is the kind of code that takes a dump.Storer.
+func rename(s dump.Storer, from, to string) error {
+	err := s.Map(func(item dump.Item) error {
+		if user := item.(*User); user.Name == from {
+			user.Name = to
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.Save()
+}
+
+func TestFake(t *testing.T) {
+	fake := New(&User{"karl"})
+
+	if id, err := fake.Add(&User{"other"}); id != 1 || err != nil {
+		t.Fatal("bad add", id, err)
+	}
+
+	if err := rename(fake, "karl", "carl"); err != nil {
+		t.Fatal(err)
+	}
+	if items := fake.Items(); items[0].(*User).Name != "carl" || fake.Saves != 1 {
+		t.Fatal("bad rename")
+	}
+
+	fake.SaveErr = errors.New("disk full")
+	if err := rename(fake, "carl", "karl"); err != fake.SaveErr {
+		t.Fatal("expected SaveErr")
+	}
+
+	failed := errors.New("failed")
+	err := fake.Update(func(items []dump.Item) error {
+		items[0] = &User{"replaced"}
+		return failed
+	})
+	if err != failed || fake.Items()[0].(*User).Name == "replaced" {
+		t.Fatal("bad failed update")
+	}
+
+	fake.Update(func(items []dump.Item) error {
+		items[0] = &User{"replaced"}
+		return nil
+	})
+	fake.View(func(items []dump.Item) error {
+		if len(items) != 2 || items[0].(*User).Name != "replaced" {
+			t.Fatal("bad update")
+		}
+		return nil
+	})
+
+	if fake.Load(); fake.Loads != 1 {
+		t.Fatal("bad load count")
+	}
+}
@@ -0,0 +1,73 @@
+package dump
+
+// WithEmergencyFile is an option that saves the dump to filename in s (or
+// on the local file system if s is nil) whenever writing the dump file
+// fails, such as when its disk is full or its directory became read-only, so
+// the items aren't only in memory until the dump file can be written again.
+// The emergency file is a whole dump file (without segments or chunks),
+// which a dump created with the same types loads like any other.
+//
+// A save written to the emergency file succeeds. failed is called with the
+// error writing the dump file each time it happens, and
+// Stats().EmergencySaves counts them; it is called while the dump is
+// locked, so it mustn't use the dump. The next saves keep trying the dump
+// file first, and the emergency file is left as it is once they succeed
+// again.
+//
+// It returns ErrInvalidEmergencyFile if filename is empty or the filename
+// of the dump, and it can't be combined with WithRecordStore() or
+// WithCommandLog().
+func WithEmergencyFile(filename string, s Storage, failed func(err error)) Option {
+	return func(d *Dump) error {
+		if filename == "" || filename == d.filename {
+			return ErrInvalidEmergencyFile
+		}
+
+		e := &emergency{filename: filename, storage: fileStorage{}, failed: failed}
+		if s != nil {
+			e.storage = pathStorage{s}
+		}
+		d.emergency = e
+		return nil
+	}
+}
+
+// emergency holds the settings of WithEmergencyFile().
+type emergency struct {
+	filename string
+	storage  Storage
+	failed   func(err error)
+}
+
+// writeEmergency writes the dump to the emergency file after writing the dump
+// file failed with cause, and returns the size of the uncompressed payload
+// and of the file. It returns cause if the emergency file can't be written
+// either.
+//
+// no mutex
+func (d *Dump) writeEmergency(cause error) (int, int, error) {
+	buffer, memory, err := d.encode(nil)
+	if err != nil {
+		return 0, 0, cause
+	}
+	defer putBuffer(buffer)
+
+	tmp := d.emergency.filename + ".tmp"
+	if err := d.emergency.storage.Write(tmp, buffer.Bytes()); err != nil {
+		return 0, 0, cause
+	}
+	if err := d.emergency.storage.Rename(tmp, d.emergency.filename); err != nil {
+		return 0, 0, cause
+	}
+
+	d.afterWrite(d.emergency.filename, buffer.Bytes())
+
+	d.statsMutex.Lock()
+	d.stats.EmergencySaves++
+	d.statsMutex.Unlock()
+
+	if d.emergency.failed != nil {
+		d.emergency.failed(cause)
+	}
+	return memory, buffer.Len(), nil
+}
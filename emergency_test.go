@@ -0,0 +1,46 @@
+package dump
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEmergencyFile(t *testing.T) {
+	defer os.Remove("emergency.db")
+
+	types := []Type{{"dump.Blob", &Blob{}}}
+	if _, err := New("storage.db", PERSIST_MANUAL, types, WithEmergencyFile("storage.db", nil, nil)); err != ErrInvalidEmergencyFile {
+		t.Fatal("accepted the dump file")
+	}
+
+	var failures []error
+	test, _ := New("storage.db", PERSIST_WRITES, types,
+		WithStorage(&failingStorage{memoryStorage{files: make(map[string][]byte)}}),
+		WithEmergencyFile("emergency.db", nil, func(err error) {
+			failures = append(failures, err)
+		}))
+
+	if _, err := test.Add(&Blob{"one"}); err != nil {
+		t.Fatal("the emergency file wasn't written", err)
+	}
+	if len(failures) != 1 || failures[0] == nil {
+		t.Fatal("failed wasn't called", failures)
+	}
+	if s := test.Stats(); s.EmergencySaves != 1 || s.SaveErrors != 0 {
+		t.Fatal("bad stats", s)
+	}
+
+	other, _ := New("emergency.db", PERSIST_MANUAL, types)
+	if err := other.Load(); err != nil || other.Len() != 1 {
+		t.Fatal("didn't load the emergency file", err)
+	}
+
+	// the error is returned if the emergency file can't be written either
+	failing, _ := New("storage.db", PERSIST_MANUAL, types,
+		WithStorage(&failingStorage{memoryStorage{files: make(map[string][]byte)}}),
+		WithEmergencyFile("emergency.db", &failingStorage{memoryStorage{files: make(map[string][]byte)}}, nil))
+	failing.Add(&Blob{"two"})
+	if err := failing.Save(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,87 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// WithJSONEnvelope is an option that wraps the JSON list written by
+// MarshalJSON() and WriteJSONTo() in an object, for clients that can't
+// handle a list at the top level:
+//
+//	{"count":2,"generated_at":"2006-01-02T15:04:05Z","items":[...]}
+//
+// If envelope isn't nil, the object is the one it returns for the number of
+// items instead (such as a struct or a map, which must marshal to a JSON
+// object), followed by the "items" key. The items are still written one at
+// a time. LoadJSON() and UnmarshalJSON() then expect an object too, and
+// read the items from its "items" key.
+func WithJSONEnvelope(envelope func(count int) interface{}) Option {
+	return func(d *Dump) error {
+		if envelope == nil {
+			envelope = defaultEnvelope
+		}
+		d.envelope = envelope
+		return nil
+	}
+}
+
+// defaultEnvelope returns the envelope used by WithJSONEnvelope() when it
+// isn't passed one.
+func defaultEnvelope(count int) interface{} {
+	return struct {
+		Count       int       `json:"count"`
+		GeneratedAt time.Time `json:"generated_at"`
+	}{count, time.Now().UTC()}
+}
+
+// openEnvelope writes the envelope of a JSON list of count items to w, up to
+// the "items" key.
+func (d *Dump) openEnvelope(w io.Writer, count int) error {
+	data, err := json.Marshal(d.envelope(count))
+	if err != nil {
+		return err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[0] != '{' || data[len(data)-1] != '}' {
+		return ErrInvalidEnvelope
+	}
+
+	data = data[:len(data)-1]
+	if len(data) > 1 {
+		data = append(data, ',')
+	}
+	_, err = w.Write(append(data, `"items":`...))
+	return err
+}
+
+// skipToItems reads the envelope of a JSON list from decoder up to the value
+// of its "items" key.
+func skipToItems(decoder *json.Decoder) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != json.Delim('{') {
+		return ErrNotList
+	}
+
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if key == "items" {
+			return nil
+		}
+
+		var skipped json.RawMessage
+		if err := decoder.Decode(&skipped); err != nil {
+			return err
+		}
+	}
+	return ErrNotList
+}
@@ -0,0 +1,59 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONEnvelope(t *testing.T) {
+	types := []Type{{"dump.Plain", &Plain{}}}
+	test, _ := New("test.db", PERSIST_MANUAL, types, WithJSONEnvelope(nil))
+	test.AddAll(&Plain{"a"}, &Plain{"b"})
+
+	data, err := test.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope struct {
+		Count       int               `json:"count"`
+		GeneratedAt string            `json:"generated_at"`
+		Items       []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Count != 2 ||
+		envelope.GeneratedAt == "" || len(envelope.Items) != 2 {
+		t.Fatal("bad envelope", string(data), err)
+	}
+
+	factory := func() Item { return &Plain{} }
+	other, _ := New("test.db", PERSIST_MANUAL, types, WithJSONEnvelope(nil))
+	if err := other.LoadJSON(bytes.NewReader(data), factory); err != nil || other.Len() != 2 {
+		t.Fatal("didn't load the envelope", err)
+	}
+	if err := other.LoadJSON(bytes.NewReader([]byte(`[]`)), factory); err != ErrNotList {
+		t.Fatal("expected ErrNotList", err)
+	}
+
+	custom, _ := New("test.db", PERSIST_MANUAL, types, WithJSONEnvelope(func(count int) interface{} {
+		return map[string]int{"total": count}
+	}))
+	custom.Add(&Plain{"a"})
+	var buffer bytes.Buffer
+	if err := custom.WriteJSONTo(&buffer); err != nil || buffer.String() != `{"total":1,"items":[{"name":"a"}]}` {
+		t.Fatal("bad envelope", buffer.String(), err)
+	}
+
+	empty, _ := New("test.db", PERSIST_MANUAL, types, WithJSONEnvelope(func(count int) interface{} {
+		return struct{}{}
+	}))
+	if data, _ := empty.MarshalJSON(); string(data) != `{"items":[]}` {
+		t.Fatal("bad envelope", string(data))
+	}
+
+	list, _ := New("test.db", PERSIST_MANUAL, types, WithJSONEnvelope(func(count int) interface{} {
+		return []int{count}
+	}))
+	if _, err := list.MarshalJSON(); err != ErrInvalidEnvelope {
+		t.Fatal("expected ErrInvalidEnvelope", err)
+	}
+}
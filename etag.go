@@ -0,0 +1,47 @@
+package dump
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ETag returns an entity tag for the current state of the dump, which changes
+// every time an item is added, changed or removed and whenever the dump is
+// loaded. It is quoted so it can be used as the value of an ETag header, and
+// it includes a token unique to the dump so it also changes across restarts.
+func (d *Dump) ETag() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return `"` + d.instance + "-" + strconv.FormatUint(d.generation, 36) + `"`
+}
+
+// generated is called after the items changed, so the dump gets a new ETag.
+//
+// no mutex
+func (d *Dump) generated() {
+	d.generation++
+}
+
+// notModified sets the ETag header of the response and responds with 304 Not
+// Modified if the request's If-None-Match header matches etag, in which case
+// it returns true.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	match := r.Header.Get("If-None-Match")
+	if match == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(match, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,88 @@
+package dump
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+
+	seen := make(map[string]bool)
+	expectNew := func(what string) {
+		etag := test.ETag()
+		if seen[etag] {
+			t.Fatal("etag didn't change after", what)
+		}
+		seen[etag] = true
+	}
+
+	expectNew("creating")
+
+	test.Add(&Blob{"a"})
+	expectNew("add")
+
+	test.Set(0, &Blob{"b"})
+	expectNew("set")
+
+	test.Update(func(items []Item) error {
+		items[0].(*Blob).Data = "c"
+		return nil
+	})
+	expectNew("update")
+
+	test.Load()
+	expectNew("load")
+
+	test.Remove(0)
+	expectNew("remove")
+
+	if etag := test.ETag(); etag != test.ETag() {
+		t.Fatal("etag changed without changes")
+	}
+
+	other, _ := NewDump("test.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+	if seen[other.ETag()] {
+		t.Fatal("etag isn't unique to the dump")
+	}
+}
+
+func TestHandlerETag(t *testing.T) {
+	test, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}},
+		WithFactory(func() Item { return &Plain{} }))
+	test.Add(&Plain{"a"})
+
+	handler := Handler(test, HandlerOptions{})
+
+	get := func(path, match string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		if match != "" {
+			r.Header.Set("If-None-Match", match)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	etag := get("/", "").Header().Get("ETag")
+	if etag != test.ETag() {
+		t.Fatal("bad etag header", etag)
+	}
+
+	for _, match := range []string{etag, `"other", W/` + etag, "*"} {
+		if response := get("/", match); response.Code != http.StatusNotModified ||
+			response.Body.Len() != 0 {
+			t.Fatal("expected 304 for", match)
+		}
+	}
+
+	if get("/0", etag).Code != http.StatusNotModified {
+		t.Fatal("expected 304 for item")
+	}
+
+	test.Add(&Plain{"b"})
+	if get("/", etag).Code != http.StatusOK {
+		t.Fatal("served 304 after a change")
+	}
+}
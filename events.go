@@ -0,0 +1,219 @@
+package dump
+
+import (
+	"os"
+)
+
+// events records the commands applied to a dump created with
+// WithCommandLog() until they are appended to the log. Commands are encoded
+// as they are recorded, so later changes to the items don't change them.
+type events struct {
+	log     *CommandLog
+	pending [][]byte
+
+	// err is the error encoding a recorded command, after which the log
+	// can't follow the dump until the next snapshot
+	err error
+
+	// seq is the number of the last command included in the snapshot of the
+	// dump (its dump file)
+	seq uint64
+}
+
+// WithCommandLog is an option that makes l the source of truth of the dump:
+// every change to the dump is recorded as a Command, and the items in memory
+// are only a projection of the log. Saving the dump (as configured by its
+// persist mode) appends the recorded commands to the log instead of writing
+// the dump file, and loading the dump replays the log on top of the last
+// snapshot taken with Snapshot().
+//
+// Replaying the commands gives the items new metadata (ids, versions,
+// timestamps and expiry), like loading them with LoadJSON() does. It can't be
+// combined with WithRecordStore() or WithCollection().
+func WithCommandLog(l *CommandLog) Option {
+	return func(d *Dump) error {
+		if l == nil {
+			return ErrInvalidCommandLog
+		}
+		d.events = &events{log: l}
+		return nil
+	}
+}
+
+// Snapshot writes the items to the dump file and truncates the command log,
+// so loading the dump only has to replay the commands that follow. It
+// returns ErrInvalidCommandLog if the dump wasn't created with
+// WithCommandLog().
+func (d *Dump) Snapshot() error {
+	if d.events == nil {
+		return ErrInvalidCommandLog
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// a command that couldn't be recorded is included in the snapshot
+	if d.events.err == nil {
+		if err := d.appendCommands(); err != nil {
+			return err
+		}
+	}
+
+	seq := d.events.seq
+	d.events.seq = d.events.log.Seq()
+
+	memory, disk, err := d.write()
+	d.saved(memory, disk, err)
+	if err != nil {
+		d.events.seq = seq
+		return err
+	}
+
+	d.events.pending, d.events.err = nil, nil
+	return d.events.log.truncate()
+}
+
+// Replay replaces the items with the ones of the last snapshot, and applies
+// the logged commands up to the one numbered until (or every command if
+// until is 0), which is useful for looking at the dump as it was at some
+// point. Commands that weren't saved yet are dropped. It returns
+// ErrInvalidCommandLog if the dump wasn't created with WithCommandLog(), and
+// ErrSnapshotted if the command numbered until is part of the snapshot.
+//
+// Like Load(), Replay() doesn't save the dump, and the replayed items aren't
+// logged again.
+func (d *Dump) Replay(until uint64) error {
+	if d.events == nil {
+		return ErrInvalidCommandLog
+	}
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer d.mutex.Unlock()
+
+	if until != 0 && until < d.events.seq {
+		return ErrSnapshotted
+	}
+
+	if err := d.replay(until); err != nil {
+		return err
+	}
+
+	d.generated()
+	d.afterReset()
+	d.events.pending, d.events.err = nil, nil
+
+	return d.onLoad()
+}
+
+// replay loads the last snapshot and applies the logged commands up to the
+// one numbered until (every command if it's 0).
+//
+// no mutex
+func (d *Dump) replay(until uint64) error {
+	if err := d.loadFile(d.filename); os.IsNotExist(err) {
+		d.items, d.meta, d.events.seq = make([]Item, 0), nil, 0
+		d.reset()
+	} else if err != nil {
+		return err
+	}
+
+	if until != 0 && until < d.events.seq {
+		return ErrSnapshotted
+	}
+
+	err := d.events.log.Read(d.events.seq, func(seq uint64, c Command) error {
+		if until != 0 && seq > until {
+			return nil
+		}
+		items := append([]Item{c.Item}, c.Items...)
+		if err := d.decodeItems(items); err != nil {
+			return err
+		}
+		c.Item, c.Items = items[0], items[1:]
+		return d.applyCommand(c)
+	})
+	if err != nil {
+		return err
+	}
+
+	d.loadedFrom = d.filename
+	d.changed()
+	return nil
+}
+
+// applyCommand applies a replayed command to the items, without the side
+// effects of the methods it was recorded by (hooks, eviction and so on,
+// whose effects were recorded too).
+//
+// no mutex
+func (d *Dump) applyCommand(c Command) error {
+	switch c.Kind {
+	case CommandAdd:
+		d.items = append(d.items, c.Item)
+		d.assign(len(d.items) - 1)
+	case CommandSet, CommandRemove:
+		if c.ID < 0 || c.ID >= len(d.items) {
+			return ErrCorrupt
+		}
+		if c.Kind == CommandSet {
+			d.items[c.ID] = c.Item
+			d.bump(c.ID)
+			break
+		}
+		d.items = append(d.items[:c.ID], d.items[c.ID+1:]...)
+		d.meta = append(d.meta[:c.ID], d.meta[c.ID+1:]...)
+	case CommandClear, CommandReplace:
+		d.items, d.meta = append(make([]Item, 0), c.Items...), nil
+		d.assign(0)
+	default:
+		return ErrInvalidCommand
+	}
+	return nil
+}
+
+// record records a command to be appended to the log.
+//
+// no mutex
+func (d *Dump) record(c Command) {
+	if d.events == nil || d.events.err != nil {
+		return
+	}
+
+	items, err := d.encodeItems(append([]Item{c.Item}, c.Items...))
+	if err != nil {
+		d.events.err = err
+		return
+	}
+	c.Item, c.Items = items[0], items[1:]
+
+	data, err := encodeCommand(c)
+	if err != nil {
+		d.events.err = err
+		return
+	}
+	d.events.pending = append(d.events.pending, data)
+}
+
+// appendCommands appends the recorded commands to the log. They are kept if
+// that fails, so they can be appended by the next save. It returns the error
+// encoding a command if one couldn't be recorded.
+//
+// no mutex
+func (d *Dump) appendCommands() error {
+	if d.events.err != nil {
+		d.saved(0, 0, d.events.err)
+		return d.events.err
+	}
+
+	// the stats report the size of the log as the size of the dump
+	size, err := d.events.log.append(d.events.pending)
+	d.saved(size, size, err)
+	if err != nil {
+		return err
+	}
+
+	d.events.pending = nil
+	return nil
+}
@@ -0,0 +1,77 @@
+package dump
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCommandLogMode(t *testing.T) {
+	defer os.Remove("events.db")
+	defer os.Remove("events.log")
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	log, _ := OpenCommandLog("events.log")
+	if _, err := New("events.db", PERSIST_WRITES, types, WithCommandLog(nil)); err != ErrInvalidCommandLog {
+		t.Fatal("accepted a nil log")
+	}
+
+	test, _ := New("events.db", PERSIST_WRITES, types, WithCommandLog(log))
+
+	test.AddAll(&Plain{"c"}, &Plain{"a"}, &Plain{"x"}, &Plain{"b"})
+	test.Set(2, &Plain{"d"})
+	test.DeleteWhere(func(item Item) bool { return item.(*Plain).Name == "a" })
+	test.Sort(func(a, b Item) bool { return a.(*Plain).Name < b.(*Plain).Name })
+
+	if _, err := os.Stat("events.db"); !os.IsNotExist(err) {
+		t.Fatal("wrote the dump file")
+	}
+
+	// appending the commands counts as saving the dump
+	if stats := test.Stats(); stats.Saves == 0 || stats.DiskSize == 0 || test.unsaved != 0 {
+		t.Fatal("didn't record the saves", stats, test.unsaved)
+	}
+
+	names := func(d *Dump) string {
+		var names []string
+		d.View(func(items []Item) error {
+			for _, item := range items {
+				names = append(names, item.(*Plain).Name)
+			}
+			return nil
+		})
+		return strings.Join(names, ",")
+	}
+
+	other, _ := New("events.db", PERSIST_WRITES, types, WithCommandLog(log))
+	if err := other.Load(); err != nil || names(other) != "b,c,d" {
+		t.Fatal("bad replay", err, names(other))
+	}
+
+	// after the adds and the set, before the delete
+	if err := other.Replay(5); err != nil || names(other) != "c,a,d,b" {
+		t.Fatal("bad partial replay", err, names(other))
+	}
+
+	if err := test.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	test.Remove(0)
+
+	if err := other.Load(); err != nil || names(other) != "c,d" {
+		t.Fatal("bad replay after snapshot", err, names(other))
+	}
+
+	if err := other.Replay(5); err != ErrSnapshotted {
+		t.Fatal("replayed snapshotted commands", err)
+	}
+
+	if err := test.Replay(0); err != nil || names(test) != "c,d" {
+		t.Fatal("bad replay of the same dump", err)
+	}
+
+	if _, err := NewTxn(test); err != ErrInvalidTxn {
+		t.Fatal("accepted a dump with a command log")
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,16 +11,17 @@ import (
 
 func index(d *dump.Dump) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var (
-			data []byte
-			err  error
-		)
+		etag := d.ETag()
+		w.Header().Set("ETag", etag)
 
-		if data, err = d.MarshalJSON(); err != nil {
-			panic(err)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
 		}
 
-		w.Write(data)
+		if err := d.WriteJSONTo(w); err != nil {
+			panic(err)
+		}
 	}
 }
 
@@ -48,11 +48,9 @@ func add(d *dump.Dump) http.HandlerFunc {
 func get(d *dump.Dump) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var (
-			bigId   int64
-			id      int
-			p       *Post
-			postOut []byte
-			err     error
+			bigId int64
+			id    int
+			err   error
 		)
 
 		if bigId, err = strconv.ParseInt(
@@ -65,21 +63,12 @@ func get(d *dump.Dump) http.HandlerFunc {
 
 		id = int(bigId)
 
-		if err = d.View(func(items []dump.Item) error {
-			if id > len(items) {
-				return errors.New("woooops")
-			}
-			p = items[id].(*Post)
-			return nil
-		}); err != nil {
-			panic(err)
+		// the post is marshaled under the read lock, so it can't change
+		// while it's being rendered
+		if err = d.WriteItemJSONTo(id, w); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
 		}
-
-		if postOut, err = p.MarshalJSON(); err != nil {
-			panic(err)
-		}
-
-		w.Write(postOut)
 	}
 }
 
@@ -89,10 +78,10 @@ func main() {
 		err error
 	)
 
-	if d, err = dump.NewDump(
+	if d, err = dump.New(
 		"posts.db",
 		dump.PERSIST_WRITES,
-		dump.Type{"main.Post", &Post{}},
+		[]dump.Type{{Name: "main.Post", Value: &Post{}}},
 	); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,151 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// The on-disk format of a dump is a fixed size header followed by the
+// payload:
+//
+//	magic    [4]byte "DUMP"
+//	version  uint8   format version
+//	flags    uint8   flagCompressed, ...
+//	length   uint64  length of the payload in bytes
+//	checksum uint32  CRC-32 (Castagnoli) of the payload
+//
+// The payload is compressed if flagCompressed is set, and its items are
+// protobuf messages if flagProtobuf is set (see WithProtobuf()). If
+// flagSigned is set, the payload is followed by an HMAC-SHA256 of the header
+// and the payload (see WithSigning()).
+//
+// Since version 2 the payload is a gob stream of a file struct (without its
+// items) followed by each of its items as a separate gob message, so items
+// can be decoded one at a time while the file is read. In version 1 it was a
+// single gob encoded file struct. Files written before the header existed
+// are a bare gob encoded []Item and are still recognized by the lack of magic
+// bytes.
+const (
+	formatVersion = 2
+	headerSize    = 4 + 1 + 1 + 8 + 4
+
+	flagCompressed = 1 << 0
+	flagProtobuf   = 1 << 1
+	flagSigned     = 1 << 2
+)
+
+var (
+	magic = []byte("DUMP")
+	crc   = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// file is the gob encoded payload of a dump file. New fields can be added
+// freely as gob ignores fields it doesn't know about when decoding. Count is
+// the number of items following the file struct in version 2 files.
+type file struct {
+	Schema     int
+	Items      []Item
+	Count      int
+	Meta       []meta
+	NextID     uint64
+	Clock      uint64
+	Tombstones []crdtKey
+
+	// Revisions and Deleted are the history of the items (see
+	// WithRevisions()).
+	Revisions map[uint64][]revision
+	Deleted   map[uint64]int64
+
+	// Segmented describes the segment files holding the items when
+	// WithSegments() is enabled, in which case Items is empty.
+	Segmented *segmented
+
+	// Seq is the number of the last logged command included in the file (see
+	// WithCommandLog()).
+	Seq uint64
+
+	// Collections holds the collections of the dump (see Collection()),
+	// which don't have collections of their own.
+	Collections map[string]file
+
+	// skipped is the number of items of unknown types skipped when decoding
+	// the file (see WithSkipUnknown()); gob ignores unexported fields
+	skipped int
+}
+
+// header holds the decoded fields of a dump file header.
+type header struct {
+	version byte
+	flags   byte
+}
+
+func encodeFile(h header, payload []byte) []byte {
+	data := make([]byte, headerSize, headerSize+len(payload))
+	data = append(data, payload...)
+	putHeader(h, data)
+	return data
+}
+
+// putHeader writes the header of data, which is the payload preceded by
+// headerSize bytes of room for the header.
+func putHeader(h header, data []byte) {
+	payload := data[headerSize:]
+	writeHeader(h, data, uint64(len(payload)), crc32.Checksum(payload, crc))
+}
+
+// writeHeader writes the header of a payload of length bytes with the
+// checksum sum to the first headerSize bytes of data.
+func writeHeader(h header, data []byte, length uint64, sum uint32) {
+	copy(data, magic)
+	data[4] = h.version
+	data[5] = h.flags
+	binary.BigEndian.PutUint64(data[6:], length)
+	binary.BigEndian.PutUint32(data[14:], sum)
+}
+
+// decodeFile verifies the header and checksum of data and returns the
+// payload (without the signature, which is verified by Dump.verify()). The
+// legacy return value is true if data doesn't have a header, in which case
+// the payload is all of data.
+func decodeFile(data []byte) (h header, payload []byte, legacy bool, err error) {
+	if !bytes.HasPrefix(data, magic) {
+		return h, data, true, nil
+	}
+
+	h, length, sum, err := parseHeader(data)
+	if err != nil {
+		return h, nil, false, err
+	}
+
+	payload = data[headerSize:]
+	if h.flags&flagSigned != 0 {
+		if len(payload) < signatureSize {
+			return h, nil, false, ErrCorrupt
+		}
+		payload = payload[:len(payload)-signatureSize]
+	}
+
+	if uint64(len(payload)) != length || crc32.Checksum(payload, crc) != sum {
+		return h, nil, false, ErrCorrupt
+	}
+
+	return h, payload, false, nil
+}
+
+// parseHeader returns the header of data, which starts with the magic bytes,
+// along with the length and checksum of the payload.
+func parseHeader(data []byte) (h header, length uint64, sum uint32, err error) {
+	if len(data) < headerSize {
+		return h, 0, 0, ErrCorrupt
+	}
+
+	h.version = data[4]
+	h.flags = data[5]
+
+	if h.version == 0 || h.version > formatVersion {
+		return h, 0, 0, ErrUnsupportedFormat
+	}
+
+	return h, binary.BigEndian.Uint64(data[6:]), binary.BigEndian.Uint32(data[14:]), nil
+}
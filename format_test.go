@@ -0,0 +1,110 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	test, err := NewDump("format.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = test.Add(&Blob{"checked"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile("format.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(data, magic) || data[4] != formatVersion {
+		t.Fatal("missing header")
+	}
+
+	load := func(data []byte) error {
+		if err := ioutil.WriteFile("format.db", data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		other, _ := NewDump("format.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+		return other.Load()
+	}
+
+	if err = load(data); err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte{}, data...)
+	flipped[len(flipped)-1] ^= 0xff
+	if err = load(flipped); err != ErrCorrupt {
+		t.Fatal("didn't detect flipped byte")
+	}
+
+	if err = load(data[:len(data)-3]); err != ErrCorrupt {
+		t.Fatal("didn't detect truncated payload")
+	}
+
+	if err = load(data[:headerSize-1]); err != ErrCorrupt {
+		t.Fatal("didn't detect truncated header")
+	}
+
+	future := append([]byte{}, data...)
+	future[4] = formatVersion + 1
+	if err = load(future); err != ErrUnsupportedFormat {
+		t.Fatal("loaded unknown format version")
+	}
+
+	compressed := append([]byte{}, data...)
+	compressed[5] |= flagCompressed
+	if err = load(compressed); err != ErrCompressed {
+		t.Fatal("loaded compressed file without compression")
+	}
+}
+
+func TestFormatLegacy(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode([]Item{&Blob{"legacy"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile("legacy.db", buffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	test, _ := NewDump("legacy.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	if err := test.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := test.View(func(items []Item) error {
+		if len(items) != 1 || items[0].(*Blob).Data != "legacy" {
+			t.Fatal("legacy load error")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	compressed, _ := Gzip.Compress(buffer.Bytes())
+	if err := ioutil.WriteFile("legacy.db", compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := New("legacy.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithCompression(Gzip))
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile("legacy.db", []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := other.Load(); err == nil {
+		t.Fatal("decompressed garbage")
+	}
+}
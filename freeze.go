@@ -0,0 +1,105 @@
+package dump
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Frozen is a read-only view of the items of a dump at the time Freeze() was
+// called. It is read without locking the dump, so slow reads (such as
+// streaming every item to a client) don't block writes.
+type Frozen struct {
+	dump  *Dump
+	items []Item
+	meta  []meta
+	once  sync.Once
+}
+
+// Freeze returns a view of the items as they are now. Only the list of items
+// is copied, so freezing is cheap; until the view is released with Release(),
+// items changed in place (by UpdateAt(), UpdateWhere() and so on) are copied
+// first, so the items of the view never change.
+//
+// The items of the view must not be modified.
+func (d *Dump) Freeze() *Frozen {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	atomic.AddInt32(&d.frozen, 1)
+
+	return &Frozen{
+		dump:  d,
+		items: append([]Item{}, d.items...),
+		meta:  append([]meta{}, d.meta...),
+	}
+}
+
+// Len returns the number of items in the view.
+func (f *Frozen) Len() int {
+	return len(f.items)
+}
+
+// Get returns the item with the provided id. It returns ErrNotFound if there
+// is no item with that id.
+func (f *Frozen) Get(id int) (Item, error) {
+	if id < 0 || id >= len(f.items) {
+		return nil, ErrNotFound
+	}
+	return f.items[id], nil
+}
+
+// Items returns the items of the view.
+func (f *Frozen) Items() []Item {
+	return f.items
+}
+
+// WriteJSONTo writes the items of the view to w like Dump.WriteJSONTo()
+// does.
+func (f *Frozen) WriteJSONTo(w io.Writer) error {
+	d := f.dump
+	if d.envelope != nil {
+		if err := d.openEnvelope(w, len(f.items)); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if d.jsonMeta {
+		err = d.writeJSONMeta(w, f.items, f.meta)
+	} else {
+		err = d.writeJSON(w, f.items)
+	}
+
+	if err != nil || d.envelope == nil {
+		return err
+	}
+	_, err = io.WriteString(w, "}")
+	return err
+}
+
+// Release releases the view, after which the dump stops copying items before
+// changing them (once every other view was released too). The items of the
+// view can still be read, but they may change.
+func (f *Frozen) Release() {
+	f.once.Do(func() {
+		atomic.AddInt32(&f.dump.frozen, -1)
+	})
+}
+
+// thaw makes sure the item with the provided id isn't shared with a frozen
+// view before it's changed in place, by replacing it with a copy.
+//
+// no mutex
+func (d *Dump) thaw(id int) error {
+	if atomic.LoadInt32(&d.frozen) == 0 {
+		return nil
+	}
+
+	copied, err := copyItem(d.items[id])
+	if err != nil {
+		return err
+	}
+	d.items[id] = copied
+	return nil
+}
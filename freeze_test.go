@@ -0,0 +1,57 @@
+package dump
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFreeze(t *testing.T) {
+	test, _ := NewDump("freeze.db", PERSIST_MANUAL, Type{"dump.Plain", &Plain{}})
+	test.AddAll(&Plain{"a"}, &Plain{"b"})
+
+	frozen := test.Freeze()
+
+	done := make(chan struct{})
+	go func() {
+		// writes aren't blocked by the view
+		test.Add(&Plain{"c"})
+		test.UpdateAt(0, func(item Item) error {
+			item.(*Plain).Name = "x"
+			return nil
+		})
+		test.UpdateWhere(func(item Item) bool { return true }, func(item Item) error {
+			item.(*Plain).Name += "!"
+			return nil
+		})
+		close(done)
+	}()
+	<-done
+
+	var buffer bytes.Buffer
+	if err := frozen.WriteJSONTo(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != `[{"name":"a"},{"name":"b"}]` || frozen.Len() != 2 {
+		t.Fatal("the view changed", buffer.String())
+	}
+	if _, err := frozen.Get(2); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound")
+	}
+
+	if item, _ := test.Get(0); item.(*Plain).Name != "x!" {
+		t.Fatal("didn't update the dump", item)
+	}
+
+	frozen.Release()
+	frozen.Release()
+	if test.frozen != 0 {
+		t.Fatal("didn't release the view", test.frozen)
+	}
+
+	// items aren't copied anymore
+	item, _ := test.Get(1)
+	test.UpdateAt(1, func(item Item) error { return nil })
+	if other, _ := test.Get(1); other != item {
+		t.Fatal("copied an item without views")
+	}
+}
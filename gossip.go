@@ -0,0 +1,339 @@
+package dump
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// gossipDigest is the response to a GET request to a GossipHandler(): the
+// version of every item of the dump and its tombstones.
+type gossipDigest struct {
+	Items      []gossipEntry `json:"items"`
+	Tombstones []crdtKey     `json:"tombstones"`
+}
+
+// gossipEntry describes the last change made to an item.
+type gossipEntry struct {
+	Origin   string `json:"origin"`
+	Created  uint64 `json:"created"`
+	Modified uint64 `json:"modified"`
+	Writer   string `json:"writer"`
+}
+
+// GossipHandler returns an http.Handler that lets the dumps gossiping with d
+// (see Gossip()) fetch its changes. A GET request responds with a JSON digest
+// of the version of every item and of the tombstones of the dump (or 304 Not
+// Modified if its If-None-Match header matches the ETag of the dump), and a
+// POST request with a JSON list of items of the digest responds with these
+// items in the dump file format, along with the tombstones.
+//
+// The dump has to be created with WithCRDT(), otherwise the handler responds
+// with 500 Internal Server Error.
+func GossipHandler(d *Dump) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.crdt == nil {
+			http.Error(w, ErrNoCRDT.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			if notModified(w, r, d.ETag()) {
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(d.digest())
+		case http.MethodPost:
+			var keys []crdtKey
+			if err := json.NewDecoder(r.Body).Decode(&keys); err != nil {
+				http.Error(w, "invalid body", http.StatusBadRequest)
+				return
+			}
+
+			data, err := d.gossipFile(keys)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(data)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// digest returns the digest of the dump served by GossipHandler().
+func (d *Dump) digest() gossipDigest {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	digest := gossipDigest{
+		Items:      make([]gossipEntry, len(d.meta)),
+		Tombstones: d.crdt.graveyard(),
+	}
+	for id, m := range d.meta {
+		digest.Items[id] = gossipEntry{m.Origin, m.Created, m.Modified, m.Writer}
+	}
+	return digest
+}
+
+// gossipFile returns the items identified by keys (those the dump still
+// holds) and the tombstones of the dump, in the uncompressed dump file
+// format.
+func (d *Dump) gossipFile(keys []crdtKey) ([]byte, error) {
+	wanted := make(map[crdtKey]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+
+	subset := d.gossipDump()
+	var payload bytes.Buffer
+
+	d.rlock()
+	for id, m := range d.meta {
+		if wanted[keyOf(m)] {
+			subset.items = append(subset.items, d.items[id])
+			subset.meta = append(subset.meta, m)
+		}
+	}
+	subset.nextID = d.nextID
+	subset.crdt.clock, subset.crdt.tombstones = d.crdt.clock, d.crdt.tombstones
+	_, err := subset.encodePayload(&payload, nil)
+	d.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return subset.seal(header{version: formatVersion}, payload.Bytes()), nil
+}
+
+// gossipDump returns an empty dump holding the items exchanged with a peer,
+// with the settings of d needed to encode and decode them.
+func (d *Dump) gossipDump() *Dump {
+	root := d.root()
+	return &Dump{
+		filename:    d.filename,
+		schema:      d.schema,
+		migrations:  d.migrations,
+		codecs:      root.codecs,
+		conversions: root.conversions,
+		items:       make([]Item, 0),
+		closed:      make(chan struct{}),
+		mutex:       &sync.RWMutex{},
+		crdt:        &crdt{replica: d.crdt.replica, tombstones: make(map[crdtKey]bool)},
+	}
+}
+
+// GossipOptions configures Gossip().
+type GossipOptions struct {
+	// Client is used to connect to the peers (http.DefaultClient by
+	// default).
+	Client *http.Client
+
+	// Interval is how often the dump syncs with its peers (10s by default).
+	Interval time.Duration
+}
+
+// Gossiper keeps a dump in sync with its peers, see Gossip().
+type Gossiper struct {
+	d       *Dump
+	peers   []string
+	options GossipOptions
+
+	// etags holds the ETag of every peer as of the last sync with it
+	etags map[string]string
+
+	mutex  sync.Mutex
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+}
+
+// Gossip keeps d in sync with the dumps holding the same logical dataset
+// served by GossipHandler() at the urls in peers, without a primary: every
+// interval, d fetches the digest of each peer, then the items the peer
+// changed since (or holds and d doesn't) and its tombstones, and merges them
+// the way Merge() does. As long as every dump gossips with at least one
+// other dump (directly or not), they all converge to the same items.
+//
+// Every dump has to be created with WithCRDT() with its own replica id (it
+// returns ErrNoCRDT otherwise) and serve its items with GossipHandler() to
+// the dumps gossiping with it.
+func Gossip(d *Dump, peers []string, options GossipOptions) (*Gossiper, error) {
+	if d.crdt == nil {
+		return nil, ErrNoCRDT
+	}
+
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.Interval <= 0 {
+		options.Interval = 10 * time.Second
+	}
+
+	g := &Gossiper{
+		d:       d,
+		peers:   append([]string{}, peers...),
+		options: options,
+		etags:   make(map[string]string, len(peers)),
+	}
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+
+	g.wg.Add(1)
+	go g.run()
+
+	return g, nil
+}
+
+func (g *Gossiper) run() {
+	defer g.wg.Done()
+
+	ticker := time.NewTicker(g.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		// unreachable peers are tried again on the next round
+		g.Sync()
+
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync syncs the dump with every peer right away. It returns the first error
+// met, after trying every peer.
+func (g *Gossiper) Sync() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	var first error
+	for _, peer := range g.peers {
+		if err := g.pull(peer); err != nil && first == nil {
+			first = fmt.Errorf("%s: %w", peer, err)
+		}
+	}
+	return first
+}
+
+// Close stops gossiping. The dump keeps the items it had.
+func (g *Gossiper) Close() error {
+	g.cancel()
+	g.wg.Wait()
+	return nil
+}
+
+// pull merges the changes of peer into the dump.
+func (g *Gossiper) pull(peer string) error {
+	request, err := http.NewRequestWithContext(g.ctx, http.MethodGet, peer, nil)
+	if err != nil {
+		return err
+	}
+	if etag := g.etags[peer]; etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+
+	response, err := g.options.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	var digest gossipDigest
+	if err := json.NewDecoder(response.Body).Decode(&digest); err != nil {
+		return err
+	}
+
+	keys, stale := g.d.missing(digest)
+	if stale {
+		if err := g.fetch(peer, keys); err != nil {
+			return err
+		}
+	}
+
+	g.etags[peer] = response.Header.Get("ETag")
+	return nil
+}
+
+// missing returns the items of digest that the dump doesn't hold or holds an
+// older version of, and whether the dump is behind the digest at all (which
+// it also is if it misses tombstones).
+func (d *Dump) missing(digest gossipDigest) ([]crdtKey, bool) {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	held := make(map[crdtKey]meta, len(d.meta))
+	for _, m := range d.meta {
+		held[keyOf(m)] = m
+	}
+
+	keys := make([]crdtKey, 0)
+	for _, entry := range digest.Items {
+		key := crdtKey{entry.Origin, entry.Created}
+		if d.crdt.tombstones[key] {
+			continue
+		}
+
+		m, ok := held[key]
+		if !ok || newer(meta{Modified: entry.Modified, Writer: entry.Writer}, m) {
+			keys = append(keys, key)
+		}
+	}
+
+	stale := len(keys) > 0
+	for _, key := range digest.Tombstones {
+		if !d.crdt.tombstones[key] {
+			stale = true
+		}
+	}
+	return keys, stale
+}
+
+// fetch merges the items of peer identified by keys, and its tombstones, into
+// the dump.
+func (g *Gossiper) fetch(peer string, keys []crdtKey) error {
+	body, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(g.ctx, http.MethodPost, peer, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := g.options.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	other := g.d.gossipDump()
+	if _, err := other.decodeFrom(response.Body); err != nil {
+		return err
+	}
+	return g.d.Merge(other)
+}
@@ -0,0 +1,86 @@
+package dump
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGossip(t *testing.T) {
+	types := []Type{{"dump.Plain", &Plain{}}}
+	if _, err := Gossip(&Dump{}, nil, GossipOptions{}); err != ErrNoCRDT {
+		t.Fatal("expected ErrNoCRDT", err)
+	}
+
+	// a gossips with b, and b with a and c
+	a, _ := New("a.db", PERSIST_MANUAL, types, WithCRDT("a"))
+	b, _ := New("b.db", PERSIST_MANUAL, types, WithCRDT("b"))
+	c, _ := New("c.db", PERSIST_MANUAL, types, WithCRDT("c"))
+	servers := make(map[*Dump]*httptest.Server)
+	for _, d := range []*Dump{a, b, c} {
+		servers[d] = httptest.NewServer(GossipHandler(d))
+		defer servers[d].Close()
+	}
+
+	options := GossipOptions{Interval: time.Hour}
+	ga, _ := Gossip(a, []string{servers[b].URL}, options)
+	defer ga.Close()
+	gb, _ := Gossip(b, []string{servers[a].URL, servers[c].URL}, options)
+	defer gb.Close()
+	gc, _ := Gossip(c, []string{servers[b].URL}, options)
+	defer gc.Close()
+
+	sync := func() {
+		for _, g := range []*Gossiper{gb, ga, gc} {
+			if err := g.Sync(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	names := func(d *Dump) (names []string) {
+		d.View(func(items []Item) error {
+			for _, item := range items {
+				names = append(names, item.(*Plain).Name)
+			}
+			return nil
+		})
+		return names
+	}
+	converged := func(want ...string) {
+		for _, d := range []*Dump{a, b, c} {
+			if got := names(d); len(got) != len(want) {
+				t.Fatal("didn't converge", d.crdt.replica, got, want)
+			}
+			for i, name := range names(d) {
+				if name != want[i] {
+					t.Fatal("didn't converge", d.crdt.replica, names(d), want)
+				}
+			}
+		}
+	}
+
+	a.Add(&Plain{"a"})
+	c.Add(&Plain{"c"})
+	sync()
+	converged("a", "c")
+
+	etag := a.ETag()
+	sync()
+	if a.ETag() != etag {
+		t.Fatal("merged unchanged peers")
+	}
+
+	// changes and removals reach dumps that don't gossip with each other
+	c.Set(0, &Plain{"changed"})
+	a.Remove(1)
+	sync()
+	converged("changed")
+
+	plain, _ := New("plain.db", PERSIST_MANUAL, types)
+	server := httptest.NewServer(GossipHandler(plain))
+	defer server.Close()
+	if response, err := http.Get(server.URL); err != nil || response.StatusCode != http.StatusInternalServerError {
+		t.Fatal("served a dump without WithCRDT()", err)
+	}
+}
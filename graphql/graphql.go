@@ -0,0 +1,543 @@
+// Package graphql provides an http.Handler serving a dump over GraphQL.
+//
+// Every registered type is exposed as a collection named after the type. For
+// a type registered as "main.Post" the schema is:
+//
+//	type Query {
+//		posts(offset: Int, limit: Int, where: PostFilter): [Post]
+//		post(id: Int!): Post
+//	}
+//
+//	type Mutation {
+//		addPost(input: PostInput!): Post
+//		updatePost(id: Int!, input: PostInput!): Post
+//		removePost(id: Int!): Boolean
+//	}
+//
+// The fields of a Post are the fields of its JSON encoding, plus _id holding
+// the id of the item in the dump. The where argument is an object of fields
+// and values the items have to be equal to, such as {author: "karl"}, and
+// inputs are the JSON encoding of an item.
+//
+// Only the parts of GraphQL needed for that are supported: queries and
+// mutations with arguments, variables, aliases and nested selections, but not
+// fragments, directives or introspection.
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/karlmcguire/dump"
+)
+
+var (
+	// ErrNoCollection is thrown when a query or mutation selects a field that
+	// doesn't exist.
+	ErrNoCollection = errors.New("no such field")
+
+	// ErrInvalidArgument is thrown when an argument is missing or has the
+	// wrong type.
+	ErrInvalidArgument = errors.New("invalid argument")
+)
+
+// collection is a registered type exposed over GraphQL.
+type collection struct {
+	name    string // "Post"
+	typ     reflect.Type
+	pointer bool
+}
+
+// Handler returns an http.Handler serving GraphQL requests over d, exposing
+// the provided types (which should be the types the dump was created with).
+// Requests are either GET requests with the query (and optionally JSON
+// encoded variables) in the URL, or POST requests with a JSON body such as
+// {"query": "...", "variables": {...}}.
+func Handler(d *dump.Dump, types ...dump.Type) http.Handler {
+	h := &handler{dump: d, collections: make(map[string]*collection)}
+
+	for _, t := range types {
+		typ := reflect.TypeOf(t.Value)
+		c := &collection{typ: typ}
+		if typ.Kind() == reflect.Ptr {
+			c.typ, c.pointer = typ.Elem(), true
+		}
+
+		name := t.Name[strings.LastIndex(t.Name, ".")+1:]
+		c.name = strings.ToUpper(name[:1]) + name[1:]
+		h.collections[c.name] = c
+	}
+
+	return h
+}
+
+type handler struct {
+	dump        *dump.Dump
+	collections map[string]*collection
+}
+
+type request struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type response struct {
+	Data   interface{}     `json:"data"`
+	Errors []responseError `json:"errors,omitempty"`
+}
+
+type responseError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+
+	switch r.Method {
+	case "GET":
+		req.Query = r.URL.Query().Get("query")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				h.fail(w, err)
+				return
+			}
+		}
+	case "POST":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			h.fail(w, err)
+			return
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+			req.Query = string(body)
+		} else if err = json.Unmarshal(body, &req); err != nil {
+			h.fail(w, err)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	doc, err := parse(req.Query, req.Variables)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	if doc.mutation && r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "mutations require POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var res response
+	if doc.mutation {
+		res = h.mutate(doc.selections)
+	} else {
+		res = h.query(doc.selections)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// fail responds to a request that couldn't be parsed.
+func (h *handler) fail(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(response{Errors: []responseError{{Message: err.Error()}}})
+}
+
+// query resolves the fields of a query while the dump is locked for reading,
+// so they all see the same items.
+func (h *handler) query(fields []*field) response {
+	var res response
+	data := make(object, 0, len(fields))
+
+	h.dump.View(func(items []dump.Item) error {
+		for _, f := range fields {
+			v, err := h.resolveQuery(f, items)
+			if err != nil {
+				res.Errors = append(res.Errors, responseError{
+					Message: err.Error(),
+					Path:    []interface{}{f.key()},
+				})
+			}
+			data = append(data, member{f.key(), v})
+		}
+		return nil
+	})
+
+	res.Data = data
+	return res
+}
+
+func (h *handler) resolveQuery(f *field, items []dump.Item) (interface{}, error) {
+	if f.name == "__typename" {
+		return "Query", nil
+	}
+
+	if c := h.collection(f.name, "", "s"); c != nil {
+		return h.list(c, f, items)
+	}
+
+	if c := h.collection(f.name, "", ""); c != nil {
+		id, err := intArgument(f, "id", -1)
+		if err != nil {
+			return nil, err
+		}
+		if id < 0 || id >= len(items) || !c.holds(items[id]) {
+			return nil, nil
+		}
+		return c.selected(h.dump, items[id], id, f.selections)
+	}
+
+	return nil, fmt.Errorf("%v: %s", ErrNoCollection, f.name)
+}
+
+func (h *handler) list(c *collection, f *field, items []dump.Item) (interface{}, error) {
+	offset, err := intArgument(f, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := intArgument(f, "limit", len(items))
+	if err != nil {
+		return nil, err
+	}
+
+	where, ok := f.arguments["where"].(map[string]interface{})
+	if !ok && f.arguments["where"] != nil {
+		return nil, fmt.Errorf("%v: where", ErrInvalidArgument)
+	}
+
+	list := make([]interface{}, 0)
+	for id, item := range items {
+		if len(list) == limit {
+			break
+		}
+
+		if !c.holds(item) {
+			continue
+		}
+
+		encoded, err := encode(h.dump, item)
+		if err != nil {
+			return nil, err
+		}
+
+		if !matches(encoded, where) {
+			continue
+		}
+
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		selected, err := selectFields(encoded, id, c.name, f.selections)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, selected)
+	}
+
+	return list, nil
+}
+
+// mutate resolves the fields of a mutation one after the other.
+func (h *handler) mutate(fields []*field) response {
+	var res response
+	data := make(object, 0, len(fields))
+
+	for _, f := range fields {
+		v, err := h.resolveMutation(f)
+		if err != nil {
+			res.Errors = append(res.Errors, responseError{
+				Message: err.Error(),
+				Path:    []interface{}{f.key()},
+			})
+		}
+		data = append(data, member{f.key(), v})
+	}
+
+	res.Data = data
+	return res
+}
+
+func (h *handler) resolveMutation(f *field) (interface{}, error) {
+	if f.name == "__typename" {
+		return "Mutation", nil
+	}
+
+	if c := h.collection(f.name, "add", ""); c != nil {
+		item, err := c.decode(f)
+		if err != nil {
+			return nil, err
+		}
+		id, err := h.dump.Add(item)
+		if err != nil {
+			return nil, err
+		}
+		return c.selected(h.dump, item, id, f.selections)
+	}
+
+	if c := h.collection(f.name, "update", ""); c != nil {
+		id, err := h.existing(c, f)
+		if err != nil {
+			return nil, err
+		}
+		item, err := c.decode(f)
+		if err != nil {
+			return nil, err
+		}
+		if err = h.dump.Set(id, item); err != nil {
+			return nil, err
+		}
+		return c.selected(h.dump, item, id, f.selections)
+	}
+
+	if c := h.collection(f.name, "remove", ""); c != nil {
+		id, err := h.existing(c, f)
+		if err != nil {
+			return nil, err
+		}
+		return true, h.dump.Remove(id)
+	}
+
+	return nil, fmt.Errorf("%v: %s", ErrNoCollection, f.name)
+}
+
+// existing returns the id argument of f, which has to be the id of an item
+// of the collection.
+func (h *handler) existing(c *collection, f *field) (int, error) {
+	id, err := intArgument(f, "id", -1)
+	if err != nil {
+		return 0, err
+	}
+
+	item, err := h.dump.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	if !c.holds(item) {
+		return 0, dump.ErrNotFound
+	}
+
+	return id, nil
+}
+
+// collection returns the collection for the field named prefix + name +
+// suffix (such as "addPost" or "posts"), or nil if there isn't one.
+func (h *handler) collection(field, prefix, suffix string) *collection {
+	if !strings.HasPrefix(field, prefix) || !strings.HasSuffix(field, suffix) ||
+		len(field) <= len(prefix)+len(suffix) {
+		return nil
+	}
+
+	name := field[len(prefix) : len(field)-len(suffix)]
+	if prefix == "" {
+		// queries start with a lowercase letter
+		if strings.ToLower(name[:1]) != name[:1] {
+			return nil
+		}
+		name = strings.ToUpper(name[:1]) + name[1:]
+	}
+
+	return h.collections[name]
+}
+
+// holds reports whether item belongs to the collection.
+func (c *collection) holds(item dump.Item) bool {
+	typ := reflect.TypeOf(item)
+	if c.pointer {
+		return typ == reflect.PtrTo(c.typ)
+	}
+	return typ == c.typ
+}
+
+// decode returns a new item from the input argument of f.
+func (c *collection) decode(f *field) (dump.Item, error) {
+	input, ok := f.arguments["input"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v: input", ErrInvalidArgument)
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	item := reflect.New(c.typ)
+	if err = json.Unmarshal(data, item.Interface()); err != nil {
+		return nil, err
+	}
+
+	if c.pointer {
+		return item.Interface(), nil
+	}
+	return item.Elem().Interface(), nil
+}
+
+// selected returns the selected fields of item.
+func (c *collection) selected(d *dump.Dump, item dump.Item, id int, selections []*field) (interface{}, error) {
+	encoded, err := encode(d, item)
+	if err != nil {
+		return nil, err
+	}
+	return selectFields(encoded, id, c.name, selections)
+}
+
+// encode returns the JSON encoding of item, as d serves it, decoded into
+// generic values.
+func encode(d *dump.Dump, item dump.Item) (interface{}, error) {
+	data, err := d.RedactJSON(item)
+	if err != nil {
+		return nil, err
+	}
+
+	var encoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return encoded, decoder.Decode(&encoded)
+}
+
+// matches reports whether every field in where is equal in encoded.
+func matches(encoded interface{}, where map[string]interface{}) bool {
+	if len(where) == 0 {
+		return true
+	}
+
+	fields, ok := encoded.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	for name, expected := range where {
+		if !equal(fields[name], expected) {
+			return false
+		}
+	}
+	return true
+}
+
+// equal compares a value decoded from JSON with an argument value.
+func equal(actual, expected interface{}) bool {
+	if number, ok := actual.(json.Number); ok {
+		switch expected := expected.(type) {
+		case int64:
+			n, err := number.Int64()
+			return err == nil && n == expected
+		case float64:
+			n, err := number.Float64()
+			return err == nil && n == expected
+		}
+		return false
+	}
+
+	a, _ := json.Marshal(actual)
+	b, _ := json.Marshal(expected)
+	return bytes.Equal(a, b)
+}
+
+// selectFields returns the selected fields of the value v. Items (id isn't
+// negative) also have the _id and __typename fields.
+func selectFields(v interface{}, id int, typename string, selections []*field) (interface{}, error) {
+	if selections == nil {
+		return v, nil
+	}
+
+	switch v := v.(type) {
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			var err error
+			if list[i], err = selectFields(v[i], -1, "", selections); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case map[string]interface{}:
+		selected := make(object, 0, len(selections))
+		for _, f := range selections {
+			var value interface{}
+			switch {
+			case f.name == "_id" && id >= 0:
+				value = id
+			case f.name == "__typename" && typename != "":
+				value = typename
+			default:
+				var err error
+				if value, err = selectFields(v[f.name], -1, "", f.selections); err != nil {
+					return nil, err
+				}
+			}
+			selected = append(selected, member{f.key(), value})
+		}
+		return selected, nil
+	case nil:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("can't select fields of %v", v)
+}
+
+// intArgument returns the named integer argument of f, or def if it wasn't
+// provided. Arguments defaulting to -1 are required.
+func intArgument(f *field, name string, def int) (int, error) {
+	v, ok := f.arguments[name]
+	if !ok || v == nil {
+		if def < 0 {
+			return 0, fmt.Errorf("%v: %s is required", ErrInvalidArgument, name)
+		}
+		return def, nil
+	}
+
+	n, ok := v.(int64)
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("%v: %s", ErrInvalidArgument, name)
+	}
+	return int(n), nil
+}
+
+// object is a JSON object keeping the order of its members, since GraphQL
+// responses follow the order of the selected fields.
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+
+	buffer.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(m.key)
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
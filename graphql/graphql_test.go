@@ -0,0 +1,145 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/karlmcguire/dump"
+)
+
+type Post struct {
+	Title  string   `json:"title"`
+	Score  int      `json:"score"`
+	Draft  bool     `json:"draft"`
+	Author *Author  `json:"author"`
+	Tags   []string `json:"tags"`
+}
+
+type Author struct {
+	Name string `json:"name"`
+}
+
+type Comment struct {
+	Text string `json:"text"`
+}
+
+func TestHandler(t *testing.T) {
+	defer os.Remove("graphql.db")
+
+	types := []dump.Type{
+		{Name: "graphql.Post", Value: &Post{}},
+		{Name: "graphql.Comment", Value: Comment{}},
+	}
+
+	d, err := dump.NewDump("graphql.db", dump.PERSIST_MANUAL, types...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.AddAll(
+		&Post{Title: "one", Score: 1, Author: &Author{"karl"}, Tags: []string{"go"}},
+		Comment{Text: "first"},
+		&Post{Title: "two", Score: 2, Draft: true},
+		&Post{Title: "three", Score: 3, Author: &Author{"karl"}},
+	)
+
+	handler := Handler(d, types...)
+
+	do := func(method, query string, variables map[string]interface{}, status int, expected string) {
+		var r *http.Request
+		if method == "GET" {
+			r = httptest.NewRequest("GET", "/?query="+url.QueryEscape(query), nil)
+		} else {
+			body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+			r = httptest.NewRequest("POST", "/", strings.NewReader(string(body)))
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+
+		if recorder.Code != status {
+			t.Fatalf("%s: expected %d, got %d (%s)", query, status, recorder.Code, recorder.Body.String())
+		}
+		if body := strings.TrimSpace(recorder.Body.String()); body != expected {
+			t.Fatalf("%s:\nexpected %s\n     got %s", query, expected, body)
+		}
+	}
+
+	do("GET", `{ posts { _id title } }`, nil, http.StatusOK,
+		`{"data":{"posts":[{"_id":0,"title":"one"},{"_id":2,"title":"two"},{"_id":3,"title":"three"}]}}`)
+
+	do("GET", `{ karls: posts(where: {author: {name: "karl"}}, offset: 1, limit: 1) { title author { name } } }`,
+		nil, http.StatusOK,
+		`{"data":{"karls":[{"title":"three","author":{"name":"karl"}}]}}`)
+
+	do("POST", `query($score: Int) { posts(where: {score: $score}) { title tags } }`,
+		map[string]interface{}{"score": 1}, http.StatusOK,
+		`{"data":{"posts":[{"title":"one","tags":["go"]}]}}`)
+
+	do("GET", `{ post(id: 2) { __typename _id draft } comment(id: 1) { text } missing: post(id: 1) { title } }`,
+		nil, http.StatusOK,
+		`{"data":{"post":{"__typename":"Post","_id":2,"draft":true},"comment":{"text":"first"},"missing":null}}`)
+
+	do("GET", `{ nope { title } post { title } }`, nil, http.StatusOK,
+		`{"data":{"nope":null,"post":null},"errors":[{"message":"no such field: nope","path":["nope"]},{"message":"invalid argument: id is required","path":["post"]}]}`)
+
+	do("POST", `mutation {
+		addPost(input: {title: "four", score: 4}) { _id title }
+		updatePost(id: 0, input: {title: "uno"}) { _id title score }
+		removePost(id: 2)
+	}`, nil, http.StatusOK,
+		`{"data":{"addPost":{"_id":4,"title":"four"},"updatePost":{"_id":0,"title":"uno","score":0},"removePost":true}}`)
+
+	do("POST", `mutation { updatePost(id: 1, input: {title: "not a post"}) { _id } addComment(input: {text: "second"}) { _id text } }`,
+		nil, http.StatusOK,
+		`{"data":{"updatePost":null,"addComment":{"_id":4,"text":"second"}},"errors":[{"message":"item not found","path":["updatePost"]}]}`)
+
+	if item, _ := d.Get(4); item.(Comment).Text != "second" {
+		t.Fatal("comment wasn't added as a value")
+	}
+
+	do("GET", `mutation { removePost(id: 0) }`, nil, http.StatusMethodNotAllowed,
+		"mutations require POST")
+
+	do("GET", `{ posts { ...fields } }`, nil, http.StatusBadRequest,
+		`{"data":null,"errors":[{"message":"fragments aren't supported (at 10)"}]}`)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("PUT", "/", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatal("accepted PUT")
+	}
+}
+
+type User struct {
+	Name  string `json:"name"`
+	Email string `json:"email" redact:"mask"`
+}
+
+func TestHandlerRedaction(t *testing.T) {
+	defer os.Remove("graphql.db")
+
+	types := []dump.Type{{Name: "graphql.User", Value: &User{}}}
+	d, err := dump.New("graphql.db", dump.PERSIST_MANUAL, types, dump.WithRedaction())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Add(&User{"ann", "ann@example.com"})
+
+	handler := Handler(d, types...)
+	for query, expected := range map[string]string{
+		`{ users { name email } }`:                              `{"data":{"users":[{"name":"ann","email":"[redacted]"}]}}`,
+		`{ users(where: {email: "ann@example.com"}) { name } }`: `{"data":{"users":[]}}`,
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/?query="+url.QueryEscape(query), nil))
+		if body := strings.TrimSpace(recorder.Body.String()); body != expected {
+			t.Fatalf("%s:\nexpected %s\n     got %s", query, expected, body)
+		}
+	}
+}
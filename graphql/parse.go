@@ -0,0 +1,409 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// document is a parsed GraphQL request, holding its only operation.
+type document struct {
+	mutation   bool
+	selections []*field
+}
+
+// field is a selected field, such as `latest: posts(limit: 10) { title }`.
+type field struct {
+	alias      string
+	name       string
+	arguments  map[string]value
+	selections []*field
+}
+
+// key returns the name the field has in the response.
+func (f *field) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// value is an argument value. Variables are resolved while parsing, so values
+// are nil, bool, int64, float64, string, []interface{} or
+// map[string]interface{}.
+type value interface{}
+
+type token struct {
+	kind  byte // 'n'ame, 's'tring, 'i'nt, 'f'loat, punctuator or 0 for the end
+	text  string
+	index int
+}
+
+// lex splits source into tokens.
+func lex(source string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(source); {
+		c := source[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case strings.IndexByte("{}()[]:!$=@|&", c) >= 0:
+			tokens = append(tokens, token{kind: c, text: string(c), index: i})
+			i++
+		case c == '.':
+			if !strings.HasPrefix(source[i:], "...") {
+				return nil, fmt.Errorf("unexpected '.' at %d", i)
+			}
+			tokens = append(tokens, token{kind: '.', text: "...", index: i})
+			i += 3
+		case c == '_' || isLetter(c):
+			start := i
+			for i < len(source) && (source[i] == '_' || isLetter(source[i]) || isDigit(source[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: 'n', text: source[start:i], index: start})
+		case c == '-' || isDigit(c):
+			start, kind := i, byte('i')
+			i++
+			for i < len(source) && (isDigit(source[i]) || strings.IndexByte(".eE+-", source[i]) >= 0) {
+				if !isDigit(source[i]) {
+					kind = 'f'
+				}
+				i++
+			}
+			tokens = append(tokens, token{kind: kind, text: source[start:i], index: start})
+		case c == '"':
+			text, n, err := lexString(source[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%v at %d", err, i)
+			}
+			tokens = append(tokens, token{kind: 's', text: text, index: i})
+			i += n
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", c, i)
+		}
+	}
+
+	return append(tokens, token{index: len(source)}), nil
+}
+
+// lexString returns the value of the string (or block string) at the start
+// of source and its length in source.
+func lexString(source string) (string, int, error) {
+	if strings.HasPrefix(source, `"""`) {
+		end := strings.Index(source[3:], `"""`)
+		if end < 0 {
+			return "", 0, fmt.Errorf("unterminated string")
+		}
+		return strings.TrimSpace(source[3 : 3+end]), end + 6, nil
+	}
+
+	for i := 1; i < len(source); i++ {
+		switch source[i] {
+		case '\\':
+			i++
+		case '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case '"':
+			// GraphQL escapes are a subset of Go's
+			text, err := strconv.Unquote(source[:i+1])
+			return text, i + 1, err
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type parser struct {
+	tokens    []token
+	variables map[string]interface{}
+}
+
+// parse parses the GraphQL document in source, which has to contain a single
+// operation. Fragments and directives aren't supported.
+func parse(source string, variables map[string]interface{}) (*document, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, variables: variables}
+	doc := &document{}
+
+	if p.peek().kind == 'n' {
+		switch p.next().text {
+		case "query":
+		case "mutation":
+			doc.mutation = true
+		default:
+			return nil, p.unexpected(p.tokens[0])
+		}
+
+		if p.peek().kind == 'n' {
+			p.next()
+		}
+
+		if p.peek().kind == '(' {
+			if err = p.variableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if doc.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != 0 {
+		return nil, fmt.Errorf("only a single operation is supported (at %d)", t.index)
+	}
+
+	return doc, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[0]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[0]
+	if t.kind != 0 {
+		p.tokens = p.tokens[1:]
+	}
+	return t
+}
+
+func (p *parser) expect(kind byte) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.unexpected(t)
+	}
+	return t, nil
+}
+
+func (p *parser) unexpected(t token) error {
+	switch t.kind {
+	case 0:
+		return fmt.Errorf("unexpected end of document")
+	case '.':
+		return fmt.Errorf("fragments aren't supported (at %d)", t.index)
+	case '@':
+		return fmt.Errorf("directives aren't supported (at %d)", t.index)
+	}
+	return fmt.Errorf("unexpected %q at %d", t.text, t.index)
+}
+
+// variableDefinitions skips the variable definitions of the operation, only
+// applying their default values.
+func (p *parser) variableDefinitions() error {
+	p.next()
+
+	for p.peek().kind != ')' {
+		if _, err := p.expect('$'); err != nil {
+			return err
+		}
+		name, err := p.expect('n')
+		if err != nil {
+			return err
+		}
+		if _, err = p.expect(':'); err != nil {
+			return err
+		}
+
+		// the type isn't checked
+		depth := 0
+		for {
+			t := p.peek()
+			if t.kind == '[' {
+				depth++
+			} else if t.kind == ']' {
+				depth--
+			} else if t.kind != 'n' && t.kind != '!' {
+				return p.unexpected(p.next())
+			}
+			p.next()
+			if depth == 0 && p.peek().kind != '!' {
+				break
+			}
+		}
+
+		if p.peek().kind == '=' {
+			p.next()
+			v, err := p.value()
+			if err != nil {
+				return err
+			}
+			if _, ok := p.variables[name.text]; !ok {
+				if p.variables == nil {
+					p.variables = make(map[string]interface{})
+				}
+				p.variables[name.text] = v
+			}
+		}
+	}
+
+	p.next()
+	return nil
+}
+
+func (p *parser) selectionSet() ([]*field, error) {
+	if _, err := p.expect('{'); err != nil {
+		return nil, err
+	}
+
+	var fields []*field
+	for p.peek().kind != '}' {
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	p.next()
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty selection set")
+	}
+
+	return fields, nil
+}
+
+func (p *parser) field() (*field, error) {
+	name, err := p.expect('n')
+	if err != nil {
+		return nil, err
+	}
+
+	f := &field{name: name.text}
+
+	if p.peek().kind == ':' {
+		p.next()
+		if name, err = p.expect('n'); err != nil {
+			return nil, err
+		}
+		f.alias, f.name = f.name, name.text
+	}
+
+	if p.peek().kind == '(' {
+		p.next()
+		f.arguments = make(map[string]value)
+		for p.peek().kind != ')' {
+			name, err := p.expect('n')
+			if err != nil {
+				return nil, err
+			}
+			if _, err = p.expect(':'); err != nil {
+				return nil, err
+			}
+			if f.arguments[name.text], err = p.value(); err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+	}
+
+	if p.peek().kind == '{' {
+		if f.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (p *parser) value() (value, error) {
+	t := p.next()
+
+	switch t.kind {
+	case '$':
+		name, err := p.expect('n')
+		if err != nil {
+			return nil, err
+		}
+		v, ok := p.variables[name.text]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s isn't defined", name.text)
+		}
+		return normalize(v), nil
+	case 'i':
+		return strconv.ParseInt(t.text, 10, 64)
+	case 'f':
+		return strconv.ParseFloat(t.text, 64)
+	case 's':
+		return t.text, nil
+	case 'n':
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		// enum values are treated as strings
+		return t.text, nil
+	case '[':
+		list := make([]interface{}, 0)
+		for p.peek().kind != ']' {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		p.next()
+		return list, nil
+	case '{':
+		object := make(map[string]interface{})
+		for p.peek().kind != '}' {
+			name, err := p.expect('n')
+			if err != nil {
+				return nil, err
+			}
+			if _, err = p.expect(':'); err != nil {
+				return nil, err
+			}
+			if object[name.text], err = p.value(); err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+		return object, nil
+	}
+
+	return nil, p.unexpected(t)
+}
+
+// normalize converts the numbers in a variable decoded from JSON to int64
+// when they are integers, like the numbers written in a document.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = normalize(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = normalize(v[k])
+		}
+	}
+	return v
+}
@@ -0,0 +1,73 @@
+package graphql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := parse(`
+		# a comment
+		query Latest($limit: Int! = 5, $tags: [String!]) {
+			latest: posts(limit: $limit, where: {draft: false, score: 1.5, tags: $tags}) {
+				title
+				author { name }
+			}
+			post(id: 3) { _id }
+		}`, map[string]interface{}{"tags": []interface{}{"go", float64(2)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.mutation || len(doc.selections) != 2 {
+		t.Fatal("bad document")
+	}
+
+	latest := doc.selections[0]
+	if latest.key() != "latest" || latest.name != "posts" ||
+		len(latest.selections) != 2 || latest.selections[1].selections[0].name != "name" {
+		t.Fatal("bad field", latest)
+	}
+
+	expected := map[string]value{
+		"limit": int64(5),
+		"where": map[string]interface{}{
+			"draft": false,
+			"score": 1.5,
+			"tags":  []interface{}{"go", int64(2)},
+		},
+	}
+	if !reflect.DeepEqual(latest.arguments, expected) {
+		t.Fatal("bad arguments", latest.arguments)
+	}
+
+	if doc, err = parse(`mutation { addPost(input: {title: "say \"hi\"", body: """ block """}) { _id } }`, nil); err != nil {
+		t.Fatal(err)
+	}
+	input := doc.selections[0].arguments["input"].(map[string]interface{})
+	if !doc.mutation || input["title"] != `say "hi"` || input["body"] != "block" {
+		t.Fatal("bad mutation", input)
+	}
+
+	if doc, err = parse(`{ posts { title } }`, nil); err != nil || doc.selections[0].name != "posts" {
+		t.Fatal("bad shorthand query")
+	}
+
+	for source, message := range map[string]string{
+		`{ posts { ...postFields } }`:    "fragments",
+		`{ posts @skip(if: true) }`:      "directives",
+		`{ post(id: $missing) { _id } }`: "$missing",
+		`{ posts {} }`:                   "empty selection set",
+		`{ posts { title }`:              "end of document",
+		`{ posts } { posts }`:            "single operation",
+		`subscription { posts }`:         "unexpected",
+		`{ posts(title: "open) }`:        "unterminated",
+		`{ posts(title: 1.2.3) }`:        "invalid syntax",
+		`{ % }`:                          "unexpected",
+	} {
+		if _, err = parse(source, nil); err == nil || !strings.Contains(err.Error(), message) {
+			t.Fatalf("%s: expected error containing %q, got %v", source, message, err)
+		}
+	}
+}
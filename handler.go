@@ -0,0 +1,564 @@
+package dump
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// HandlerOptions configures the http.Handler returned by Handler().
+type HandlerOptions struct {
+	// Decode decodes an item from the body of a POST or PUT request. By
+	// default the body is unmarshaled as JSON into a new item created by the
+	// factory set with WithFactory().
+	Decode func(r io.Reader) (Item, error)
+
+	// Limit is the default and maximum number of items listed by a single
+	// GET / request (100 if it isn't positive).
+	Limit int
+
+	// MaxBodySize is the maximum size of the body of a POST or PUT request in
+	// bytes (1MB if it isn't positive). Larger bodies are refused with 413
+	// Request Entity Too Large.
+	MaxBodySize int64
+
+	// Auth is called with every request before it is served, along with the
+	// operation it would perform. If it returns an error the request is
+	// refused: with 401 Unauthorized for ErrUnauthorized and 403 Forbidden
+	// otherwise. Every request is allowed if Auth is nil.
+	Auth func(r *http.Request, op Operation) error
+
+	// DisableCompression stops lists from being gzip-compressed for clients
+	// that accept it (with an Accept-Encoding header).
+	DisableCompression bool
+
+	// RateLimit, if set, limits how often each client can add, update and
+	// delete items (see RateLimit). Requests are limited once they are
+	// allowed by Auth, so Key can rely on what Auth checked.
+	RateLimit *RateLimit
+
+	// CORS, if set, allows browser applications served from other origins
+	// to use the API, answering their preflight requests (see CORS).
+	CORS *CORS
+}
+
+// Operation is an operation performed by a request to Handler().
+type Operation int
+
+const (
+	// OpList lists the items (GET /).
+	OpList Operation = iota
+	// OpGet returns an item (GET /{id}).
+	OpGet
+	// OpAdd adds an item (POST /).
+	OpAdd
+	// OpUpdate replaces an item (PUT /{id}).
+	OpUpdate
+	// OpDelete removes an item (DELETE /{id}).
+	OpDelete
+	// OpSchema returns the OpenAPI document (GET /openapi.json).
+	OpSchema
+)
+
+// Write reports whether the operation changes the dump.
+func (op Operation) Write() bool {
+	return op == OpAdd || op == OpUpdate || op == OpDelete
+}
+
+// String returns the name of the operation, such as "list".
+func (op Operation) String() string {
+	switch op {
+	case OpList:
+		return "list"
+	case OpGet:
+		return "get"
+	case OpAdd:
+		return "add"
+	case OpUpdate:
+		return "update"
+	case OpDelete:
+		return "delete"
+	case OpSchema:
+		return "schema"
+	}
+	return "unknown"
+}
+
+// defaultLimit is the number of items listed when HandlerOptions.Limit isn't
+// set.
+const defaultLimit = 100
+
+// defaultMaxBodySize is the maximum size of request bodies when
+// HandlerOptions.MaxBodySize isn't set.
+const defaultMaxBodySize = 1 << 20
+
+// Handler returns an http.Handler serving the dump as a REST API:
+//
+//	GET /              lists the items as a JSON list (see below)
+//	GET /{id}          returns the item with the id
+//	POST /             adds the item in the body, responding with {"id":id}
+//	PUT /{id}          replaces the item with the id with the item in the body
+//	DELETE /{id}       removes the item with the id
+//	GET /openapi.json  returns the OpenAPI() document describing the API
+//
+// Items that fail validation (see WithValidator()) are refused with 422
+// Unprocessable Entity, and changes requested once the dump is closed with 503
+// Service Unavailable.
+//
+// Lists are paginated with the offset and limit query parameters (such as
+// GET /?offset=100&limit=50) and the total number of items is sent in the
+// X-Total-Count header. GET responses carry the ETag() of the dump and
+// requests with a matching If-None-Match header get 304 Not Modified. Unlike
+// everywhere else, ids are the stable ids of the items (see Meta), the ones the
+// change feed reports, so removing an item doesn't change the ids of the items
+// after it.
+//
+// The handler expects its paths to start at "/", so it should be used with
+// http.StripPrefix() when mounted somewhere else.
+func Handler(d *Dump, opts HandlerOptions) http.Handler {
+	if opts.Limit <= 0 {
+		opts.Limit = defaultLimit
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultMaxBodySize
+	}
+
+	if opts.Decode == nil {
+		opts.Decode = func(r io.Reader) (Item, error) {
+			if d.factory == nil {
+				return nil, ErrNoFactory
+			}
+			item := d.factory()
+			return item, json.NewDecoder(r).Decode(item)
+		}
+	}
+
+	h := &handler{dump: d, opts: opts}
+	if opts.RateLimit != nil {
+		h.limiter = newLimiter(*opts.RateLimit)
+	}
+	if opts.CORS != nil {
+		h.cors = newCORS(*opts.CORS)
+	}
+	return h
+}
+
+type handler struct {
+	dump    *Dump
+	opts    HandlerOptions
+	limiter *limiter
+	cors    *cors
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.cors != nil && h.cors.handle(w, r) {
+		return
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+
+	if path == "" {
+		switch r.Method {
+		case "GET", "HEAD":
+			if h.auth(w, r, OpList) {
+				h.list(w, r)
+			}
+		case "POST":
+			if h.auth(w, r, OpAdd) && h.allow(w, r) {
+				h.add(w, r)
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if path == "openapi.json" && (r.Method == "GET" || r.Method == "HEAD") {
+		if h.auth(w, r, OpSchema) {
+			h.openAPI(w)
+		}
+		return
+	}
+
+	id, err := strconv.ParseUint(path, 10, 64)
+	if err != nil {
+		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+		if h.auth(w, r, OpGet) && !notModified(w, r, h.dump.ETag()) {
+			h.get(w, id)
+		}
+	case "PUT":
+		if h.auth(w, r, OpUpdate) && h.allow(w, r) {
+			h.set(w, r, id)
+		}
+	case "DELETE":
+		if h.auth(w, r, OpDelete) && h.allow(w, r) {
+			writeError(w, h.dump.removeStable(id), http.StatusNoContent)
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// auth reports whether the request is allowed to perform op, responding to
+// it if it isn't.
+func (h *handler) auth(w http.ResponseWriter, r *http.Request, op Operation) bool {
+	if h.opts.Auth == nil {
+		return true
+	}
+
+	err := h.opts.Auth(r, op)
+	switch err {
+	case nil:
+		return true
+	case ErrUnauthorized:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	default:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	}
+	return false
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	offset, limit := 0, h.opts.Limit
+
+	var err error
+	if value := r.FormValue("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.FormValue("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			http.Error(w, ErrInvalidLimit.Error(), http.StatusBadRequest)
+			return
+		}
+		if limit > h.opts.Limit {
+			limit = h.opts.Limit
+		}
+	}
+
+	// the ETag is taken first, so it's never newer than the items
+	if notModified(w, r, h.dump.ETag()) {
+		return
+	}
+
+	var total int
+	items, err := h.dump.page(offset, limit, &total)
+	if err != nil {
+		writeError(w, err, 0)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	// streamed uncompressed, so every item is sent as soon as it's written
+	if acceptsNDJSON(r) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Add("Vary", "Accept")
+		writeLines(w, items, marshalItem)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.Header().Add("Vary", "Accept")
+
+	if h.opts.DisableCompression || !acceptsGzip(r) {
+		writeRawJSON(w, items)
+		return
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	writeRawJSON(gz, items)
+	gz.Close()
+}
+
+// writeRawJSON writes items, which are already marshaled, to w as a JSON
+// list.
+func writeRawJSON(w io.Writer, items []Item) error {
+	writer := bufio.NewWriter(w)
+
+	writer.WriteString(`[`)
+	for i, item := range items {
+		if i > 0 {
+			writer.WriteString(`,`)
+		}
+		writer.Write(item.(json.RawMessage))
+	}
+	writer.WriteString(`]`)
+
+	return writer.Flush()
+}
+
+// acceptsNDJSON reports whether the Accept header of the request asks for
+// newline-delimited JSON.
+func acceptsNDJSON(r *http.Request) bool {
+	for _, value := range r.Header["Accept"] {
+		for _, media := range strings.Split(value, ",") {
+			media = strings.TrimSpace(strings.Split(media, ";")[0])
+			if media == "application/x-ndjson" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of the request
+// allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, value := range r.Header["Accept-Encoding"] {
+		for _, coding := range strings.Split(value, ",") {
+			var (
+				parts = strings.Split(coding, ";")
+				name  = strings.TrimSpace(parts[0])
+			)
+
+			if name != "gzip" && name != "*" {
+				continue
+			}
+
+			for _, param := range parts[1:] {
+				param = strings.TrimSpace(param)
+				if !strings.HasPrefix(param, "q=") {
+					continue
+				}
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+
+			return true
+		}
+	}
+	return false
+}
+
+// page returns the JSON of up to limit items starting at offset, as
+// json.RawMessage values, and sets total to the number of items in the dump.
+// The items are marshaled under the read lock, as they may be changed in
+// place.
+func (d *Dump) page(offset, limit int, total *int) ([]Item, error) {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	*total = len(d.items)
+	if offset > len(d.items) {
+		offset = len(d.items)
+	}
+	if limit > len(d.items)-offset {
+		limit = len(d.items) - offset
+	}
+
+	items := make([]Item, limit)
+	for i, item := range d.items[offset : offset+limit] {
+		data, err := d.marshalJSON(item)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = json.RawMessage(data)
+	}
+	return items, nil
+}
+
+// stableJSON returns the item with the provided stable id as JSON. The item
+// is marshaled under the read lock, as it may be changed in place.
+func (d *Dump) stableJSON(id uint64) ([]byte, error) {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	return d.itemJSON(d.find(id), false)
+}
+
+// addStable adds the item like Add() does, but returns its stable id.
+func (d *Dump) addStable(item Item) (id uint64, err error) {
+	span := d.trace("Add")
+	defer func() { span.End(err) }()
+
+	if err := d.lock(); err != nil {
+		return 0, err
+	}
+	span.Locked()
+	defer d.mutex.Unlock()
+
+	if id, err = d.add(item); err != nil {
+		return 0, err
+	}
+
+	if d.autosave() {
+		return id, d.save()
+	}
+
+	return id, nil
+}
+
+// setStable replaces the item with the provided stable id like Set() does.
+// The item is looked up under the same lock it's replaced under, so it can't
+// move in between.
+func (d *Dump) setStable(id uint64, item Item) (err error) {
+	span := d.trace("Set")
+	defer func() { span.End(err) }()
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	span.Locked()
+	defer d.mutex.Unlock()
+
+	if err := d.set(d.find(id), item); err != nil {
+		return err
+	}
+
+	if d.autosave() {
+		return d.save()
+	}
+
+	return nil
+}
+
+// removeStable removes the item with the provided stable id like Remove()
+// does.
+func (d *Dump) removeStable(id uint64) (err error) {
+	span := d.trace("Remove")
+	defer func() { span.End(err) }()
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	span.Locked()
+	defer d.mutex.Unlock()
+
+	i := d.find(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	if _, err := d.remove(func(other int) bool { return other == i }); err != nil {
+		return err
+	}
+
+	if d.autosave() {
+		return d.save()
+	}
+
+	return nil
+}
+
+func (h *handler) get(w http.ResponseWriter, id uint64) {
+	data, err := h.dump.stableJSON(id)
+	if err != nil {
+		writeError(w, err, 0)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *handler) add(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := h.dump.addStable(item)
+	if err != nil {
+		writeError(w, err, 0)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	// the original path, since the handler is usually behind StripPrefix()
+	base := r.URL.Path
+	if original, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		base = original.Path
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/%d", strings.TrimSuffix(base, "/"), id))
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, `{"id":%d}`, id)
+}
+
+func (h *handler) set(w http.ResponseWriter, r *http.Request, id uint64) {
+	item, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+
+	writeError(w, h.dump.setStable(id, item), http.StatusNoContent)
+}
+
+// decode decodes the item in the body of the request and validates it (see
+// WithValidator()), responding to the request if that fails.
+func (h *handler) decode(w http.ResponseWriter, r *http.Request) (Item, bool) {
+	item, err := h.opts.Decode(http.MaxBytesReader(w, r.Body, h.opts.MaxBodySize))
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+	case err == ErrNoFactory:
+		writeError(w, err, 0)
+		return nil, false
+	case errors.As(err, &tooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return nil, false
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	// the validators can return any error, which would look like a failure
+	// of the server once returned by Add() or Set()
+	if err = h.dump.check(item); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return nil, false
+	}
+	return item, true
+}
+
+// writeError responds with the status code matching err, or with status if
+// err is nil.
+func writeError(w http.ResponseWriter, err error, status int) {
+	var invalid *ValidationError
+	switch {
+	case err == nil:
+		w.WriteHeader(status)
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrDuplicate):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrDangling), errors.As(err, &invalid):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, ErrClosed):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *handler) openAPI(w http.ResponseWriter) {
+	data, err := h.dump.OpenAPI("dump", "1.0.0")
+	if err != nil {
+		writeError(w, err, 0)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
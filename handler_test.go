@@ -0,0 +1,251 @@
+package dump
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	test, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}},
+		WithFactory(func() Item { return &Plain{} }),
+		WithUniqueIndex("name", func(item Item) string { return item.(*Plain).Name }))
+
+	handler := http.StripPrefix("/plain", Handler(test, HandlerOptions{Limit: 2}))
+
+	do := func(method, path, body string, status int, expected string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+		if recorder.Code != status {
+			t.Fatalf("%s %s: expected %d, got %d (%s)", method, path, status,
+				recorder.Code, recorder.Body.String())
+		}
+		if expected != "" && strings.TrimSpace(recorder.Body.String()) != expected {
+			t.Fatalf("%s %s: expected %s, got %s", method, path, expected,
+				recorder.Body.String())
+		}
+		return recorder
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		do("POST", "/plain/", `{"name":"`+name+`"}`, http.StatusCreated, "")
+	}
+
+	created := do("POST", "/plain", `{"name":"d"}`, http.StatusCreated, `{"id":3}`)
+	if created.Header().Get("Location") != "/plain/3" {
+		t.Fatal("bad location", created.Header().Get("Location"))
+	}
+
+	list := do("GET", "/plain/", "", http.StatusOK, `[{"name":"a"},{"name":"b"}]`)
+	if list.Header().Get("X-Total-Count") != "4" {
+		t.Fatal("bad total count")
+	}
+
+	do("GET", "/plain/?offset=3&limit=10", "", http.StatusOK, `[{"name":"d"}]`)
+	do("GET", "/plain/?offset=9", "", http.StatusOK, `[]`)
+	do("GET", "/plain/?offset=-1", "", http.StatusBadRequest, "")
+	do("GET", "/plain/?limit=0", "", http.StatusBadRequest, "")
+
+	do("GET", "/plain/1", "", http.StatusOK, `{"name":"b"}`)
+	do("GET", "/plain/9", "", http.StatusNotFound, "")
+	do("GET", "/plain/nope", "", http.StatusNotFound, "")
+
+	do("PUT", "/plain/1", `{"name":"e"}`, http.StatusNoContent, "")
+	do("GET", "/plain/1", "", http.StatusOK, `{"name":"e"}`)
+	do("PUT", "/plain/1", `{"name":"a"}`, http.StatusConflict, "")
+	do("PUT", "/plain/1", `{`, http.StatusBadRequest, "")
+	do("PUT", "/plain/9", `{"name":"f"}`, http.StatusNotFound, "")
+
+	// ids are stable, so removing an item doesn't move the ones after it
+	do("DELETE", "/plain/0", "", http.StatusNoContent, "")
+	do("GET", "/plain/0", "", http.StatusNotFound, "")
+	do("GET", "/plain/1", "", http.StatusOK, `{"name":"e"}`)
+	do("DELETE", "/plain/0", "", http.StatusNotFound, "")
+	do("PUT", "/plain/2", `{"name":"f"}`, http.StatusNoContent, "")
+	do("DELETE", "/plain/2", "", http.StatusNoContent, "")
+	do("GET", "/plain/3", "", http.StatusOK, `{"name":"d"}`)
+	do("DELETE", "/plain/9", "", http.StatusNotFound, "")
+
+	if do("DELETE", "/plain/", "", http.StatusMethodNotAllowed, "").Header().Get("Allow") == "" {
+		t.Fatal("missing allow header")
+	}
+	do("POST", "/plain/0", "", http.StatusMethodNotAllowed, "")
+
+	plain, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Plain", &Plain{}})
+	recorder := httptest.NewRecorder()
+	Handler(plain, HandlerOptions{}).ServeHTTP(recorder,
+		httptest.NewRequest("POST", "/", strings.NewReader(`{}`)))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatal("added without a factory")
+	}
+}
+
+func TestHandlerAuth(t *testing.T) {
+	test, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}},
+		WithFactory(func() Item { return &Plain{} }))
+	test.Add(&Plain{"a"})
+
+	var ops []string
+	handler := Handler(test, HandlerOptions{
+		Auth: func(r *http.Request, op Operation) error {
+			ops = append(ops, op.String())
+			if !op.Write() {
+				return nil
+			}
+			switch r.Header.Get("Authorization") {
+			case "":
+				return ErrUnauthorized
+			case "Bearer secret":
+				return nil
+			}
+			return errors.New("wrong token")
+		},
+	})
+
+	for _, request := range []struct {
+		method, path, token string
+		status              int
+	}{
+		{"GET", "/", "", http.StatusOK},
+		{"GET", "/0", "", http.StatusOK},
+		{"POST", "/", "", http.StatusUnauthorized},
+		{"PUT", "/0", "Bearer wrong", http.StatusForbidden},
+		{"PUT", "/0", "Bearer secret", http.StatusNoContent},
+		{"DELETE", "/0", "Bearer secret", http.StatusNoContent},
+	} {
+		r := httptest.NewRequest(request.method, request.path, strings.NewReader(`{"name":"b"}`))
+		if request.token != "" {
+			r.Header.Set("Authorization", request.token)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		if recorder.Code != request.status {
+			t.Fatalf("%s %s: expected %d, got %d", request.method, request.path,
+				request.status, recorder.Code)
+		}
+	}
+
+	if strings.Join(ops, ",") != "list,get,add,update,update,delete" {
+		t.Fatal("bad operations", ops)
+	}
+
+	if Operation(99).String() != "unknown" {
+		t.Fatal("bad unknown operation")
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	test, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Age", &Age{}}},
+		WithFactory(func() Item { return &Age{} }))
+	test.Add(&Age{1})
+
+	handler := Handler(test, HandlerOptions{
+		MaxBodySize: 32,
+		Auth: func(r *http.Request, op Operation) error {
+			if op == OpSchema {
+				return ErrUnauthorized
+			}
+			return nil
+		},
+	})
+
+	do := func(method, path, body string) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder.Code
+	}
+
+	for _, request := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{"GET", "/openapi.json", "", http.StatusUnauthorized},
+		{"POST", "/", `{"Years":-1}`, http.StatusUnprocessableEntity},
+		{"PUT", "/0", `{"Years":-1}`, http.StatusUnprocessableEntity},
+		{"POST", "/", `{"Years":`, http.StatusBadRequest},
+		{"POST", "/", `{"Years":` + strings.Repeat("1", 32) + `}`, http.StatusRequestEntityTooLarge},
+	} {
+		if status := do(request.method, request.path, request.body); status != request.status {
+			t.Fatalf("%s %s: expected %d, got %d", request.method, request.path, request.status, status)
+		}
+	}
+
+	test.Close()
+	if status := do("PUT", "/0", `{"Years":2}`); status != http.StatusServiceUnavailable {
+		t.Fatal("expected 503 once closed", status)
+	}
+}
+
+func TestHandlerGzip(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Plain", &Plain{}})
+	test.AddAll(&Plain{"a"}, &Plain{"b"})
+
+	list := func(opts HandlerOptions, encoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		if encoding != "" {
+			r.Header.Set("Accept-Encoding", encoding)
+		}
+		recorder := httptest.NewRecorder()
+		Handler(test, opts).ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	for _, encoding := range []string{"gzip", "deflate, gzip;q=0.5", "*"} {
+		response := list(HandlerOptions{}, encoding)
+		if response.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatal("response wasn't compressed for", encoding)
+		}
+
+		reader, err := gzip.NewReader(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := ioutil.ReadAll(reader); string(data) != `[{"name":"a"},{"name":"b"}]` {
+			t.Fatal("bad compressed body", string(data))
+		}
+	}
+
+	for _, encoding := range []string{"", "deflate", "gzip;q=0"} {
+		if response := list(HandlerOptions{}, encoding); response.Header().Get("Content-Encoding") != "" {
+			t.Fatal("response was compressed for", encoding)
+		}
+	}
+
+	if response := list(HandlerOptions{DisableCompression: true}, "gzip"); response.Header().Get("Content-Encoding") != "" ||
+		response.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatal("compression wasn't disabled")
+	}
+}
+
+func TestHandlerListConcurrentUpdate(t *testing.T) {
+	types := []Type{{"dump.Counter", &Counter{}}}
+	test, _ := New("test.db", PERSIST_MANUAL, types)
+	test.Add(&Counter{"a", 0})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			test.UpdateAt(0, func(item Item) error {
+				item.(*Counter).Count++
+				return nil
+			})
+		}
+	}()
+
+	h := Handler(test, HandlerOptions{})
+	for i := 0; i < 100; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatal("bad status", w.Code)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,220 @@
+package dump
+
+// Hooks are functions called by the dump as its items change and as it is
+// persisted, registered with WithHooks(). Every hook is optional.
+//
+// Hooks are called while the dump is locked, so they must not call any of
+// the methods of the dump.
+type Hooks struct {
+	// BeforeAdd is called with every item before it is added by Add(),
+	// AddAll(), Upsert() or ImportJSONL(). It can change the item (to set a
+	// timestamp, for example) or return an error to stop the items from being
+	// added, in which case the error is returned.
+	BeforeAdd func(item Item) error
+
+	// AfterAdd is called with the id of every item that was added.
+	AfterAdd func(id int, item Item)
+
+	// AfterUpdate is called with the id of every item that was changed or
+	// replaced.
+	AfterUpdate func(id int, item Item)
+
+	// AfterDelete is called with the id every deleted item had before it was
+	// deleted by DeleteWhere() or Clear().
+	AfterDelete func(id int, item Item)
+
+	// AfterSave is called after every save with its error (nil if the save
+	// succeeded).
+	AfterSave func(err error)
+
+	// AfterWrite is called before AfterSave with the name of the file a
+	// successful save wrote (the dump file, or the file of
+	// WithEmergencyFile()) and its contents, to copy it elsewhere or
+	// invalidate caches without watching the file. data is only valid until
+	// the hook returns. Segment and chunk files are written before the dump
+	// file, and dumps created with WithRecordStore() or WithCommandLog()
+	// don't write a dump file when they are saved.
+	AfterWrite func(path string, data []byte)
+
+	// OnLoad is called with the items after the dump was loaded by Load() or
+	// LoadJSON(). If it returns an error, the error is returned (the items
+	// stay loaded).
+	OnLoad func(items []Item) error
+}
+
+// WithHooks is an option that registers hooks. It can be used more than once,
+// in which case the hooks are called in the order they were registered.
+func WithHooks(h Hooks) Option {
+	return func(d *Dump) error {
+		d.hooks = append(d.hooks, h)
+		return nil
+	}
+}
+
+// no mutex
+func (d *Dump) beforeAdd(items []Item) error {
+	for _, h := range d.hooks {
+		if h.BeforeAdd == nil {
+			continue
+		}
+		for _, item := range items {
+			if err := h.BeforeAdd(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	// items are validated as the hooks left them
+	return d.validate(items...)
+}
+
+// no mutex
+func (d *Dump) afterAdd(ids ...int) {
+	d.revise(ids...)
+	for _, id := range ids {
+		d.record(Command{Kind: CommandAdd, Item: d.items[id]})
+	}
+
+	if d.feed != nil {
+		for _, id := range ids {
+			d.publish("add", id, d.items[id], d.meta[id])
+		}
+	}
+	for _, id := range ids {
+		d.notify("add", id, d.items[id], d.meta[id])
+	}
+
+	for _, h := range d.hooks {
+		if h.AfterAdd == nil {
+			continue
+		}
+		for _, id := range ids {
+			h.AfterAdd(id, d.items[id])
+		}
+	}
+}
+
+// no mutex
+func (d *Dump) afterUpdate(ids ...int) {
+	// the commands set the items where they were, which moves them again
+	// when the log is replayed, unless moving them one at a time could put
+	// equal items in another order
+	moved, ok := d.reorder(ids)
+	if ok && len(ids) > 1 {
+		d.record(Command{Kind: CommandReplace, Items: d.items})
+	} else {
+		for i, id := range ids {
+			d.record(Command{Kind: CommandSet, ID: id, Item: d.items[moved[i]]})
+		}
+	}
+	ids = moved
+
+	d.revise(ids...)
+
+	if d.feed != nil {
+		for _, id := range ids {
+			d.publish("update", id, d.items[id], d.meta[id])
+		}
+	}
+	for _, id := range ids {
+		d.notify("update", id, d.items[id], d.meta[id])
+	}
+
+	for _, h := range d.hooks {
+		if h.AfterUpdate == nil {
+			continue
+		}
+		for _, id := range ids {
+			h.AfterUpdate(id, d.items[id])
+		}
+	}
+}
+
+// no mutex
+func (d *Dump) afterDelete(ids []int, items []Item, metas []meta) {
+	if d.crdt != nil {
+		d.crdt.bury(metas)
+	}
+	if d.lru != nil {
+		d.lru.forget(metas)
+	}
+	d.unrevise(metas)
+
+	// ids are positions before the delete, so they are removed from the end
+	if len(d.items) == 0 {
+		d.record(Command{Kind: CommandClear})
+	} else {
+		for i := len(ids) - 1; i >= 0; i-- {
+			d.record(Command{Kind: CommandRemove, ID: ids[i]})
+		}
+	}
+
+	if d.feed != nil {
+		for i, id := range ids {
+			d.publish("delete", id, items[i], metas[i])
+		}
+	}
+	for i, id := range ids {
+		d.notify("delete", id, items[i], metas[i])
+	}
+
+	for _, h := range d.hooks {
+		if h.AfterDelete == nil {
+			continue
+		}
+		for i, id := range ids {
+			h.AfterDelete(id, items[i])
+		}
+	}
+
+	d.dereference(metas)
+}
+
+// no mutex
+func (d *Dump) afterReset() {
+	if !d.ordered() {
+		d.arrange(d.order)
+	}
+	d.reconcile()
+	d.record(Command{Kind: CommandReplace, Items: d.items})
+
+	if d.feed != nil {
+		d.publish("reset", -1, nil, meta{})
+	}
+	d.notify("reset", -1, nil, meta{})
+}
+
+// no mutex
+func (d *Dump) afterSave(err error) {
+	for _, w := range d.webhooks {
+		w.flush(err)
+	}
+
+	for _, h := range d.hooks {
+		if h.AfterSave != nil {
+			h.AfterSave(err)
+		}
+	}
+}
+
+// no mutex
+func (d *Dump) afterWrite(path string, data []byte) {
+	for _, h := range d.hooks {
+		if h.AfterWrite != nil {
+			h.AfterWrite(path, data)
+		}
+	}
+}
+
+// no mutex
+func (d *Dump) onLoad() error {
+	for _, h := range d.hooks {
+		if h.OnLoad == nil {
+			continue
+		}
+		if err := h.OnLoad(d.items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
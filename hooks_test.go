@@ -0,0 +1,129 @@
+package dump
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	var (
+		events  []string
+		errTest = errors.New("hooks")
+	)
+
+	event := func(format string, args ...interface{}) {
+		events = append(events, fmt.Sprintf(format, args...))
+	}
+
+	expect := func(expected ...string) {
+		if strings.Join(events, ",") != strings.Join(expected, ",") {
+			t.Fatalf("expected %v, got %v", expected, events)
+		}
+		events = nil
+	}
+
+	test, _ := New("test.db", PERSIST_WRITES, []Type{{"dump.Blob", &Blob{}}},
+		WithHooks(Hooks{
+			BeforeAdd: func(item Item) error {
+				if item.(*Blob).Data == "invalid" {
+					return errTest
+				}
+				item.(*Blob).Data = strings.ToUpper(item.(*Blob).Data)
+				return nil
+			},
+			AfterAdd: func(id int, item Item) {
+				event("add %d %s", id, item.(*Blob).Data)
+			},
+			AfterUpdate: func(id int, item Item) {
+				event("update %d %s", id, item.(*Blob).Data)
+			},
+			AfterDelete: func(id int, item Item) {
+				event("delete %d %s", id, item.(*Blob).Data)
+			},
+			OnLoad: func(items []Item) error {
+				event("load %d", len(items))
+				return nil
+			},
+		}),
+		WithHooks(Hooks{
+			AfterSave: func(err error) {
+				event("save %v", err)
+			},
+		}))
+
+	test.AddAll(&Blob{"a"}, &Blob{"b"})
+	expect("add 0 A", "add 1 B", "save <nil>")
+
+	if _, err := test.Add(&Blob{"invalid"}); err != errTest || test.Len() != 2 {
+		t.Fatal("before add didn't stop the add")
+	}
+	expect()
+
+	test.Set(1, &Blob{"c"})
+	expect("update 1 c", "save <nil>")
+
+	test.Update(func(items []Item) error {
+		items[0].(*Blob).Data = "d"
+		return nil
+	})
+	expect("update 0 d", "save <nil>")
+
+	test.UpdateAt(0, func(item Item) error { return errTest })
+	expect()
+
+	test.DeleteWhere(func(item Item) bool { return item.(*Blob).Data == "d" })
+	expect("delete 0 d", "save <nil>")
+
+	test.Load()
+	expect("load 1")
+
+	test.Clear()
+	expect("delete 0 c", "save <nil>")
+}
+
+func TestOnLoadError(t *testing.T) {
+	var errTest = errors.New("on load")
+
+	test, _ := New("test.db", PERSIST_WRITES, []Type{{"dump.Blob", &Blob{}}},
+		WithHooks(Hooks{
+			OnLoad: func(items []Item) error { return errTest },
+		}))
+	test.Add(&Blob{"a"})
+
+	if err := test.Load(); err != errTest {
+		t.Fatal("on load error wasn't returned")
+	}
+}
+
+func TestAfterWrite(t *testing.T) {
+	defer os.Remove("written.db")
+
+	var (
+		paths   []string
+		written []byte
+	)
+	test, _ := New("written.db", PERSIST_WRITES, []Type{{"dump.Plain", &Plain{}}},
+		WithHooks(Hooks{
+			AfterWrite: func(path string, data []byte) {
+				paths = append(paths, path)
+				written = append(written[:0], data...)
+			},
+			AfterSave: func(err error) {
+				paths = append(paths, "saved")
+			},
+		}))
+
+	test.Add(&Plain{"a"})
+	if len(paths) != 2 || paths[0] != "written.db" || paths[1] != "saved" {
+		t.Fatal("bad hooks", paths)
+	}
+
+	data, _ := os.ReadFile("written.db")
+	if !bytes.Equal(data, written) {
+		t.Fatal("data isn't the file")
+	}
+}
@@ -0,0 +1,208 @@
+package dump
+
+// index maps the key of every item to the ids of the items with that key.
+type index struct {
+	key    func(item Item) string
+	unique bool
+	keys   []string
+	ids    map[string][]int
+}
+
+// WithIndex is an option that registers an index with the provided name. The
+// key function returns the value an item is indexed by (such as an email
+// address). The index is kept up to date as items are added and changed, and
+// GetByIndex() looks up items by their key without scanning the dump.
+func WithIndex(name string, key func(item Item) string) Option {
+	return withIndex(name, key, false)
+}
+
+// WithUniqueIndex is an option that registers an index like WithIndex() but
+// also prevents two items from having the same key. Writes that would cause a
+// duplicate key fail with ErrDuplicate and leave the dump unchanged. Items
+// loaded from disk aren't checked.
+func WithUniqueIndex(name string, key func(item Item) string) Option {
+	return withIndex(name, key, true)
+}
+
+func withIndex(name string, key func(item Item) string, unique bool) Option {
+	return func(d *Dump) error {
+		if _, ok := d.indexes[name]; ok || name == "" || key == nil {
+			return ErrInvalidIndex
+		}
+		if d.indexes == nil {
+			d.indexes = make(map[string]*index)
+		}
+		d.indexes[name] = &index{
+			key:    key,
+			unique: unique,
+			ids:    make(map[string][]int),
+		}
+		return nil
+	}
+}
+
+// GetByIndex returns the ids and items with the provided value in the named
+// index, in id order. It returns ErrNoIndex if there is no index with that
+// name.
+func (d *Dump) GetByIndex(name, value string) ([]int, []Item, error) {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	idx, ok := d.indexes[name]
+	if !ok {
+		return nil, nil, ErrNoIndex
+	}
+
+	var (
+		ids   = append([]int{}, idx.ids[value]...)
+		items = make([]Item, len(ids))
+	)
+
+	for i, id := range ids {
+		items[i] = d.items[id]
+		d.used(id)
+	}
+
+	items, err := d.reading(items)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ids, items, nil
+}
+
+// hasUnique reports whether the dump has any unique indexes.
+//
+// no mutex
+func (d *Dump) hasUnique() bool {
+	for _, idx := range d.indexes {
+		if idx.unique {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAppend returns ErrDuplicate if appending items would violate a unique
+// index.
+//
+// no mutex
+func (d *Dump) checkAppend(items []Item) error {
+	for _, idx := range d.indexes {
+		if !idx.unique {
+			continue
+		}
+
+		seen := make(map[string]bool, len(items))
+		for _, item := range items {
+			key := idx.key(item)
+			if len(idx.ids[key]) > 0 || seen[key] {
+				return ErrDuplicate
+			}
+			seen[key] = true
+		}
+	}
+	return nil
+}
+
+// checkSet returns ErrDuplicate if replacing the item with the provided id
+// would violate a unique index.
+//
+// no mutex
+func (d *Dump) checkSet(id int, item Item) error {
+	for _, idx := range d.indexes {
+		if !idx.unique {
+			continue
+		}
+
+		for _, other := range idx.ids[idx.key(item)] {
+			if other != id {
+				return ErrDuplicate
+			}
+		}
+	}
+	return nil
+}
+
+// checkIndexes returns ErrDuplicate if a unique index currently has a key
+// shared by more than one item.
+//
+// no mutex
+func (d *Dump) checkIndexes() error {
+	for _, idx := range d.indexes {
+		if !idx.unique {
+			continue
+		}
+
+		for _, ids := range idx.ids {
+			if len(ids) > 1 {
+				return ErrDuplicate
+			}
+		}
+	}
+	return nil
+}
+
+// indexFrom adds the items starting at from to every index.
+//
+// no mutex
+func (d *Dump) indexFrom(from int) {
+	for _, idx := range d.indexes {
+		for id := from; id < len(d.items); id++ {
+			key := idx.key(d.items[id])
+			idx.keys = append(idx.keys, key)
+			idx.ids[key] = append(idx.ids[key], id)
+		}
+	}
+}
+
+// indexSet updates every index after the item with the provided id changed.
+//
+// no mutex
+func (d *Dump) indexSet(id int) {
+	for _, idx := range d.indexes {
+		old, key := idx.keys[id], idx.key(d.items[id])
+		if old == key {
+			continue
+		}
+
+		ids := idx.ids[old]
+		for i := range ids {
+			if ids[i] == id {
+				ids = append(ids[:i], ids[i+1:]...)
+				break
+			}
+		}
+
+		if len(ids) == 0 {
+			delete(idx.ids, old)
+		} else {
+			idx.ids[old] = ids
+		}
+
+		idx.keys[id] = key
+		idx.ids[key] = insertID(idx.ids[key], id)
+	}
+}
+
+// reindex rebuilds every index from scratch.
+//
+// no mutex
+func (d *Dump) reindex() {
+	for _, idx := range d.indexes {
+		idx.keys = idx.keys[:0]
+		idx.ids = make(map[string][]int)
+	}
+	d.indexFrom(0)
+}
+
+// insertID inserts id into the sorted list of ids.
+func insertID(ids []int, id int) []int {
+	i := len(ids)
+	for i > 0 && ids[i-1] > id {
+		i--
+	}
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = id
+	return ids
+}
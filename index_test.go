@@ -0,0 +1,186 @@
+package dump
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	byData := func(item Item) string { return item.(*Blob).Data }
+
+	for _, option := range []Option{
+		WithIndex("", byData),
+		WithIndex("data", nil),
+	} {
+		if _, err := New("index.db", PERSIST_MANUAL,
+			[]Type{{"dump.Blob", &Blob{}}}, option); err != ErrInvalidIndex {
+			t.Fatal("accepted invalid index")
+		}
+	}
+
+	if _, err := New("index.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}},
+		WithIndex("data", byData), WithIndex("data", byData)); err != ErrInvalidIndex {
+		t.Fatal("accepted duplicate index")
+	}
+
+	test, _ := New("index.db", PERSIST_WRITES,
+		[]Type{{"dump.Blob", &Blob{}}}, WithIndex("data", byData))
+
+	lookup := func(d *Dump, value string, expected ...int) {
+		ids, items, err := d.GetByIndex("data", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != len(expected) {
+			t.Fatalf("%s: expected ids %v, got %v", value, expected, ids)
+		}
+		for i := range ids {
+			if ids[i] != expected[i] || items[i].(*Blob).Data != value {
+				t.Fatalf("%s: expected ids %v, got %v", value, expected, ids)
+			}
+		}
+	}
+
+	test.Add(&Blob{"a"})
+	test.AddAll(&Blob{"b"}, &Blob{"a"})
+	lookup(test, "a", 0, 2)
+	lookup(test, "b", 1)
+	lookup(test, "c")
+
+	test.Set(0, &Blob{"b"})
+	lookup(test, "a", 2)
+	lookup(test, "b", 0, 1)
+
+	test.Set(2, &Blob{"b"})
+	test.Set(1, &Blob{"b"})
+	lookup(test, "a")
+	lookup(test, "b", 0, 1, 2)
+
+	test.Update(func(items []Item) error {
+		items[1].(*Blob).Data = "c"
+		return nil
+	})
+	lookup(test, "b", 0, 2)
+	lookup(test, "c", 1)
+
+	test.Map(func(item Item) error {
+		item.(*Blob).Data = "d"
+		return nil
+	})
+	lookup(test, "d", 0, 1, 2)
+
+	other, _ := New("index.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithIndex("data", byData))
+	other.Load()
+	lookup(other, "d", 0, 1, 2)
+
+	other.ImportJSONL(bytes.NewBufferString(`{"data":"e"}`), func() Item { return &Blob{} })
+	lookup(other, "e", 3)
+
+	other.LoadJSON(bytes.NewBufferString(`[{"data":"f"}]`), func() Item { return &Blob{} })
+	lookup(other, "f", 0)
+	lookup(other, "d")
+
+	other.Clear()
+	lookup(other, "f")
+
+	if _, _, err := other.GetByIndex("missing", "f"); err != ErrNoIndex {
+		t.Fatal("expected ErrNoIndex")
+	}
+}
+
+func TestInsertID(t *testing.T) {
+	ids := insertID(insertID(insertID(nil, 5), 1), 3)
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 3 || ids[2] != 5 {
+		t.Fatal("bad insert", ids)
+	}
+}
+
+func TestUniqueIndex(t *testing.T) {
+	byData := func(item Item) string { return item.(*Blob).Data }
+
+	test, _ := New("unique.db", PERSIST_WRITES,
+		[]Type{{"dump.Blob", &Blob{}}},
+		WithUniqueIndex("data", byData), WithIndex("other", byData))
+
+	if _, err := test.Add(&Blob{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := test.Add(&Blob{"a"}); err != ErrDuplicate || id != -1 {
+		t.Fatal("added duplicate")
+	}
+
+	if _, err := test.AddAll(&Blob{"b"}, &Blob{"b"}); err != ErrDuplicate {
+		t.Fatal("added duplicates within batch")
+	}
+
+	if _, err := test.AddAll(&Blob{"b"}, &Blob{"c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := test.Set(1, &Blob{"a"}); err != ErrDuplicate {
+		t.Fatal("set duplicate")
+	}
+
+	if err := test.Set(1, &Blob{"b"}); err != nil {
+		t.Fatal("set rejected its own key")
+	}
+
+	if err := test.Update(func(items []Item) error {
+		items[2].(*Blob).Data = "a"
+		return nil
+	}); err != ErrDuplicate {
+		t.Fatal("update made duplicate")
+	}
+
+	if item, _ := test.Get(2); item.(*Blob).Data != "c" {
+		t.Fatal("update wasn't undone")
+	}
+
+	if ids, _, _ := test.GetByIndex("data", "c"); len(ids) != 1 || ids[0] != 2 {
+		t.Fatal("index wasn't restored")
+	}
+
+	if err := test.Map(func(item Item) error {
+		item.(*Blob).Data = "same"
+		return nil
+	}); err != ErrDuplicate {
+		t.Fatal("map made duplicate")
+	}
+
+	if err := test.Map(func(item Item) error {
+		item.(*Blob).Data += "!"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := test.ImportJSONL(bytes.NewBufferString(`{"data":"a!"}`),
+		func() Item { return &Blob{} }); err != ErrDuplicate {
+		t.Fatal("imported duplicate")
+	}
+
+	if err := test.LoadJSON(bytes.NewBufferString(`[{"data":"x"},{"data":"x"}]`),
+		func() Item { return &Blob{} }); err != ErrDuplicate {
+		t.Fatal("loaded duplicate json")
+	}
+
+	if test.Len() != 3 {
+		t.Fatal("failed load json changed the dump")
+	}
+
+	unregistered, _ := New("unique.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}},
+		WithUniqueIndex("data", func(Item) string { return "" }))
+	unregistered.Add(&Unregistered{})
+
+	if err := unregistered.Update(func([]Item) error { return nil }); err == nil {
+		t.Fatal("backed up unregistered type")
+	}
+
+	if err := unregistered.Map(func(Item) error { return nil }); err == nil {
+		t.Fatal("backed up unregistered type")
+	}
+}
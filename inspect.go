@@ -0,0 +1,95 @@
+package dump
+
+import (
+	"io/ioutil"
+)
+
+// FileInfo describes a dump file, as returned by Inspect().
+type FileInfo struct {
+	// Version is the version of the on-disk format, or 0 for files written
+	// before dump files had a header.
+	Version int
+
+	// Compressed is whether the payload is compressed.
+	Compressed bool
+
+	// Protobuf is whether the items are protobuf encoded (see
+	// WithProtobuf()).
+	Protobuf bool
+
+	// Signed is whether the file is signed (see WithSigning()). The
+	// signature isn't verified.
+	Signed bool
+
+	// Size is the size of the file in bytes.
+	Size int
+}
+
+// Inspect returns information about the named dump file, after checking its
+// checksum, without decoding its items (so their types don't have to be
+// registered). It returns ErrCorrupt if the file is truncated or fails its
+// checksum.
+func Inspect(filename string) (FileInfo, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	h, _, legacy, err := decodeFile(data)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	info := FileInfo{Version: int(h.version), Size: len(data)}
+	if !legacy {
+		info.Compressed = h.flags&flagCompressed != 0
+		info.Protobuf = h.flags&flagProtobuf != 0
+		info.Signed = h.flags&flagSigned != 0
+	}
+	return info, nil
+}
+
+// ConvertFile rewrites the dump file in as out, compressed with to (or
+// uncompressed if to is nil). A compressed file is decompressed with from.
+// The items aren't decoded, so their types don't have to be registered.
+//
+// It returns ErrCompressed if in is compressed and from is nil, and
+// ErrUnsupportedFormat for files written before dump files had a header. The
+// segment files of a dump created with WithSegments() aren't converted, and
+// signed files (see WithSigning()) are written unsigned.
+func ConvertFile(in, out string, from, to Compression) error {
+	data, err := ioutil.ReadFile(in)
+	if err != nil {
+		return err
+	}
+
+	h, payload, legacy, err := decodeFile(data)
+	if err != nil {
+		return err
+	}
+	if legacy {
+		return ErrUnsupportedFormat
+	}
+
+	if h.flags&flagCompressed != 0 {
+		if from == nil {
+			return ErrCompressed
+		}
+		if payload, err = from.Decompress(payload); err != nil {
+			return err
+		}
+		h.flags &^= flagCompressed
+	}
+
+	// the signature can't be computed again without the key
+	h.flags &^= flagSigned
+
+	if to != nil {
+		if payload, err = to.Compress(payload); err != nil {
+			return err
+		}
+		h.flags |= flagCompressed
+	}
+
+	return ioutil.WriteFile(out, encodeFile(h, payload), 0644)
+}
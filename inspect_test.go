@@ -0,0 +1,43 @@
+package dump
+
+import (
+	"os"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	defer os.Remove("inspect.db")
+	defer os.Remove("inspect.gz.db")
+
+	test, _ := New("inspect.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}})
+	test.Add(&Plain{"karl"})
+	test.Save()
+
+	info, err := Inspect("inspect.db")
+	if err != nil || info.Version != formatVersion || info.Compressed || info.Size == 0 {
+		t.Fatal("bad info", info, err)
+	}
+
+	if err := ConvertFile("inspect.db", "inspect.gz.db", nil, Gzip); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ = Inspect("inspect.gz.db"); !info.Compressed {
+		t.Fatal("expected compressed file")
+	}
+	if err := ConvertFile("inspect.gz.db", "inspect.db", nil, nil); err != ErrCompressed {
+		t.Fatal("expected ErrCompressed", err)
+	}
+
+	compressed, _ := New("inspect.gz.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}},
+		WithCompression(Gzip))
+	if err := compressed.Load(); err != nil || compressed.Len() != 1 {
+		t.Fatal("bad converted file", err)
+	}
+
+	data, _ := os.ReadFile("inspect.db")
+	data[len(data)-1]++
+	os.WriteFile("inspect.db", data, 0644)
+	if _, err := Inspect("inspect.db"); err != ErrCorrupt {
+		t.Fatal("expected ErrCorrupt", err)
+	}
+}
@@ -0,0 +1,134 @@
+package dump
+
+import (
+	"encoding/gob"
+	"fmt"
+	"reflect"
+)
+
+// WithItemCodec is an option that persists the items of the type of value
+// (such as &User{}) with encode and decode instead of gob, for types with
+// fields that shouldn't be written to disk (such as computed fields) or whose
+// persisted layout differs from the Go type (such as a legacy layout). It
+// can be used once per type, which must be registered with New(), and can't
+// be combined with WithProtobuf(). Collections use the item codecs of the
+// dump they belong to.
+//
+// encode returns the persisted form of an item, and decode returns the item
+// it was encoded from. The JSON representation of the items isn't affected.
+// It applies to the dump file, its collections, segments and chunks, and to
+// the records of WithRecordStore(), the revisions of WithRevisions() and the
+// commands of WithCommandLog(). Items written before it was enabled are
+// still decoded by gob, and a dump file with items encoded by it can't be
+// loaded without it (the type is reported by an *UnknownTypeError).
+func WithItemCodec(value Item, encode func(item Item) ([]byte, error), decode func(data []byte) (Item, error)) Option {
+	return func(d *Dump) error {
+		if value == nil || encode == nil || decode == nil {
+			return ErrInvalidItemCodec
+		}
+
+		t := reflect.TypeOf(value)
+		for _, registered := range d.types {
+			if reflect.TypeOf(registered.Value) != t {
+				continue
+			}
+			if _, ok := d.codecs[t]; ok {
+				return ErrInvalidItemCodec
+			}
+
+			if d.codecs == nil {
+				d.codecs = make(map[reflect.Type]*itemCodec)
+			}
+			d.codecs[t] = &itemCodec{name: registered.Name, encode: encode, decode: decode}
+			return nil
+		}
+		return ErrInvalidItemCodec
+	}
+}
+
+// itemCodec holds the functions passed to WithItemCodec() for a type.
+type itemCodec struct {
+	name   string
+	encode func(item Item) ([]byte, error)
+	decode func(data []byte) (Item, error)
+}
+
+func init() {
+	gob.RegisterName("dump.encodedItem", &encodedItem{})
+}
+
+// encodedItem is persisted by gob in place of an item whose type has an item
+// codec. Type is the name the type was registered under.
+type encodedItem struct {
+	Type string
+	Data []byte
+}
+
+// encodeItems returns items with the ones whose type has an item codec
+// replaced by their encoding. items is returned as is if none have one.
+//
+// no mutex
+func (d *Dump) encodeItems(items []Item) ([]Item, error) {
+	codecs := d.root().codecs
+	if codecs == nil {
+		return items, nil
+	}
+
+	var encoded []Item
+	for i, item := range items {
+		codec, ok := codecs[reflect.TypeOf(item)]
+		if !ok {
+			continue
+		}
+
+		data, err := codec.encode(item)
+		if err != nil {
+			return nil, &EncodeError{Type: fmt.Sprintf("%T", item), Err: err}
+		}
+		if encoded == nil {
+			encoded = append(make([]Item, 0, len(items)), items...)
+		}
+		encoded[i] = &encodedItem{Type: codec.name, Data: data}
+	}
+
+	if encoded == nil {
+		return items, nil
+	}
+	return encoded, nil
+}
+
+// decodeItems replaces the items of items that were encoded by an item
+// codec with the items they were encoded from.
+//
+// no mutex
+func (d *Dump) decodeItems(items []Item) error {
+	for i, item := range items {
+		encoded, ok := item.(*encodedItem)
+		if !ok {
+			continue
+		}
+
+		codec := d.root().codec(encoded.Type)
+		if codec == nil {
+			return &UnknownTypeError{Types: []string{encoded.Type}}
+		}
+
+		decoded, err := codec.decode(encoded.Data)
+		if err != nil {
+			return err
+		}
+		items[i] = decoded
+	}
+	return nil
+}
+
+// codec returns the item codec of the type registered under name, or nil if
+// it doesn't have one.
+func (d *Dump) codec(name string) *itemCodec {
+	for _, codec := range d.codecs {
+		if codec.name == name {
+			return codec
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package dump
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Note has a computed field that isn't persisted with an item codec.
+type Note struct {
+	Text  string
+	Words int
+}
+
+func TestItemCodec(t *testing.T) {
+	defer func() {
+		names, _ := filepath.Glob("codec.*")
+		for _, name := range names {
+			os.Remove(name)
+		}
+	}()
+
+	types := []Type{{"dump.Note", &Note{}}, {"dump.Plain", &Plain{}}}
+	encode := func(item Item) ([]byte, error) {
+		return []byte(item.(*Note).Text), nil
+	}
+	decode := func(data []byte) (Item, error) {
+		return &Note{Text: string(data), Words: len(strings.Fields(string(data)))}, nil
+	}
+	codec := WithItemCodec(&Note{}, encode, decode)
+
+	if _, err := New("codec.db", PERSIST_MANUAL, types, WithItemCodec(&Blob{}, encode, decode)); err != ErrInvalidItemCodec {
+		t.Fatal("accepted an unregistered type")
+	}
+	if _, err := New("codec.db", PERSIST_MANUAL, types, codec, codec); err != ErrInvalidItemCodec {
+		t.Fatal("accepted a second codec for the type")
+	}
+
+	// a gob encoded dump file can still be loaded
+	plain, _ := New("codec.db", PERSIST_MANUAL, types)
+	plain.Add(&Note{"old note", 2})
+	plain.Save()
+
+	test, _ := New("codec.db", PERSIST_MANUAL, types, codec)
+	if err := test.Load(); err != nil || test.Len() != 1 {
+		t.Fatal("didn't load the gob encoded file", err)
+	}
+	test.AddAll(&Note{"a new note", 3}, &Plain{"plain"})
+	notes, _ := test.Collection("notes")
+	notes.Add(&Note{"in a collection", 3})
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile("codec.db"); bytes.Contains(data, []byte("Words")) {
+		t.Fatal("persisted the computed field")
+	}
+
+	other, _ := New("codec.db", PERSIST_MANUAL, types, codec)
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := other.Get(1); *item.(*Note) != (Note{"a new note", 3}) {
+		t.Fatal("bad item", item)
+	}
+	if item, _ := other.Get(2); item.(*Plain).Name != "plain" {
+		t.Fatal("bad item", item)
+	}
+	notes, _ = other.Collection("notes")
+	if item, _ := notes.Get(0); item == nil || *item.(*Note) != (Note{"in a collection", 3}) {
+		t.Fatal("bad collection item", item)
+	}
+
+	if err := plain.Load(); !errors.Is(err, ErrUnknownType) {
+		t.Fatal("expected ErrUnknownType", err)
+	}
+
+	// segments and revisions are encoded with it too
+	segmented, _ := New("codec.db", PERSIST_MANUAL, types, codec, WithSegments(2), WithRevisions(2, 0))
+	segmented.AddAll(&Note{"one", 1}, &Note{"two words", 2})
+	segmented.Set(0, &Note{"one more", 2})
+	if err := segmented.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := segmented.Load(); err != nil || segmented.Len() != 2 {
+		t.Fatal("didn't load the segments", err)
+	}
+	if item, _ := segmented.GetRevision(0, 1); item == nil || *item.(*Note) != (Note{"one", 1}) {
+		t.Fatal("bad revision", item)
+	}
+}
+
+func TestItemCodecCommandLog(t *testing.T) {
+	defer os.Remove("codec.log")
+
+	types := []Type{{"dump.Note", &Note{}}}
+	codec := WithItemCodec(&Note{},
+		func(item Item) ([]byte, error) {
+			return []byte(item.(*Note).Text), nil
+		},
+		func(data []byte) (Item, error) {
+			return &Note{Text: string(data), Words: len(strings.Fields(string(data)))}, nil
+		})
+
+	log, _ := OpenCommandLog("codec.log")
+	test, _ := New("codec.db", PERSIST_WRITES, types, codec, WithCommandLog(log))
+	test.AddAll(&Note{"a b", 2}, &Note{"c", 1})
+	test.Set(1, &Note{"c d e", 3})
+
+	if data, _ := os.ReadFile("codec.log"); bytes.Contains(data, []byte("Words")) {
+		t.Fatal("logged the computed field")
+	}
+
+	other, _ := New("codec.db", PERSIST_WRITES, types, codec, WithCommandLog(log))
+	if err := other.Load(); err != nil || other.Len() != 2 {
+		t.Fatal("bad replay", err)
+	}
+	if item, _ := other.Get(1); *item.(*Note) != (Note{"c d e", 3}) {
+		t.Fatal("bad item", item)
+	}
+}
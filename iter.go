@@ -0,0 +1,27 @@
+//go:build go1.23
+
+package dump
+
+import "iter"
+
+// All returns an iterator over the ids and items in the dump, for use with
+// range:
+//
+//	for id, item := range d.All() {
+//		...
+//	}
+//
+// The read lock is held while the loop runs and released when it finishes
+// (including on break), so the loop body must not modify the dump.
+func (d *Dump) All() iter.Seq2[int, Item] {
+	return func(yield func(int, Item) bool) {
+		d.rlock()
+		defer d.mutex.RUnlock()
+
+		for id, item := range d.items {
+			if !yield(id, item) {
+				return
+			}
+		}
+	}
+}
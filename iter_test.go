@@ -0,0 +1,33 @@
+//go:build go1.23
+
+package dump
+
+import "testing"
+
+func TestAll(t *testing.T) {
+	test, _ := NewDump("iter.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	test.AddAll(&Blob{"zero"}, &Blob{"one"}, &Blob{"two"})
+
+	var data []string
+	for id, item := range test.All() {
+		if len(data) != id {
+			t.Fatal("bad id", id)
+		}
+		data = append(data, item.(*Blob).Data)
+	}
+
+	if len(data) != 3 || data[2] != "two" {
+		t.Fatal("bad iteration", data)
+	}
+
+	for id := range test.All() {
+		if id == 1 {
+			break
+		}
+	}
+
+	// the lock must be released after breaking out of the loop
+	if _, err := test.Add(&Blob{"three"}); err != nil {
+		t.Fatal(err)
+	}
+}
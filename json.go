@@ -0,0 +1,115 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// WithFactory is an option that sets the function used to create new, empty
+// items (such as &User{}) when the dump is unmarshaled from JSON with
+// UnmarshalJSON().
+func WithFactory(factory func() Item) Option {
+	return func(d *Dump) error {
+		d.factory = factory
+		return nil
+	}
+}
+
+// LoadJSON replaces the items in the dump with the items in the JSON list
+// read from r (as written by MarshalJSON() or WriteJSONTo()). The factory
+// function returns a new, empty item that each element of the list is
+// unmarshaled into. It returns ErrNotList if the JSON isn't a list.
+//
+// If WithJSONMeta() is enabled every element is expected to be an item along
+// with its metadata, and if WithJSONEnvelope() is the list is read from the
+// "items" key of an object (the rest of which is ignored).
+//
+// The dump is left unchanged if there is an error. Like Load(), LoadJSON
+// doesn't save the dump.
+func (d *Dump) LoadJSON(r io.Reader, factory func() Item) error {
+	var (
+		decoder = json.NewDecoder(r)
+		items   = make([]Item, 0)
+	)
+
+	if d.envelope != nil {
+		if err := skipToItems(decoder); err != nil {
+			return err
+		}
+	}
+
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		item := factory()
+		if d.jsonMeta {
+			var wrapped withMeta
+			if err := decoder.Decode(&wrapped); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(wrapped.Item, item); err != nil {
+				return err
+			}
+		} else if err := decoder.Decode(item); err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+
+	if err := expectDelim(decoder, ']'); err != nil {
+		return err
+	}
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer d.mutex.Unlock()
+
+	return d.replace(items)
+}
+
+// replace replaces the items in the dump with items, leaving the dump
+// unchanged if that violates a unique index.
+//
+// no mutex
+func (d *Dump) replace(items []Item) error {
+	backup, backupMeta, backupUnordered := d.items, d.meta, d.unordered
+	d.items, d.meta = items, nil
+	d.reset()
+
+	if err := d.checkIndexes(); err != nil {
+		d.items, d.meta, d.unordered = backup, backupMeta, backupUnordered
+		d.changed()
+		return err
+	}
+
+	d.afterReset()
+	return d.onLoad()
+}
+
+// UnmarshalJSON replaces the items in the dump with the items in the JSON
+// list data, allowing the dump to implement the json.Unmarshaler interface.
+// It returns ErrNoFactory if the dump wasn't created with WithFactory().
+func (d *Dump) UnmarshalJSON(data []byte) error {
+	if d.factory == nil {
+		return ErrNoFactory
+	}
+
+	return d.LoadJSON(bytes.NewReader(data), d.factory)
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return ErrNotList
+	}
+
+	return nil
+}
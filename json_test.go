@@ -0,0 +1,69 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestLoadJSON(t *testing.T) {
+	test, _ := NewDump("json.db", PERSIST_MANUAL, Type{"dump.Plain", &Plain{}})
+	test.Add(&Plain{"one"})
+	test.Add(&Plain{"two"})
+
+	data, err := test.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := NewDump("json.db", PERSIST_MANUAL, Type{"dump.Plain", &Plain{}})
+	other.Add(&Plain{"replaced"})
+
+	factory := func() Item { return &Plain{} }
+
+	if err = other.LoadJSON(bytes.NewReader(data), factory); err != nil {
+		t.Fatal(err)
+	}
+
+	other.View(func(items []Item) error {
+		if len(items) != 2 || items[1].(*Plain).Name != "two" {
+			t.Fatal("bad json load")
+		}
+		return nil
+	})
+
+	for _, bad := range []string{``, `{}`, `[{"name":1}]`, `[{"name":"x"}`, `[{"name":"x"}}`} {
+		if err = other.LoadJSON(bytes.NewBufferString(bad), factory); err == nil {
+			t.Fatal("loaded bad json", bad)
+		}
+	}
+
+	if err = other.LoadJSON(bytes.NewBufferString(`{}`), factory); err != ErrNotList {
+		t.Fatal("expected ErrNotList")
+	}
+
+	other.View(func(items []Item) error {
+		if len(items) != 2 {
+			t.Fatal("failed load changed the dump")
+		}
+		return nil
+	})
+
+	if err = json.Unmarshal(data, other); err != ErrNoFactory {
+		t.Fatal("expected ErrNoFactory")
+	}
+
+	withFactory, _ := New("json.db", PERSIST_MANUAL,
+		[]Type{{"dump.Plain", &Plain{}}}, WithFactory(factory))
+
+	if err = json.Unmarshal([]byte(`[{"name":"three"}]`), withFactory); err != nil {
+		t.Fatal(err)
+	}
+
+	withFactory.View(func(items []Item) error {
+		if len(items) != 1 || items[0].(*Plain).Name != "three" {
+			t.Fatal("bad json unmarshal")
+		}
+		return nil
+	})
+}
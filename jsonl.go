@@ -0,0 +1,138 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ExportJSONL writes every item in the dump to w as JSON Lines: one JSON
+// encoded item per line. It returns an error if one of the items can't be
+// marshaled or if there was an error writing to w.
+func (d *Dump) ExportJSONL(w io.Writer) error {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	return writeLines(w, d.items, marshalItem)
+}
+
+// WriteNDJSONTo writes the items to w as newline-delimited JSON, one item
+// per line like ExportJSONL(), but as they are served (see WithRedaction())
+// and from a frozen view (see Freeze()), so a slow reader doesn't block
+// writes to the dump. If w is an http.Flusher (such as an
+// http.ResponseWriter) it is flushed after every item, so clients can
+// process the items as they arrive.
+func (d *Dump) WriteNDJSONTo(w io.Writer) error {
+	f := d.Freeze()
+	defer f.Release()
+
+	return f.WriteNDJSONTo(w)
+}
+
+// WriteNDJSONTo writes the items of the view to w like
+// Dump.WriteNDJSONTo() does.
+func (f *Frozen) WriteNDJSONTo(w io.Writer) error {
+	return writeLines(w, f.items, f.dump.marshalJSON)
+}
+
+// writeLines writes items to w as JSON Lines, encoded by marshal, flushing w
+// after every item if it's an http.Flusher.
+func writeLines(w io.Writer, items []Item, marshal func(item Item) ([]byte, error)) error {
+	var (
+		buffer     bytes.Buffer
+		writer     = bufio.NewWriter(w)
+		flusher, _ = w.(http.Flusher)
+	)
+
+	for _, item := range items {
+		data, err := marshal(item)
+		if err != nil {
+			return err
+		}
+
+		// items are free to marshal across multiple lines
+		buffer.Reset()
+		if err = json.Compact(&buffer, data); err != nil {
+			return err
+		}
+		buffer.WriteByte('\n')
+
+		if _, err = writer.Write(buffer.Bytes()); err != nil {
+			return err
+		}
+
+		if flusher != nil {
+			if err = writer.Flush(); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+	}
+
+	return writer.Flush()
+}
+
+// ImportJSONL reads JSON Lines from r (as written by ExportJSONL()) and
+// appends an item to the dump for each line. The factory function returns a
+// new, empty item (such as &User{}) that each line is unmarshaled into. Blank
+// lines are skipped.
+//
+// Nothing is added to the dump if any line fails to unmarshal. When
+// PERSIST_WRITES is enabled the dump is saved once after all items are added.
+func (d *Dump) ImportJSONL(r io.Reader, factory func() Item) error {
+	var (
+		items  []Item
+		reader = bufio.NewReader(r)
+	)
+
+	for n := 1; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			item := factory()
+			if uerr := json.Unmarshal(line, item); uerr != nil {
+				return fmt.Errorf("line %d: %v", n, uerr)
+			}
+			items = append(items, item)
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return d.importItems(items)
+}
+
+// importItems appends imported items to the dump, saving it once if
+// PERSIST_WRITES is enabled.
+func (d *Dump) importItems(items []Item) error {
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer d.mutex.Unlock()
+
+	if err := d.beforeAdd(items); err != nil {
+		return err
+	}
+
+	if err := d.checkAppend(items); err != nil {
+		return err
+	}
+
+	d.items = append(d.items, items...)
+	d.appended(len(d.items) - len(items))
+	d.evict()
+
+	if d.autosave() {
+		return d.save()
+	}
+
+	return nil
+}
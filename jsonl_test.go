@@ -0,0 +1,133 @@
+package dump
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write")
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read")
+}
+
+// Multiline marshals itself across several lines.
+type Multiline struct {
+	Data string
+}
+
+func (m *Multiline) MarshalJSON() ([]byte, error) {
+	return []byte("{\n  \"data\": \"" + m.Data + "\"\n}"), nil
+}
+
+func TestJSONL(t *testing.T) {
+	test, _ := NewDump("jsonl.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	test.Add(&Blob{"one"})
+	test.Add(&Blob{"two"})
+
+	var buffer bytes.Buffer
+	if err := test.ExportJSONL(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	if buffer.String() != "{\"data\":\"one\"}\n{\"data\":\"two\"}\n" {
+		t.Fatal("bad jsonl", buffer.String())
+	}
+
+	other, _ := NewDump("jsonl.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+	if err := other.ImportJSONL(
+		bytes.NewBufferString(buffer.String()+"\n{\"data\":\"three\"}"),
+		func() Item { return &Blob{} },
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	other.View(func(items []Item) error {
+		if len(items) != 3 ||
+			items[0].(*Blob).Data != "one" ||
+			items[2].(*Blob).Data != "three" {
+			t.Fatal("bad import")
+		}
+		return nil
+	})
+
+	if err := other.ImportJSONL(
+		bytes.NewBufferString("{\"data\":\"four\"}\nnope\n"),
+		func() Item { return &Blob{} },
+	); err == nil || err.Error()[:6] != "line 2" {
+		t.Fatal("imported invalid json", err)
+	}
+
+	if err := other.ImportJSONL(errReader{}, func() Item { return &Blob{} }); err == nil {
+		t.Fatal("ignored read error")
+	}
+
+	multi, _ := NewDump("jsonl.db", PERSIST_MANUAL, Type{"dump.Multiline", &Multiline{}})
+	multi.Add(&Multiline{"line"})
+
+	buffer.Reset()
+	if err := multi.ExportJSONL(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	if buffer.String() != "{\"data\":\"line\"}\n" {
+		t.Fatal("item spans multiple lines")
+	}
+
+	if err := multi.ExportJSONL(errWriter{}); err == nil {
+		t.Fatal("ignored write error")
+	}
+
+	test.Add(&Blob{"bad"})
+	if err := test.ExportJSONL(&buffer); err == nil {
+		t.Fatal("ignored marshal error")
+	}
+
+	invalid, _ := NewDump("jsonl.db", PERSIST_MANUAL, Type{"dump.Invalid", &Invalid{}})
+	invalid.Add(&Invalid{})
+	if err := invalid.ExportJSONL(&buffer); err == nil {
+		t.Fatal("exported invalid json")
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	test, _ := New("jsonl.db", PERSIST_MANUAL, []Type{{"dump.Multiline", &Multiline{}}})
+	test.AddAll(&Multiline{"a"}, &Multiline{"b"})
+
+	recorder := httptest.NewRecorder()
+	if err := test.WriteNDJSONTo(recorder); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Body.String() != "{\"data\":\"a\"}\n{\"data\":\"b\"}\n" || !recorder.Flushed {
+		t.Fatal("bad NDJSON", recorder.Body.String(), recorder.Flushed)
+	}
+
+	if err := test.WriteNDJSONTo(errWriter{}); err == nil {
+		t.Fatal("ignored write error")
+	}
+
+	// lists are streamed by the handler when asked for
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept", "application/json, application/x-ndjson;q=0.9")
+	recorder = httptest.NewRecorder()
+	Handler(test, HandlerOptions{}).ServeHTTP(recorder, request)
+	if recorder.Header().Get("Content-Type") != "application/x-ndjson" ||
+		recorder.Body.String() != "{\"data\":\"a\"}\n{\"data\":\"b\"}\n" {
+		t.Fatal("bad NDJSON response", recorder.Body.String())
+	}
+}
+
+// Invalid marshals itself to invalid JSON.
+type Invalid struct{}
+
+func (i *Invalid) MarshalJSON() ([]byte, error) {
+	return []byte("{nope"), nil
+}
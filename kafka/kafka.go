@@ -0,0 +1,118 @@
+// Package kafka provides a dump.EventSink that publishes the changes made to
+// a dump to a Kafka topic (see dump.Publish()).
+//
+// Records are produced through a Kafka REST Proxy (the v2 API of the
+// Confluent REST Proxy, also implemented by Redpanda's HTTP Proxy), so the
+// sink has no dependencies. Every change is a record whose value is its JSON
+// (see dump.Change.MarshalJSON()) and whose key is the stable id of the item,
+// so the changes to an item land in the same partition, in order.
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/karlmcguire/dump"
+)
+
+// ErrInvalidConfig is thrown by New() when the URL or the topic is missing
+// or invalid.
+var ErrInvalidConfig = errors.New("invalid kafka config")
+
+// contentType is the content type of records with JSON keys and values.
+const contentType = "application/vnd.kafka.json.v2+json"
+
+// Config describes the proxy and topic a Sink publishes to.
+type Config struct {
+	// URL is the base URL of the REST Proxy, such as
+	// "http://rest-proxy:8082".
+	URL string
+
+	// Topic is the topic the changes are produced to.
+	Topic string
+
+	// Client is used to connect to the proxy (http.DefaultClient by
+	// default). Its Transport can add the authentication the proxy
+	// requires.
+	Client *http.Client
+}
+
+// Sink produces changes to a Kafka topic.
+type Sink struct {
+	cfg      Config
+	endpoint string
+}
+
+// New returns a sink producing to the topic of cfg.
+func New(cfg Config) (*Sink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") || cfg.Topic == "" {
+		return nil, ErrInvalidConfig
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	return &Sink{
+		cfg:      cfg,
+		endpoint: strings.TrimSuffix(cfg.URL, "/") + "/topics/" + url.PathEscape(cfg.Topic),
+	}, nil
+}
+
+type record struct {
+	Key   string      `json:"key"`
+	Value dump.Change `json:"value"`
+}
+
+// Publish produces the change and waits for the proxy to acknowledge it.
+func (s *Sink) Publish(c dump.Change) error {
+	body, err := json.Marshal(struct {
+		Records []record `json:"records"`
+	}{[]record{{strconv.FormatUint(c.StableID, 10), c}}})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	response, err := s.cfg.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("kafka: unexpected status %s: %s", response.Status, bytes.TrimSpace(message))
+	}
+
+	// records can fail individually
+	var produced struct {
+		Offsets []struct {
+			Error string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&produced); err != nil {
+		return err
+	}
+	for _, offset := range produced.Offsets {
+		if offset.Error != "" {
+			return fmt.Errorf("kafka: %s", offset.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package kafka
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/karlmcguire/dump"
+)
+
+func TestSink(t *testing.T) {
+	if _, err := New(Config{URL: "http://proxy"}); err != ErrInvalidConfig {
+		t.Fatal("accepted an empty topic", err)
+	}
+
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/topics/posts" || r.Header.Get("Content-Type") != contentType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		if strings.Contains(string(body), `"op":"reset"`) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"offsets": []map[string]interface{}{{"error_code": 50002, "error": "record too large"}},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"offsets": []map[string]interface{}{{"partition": 0, "offset": len(bodies), "error": nil}},
+		})
+	}))
+	defer server.Close()
+
+	sink, err := New(Config{URL: server.URL + "/", Topic: "posts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Publish(dump.Change{Seq: 1, Op: "add", StableID: 3, Data: []byte(`{"title":"a"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if bodies[0] != `{"records":[{"key":"3","value":{"seq":1,"op":"add","id":0,"stable_id":3,"data":{"title":"a"}}}]}` {
+		t.Fatal("bad records", bodies[0])
+	}
+
+	if err := sink.Publish(dump.Change{Seq: 2, Op: "reset", ID: -1}); err == nil || err.Error() != "kafka: record too large" {
+		t.Fatal("expected an error", err)
+	}
+
+	other, _ := New(Config{URL: server.URL, Topic: "other"})
+	if err := other.Publish(dump.Change{Seq: 1, Op: "add"}); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatal("expected an error", err)
+	}
+}
@@ -0,0 +1,254 @@
+package dump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// LogStore is a RecordStore that appends every commit to a log file. Each
+// record is written as a frame:
+//
+//	op       uint8   opPut, opDelete or opCommit
+//	key      uint64
+//	length   uint32  length of data
+//	checksum uint32  CRC-32 (Castagnoli) of data
+//	data     []byte
+//
+// A commit is only applied when its opCommit frame is read, so a commit that
+// was interrupted by a crash is ignored when the log is loaded. The log is
+// compacted (rewritten with only the live records) when the dead records
+// outgrow the live ones.
+type LogStore struct {
+	filename string
+	file     *os.File
+	records  map[uint64][]byte
+	live     int64
+	size     int64
+	mutex    sync.Mutex
+}
+
+const (
+	opPut byte = iota + 1
+	opDelete
+	opCommit
+
+	frameSize = 1 + 8 + 4 + 4
+
+	// compactSize is the minimum size of the log before it is compacted.
+	compactSize = 1 << 20
+)
+
+// OpenLogStore opens (or creates) the log file with the provided filename.
+// It returns ErrCorrupt if a committed frame fails its checksum.
+func OpenLogStore(filename string) (*LogStore, error) {
+	l := &LogStore{
+		filename: filename,
+		records:  make(map[uint64][]byte),
+	}
+
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = l.replay(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// drop an interrupted commit so new frames follow the last good one
+	if err = file.Truncate(l.size); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if _, err = file.Seek(l.size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	l.file = file
+	return l, nil
+}
+
+func (l *LogStore) replay(r io.Reader) error {
+	var (
+		reader  = bufio.NewReader(r)
+		frame   = make([]byte, frameSize)
+		pending []func()
+		offset  int64
+	)
+
+	for {
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			// a partial frame at the end is an interrupted commit
+			return nil
+		}
+
+		var (
+			op     = frame[0]
+			key    = binary.BigEndian.Uint64(frame[1:])
+			length = binary.BigEndian.Uint32(frame[9:])
+			sum    = binary.BigEndian.Uint32(frame[13:])
+			data   = make([]byte, length)
+		)
+
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil
+		}
+
+		if crc32.Checksum(data, crc) != sum {
+			return ErrCorrupt
+		}
+
+		offset += int64(frameSize + len(data))
+
+		switch op {
+		case opPut:
+			pending = append(pending, func() {
+				l.live -= int64(len(l.records[key]))
+				l.records[key] = data
+				l.live += int64(len(data))
+			})
+		case opDelete:
+			pending = append(pending, func() {
+				l.live -= int64(len(l.records[key]))
+				delete(l.records, key)
+			})
+		case opCommit:
+			for _, apply := range pending {
+				apply()
+			}
+			pending = nil
+			l.size = offset
+		default:
+			return ErrCorrupt
+		}
+	}
+}
+
+// Load calls f for every record in ascending key order.
+func (l *LogStore) Load(f func(key uint64, data []byte) error) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	keys := make([]uint64, 0, len(l.records))
+	for key := range l.records {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	for _, key := range keys {
+		if err := f(key, l.records[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Commit appends puts and deletes to the log followed by a commit frame and
+// syncs the file.
+func (l *LogStore) Commit(puts map[uint64][]byte, deletes []uint64) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var buffer []byte
+	for key, data := range puts {
+		buffer = appendFrame(buffer, opPut, key, data)
+	}
+	for _, key := range deletes {
+		buffer = appendFrame(buffer, opDelete, key, nil)
+	}
+	buffer = appendFrame(buffer, opCommit, 0, nil)
+
+	if _, err := l.file.Write(buffer); err != nil {
+		return err
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+
+	for key, data := range puts {
+		l.live -= int64(len(l.records[key]))
+		l.records[key] = data
+		l.live += int64(len(data))
+	}
+	for _, key := range deletes {
+		l.live -= int64(len(l.records[key]))
+		delete(l.records, key)
+	}
+	l.size += int64(len(buffer))
+
+	if l.size > compactSize && l.size > 2*(l.live+int64(len(l.records)*frameSize)) {
+		return l.compact()
+	}
+
+	return nil
+}
+
+// Compact rewrites the log with only the live records.
+func (l *LogStore) Compact() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.compact()
+}
+
+// no mutex
+func (l *LogStore) compact() error {
+	var buffer []byte
+	for key, data := range l.records {
+		buffer = appendFrame(buffer, opPut, key, data)
+	}
+	buffer = appendFrame(buffer, opCommit, 0, nil)
+
+	tmp := l.filename + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(buffer); err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = rename(tmp, l.filename)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	l.file.Close()
+	l.file = file
+	l.size = int64(len(buffer))
+
+	return nil
+}
+
+// Close closes the log file.
+func (l *LogStore) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.file.Close()
+}
+
+func appendFrame(buffer []byte, op byte, key uint64, data []byte) []byte {
+	var frame [frameSize]byte
+
+	frame[0] = op
+	binary.BigEndian.PutUint64(frame[1:], key)
+	binary.BigEndian.PutUint32(frame[9:], uint32(len(data)))
+	binary.BigEndian.PutUint32(frame[13:], crc32.Checksum(data, crc))
+
+	return append(append(buffer, frame[:]...), data...)
+}
@@ -0,0 +1,137 @@
+package dump
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLogStore(t *testing.T) {
+	defer os.Remove("log.log")
+	os.Remove("log.log")
+
+	log, err := OpenLogStore("log.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = log.Commit(map[uint64][]byte{
+		0: []byte("zero"),
+		1: []byte("one"),
+		2: []byte("two"),
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = log.Commit(map[uint64][]byte{1: []byte("uno")}, []uint64{2}); err != nil {
+		t.Fatal(err)
+	}
+
+	log.Close()
+
+	// simulate a commit interrupted by a crash
+	file, _ := os.OpenFile("log.log", os.O_WRONLY|os.O_APPEND, 0644)
+	file.Write(appendFrame(nil, opPut, 3, []byte("three")))
+	file.Write(appendFrame(nil, opPut, 4, []byte("four"))[:5])
+	file.Close()
+
+	check := func(expected map[uint64]string) {
+		found := make(map[uint64]string)
+		var last uint64
+		if err := log.Load(func(key uint64, data []byte) error {
+			if key < last {
+				t.Fatal("keys out of order")
+			}
+			last = key
+			found[key] = string(data)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != len(expected) {
+			t.Fatal("unexpected records", found)
+		}
+		for key, data := range expected {
+			if found[key] != data {
+				t.Fatal("unexpected records", found)
+			}
+		}
+	}
+
+	if log, err = OpenLogStore("log.log"); err != nil {
+		t.Fatal(err)
+	}
+
+	check(map[uint64]string{0: "zero", 1: "uno"})
+
+	if err = log.Commit(map[uint64][]byte{5: []byte("five")}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = log.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = log.Commit(map[uint64][]byte{6: []byte("six")}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	log.Close()
+
+	if log, err = OpenLogStore("log.log"); err != nil {
+		t.Fatal(err)
+	}
+
+	check(map[uint64]string{0: "zero", 1: "uno", 5: "five", 6: "six"})
+
+	if err = log.Load(func(key uint64, data []byte) error {
+		return ErrCorrupt
+	}); err != ErrCorrupt {
+		t.Fatal("load didn't return error")
+	}
+
+	log.Close()
+
+	data, _ := ioutil.ReadFile("log.log")
+	data[frameSize] ^= 0xff
+	ioutil.WriteFile("log.log", data, 0644)
+
+	if _, err = OpenLogStore("log.log"); err != ErrCorrupt {
+		t.Fatal("opened corrupt log")
+	}
+
+	data[frameSize] ^= 0xff
+	data[0] = 42
+	ioutil.WriteFile("log.log", data, 0644)
+
+	if _, err = OpenLogStore("log.log"); err != ErrCorrupt {
+		t.Fatal("opened log with unknown op")
+	}
+
+	if _, err = OpenLogStore("missing/log.log"); err == nil {
+		t.Fatal("opened log in missing directory")
+	}
+}
+
+func TestLogStoreAutoCompact(t *testing.T) {
+	defer os.Remove("compact.log")
+	os.Remove("compact.log")
+
+	log, err := OpenLogStore("compact.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	big := make([]byte, 64<<10)
+	for i := 0; i < 40; i++ {
+		if err = log.Commit(map[uint64][]byte{0: big}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, _ := os.Stat("compact.log")
+	if info.Size() > compactSize {
+		t.Fatal("log wasn't compacted")
+	}
+}
@@ -0,0 +1,117 @@
+package dump
+
+import (
+	"sort"
+	"sync"
+)
+
+// WithLRU is an option for using the dump as a cache: it keeps at most n
+// items, and when adding items grows the dump beyond n, the least recently
+// used items are removed. Items are used when they are added, and when they
+// are read with Get() or GetByIndex() (reading them with View() or a query
+// doesn't count, since the dump can't tell which items were read).
+//
+// If onEvict isn't nil it is called with every removed item, for example to
+// persist it elsewhere. It is called while the dump is locked, so it can't
+// call methods of the dump. Like DeleteWhere(), removing items shifts the
+// ids of the remaining ones down.
+func WithLRU(n int, onEvict func(item Item)) Option {
+	return func(d *Dump) error {
+		if n <= 0 {
+			return ErrInvalidRetention
+		}
+
+		d.lru = &lru{max: n, onEvict: onEvict, used: make(map[uint64]uint64)}
+		return nil
+	}
+}
+
+// lru tracks when the items of a dump created with WithLRU() were last used.
+// It has its own mutex since items are used while the dump is only locked
+// for reading.
+type lru struct {
+	max     int
+	onEvict func(item Item)
+
+	mutex sync.Mutex
+	clock uint64
+
+	// used maps the stable id of an item to when it was last used
+	used map[uint64]uint64
+}
+
+// touch marks the item with the provided stable id as used.
+func (l *lru) touch(id uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.clock++
+	l.used[id] = l.clock
+}
+
+// forget stops tracking the removed items.
+func (l *lru) forget(metas []meta) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, m := range metas {
+		delete(l.used, m.ID)
+	}
+}
+
+// used marks the item with the provided id as used (if WithLRU() is
+// enabled).
+//
+// no mutex (the dump has to be locked, at least for reading)
+func (d *Dump) used(id int) {
+	if d.lru != nil {
+		d.lru.touch(d.meta[id].ID)
+	}
+}
+
+// evictLRU removes the least recently used items until there are at most
+// WithLRU() items left, and returns the number of items removed.
+//
+// no mutex
+func (d *Dump) evictLRU() int {
+	excess := len(d.items) - d.lru.max
+	if excess <= 0 {
+		return 0
+	}
+
+	d.lru.mutex.Lock()
+	ids := make([]int, len(d.items))
+	for id := range ids {
+		ids[id] = id
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return d.lru.used[d.meta[ids[i]].ID] < d.lru.used[d.meta[ids[j]].ID]
+	})
+
+	evicted := make(map[int]bool, excess)
+	for _, id := range ids[:excess] {
+		evicted[id] = true
+	}
+	d.lru.mutex.Unlock()
+
+	var items []Item
+	for id, item := range d.items {
+		if evicted[id] {
+			items = append(items, item)
+		}
+	}
+
+	// items that can't be removed yet are evicted the next time
+	removed, err := d.remove(func(id int) bool { return evicted[id] })
+	if err != nil {
+		return 0
+	}
+
+	if d.lru.onEvict != nil {
+		for _, item := range items {
+			d.lru.onEvict(item)
+		}
+	}
+
+	return removed
+}
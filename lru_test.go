@@ -0,0 +1,45 @@
+package dump
+
+import (
+	"testing"
+)
+
+func TestLRU(t *testing.T) {
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	if _, err := New("lru.db", PERSIST_MANUAL, types, WithLRU(0, nil)); err != ErrInvalidRetention {
+		t.Fatal("accepted 0 items")
+	}
+
+	var evicted []string
+	test, _ := New("lru.db", PERSIST_MANUAL, types,
+		WithIndex("name", func(item Item) string { return item.(*Plain).Name }),
+		WithLRU(3, func(item Item) {
+			evicted = append(evicted, item.(*Plain).Name)
+		}))
+
+	test.AddAll(&Plain{"a"}, &Plain{"b"}, &Plain{"c"})
+
+	// a and b are used, so c is the least recently used
+	test.Get(0)
+	test.GetByIndex("name", "b")
+
+	if id, _ := test.Add(&Plain{"d"}); id != 2 {
+		t.Fatal("expected id 2", id)
+	}
+	if len(evicted) != 1 || evicted[0] != "c" {
+		t.Fatal("expected c to be evicted", evicted)
+	}
+
+	test.Add(&Plain{"e"})
+	if len(evicted) != 2 || evicted[1] != "a" {
+		t.Fatal("expected a to be evicted", evicted)
+	}
+
+	test.View(func(items []Item) error {
+		if len(items) != 3 || items[0].(*Plain).Name != "b" {
+			t.Fatal("bad items", items)
+		}
+		return nil
+	})
+}
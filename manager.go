@@ -0,0 +1,134 @@
+package dump
+
+import (
+	"container/list"
+	"os"
+	"sync"
+)
+
+// ManagerOptions configures a Manager.
+type ManagerOptions struct {
+	// Filename returns the filename of the dump of a key (key + ".db" by
+	// default).
+	Filename func(key string) string
+
+	// MaxOpen is the maximum number of dumps kept open. When it is reached,
+	// the least recently used dump is closed (see Dump.Close()) to make room.
+	// Zero means no limit.
+	MaxOpen int
+
+	// Options are passed to New() for every dump. Errors saving dumps that
+	// are closed can be observed with the AfterSave hook (see WithHooks()).
+	Options []Option
+}
+
+// Manager opens one dump per key, such as per tenant, the first time it is
+// needed. It is created with NewManager().
+type Manager struct {
+	persist int
+	types   []Type
+	options ManagerOptions
+
+	mutex    sync.Mutex
+	dumps    map[string]*list.Element
+	lru      *list.List
+	shutdown bool
+}
+
+// managed is an element of Manager.lru.
+type managed struct {
+	key  string
+	dump *Dump
+}
+
+// NewManager returns a Manager opening dumps created with New() from the
+// provided persist setting, types and options.
+func NewManager(persist int, types []Type, options ManagerOptions) *Manager {
+	if options.Filename == nil {
+		options.Filename = func(key string) string { return key + ".db" }
+	}
+
+	return &Manager{
+		persist: persist,
+		types:   types,
+		options: options,
+		dumps:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get returns the dump of the provided key, creating it and loading it from
+// its file (if the file exists) the first time. It returns ErrShutdown after
+// Shutdown() was called.
+//
+// Dumps closed to stay under ManagerOptions.MaxOpen are opened again by the
+// next Get(), so the returned dump shouldn't be held on to for longer than
+// it is needed.
+func (m *Manager) Get(key string) (*Dump, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.shutdown {
+		return nil, ErrShutdown
+	}
+
+	if e, ok := m.dumps[key]; ok {
+		m.lru.MoveToFront(e)
+		return e.Value.(*managed).dump, nil
+	}
+
+	d, err := New(m.options.Filename(key), m.persist, m.types, m.options.Options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = d.Load(); err != nil && !os.IsNotExist(err) {
+		d.Close()
+		return nil, err
+	}
+
+	m.dumps[key] = m.lru.PushFront(&managed{key: key, dump: d})
+
+	for m.options.MaxOpen > 0 && m.lru.Len() > m.options.MaxOpen {
+		oldest := m.lru.Remove(m.lru.Back()).(*managed)
+		delete(m.dumps, oldest.key)
+		oldest.dump.Close()
+	}
+
+	return d, nil
+}
+
+// Open returns the keys of the dumps that are currently open, from the most
+// to the least recently used.
+func (m *Manager) Open() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	keys := make([]string, 0, m.lru.Len())
+	for e := m.lru.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(*managed).key)
+	}
+	return keys
+}
+
+// Shutdown closes every open dump (saving them unless PERSIST_MANUAL is
+// used) and makes Get() return ErrShutdown from then on. It returns the first
+// error closing a dump.
+func (m *Manager) Shutdown() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.shutdown = true
+
+	var first error
+	for e := m.lru.Front(); e != nil; e = e.Next() {
+		if err := e.Value.(*managed).dump.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	m.dumps = make(map[string]*list.Element)
+	m.lru.Init()
+
+	return first
+}
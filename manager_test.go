@@ -0,0 +1,62 @@
+package dump
+
+import (
+	"os"
+	"testing"
+)
+
+func TestManager(t *testing.T) {
+	defer os.Remove("tenant-acme.db")
+	defer os.Remove("tenant-globex.db")
+
+	var saves int
+	manager := NewManager(PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}}, ManagerOptions{
+		Filename: func(key string) string { return "tenant-" + key + ".db" },
+		MaxOpen:  1,
+		Options: []Option{WithHooks(Hooks{
+			AfterSave: func(err error) { saves++ },
+		})},
+	})
+
+	acme, err := manager.Get("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme.Add(&Plain{"wile"})
+
+	if again, _ := manager.Get("acme"); again != acme {
+		t.Fatal("expected the open dump")
+	}
+
+	// opening a second tenant closes the least recently used one
+	globex, _ := manager.Get("globex")
+	globex.Add(&Plain{"hank"})
+
+	if open := manager.Open(); len(open) != 1 || open[0] != "globex" {
+		t.Fatal("expected only globex open", open)
+	}
+
+	// PERSIST_MANUAL dumps aren't saved when closed
+	if saves != 0 {
+		t.Fatal("unexpected save")
+	}
+	acme.Save()
+
+	reopened, _ := manager.Get("acme")
+	if reopened == acme {
+		t.Fatal("expected a new dump")
+	}
+	reopened.View(func(items []Item) error {
+		if len(items) != 1 || items[0].(*Plain).Name != "wile" {
+			t.Fatal("didn't load the tenant's file")
+		}
+		return nil
+	})
+
+	if err = manager.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = manager.Get("acme"); err != ErrShutdown {
+		t.Fatal("expected ErrShutdown")
+	}
+}
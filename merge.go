@@ -0,0 +1,150 @@
+package dump
+
+import "sort"
+
+// MergeFile merges the items of another dump file (of the same registered
+// types, compression and schema) into the dump, for example to combine the
+// dump files of several shards. It returns the number of items added or
+// replaced.
+//
+// If the dump was created with WithKey(), an item of the file with the same
+// key as an item of the dump (or as an earlier item of the file) is a
+// duplicate: conflict is called with both items and the item it returns
+// replaces the existing one. If conflict is nil the ConflictResolver set with
+// WithConflictResolver() is used instead. If there is neither or it returns
+// an error, nothing is merged and ErrDuplicate or that error is returned.
+// Items that aren't duplicates are appended on the end of the dump.
+//
+// The dump is left unchanged if the file can't be loaded or the merge would
+// violate a unique index. It returns an error if there was a problem
+// persisting the dump on the disk (if PERSIST_WRITES is enabled).
+func (d *Dump) MergeFile(filename string, conflict func(existing, incoming Item) (Item, error)) (int, error) {
+	other := &Dump{
+		filename:    filename,
+		storage:     d.storage,
+		compression: d.compression,
+		schema:      d.schema,
+		migrations:  d.migrations,
+		items:       make([]Item, 0),
+	}
+
+	if err := other.loadFile(filename); err != nil {
+		return 0, err
+	}
+
+	if err := d.lock(); err != nil {
+		return 0, err
+	}
+	defer d.mutex.Unlock()
+
+	var (
+		replaced = make(map[int]Item)
+		added    []Item
+		keys     = make(map[string]int)
+		key      func(item Item) string
+	)
+
+	if idx, ok := d.indexes[d.key]; ok {
+		key = idx.key
+	}
+
+	if conflict == nil && d.resolver != nil {
+		conflict = func(existing, incoming Item) (Item, error) {
+			return d.resolver.Resolve(Conflict{Existing: existing, Incoming: incoming})
+		}
+	}
+
+	for _, item := range other.items {
+		if key == nil {
+			added = append(added, item)
+			continue
+		}
+
+		k := key(item)
+
+		// duplicates of earlier items of the file are found in keys, as
+		// len(d.items)+i for added[i]
+		id, ok := keys[k]
+		if !ok {
+			ids := d.indexes[d.key].ids[k]
+			if ok = len(ids) > 0; ok {
+				id = ids[0]
+			}
+		}
+
+		if !ok {
+			keys[k] = len(d.items) + len(added)
+			added = append(added, item)
+			continue
+		}
+
+		if conflict == nil {
+			return 0, ErrDuplicate
+		}
+
+		var existing Item
+		if id >= len(d.items) {
+			existing = added[id-len(d.items)]
+		} else if existing, ok = replaced[id]; !ok {
+			existing = d.items[id]
+		}
+
+		resolved, err := conflict(existing, item)
+		if err != nil {
+			return 0, err
+		}
+
+		if id >= len(d.items) {
+			added[id-len(d.items)] = resolved
+		} else {
+			replaced[id] = resolved
+		}
+	}
+
+	if err := d.beforeAdd(added); err != nil {
+		return 0, err
+	}
+
+	var (
+		items  = append([]Item{}, d.items...)
+		metas  = append([]meta{}, d.meta...)
+		nextID = d.nextID
+		ids    []int
+		from   = len(d.items)
+	)
+
+	for id := range replaced {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		d.items[id] = replaced[id]
+		d.replaced(id)
+	}
+
+	d.items = append(d.items, added...)
+	d.generated()
+	d.assign(from)
+	d.indexFrom(from)
+
+	if err := d.checkIndexes(); err != nil {
+		d.items, d.meta, d.nextID = items, metas, nextID
+		d.changed()
+		return 0, err
+	}
+
+	// the added items are put in place along with the changed ones, since
+	// the items have to be in order when the changed ones are moved
+	placed, _ := d.reorder(append(ids, idsFrom(from, len(d.items))...))
+	d.afterUpdate(placed[:len(ids)]...)
+	d.afterAdd(placed[len(ids):]...)
+	d.evict()
+
+	merged := len(replaced) + len(added)
+	if merged > 0 && d.autosave() {
+		return merged, d.save()
+	}
+
+	return merged, nil
+}
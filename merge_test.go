@@ -0,0 +1,69 @@
+package dump
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+type Counter struct {
+	Key   string
+	Count int
+}
+
+func TestMergeFile(t *testing.T) {
+	defer os.Remove("shard.db")
+
+	types := []Type{{"dump.Counter", &Counter{}}}
+
+	shard, _ := New("shard.db", PERSIST_MANUAL, types)
+	shard.AddAll(&Counter{"a", 1}, &Counter{"b", 2}, &Counter{"b", 3})
+	shard.Save()
+
+	test, _ := New("merged.db", PERSIST_MANUAL, types)
+	test.Add(&Counter{"a", 10})
+
+	if _, err := test.MergeFile("missing.db", nil); !os.IsNotExist(err) {
+		t.Fatal("expected missing file")
+	}
+
+	if merged, err := test.MergeFile("shard.db", nil); err != nil || merged != 3 {
+		t.Fatal("expected 3 appended items", merged, err)
+	}
+
+	keyed, _ := New("merged.db", PERSIST_MANUAL, types,
+		WithKey("key", func(item Item) string { return item.(*Counter).Key }))
+	keyed.Add(&Counter{"a", 10})
+
+	if _, err := keyed.MergeFile("shard.db", nil); err != ErrDuplicate {
+		t.Fatal("expected ErrDuplicate")
+	}
+
+	failed := errors.New("failed")
+	if _, err := keyed.MergeFile("shard.db", func(existing, incoming Item) (Item, error) {
+		return nil, failed
+	}); err != failed {
+		t.Fatal("expected conflict error")
+	}
+
+	sum := func(existing, incoming Item) (Item, error) {
+		return &Counter{existing.(*Counter).Key,
+			existing.(*Counter).Count + incoming.(*Counter).Count}, nil
+	}
+
+	if merged, err := keyed.MergeFile("shard.db", sum); err != nil || merged != 2 {
+		t.Fatal("expected one replaced and one added item", merged, err)
+	}
+
+	keyed.View(func(items []Item) error {
+		if len(items) != 2 || items[0].(*Counter).Count != 11 ||
+			items[1].(*Counter).Count != 5 {
+			t.Fatal("bad merge", items)
+		}
+		return nil
+	})
+
+	if ids, _, _ := keyed.GetByIndex("key", "b"); len(ids) != 1 {
+		t.Fatal("index not updated")
+	}
+}
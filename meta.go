@@ -0,0 +1,191 @@
+package dump
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"time"
+)
+
+// Meta is the metadata the dump keeps for an item, as returned by GetMeta().
+type Meta struct {
+	// ID is the stable id of the item, which unlike its position in the dump
+	// never changes and is never reused for another item.
+	ID uint64 `json:"id"`
+
+	// Version starts at 1 and is incremented every time the item is changed
+	// (see Version()).
+	Version uint64 `json:"version"`
+
+	// CreatedAt is when the item was added and UpdatedAt when it was last
+	// changed. They are the zero time for items persisted before the dump
+	// kept track of them.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Clock is the logical timestamp of the last change to the item and
+	// Writer the replica that made it, for dumps created with WithCRDT()
+	// (see After()).
+	Clock  uint64 `json:"clock,omitempty"`
+	Writer string `json:"writer,omitempty"`
+}
+
+// After reports whether the last change described by m wins over the one
+// described by other when merging them last-write-wins, like Merge() does:
+// the change with the later Clock wins, with ties broken by Writer. The
+// result is the same on every replica.
+func (m Meta) After(other Meta) bool {
+	return newer(meta{Modified: m.Clock, Writer: m.Writer}, meta{Modified: other.Clock, Writer: other.Writer})
+}
+
+// meta holds what the dump keeps track of for each item, alongside the item
+// itself. It is persisted together with the items.
+type meta struct {
+	// ID is the stable id of the item. Unlike the position of the item in the
+	// dump it never changes, and it is never reused for another item.
+	ID uint64
+
+	// Version is incremented every time the item is changed, starting at 1
+	// when the item is added.
+	Version uint64
+
+	// Origin is the replica that added the item and Created the Lamport
+	// timestamp it was added at, which together identify the item across
+	// merged dumps. Modified and Writer are the timestamp and replica of its
+	// last change. They are only set by dumps created with WithCRDT().
+	Origin   string
+	Created  uint64
+	Modified uint64
+	Writer   string
+
+	// Expires is when the item expires, in Unix nanoseconds, or 0 if it never
+	// does (see WithTTL()).
+	Expires int64
+
+	// CreatedAt and UpdatedAt are when the item was added and last changed,
+	// in Unix nanoseconds.
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+// GetMeta returns the metadata of the item with the provided id. It returns
+// ErrNotFound if there is no item with that id.
+func (d *Dump) GetMeta(id int) (Meta, error) {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	if id < 0 || id >= len(d.items) {
+		return Meta{}, ErrNotFound
+	}
+
+	return d.meta[id].public(), nil
+}
+
+// WithJSONMeta is an option that includes the metadata of the items in the
+// JSON written by MarshalJSON() and WriteJSONTo(): every item is written as
+// {"meta": {...}, "item": ...} instead. LoadJSON() and UnmarshalJSON() then
+// expect the same format, and unwrap the items (the items are given new
+// metadata, like they are without the option).
+func WithJSONMeta() Option {
+	return func(d *Dump) error {
+		d.jsonMeta = true
+		return nil
+	}
+}
+
+// public returns the exported version of the metadata.
+func (m meta) public() Meta {
+	p := Meta{ID: m.ID, Version: m.Version, Clock: m.Modified, Writer: m.Writer}
+	if m.CreatedAt != 0 {
+		p.CreatedAt = time.Unix(0, m.CreatedAt)
+	}
+	if m.UpdatedAt != 0 {
+		p.UpdatedAt = time.Unix(0, m.UpdatedAt)
+	}
+	return p
+}
+
+// withMeta is an item along with its metadata, as written and read when
+// WithJSONMeta() is enabled.
+type withMeta struct {
+	Meta Meta            `json:"meta"`
+	Item json.RawMessage `json:"item"`
+}
+
+// assign gives new metadata to every item starting at from.
+//
+// no mutex
+func (d *Dump) assign(from int) {
+	d.meta = d.meta[:from]
+	now := time.Now().UnixNano()
+	for i := from; i < len(d.items); i++ {
+		m := meta{ID: d.nextID, Version: 1, CreatedAt: now, UpdatedAt: now}
+		if d.crdt != nil {
+			m.Origin, m.Created = d.crdt.replica, d.crdt.tick()
+			m.Writer, m.Modified = m.Origin, m.Created
+		}
+		if d.ttl != nil {
+			m.Expires = d.ttl.expires()
+			d.ttl.schedule(m.Expires)
+		}
+		d.meta = append(d.meta, m)
+		d.used(i)
+		d.dirty(i)
+		d.nextID++
+	}
+}
+
+// restore sets the metadata of the items to m, as decoded from disk. Items
+// persisted without metadata are given new metadata.
+//
+// no mutex
+func (d *Dump) restore(m []meta, nextID uint64) {
+	d.nextID = nextID
+	for _, item := range m {
+		if item.ID >= d.nextID {
+			d.nextID = item.ID + 1
+		}
+	}
+
+	d.unordered = false
+	for i := 1; i < len(m); i++ {
+		if m[i].ID <= m[i-1].ID {
+			d.unordered = true
+			break
+		}
+	}
+
+	if len(m) != len(d.items) {
+		d.unordered = false
+		d.meta = make([]meta, 0, len(d.items))
+		d.assign(0)
+		return
+	}
+
+	d.meta = m
+	if d.ttl != nil {
+		d.ttl.schedule(1)
+	}
+}
+
+// bump increments the version of the item with the provided id, and sets
+// when it was updated.
+//
+// no mutex
+func (d *Dump) bump(id int) {
+	d.meta[id].Version++
+	d.meta[id].UpdatedAt = time.Now().UnixNano()
+	if d.crdt != nil {
+		d.meta[id].Writer, d.meta[id].Modified = d.crdt.replica, d.crdt.tick()
+	}
+}
+
+// encodeItem returns the gob encoding of item, or nil if it can't be encoded.
+func encodeItem(item Item) []byte {
+	buffer := getBuffer(0)
+	defer putBuffer(buffer)
+
+	if err := gob.NewEncoder(buffer).Encode(&item); err != nil {
+		return nil
+	}
+	return append([]byte{}, buffer.Bytes()...)
+}
@@ -0,0 +1,72 @@
+package dump
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRestore(t *testing.T) {
+	test, _ := NewDump("meta.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	test.items = []Item{&Blob{"a"}, &Blob{"b"}}
+
+	test.restore([]meta{{ID: 7}, {ID: 3}}, 5)
+	if test.nextID != 8 || !test.unordered || test.meta[1].ID != 3 {
+		t.Fatal("bad restore")
+	}
+
+	test.restore(nil, 10)
+	if test.nextID != 12 || test.unordered ||
+		test.meta[0].ID != 10 || test.meta[1].ID != 11 {
+		t.Fatal("didn't assign missing metadata")
+	}
+}
+
+func TestGetMeta(t *testing.T) {
+	test, _ := New("meta.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}},
+		WithFactory(func() Item { return &Plain{} }), WithJSONMeta())
+
+	before := time.Now()
+	test.AddAll(&Plain{"a"}, &Plain{"b"})
+
+	if _, err := test.GetMeta(2); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound")
+	}
+
+	m, _ := test.GetMeta(1)
+	if m.ID != 1 || m.Version != 1 || m.CreatedAt.Before(before) || !m.UpdatedAt.Equal(m.CreatedAt) {
+		t.Fatal("bad metadata", m)
+	}
+
+	time.Sleep(time.Millisecond)
+	test.Set(1, &Plain{"c"})
+
+	updated, _ := test.GetMeta(1)
+	if updated.Version != 2 || !updated.CreatedAt.Equal(m.CreatedAt) || !updated.UpdatedAt.After(m.UpdatedAt) {
+		t.Fatal("bad updated metadata", updated)
+	}
+
+	data, err := test.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var list []struct {
+		Meta Meta   `json:"meta"`
+		Item *Plain `json:"item"`
+	}
+	if err = json.Unmarshal(data, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[1].Item.Name != "c" || list[1].Meta.Version != 2 ||
+		!list[1].Meta.UpdatedAt.Equal(updated.UpdatedAt) {
+		t.Fatal("bad JSON", string(data))
+	}
+
+	if err = test.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := test.Get(1); item.(*Plain).Name != "c" {
+		t.Fatal("didn't unwrap items")
+	}
+}
@@ -0,0 +1,129 @@
+package dump
+
+import (
+	"encoding/gob"
+	"reflect"
+)
+
+// Migration upgrades the items of a dump from one schema version to the
+// next. It returns the upgraded items or an error if they can't be upgraded.
+type Migration func(items []Item) ([]Item, error)
+
+// WithSchema is an option that sets the schema version of the items held in
+// the dump. The version is written to the dump file on every save. When a
+// file with an older version is loaded, the migrations registered with
+// WithMigration() are run in order to bring the items up to date.
+func WithSchema(version int) Option {
+	return func(d *Dump) error {
+		if version < 0 {
+			return ErrInvalidSchema
+		}
+		d.schema = version
+		return nil
+	}
+}
+
+// WithMigration is an option that registers the migration m for upgrading
+// items from schema version from to version from+1. Versions without a
+// registered migration are upgraded without any changes to the items.
+func WithMigration(from int, m Migration) Option {
+	return func(d *Dump) error {
+		if from < 0 || m == nil {
+			return ErrInvalidSchema
+		}
+		if d.migrations == nil {
+			d.migrations = make(map[int]Migration)
+		}
+		d.migrations[from] = m
+		return nil
+	}
+}
+
+// WithTypeMigration is an option that loads items saved with an older
+// layout of a type, such as before a field was renamed. old is the old
+// layout, registered under the name the items were saved under:
+//
+//	dump.WithTypeMigration(dump.Type{"main.User", &UserV1{}}, func(item dump.Item) (dump.Item, error) {
+//		v1 := item.(*UserV1)
+//		return &User{FullName: v1.Name}, nil
+//	})
+//
+// Since gob identifies the types of the items by their names, the current
+// type has to be registered with New() under a new name (such as
+// "main.User.v2"). The items of the old type are converted by convert when
+// the dump file is loaded (before the migrations of WithMigration() run),
+// and are saved under the new name from the next save. An item converted to
+// another old type is converted again, so layouts can be chained.
+func WithTypeMigration(old Type, convert func(item Item) (Item, error)) Option {
+	return func(d *Dump) error {
+		if old.Value == nil || convert == nil {
+			return ErrInvalidTypeMigration
+		}
+
+		t := reflect.TypeOf(old.Value)
+		for _, registered := range d.types {
+			if registered.Name == old.Name || reflect.TypeOf(registered.Value) == t {
+				return ErrInvalidTypeMigration
+			}
+		}
+		if _, ok := d.conversions[t]; ok {
+			return ErrInvalidTypeMigration
+		}
+
+		gob.RegisterName(old.Name, old.Value)
+		if d.conversions == nil {
+			d.conversions = make(map[reflect.Type]func(Item) (Item, error))
+		}
+		d.conversions[t] = convert
+		return nil
+	}
+}
+
+// convert converts the items of old types in place (see
+// WithTypeMigration()).
+func (d *Dump) convert(items []Item) error {
+	conversions := d.root().conversions
+	if conversions == nil {
+		return nil
+	}
+
+	for i := range items {
+		// every conversion is applied at most once, so cycles end
+		for n := 0; n < len(conversions); n++ {
+			convert, ok := conversions[reflect.TypeOf(items[i])]
+			if !ok {
+				break
+			}
+
+			item, err := convert(items[i])
+			if err != nil {
+				return err
+			}
+			items[i] = item
+		}
+	}
+	return nil
+}
+
+// migrate upgrades items from schema version from to the schema version of
+// the dump, converting the items of old types first.
+func (d *Dump) migrate(from int, items []Item) ([]Item, error) {
+	if from > d.schema {
+		return nil, ErrSchemaTooNew
+	}
+
+	if err := d.convert(items); err != nil {
+		return nil, err
+	}
+
+	var err error
+	for v := from; v < d.schema; v++ {
+		if m, ok := d.migrations[v]; ok {
+			if items, err = m(items); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return items, nil
+}
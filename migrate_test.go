@@ -0,0 +1,128 @@
+package dump
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMigration(t *testing.T) {
+	if _, err := New("migrate.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithSchema(-1)); err != ErrInvalidSchema {
+		t.Fatal("accepted negative schema")
+	}
+
+	if _, err := New("migrate.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithMigration(0, nil)); err != ErrInvalidSchema {
+		t.Fatal("accepted nil migration")
+	}
+
+	v1, _ := New("migrate.db", PERSIST_WRITES,
+		[]Type{{"dump.Blob", &Blob{}}}, WithSchema(1))
+	if _, err := v1.Add(&Blob{"old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	v3, _ := New("migrate.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}},
+		WithSchema(3),
+		WithMigration(0, func(items []Item) ([]Item, error) {
+			t.Fatal("ran migration for older version")
+			return items, nil
+		}),
+		WithMigration(2, func(items []Item) ([]Item, error) {
+			for _, item := range items {
+				item.(*Blob).Data += "+v3"
+			}
+			return items, nil
+		}))
+	if err := v3.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	v3.View(func(items []Item) error {
+		if items[0].(*Blob).Data != "old+v3" {
+			t.Fatal("migration didn't run")
+		}
+		return nil
+	})
+
+	if err := v3.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v1.Load(); err != ErrSchemaTooNew {
+		t.Fatal("loaded newer schema")
+	}
+
+	var errMigrate = errors.New("migrate")
+
+	broken, _ := New("migrate.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}},
+		WithSchema(4),
+		WithMigration(3, func(items []Item) ([]Item, error) {
+			return nil, errMigrate
+		}))
+	if err := broken.Load(); err != errMigrate {
+		t.Fatal("migration error not returned")
+	}
+}
+
+// ProfileV1 is the old layout of Profile, before Name was split.
+type ProfileV1 struct {
+	Name string
+}
+
+type Profile struct {
+	First, Last string
+}
+
+func TestTypeMigration(t *testing.T) {
+	defer os.Remove("profiles.db")
+
+	old, _ := New("profiles.db", PERSIST_MANUAL, []Type{{"dump.Profile", &ProfileV1{}}})
+	old.AddAll(&ProfileV1{"Ada Lovelace"}, &ProfileV1{"Grace Hopper"})
+	old.Save()
+
+	types := []Type{{"dump.Profile.v2", &Profile{}}}
+	split := func(item Item) (Item, error) {
+		names := strings.SplitN(item.(*ProfileV1).Name, " ", 2)
+		return &Profile{names[0], names[1]}, nil
+	}
+
+	if _, err := New("profiles.db", PERSIST_MANUAL, types,
+		WithTypeMigration(Type{"dump.Profile.v2", &ProfileV1{}}, split)); err != ErrInvalidTypeMigration {
+		t.Fatal("accepted the name of a current type")
+	}
+	if _, err := New("profiles.db", PERSIST_MANUAL, types,
+		WithTypeMigration(Type{"dump.Profile", &ProfileV1{}}, nil)); err != ErrInvalidTypeMigration {
+		t.Fatal("accepted a nil function")
+	}
+
+	test, _ := New("profiles.db", PERSIST_MANUAL, types,
+		WithTypeMigration(Type{"dump.Profile", &ProfileV1{}}, split))
+	if err := test.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := test.Get(1); *item.(*Profile) != (Profile{"Grace", "Hopper"}) {
+		t.Fatal("bad item", item)
+	}
+
+	// saved with the new layout
+	test.Save()
+	other, _ := New("profiles.db", PERSIST_MANUAL, types)
+	if err := other.Load(); err != nil || other.Len() != 2 {
+		t.Fatal("didn't load the converted items", err)
+	}
+
+	errConvert := errors.New("convert")
+	old.Save()
+	failing, _ := New("profiles.db", PERSIST_MANUAL, types,
+		WithTypeMigration(Type{"dump.Profile", &ProfileV1{}}, func(item Item) (Item, error) {
+			return nil, errConvert
+		}))
+	if err := failing.Load(); err != errConvert {
+		t.Fatal("expected the conversion error", err)
+	}
+}
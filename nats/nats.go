@@ -0,0 +1,227 @@
+// Package nats provides a dump.EventSink that publishes the changes made to
+// a dump to a NATS server (see dump.Publish()).
+//
+// It speaks the NATS client protocol directly, so it has no dependencies, but
+// only supports what a publisher needs: every change is published as a JSON
+// message (see dump.Change.MarshalJSON()) and confirmed with a PING before
+// Publish() returns, which tells failed publishes apart from successful ones.
+package nats
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karlmcguire/dump"
+)
+
+var (
+	// ErrInvalidConfig is thrown by New() when the URL or the subject is
+	// missing or invalid.
+	ErrInvalidConfig = errors.New("invalid nats config")
+
+	// ErrClosed is thrown after the sink was closed.
+	ErrClosed = errors.New("nats sink closed")
+)
+
+// Config describes the server and subject a Sink publishes to.
+type Config struct {
+	// URL is the URL of the server, such as "nats://localhost:4222". The
+	// "tls" scheme connects with TLS, and the user and password in the URL
+	// (or the user alone, as a token) authenticate the connection.
+	URL string
+
+	// Subject is the prefix of the subjects the changes are published to,
+	// followed by their op: with "posts", additions are published to
+	// "posts.add" and so on ("posts.*" receives every change).
+	Subject string
+
+	// TLS configures the connection to servers with the "tls" scheme, which
+	// is upgraded to TLS after the server's greeting.
+	TLS *tls.Config
+
+	// Timeout bounds connecting and publishing a change (5s by default).
+	Timeout time.Duration
+}
+
+// Sink publishes changes to a NATS server. It connects on the first change
+// and reconnects after errors.
+type Sink struct {
+	cfg Config
+	url *url.URL
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	closed bool
+}
+
+// New returns a sink publishing to the server and subject of cfg.
+func New(cfg Config) (*Sink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "nats" && u.Scheme != "tls") ||
+		cfg.Subject == "" || strings.ContainsAny(cfg.Subject, " \t\r\n") {
+		return nil, ErrInvalidConfig
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	return &Sink{cfg: cfg, url: u}, nil
+}
+
+// Publish publishes the change to the subject of its op and waits for the
+// server to process it.
+func (s *Sink) Publish(c dump.Change) error {
+	payload, err := c.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.publish(s.cfg.Subject+"."+c.Op, payload); err != nil {
+		// the connection is in an unknown state
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection to the server.
+func (s *Sink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	s.closed = true
+
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// connect connects to the server, which greets the client with an INFO line
+// that is answered with CONNECT (after upgrading the connection to TLS for
+// the "tls" scheme).
+//
+// no mutex
+func (s *Sink) connect() error {
+	conn, err := net.DialTimeout("tcp", s.url.Host, s.cfg.Timeout)
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+	reader := bufio.NewReader(conn)
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("nats: unexpected greeting %q", strings.TrimSpace(line))
+	}
+
+	if s.url.Scheme == "tls" {
+		cfg := &tls.Config{ServerName: s.url.Hostname()}
+		if s.cfg.TLS != nil {
+			cfg = s.cfg.TLS.Clone()
+			if cfg.ServerName == "" {
+				cfg.ServerName = s.url.Hostname()
+			}
+		}
+
+		secure := tls.Client(conn, cfg)
+		if err := secure.Handshake(); err != nil {
+			conn.Close()
+			return err
+		}
+		conn, reader = secure, bufio.NewReader(secure)
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "dump",
+		"lang":     "go",
+	}
+	if user := s.url.User; user != nil {
+		if password, ok := user.Password(); ok {
+			options["user"], options["pass"] = user.Username(), password
+		} else {
+			options["auth_token"] = user.Username()
+		}
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\n", data); err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.conn, s.reader = conn, reader
+	return nil
+}
+
+// publish sends the message followed by a PING, and waits for the PONG
+// answering it. The server processes messages in order, so an error about
+// the message comes before the PONG.
+//
+// no mutex
+func (s *Sink) publish(subject string, payload []byte) error {
+	s.conn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+
+	message := fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload)
+	if _, err := s.conn.Write([]byte(message)); err != nil {
+		return err
+	}
+
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
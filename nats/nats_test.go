@@ -0,0 +1,125 @@
+package nats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/karlmcguire/dump"
+)
+
+// server is a NATS server understanding just enough of the protocol to
+// receive messages, rejecting the subjects in reject.
+type server struct {
+	listener net.Listener
+	connects chan string
+	messages chan string
+	reject   string
+}
+
+func newServer(t *testing.T) *server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &server{
+		listener: listener,
+		connects: make(chan string, 10),
+		messages: make(chan string, 10),
+		reject:   "posts.reset",
+	}
+	go s.serve()
+	return s
+}
+
+func (s *server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "CONNECT":
+			s.connects <- strings.TrimSpace(strings.TrimPrefix(line, "CONNECT"))
+		case "PUB":
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			if fields[1] == s.reject {
+				fmt.Fprint(conn, "-ERR 'Permissions Violation'\r\n")
+				continue
+			}
+			s.messages <- fields[1] + " " + string(payload[:size])
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		}
+	}
+}
+
+func TestSink(t *testing.T) {
+	if _, err := New(Config{URL: "http://localhost", Subject: "posts"}); err != ErrInvalidConfig {
+		t.Fatal("accepted an invalid scheme", err)
+	}
+	if _, err := New(Config{URL: "nats://localhost"}); err != ErrInvalidConfig {
+		t.Fatal("accepted an empty subject", err)
+	}
+
+	s := newServer(t)
+	defer s.listener.Close()
+
+	sink, err := New(Config{URL: "nats://token@" + s.listener.Addr().String(), Subject: "posts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	change := dump.Change{Seq: 1, Op: "add", StableID: 3, Data: []byte(`{"title":"a"}`)}
+	if err := sink.Publish(change); err != nil {
+		t.Fatal(err)
+	}
+	if connect := <-s.connects; !strings.Contains(connect, `"auth_token":"token"`) {
+		t.Fatal("didn't authenticate", connect)
+	}
+	if message := <-s.messages; message != `posts.add {"seq":1,"op":"add","id":0,"stable_id":3,"data":{"title":"a"}}` {
+		t.Fatal("bad message", message)
+	}
+
+	// errors are returned and the sink reconnects
+	if err := sink.Publish(dump.Change{Seq: 2, Op: "reset", ID: -1}); err == nil || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Fatal("expected an error", err)
+	}
+	if err := sink.Publish(dump.Change{Seq: 3, Op: "delete", StableID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if message := <-s.messages; !strings.HasPrefix(message, "posts.delete ") || len(s.connects) != 1 {
+		t.Fatal("didn't reconnect", message)
+	}
+
+	sink.Close()
+	if err := sink.Publish(change); err != ErrClosed {
+		t.Fatal("expected ErrClosed", err)
+	}
+}
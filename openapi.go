@@ -0,0 +1,270 @@
+package dump
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// OpenAPI returns an OpenAPI 3 document (as JSON) describing the REST API
+// served by Handler(), with the provided title and version. The schemas of
+// the items are derived from the registered types using reflection, following
+// the rules of encoding/json (json struct tags are respected). Types with
+// their own MarshalJSON method can't be described and are left unspecified.
+//
+// Handler() also serves the document at GET /openapi.json.
+func (d *Dump) OpenAPI(title, version string) ([]byte, error) {
+	var (
+		schemas = make(map[string]interface{})
+		refs    = make([]interface{}, 0, len(d.types))
+	)
+
+	for _, t := range d.types {
+		typ := reflect.TypeOf(t.Value)
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		schemas[t.Name] = schemaOf(typ, schemas, true)
+		refs = append(refs, ref(t.Name))
+	}
+
+	item := refs[0]
+	if len(refs) > 1 {
+		item = map[string]interface{}{"oneOf": refs}
+	}
+	schemas["Item"] = item
+
+	var (
+		itemContent = content(ref("Item"))
+		idParameter = []interface{}{map[string]interface{}{
+			"name":        "id",
+			"in":          "path",
+			"description": "The stable id of the item, which removing other items doesn't change.",
+			"required":    true,
+			"schema":      map[string]interface{}{"type": "integer", "minimum": 0},
+		}}
+		notFound = map[string]interface{}{"description": "There is no item with the id."}
+		invalid  = map[string]interface{}{"description": "The item failed validation."}
+	)
+
+	return json.MarshalIndent(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": version,
+		},
+		"paths": map[string]interface{}{
+			"/": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "list",
+					"summary":     "Lists the items.",
+					"parameters": []interface{}{
+						query("offset", "The position of the first item listed."),
+						query("limit", "The maximum number of items listed."),
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "The items.",
+							"headers": map[string]interface{}{
+								"X-Total-Count": map[string]interface{}{
+									"description": "The number of items in the dump.",
+									"schema":      map[string]interface{}{"type": "integer"},
+								},
+							},
+							"content": content(map[string]interface{}{
+								"type":  "array",
+								"items": ref("Item"),
+							})["content"],
+						},
+						"304": map[string]interface{}{"description": "The items didn't change."},
+					},
+				},
+				"post": map[string]interface{}{
+					"operationId": "add",
+					"summary":     "Adds an item.",
+					"requestBody": itemContent,
+					"responses": map[string]interface{}{
+						"201": map[string]interface{}{
+							"description": "The id of the added item.",
+							"content": content(map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"id": map[string]interface{}{"type": "integer"},
+								},
+							})["content"],
+						},
+						"422": invalid,
+					},
+				},
+			},
+			"/{id}": map[string]interface{}{
+				"parameters": idParameter,
+				"get": map[string]interface{}{
+					"operationId": "get",
+					"summary":     "Returns an item.",
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "The item.",
+							"content":     itemContent["content"],
+						},
+						"404": notFound,
+					},
+				},
+				"put": map[string]interface{}{
+					"operationId": "update",
+					"summary":     "Replaces an item.",
+					"requestBody": itemContent,
+					"responses": map[string]interface{}{
+						"204": map[string]interface{}{"description": "The item was replaced."},
+						"404": notFound,
+						"422": invalid,
+					},
+				},
+				"delete": map[string]interface{}{
+					"operationId": "delete",
+					"summary":     "Removes an item.",
+					"responses": map[string]interface{}{
+						"204": map[string]interface{}{"description": "The item was removed."},
+						"404": notFound,
+					},
+				},
+			},
+		},
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}, "", "  ")
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func content(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"required": true,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schema},
+		},
+	}
+}
+
+func query(name, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      map[string]interface{}{"type": "integer", "minimum": 0},
+	}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schemaOf returns the JSON schema of typ as encoded by encoding/json. Named
+// struct types are added to schemas and referenced, unless root is true.
+func schemaOf(typ reflect.Type, schemas map[string]interface{}, root bool) map[string]interface{} {
+	switch {
+	case typ == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case typ.Implements(marshalerType) || reflect.PtrTo(typ).Implements(marshalerType):
+		return map[string]interface{}{}
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return schemaOf(typ.Elem(), schemas, false)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 && typ.Kind() == reflect.Slice {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{
+			"type":  "array",
+			"items": schemaOf(typ.Elem(), schemas, false),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaOf(typ.Elem(), schemas, false),
+		}
+	case reflect.Struct:
+		if root || typ.Name() == "" {
+			return structSchema(typ, schemas)
+		}
+
+		name := strings.Replace(typ.String(), "/", ".", -1)
+		if _, ok := schemas[name]; !ok {
+			// reserved first, so recursive types terminate
+			schemas[name] = nil
+			schemas[name] = structSchema(typ, schemas)
+		}
+		return ref(name)
+	}
+
+	// interfaces and anything else can be any value
+	return map[string]interface{}{}
+}
+
+func structSchema(typ reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	addFields(typ, schemas, properties)
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+// addFields adds the fields of the struct typ to properties, including the
+// fields of embedded structs.
+func addFields(typ reflect.Type, schemas, properties map[string]interface{}) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addFields(embedded, schemas, properties)
+				continue
+			}
+		}
+
+		// unexported fields aren't encoded
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := schemaOf(field.Type, schemas, false)
+		if strings.Contains(tag, ",string") {
+			schema = map[string]interface{}{"type": "string"}
+		}
+		properties[name] = schema
+	}
+}
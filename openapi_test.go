@@ -0,0 +1,125 @@
+package dump
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type Author struct {
+	Name  string
+	Posts []*Article `json:"posts,omitempty"`
+}
+
+type Article struct {
+	Title     string            `json:"title"`
+	Views     uint              `json:"views"`
+	Score     float64           `json:"score"`
+	Draft     bool              `json:"draft"`
+	Published time.Time         `json:"published"`
+	Tags      map[string]string `json:"tags"`
+	Raw       []byte            `json:"raw"`
+	Count     int64             `json:"count,string"`
+	Author    *Author           `json:"author"`
+	Secret    string            `json:"-"`
+	hidden    string
+	Embedded
+}
+
+type Embedded struct {
+	Extra interface{} `json:"extra"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_MANUAL,
+		Type{"dump.Article", &Article{}}, Type{"dump.Blob", &Blob{}})
+
+	data, err := test.OpenAPI("articles", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title string `json:"title"`
+		} `json:"info"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Type       string                            `json:"type"`
+				Properties map[string]map[string]interface{} `json:"properties"`
+				OneOf      []map[string]string               `json:"oneOf"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI != "3.0.3" || doc.Info.Title != "articles" {
+		t.Fatal("bad document info")
+	}
+
+	for path, methods := range map[string][]string{
+		"/":     {"get", "post"},
+		"/{id}": {"get", "put", "delete"},
+	} {
+		for _, method := range methods {
+			if _, ok := doc.Paths[path][method]; !ok {
+				t.Fatal("missing operation", method, path)
+			}
+		}
+	}
+
+	if item := doc.Components.Schemas["Item"]; len(item.OneOf) != 2 ||
+		item.OneOf[0]["$ref"] != "#/components/schemas/dump.Article" {
+		t.Fatal("bad item schema", item)
+	}
+
+	article := doc.Components.Schemas["dump.Article"].Properties
+	for name, typ := range map[string]string{
+		"title":     "string",
+		"views":     "integer",
+		"score":     "number",
+		"draft":     "boolean",
+		"published": "string",
+		"tags":      "object",
+		"raw":       "string",
+		"count":     "string",
+	} {
+		if article[name]["type"] != typ {
+			t.Fatal("bad property", name, article[name])
+		}
+	}
+
+	for _, name := range []string{"Secret", "hidden"} {
+		if _, ok := article[name]; ok {
+			t.Fatal("described a field that isn't encoded", name)
+		}
+	}
+
+	if _, ok := article["extra"]; !ok {
+		t.Fatal("didn't describe embedded fields")
+	}
+
+	if article["author"]["$ref"] != "#/components/schemas/dump.Author" {
+		t.Fatal("bad reference", article["author"])
+	}
+
+	if _, ok := doc.Components.Schemas["dump.Author"].Properties["posts"]; !ok {
+		t.Fatal("bad recursive schema")
+	}
+
+	if len(doc.Components.Schemas["dump.Blob"].Properties) != 0 {
+		t.Fatal("described a type with its own MarshalJSON")
+	}
+
+	recorder := httptest.NewRecorder()
+	Handler(test, HandlerOptions{}).ServeHTTP(recorder, httptest.NewRequest("GET", "/openapi.json", nil))
+	if recorder.Code != http.StatusOK || !json.Valid(recorder.Body.Bytes()) {
+		t.Fatal("openapi.json wasn't served")
+	}
+}
@@ -0,0 +1,168 @@
+package dump
+
+import (
+	"sort"
+)
+
+// WithOrder is an option that keeps the items of the dump sorted using less,
+// like a priority queue: items are put in their place as they are added,
+// and moved to their new place when they are changed (after the items equal
+// to them). Since the id of an item is its position in
+// the dump, adding or changing an item can shift the ids of the others, and
+// the ids returned by Add(), AddAll() and Upsert() are the positions the
+// items were put at. Change events (see WithChanges()) carry the ids of the
+// items in their new places.
+//
+// View(), All(), Query() and the other ways of reading the dump go over the
+// items in order, and PopMin() and PopMax() remove the least and the
+// greatest item. With WithMaxItems(), the least items are the ones removed
+// when the dump is full. Items loaded or replaced as a whole are put in order
+// too, so Sort() has no effect.
+func WithOrder(less func(a, b Item) bool) Option {
+	return func(d *Dump) error {
+		if less == nil {
+			return ErrNoOrder
+		}
+		d.order = less
+		return nil
+	}
+}
+
+// PopMin removes the least item of a dump created with WithOrder() and
+// returns it. It returns ErrNoOrder if the dump wasn't created with
+// WithOrder(), ErrNotFound if the dump is empty, and an error if there was a
+// problem persisting the dump on the disk (if PERSIST_WRITES is enabled).
+func (d *Dump) PopMin() (Item, error) {
+	if d.order == nil {
+		return nil, ErrNoOrder
+	}
+	return d.pop(false)
+}
+
+// PopMax removes the greatest item of a dump created with WithOrder() and
+// returns it, like PopMin().
+func (d *Dump) PopMax() (Item, error) {
+	if d.order == nil {
+		return nil, ErrNoOrder
+	}
+	return d.pop(true)
+}
+
+// reorder moves the items with the provided ids, which were just added or
+// changed, to their place if WithOrder() is enabled, and returns their new
+// ids and whether any item moved. The other items have to be in order. Items
+// are inserted one at a time after the items equal to them, found with a
+// binary search, so items added in order are never moved.
+//
+// no mutex
+func (d *Dump) reorder(ids []int) ([]int, bool) {
+	if d.order == nil || d.placed(ids) {
+		return ids, false
+	}
+
+	var (
+		stables = d.stables(ids)
+		changed = make(map[int]bool, len(ids))
+		items   = make([]Item, 0, len(d.items))
+		metas   = make([]meta, 0, len(d.meta))
+		lowest  = len(d.items)
+	)
+	for _, id := range ids {
+		changed[id] = true
+		if id < lowest {
+			lowest = id
+		}
+	}
+
+	// the items are moved after the others, then put in place one by one
+	for id := range d.items {
+		if !changed[id] {
+			items, metas = append(items, d.items[id]), append(metas, d.meta[id])
+		}
+	}
+	for _, id := range ids {
+		items, metas = append(items, d.items[id]), append(metas, d.meta[id])
+	}
+	d.items, d.meta = items, metas
+
+	for n := len(d.items) - len(ids); n < len(d.items); n++ {
+		item, m := d.items[n], d.meta[n]
+		i := sort.Search(n, func(j int) bool {
+			return d.order(item, d.items[j])
+		})
+		copy(d.items[i+1:n+1], d.items[i:n])
+		copy(d.meta[i+1:n+1], d.meta[i:n])
+		d.items[i], d.meta[i] = item, m
+		if i < lowest {
+			lowest = i
+		}
+	}
+
+	d.unordered = true
+	d.generated()
+	d.shifted(lowest)
+	d.reindex()
+
+	return d.positions(stables), true
+}
+
+// placed reports whether the items with the provided ids are in order with
+// their neighbours, which means every item is in place if the others are.
+//
+// no mutex
+func (d *Dump) placed(ids []int) bool {
+	for _, id := range ids {
+		if id > 0 && d.order(d.items[id], d.items[id-1]) {
+			return false
+		}
+		if id < len(d.items)-1 && d.order(d.items[id+1], d.items[id]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ordered reports whether the items are in order, which they always are
+// unless WithOrder() is enabled.
+//
+// no mutex
+func (d *Dump) ordered() bool {
+	if d.order == nil {
+		return true
+	}
+	return sort.SliceIsSorted(d.items, func(i, j int) bool {
+		return d.order(d.items[i], d.items[j])
+	})
+}
+
+// stables returns the stable ids of the items with the provided ids.
+//
+// no mutex
+func (d *Dump) stables(ids []int) []uint64 {
+	stables := make([]uint64, len(ids))
+	for i, id := range ids {
+		stables[i] = d.meta[id].ID
+	}
+	return stables
+}
+
+// positions returns the ids of the items with the provided stable ids (-1
+// for items that were removed), for finding items WithOrder() moved.
+//
+// no mutex
+func (d *Dump) positions(stables []uint64) []int {
+	ids := make(map[uint64]int, len(d.meta))
+	for id, m := range d.meta {
+		ids[m.ID] = id
+	}
+
+	positions := make([]int, len(stables))
+	for i, stable := range stables {
+		id, ok := ids[stable]
+		if !ok {
+			id = -1
+		}
+		positions[i] = id
+	}
+	return positions
+}
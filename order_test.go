@@ -0,0 +1,160 @@
+package dump
+
+import (
+	"os"
+	"testing"
+)
+
+type Task struct {
+	Priority int
+}
+
+func TestOrder(t *testing.T) {
+	types := []Type{{"dump.Task", &Task{}}}
+	byPriority := func(a, b Item) bool {
+		return a.(*Task).Priority < b.(*Task).Priority
+	}
+
+	plain, _ := New("order.db", PERSIST_MANUAL, types)
+	if _, err := plain.PopMin(); err != ErrNoOrder {
+		t.Fatal("popped from an unordered dump")
+	}
+
+	test, err := New("order.db", PERSIST_WRITES, types, WithOrder(byPriority))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = test.PopMax(); err != ErrNotFound {
+		t.Fatal("popped from an empty dump")
+	}
+
+	if id, _ := test.Add(&Task{5}); id != 0 {
+		t.Fatal("bad id", id)
+	}
+	if id, _ := test.Add(&Task{1}); id != 0 {
+		t.Fatal("didn't put the item in its place", id)
+	}
+	ids, err := test.AddAll(&Task{9}, &Task{3})
+	if err != nil || ids[0] != 3 || ids[1] != 1 {
+		t.Fatal("bad ids", ids, err)
+	}
+
+	priorities := func(d *Dump) []int {
+		var p []int
+		d.View(func(items []Item) error {
+			for _, item := range items {
+				p = append(p, item.(*Task).Priority)
+			}
+			return nil
+		})
+		return p
+	}
+	if p := priorities(test); p[0] != 1 || p[1] != 3 || p[2] != 5 || p[3] != 9 {
+		t.Fatal("bad order", p)
+	}
+
+	// changing an item moves it
+	test.UpdateAt(0, func(item Item) error {
+		item.(*Task).Priority = 7
+		return nil
+	})
+	if p := priorities(test); p[0] != 3 || p[2] != 7 {
+		t.Fatal("didn't move the changed item", p)
+	}
+
+	if item, err := test.PopMin(); err != nil || item.(*Task).Priority != 3 {
+		t.Fatal("bad PopMin", item, err)
+	}
+	if item, err := test.PopMax(); err != nil || item.(*Task).Priority != 9 {
+		t.Fatal("bad PopMax", item, err)
+	}
+
+	loaded, _ := New("order.db", PERSIST_MANUAL, types, WithOrder(byPriority))
+	if err = loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if p := priorities(loaded); len(p) != 2 || p[0] != 5 || p[1] != 7 {
+		t.Fatal("didn't persist the order", p)
+	}
+}
+
+func TestOrderChanges(t *testing.T) {
+	types := []Type{{"dump.Task", &Task{}}}
+	byPriority := func(a, b Item) bool {
+		return a.(*Task).Priority < b.(*Task).Priority
+	}
+
+	test, _ := New("order.db", PERSIST_MANUAL, types, WithOrder(byPriority), WithChanges(100))
+	defer os.Remove("order.db")
+	changes, cancel, err := test.Changes(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	for _, p := range []int{5, 3, 4, 1} {
+		test.Add(&Task{p})
+	}
+	test.UpdateAt(0, func(item Item) error {
+		item.(*Task).Priority = 6
+		return nil
+	})
+
+	// every change is published once, with the id the item was put at
+	expected := []struct {
+		op string
+		id int
+	}{{"add", 0}, {"add", 0}, {"add", 1}, {"add", 0}, {"update", 3}}
+	for _, e := range expected {
+		if c := <-changes; c.Op != e.op || c.ID != e.id {
+			t.Fatal("bad change", c.Op, c.ID, e)
+		}
+	}
+	select {
+	case c := <-changes:
+		t.Fatal("unexpected change", c.Op, c.ID)
+	default:
+	}
+}
+
+func TestOrderCommandLog(t *testing.T) {
+	defer os.Remove("order.db")
+	defer os.Remove("order.log")
+
+	types := []Type{{"dump.Task", &Task{}}}
+	byPriority := func(a, b Item) bool {
+		return a.(*Task).Priority < b.(*Task).Priority
+	}
+
+	log, _ := OpenCommandLog("order.log")
+	test, _ := New("order.db", PERSIST_WRITES, types, WithOrder(byPriority), WithCommandLog(log))
+	test.AddAll(&Task{5}, &Task{3}, &Task{4}, &Task{1})
+	test.UpdateAt(0, func(item Item) error {
+		item.(*Task).Priority = 6
+		return nil
+	})
+	test.Update(func(items []Item) error {
+		items[0].(*Task).Priority = 9
+		items[1].(*Task).Priority = 2
+		return nil
+	})
+
+	priorities := func(d *Dump) (p []int) {
+		d.View(func(items []Item) error {
+			for _, item := range items {
+				p = append(p, item.(*Task).Priority)
+			}
+			return nil
+		})
+		return p
+	}
+
+	other, _ := New("order.db", PERSIST_MANUAL, types, WithOrder(byPriority), WithCommandLog(log))
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := priorities(test), priorities(other); len(a) != 4 || len(b) != 4 || a[0] != 2 || a[3] != 9 ||
+		a[0] != b[0] || a[1] != b[1] || a[2] != b[2] || a[3] != b[3] {
+		t.Fatal("bad replay", a, b)
+	}
+}
@@ -0,0 +1,77 @@
+package dump
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Page returns up to limit items in the order they were added to the dump,
+// starting after the cursor. An empty cursor starts at the first item. The
+// returned next cursor is passed to the following call to get the next page,
+// and is empty when there are no more items.
+//
+// Cursors are based on stable ids rather than positions, so items being
+// added or removed between calls never cause items to be skipped or repeated.
+// It returns ErrInvalidCursor if the cursor is malformed and ErrInvalidLimit
+// if limit isn't positive.
+func (d *Dump) Page(cursor string, limit int) ([]Item, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidLimit
+	}
+
+	var (
+		after uint64
+		err   error
+	)
+
+	if cursor != "" {
+		if after, err = strconv.ParseUint(cursor, 36, 64); err != nil || after == 0 {
+			return nil, "", ErrInvalidCursor
+		}
+		// ids start at 0, so cursors are offset by one to tell them apart
+		// from the empty cursor
+		after--
+	}
+
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	var positions []int
+
+	if !d.unordered {
+		start := 0
+		if cursor != "" {
+			start = sort.Search(len(d.meta), func(i int) bool {
+				return d.meta[i].ID > after
+			})
+		}
+		for i := start; i < len(d.meta) && len(positions) <= limit; i++ {
+			positions = append(positions, i)
+		}
+	} else {
+		for i := range d.meta {
+			if cursor == "" || d.meta[i].ID > after {
+				positions = append(positions, i)
+			}
+		}
+		sort.Slice(positions, func(i, j int) bool {
+			return d.meta[positions[i]].ID < d.meta[positions[j]].ID
+		})
+	}
+
+	next := ""
+	if len(positions) > limit {
+		positions = positions[:limit]
+		next = strconv.FormatUint(d.meta[positions[limit-1]].ID+1, 36)
+	}
+
+	items := make([]Item, len(positions))
+	for i, position := range positions {
+		items[i] = d.items[position]
+	}
+
+	if items, err = d.reading(items); err != nil {
+		return nil, "", err
+	}
+	return items, next, nil
+}
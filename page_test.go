@@ -0,0 +1,106 @@
+package dump
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPage(t *testing.T) {
+	test, _ := NewDump("page.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+	test.AddAll(&Blob{"e"}, &Blob{"d"}, &Blob{"c"}, &Blob{"b"}, &Blob{"a"})
+
+	page := func(d *Dump, cursor string, limit int, expected ...string) string {
+		items, next, err := d.Page(cursor, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != len(expected) {
+			t.Fatalf("expected %v, got %d items", expected, len(items))
+		}
+		for i := range items {
+			if items[i].(*Blob).Data != expected[i] {
+				t.Fatalf("expected %v, got %v at %d", expected, items[i], i)
+			}
+		}
+		return next
+	}
+
+	next := page(test, "", 2, "e", "d")
+	next = page(test, next, 2, "c", "b")
+
+	// items added while paginating show up on later pages
+	test.Add(&Blob{"z"})
+
+	if next = page(test, next, 2, "a", "z"); next != "" {
+		t.Fatal("expected last page")
+	}
+
+	if next = page(test, "", 10, "e", "d", "c", "b", "a", "z"); next != "" {
+		t.Fatal("expected last page")
+	}
+
+	next = page(test, "", 3, "e", "d", "c")
+
+	// sorting changes positions but not the order of pages
+	test.Sort(func(a, b Item) bool { return a.(*Blob).Data < b.(*Blob).Data })
+
+	if next = page(test, next, 2, "b", "a"); next == "" {
+		t.Fatal("expected another page")
+	}
+
+	// cursors survive saving and loading
+	other, _ := NewDump("page.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+	page(other, next, 2, "z")
+
+	other.Clear()
+	other.Add(&Blob{"new"})
+	page(other, next, 2, "new")
+
+	for _, cursor := range []string{"!", "0"} {
+		if _, _, err := test.Page(cursor, 1); err != ErrInvalidCursor {
+			t.Fatal("accepted invalid cursor", cursor)
+		}
+	}
+
+	if _, _, err := test.Page("", 0); err != ErrInvalidLimit {
+		t.Fatal("accepted invalid limit")
+	}
+}
+
+func TestPageRecords(t *testing.T) {
+	defer os.Remove("page.log")
+	os.Remove("page.log")
+
+	log, err := OpenLogStore("page.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	test, _ := New("page.db", PERSIST_WRITES,
+		[]Type{{"dump.Blob", &Blob{}}}, WithRecordStore(log))
+	test.AddAll(&Blob{"b"}, &Blob{"a"})
+	test.Sort(func(a, b Item) bool { return a.(*Blob).Data < b.(*Blob).Data })
+
+	other, _ := New("page.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithRecordStore(log))
+	if err = other.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	items, next, _ := other.Page("", 1)
+	if items[0].(*Blob).Data != "b" {
+		t.Fatal("record store lost ids")
+	}
+
+	if items, _, _ = other.Page(next, 1); items[0].(*Blob).Data != "a" {
+		t.Fatal("record store lost ids")
+	}
+
+	if id, _ := other.Add(&Blob{"c"}); other.meta[id].ID != 2 {
+		t.Fatal("reused id after load")
+	}
+}
@@ -0,0 +1,132 @@
+package dump
+
+import (
+	"sync"
+	"time"
+)
+
+// Policy is a rule for when a dump is saved, passed to WithPersistence().
+type Policy func(p *policy) error
+
+// AfterWrites is a Policy that saves the dump after every n changes, like
+// PERSIST_BATCH(n) (and PERSIST_WRITES for an n of 1).
+func AfterWrites(n int) Policy {
+	return func(p *policy) error {
+		if n < 1 {
+			return ErrInvalidPolicy
+		}
+		if p.batch == 0 || n < p.batch {
+			p.batch = n
+		}
+		return nil
+	}
+}
+
+// AfterQuiet is a Policy that saves the dump once it wasn't changed for
+// quiet, so a burst of changes is saved once it is over.
+func AfterQuiet(quiet time.Duration) Policy {
+	return func(p *policy) error {
+		if quiet <= 0 {
+			return ErrInvalidPolicy
+		}
+		p.quiet = quiet
+		return nil
+	}
+}
+
+// Every is a Policy that saves the dump every interval if it was changed
+// since it was last saved, as a safety net for the other policies (such as
+// AfterQuiet() with changes that never stop).
+func Every(interval time.Duration) Policy {
+	return func(p *policy) error {
+		if interval <= 0 {
+			return ErrInvalidPolicy
+		}
+		p.interval = interval
+		return nil
+	}
+}
+
+// WithPersistence is an option that saves the dump according to policies,
+// in addition to its disk-persistence setting (which is usually
+// PERSIST_MANUAL when policies are used). The dump is saved as soon as any
+// of the policies says so, for example after every 100 changes, once it
+// wasn't changed for a second, and at least once a minute:
+//
+//	dump.WithPersistence(dump.AfterWrites(100), dump.AfterQuiet(time.Second), dump.Every(time.Minute))
+//
+// Saves made because of AfterWrites() happen in the method changing the
+// dump, which returns their error. The other policies save in the
+// background, printing errors like PERSIST_INTERVAL does (Stats() reports
+// them too). Close() saves the dump one last time.
+func WithPersistence(policies ...Policy) Option {
+	return func(d *Dump) error {
+		if d.policy == nil {
+			d.policy = &policy{}
+		}
+		for _, p := range policies {
+			if err := p(d.policy); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// policy holds the policies of WithPersistence().
+type policy struct {
+	batch    int
+	quiet    time.Duration
+	interval time.Duration
+
+	// timer saves the dump once it wasn't changed for quiet
+	timer *time.Timer
+	mutex sync.Mutex
+}
+
+// restartQuiet restarts the wait for the dump to be quiet after a change, if
+// AfterQuiet() is used.
+func (d *Dump) restartQuiet() {
+	if d.policy == nil || d.policy.quiet == 0 {
+		return
+	}
+
+	d.policy.mutex.Lock()
+	defer d.policy.mutex.Unlock()
+
+	if d.policy.timer == nil {
+		d.policy.timer = time.AfterFunc(d.policy.quiet, d.flushInBackground)
+		return
+	}
+	d.policy.timer.Reset(d.policy.quiet)
+}
+
+// startPolicies starts saving the dump every interval, if Every() is used.
+func (d *Dump) startPolicies() {
+	if d.policy == nil || d.policy.interval == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(d.policy.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.closed:
+				return
+			case <-ticker.C:
+			}
+
+			d.flushInBackground()
+		}
+	}()
+}
+
+// flushInBackground saves the changes made since the last save, printing the
+// error if there is one.
+func (d *Dump) flushInBackground() {
+	if err := d.Flush(); err != nil {
+		println(err.Error())
+	}
+}
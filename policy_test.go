@@ -0,0 +1,53 @@
+package dump
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPersistence(t *testing.T) {
+	defer os.Remove("policy.db")
+
+	types := []Type{{"dump.Blob", &Blob{}}}
+	if _, err := New("policy.db", PERSIST_MANUAL, types, WithPersistence(AfterWrites(0))); err != ErrInvalidPolicy {
+		t.Fatal("accepted 0 writes")
+	}
+
+	// the smallest batch wins
+	batched, _ := New("policy.db", PERSIST_BATCH(5), types, WithPersistence(AfterWrites(2)))
+	batched.Add(&Blob{"one"})
+	batched.Add(&Blob{"two"})
+	if saves := batched.Stats().Saves; saves != 1 {
+		t.Fatal("didn't save after 2 writes", saves)
+	}
+
+	quiet, _ := New("policy.db", PERSIST_MANUAL, types, WithPersistence(AfterQuiet(20*time.Millisecond)))
+	quiet.Add(&Blob{"one"})
+	quiet.Add(&Blob{"two"})
+	if saves := quiet.Stats().Saves; saves != 0 {
+		t.Fatal("saved before the dump was quiet", saves)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if saves := quiet.Stats().Saves; saves != 1 {
+		t.Fatal("didn't save once quiet", saves)
+	}
+	quiet.Close()
+
+	every, _ := New("policy.db", PERSIST_MANUAL, types, WithPersistence(Every(10*time.Millisecond)))
+	time.Sleep(50 * time.Millisecond)
+	if saves := every.Stats().Saves; saves != 0 {
+		t.Fatal("saved without changes", saves)
+	}
+	every.Add(&Blob{"three"})
+	time.Sleep(50 * time.Millisecond)
+	if saves := every.Stats().Saves; saves != 1 {
+		t.Fatal("didn't save the change", saves)
+	}
+
+	// closing saves the changes of a manual dump with policies
+	every.Add(&Blob{"four"})
+	if err := every.Close(); err != nil || every.Stats().Saves != 2 {
+		t.Fatal("didn't save on close", err)
+	}
+}
@@ -0,0 +1,27 @@
+package dump
+
+import (
+	"bytes"
+	"sync"
+)
+
+// buffers pools the buffers dump files and items are encoded into, since
+// dumps saved on every write (PERSIST_WRITES) would otherwise allocate (and
+// grow) a buffer the size of the whole file on every change.
+var buffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// getBuffer returns an empty buffer from the pool, with room for at least
+// size bytes.
+func getBuffer(size int) *bytes.Buffer {
+	buffer := buffers.Get().(*bytes.Buffer)
+	buffer.Reset()
+	buffer.Grow(size)
+	return buffer
+}
+
+// putBuffer returns buffer to the pool. Its contents mustn't be used after.
+func putBuffer(buffer *bytes.Buffer) {
+	buffers.Put(buffer)
+}
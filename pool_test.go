@@ -0,0 +1,47 @@
+package dump
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	defer os.Remove("pool.db")
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	test, _ := New("pool.db", PERSIST_WRITES, types)
+	for i := 0; i < 100; i++ {
+		test.Add(&Plain{"item"})
+	}
+
+	for _, name := range []string{"a", "bb", "c"} {
+		if err := test.Set(50, &Plain{name}); err != nil {
+			t.Fatal(err)
+		}
+
+		other, _ := New("pool.db", PERSIST_MANUAL, types)
+		if err := other.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if item, _ := other.Get(50); other.Len() != 100 || item.(*Plain).Name != name {
+			t.Fatal("bad save", name)
+		}
+	}
+
+	// returned lists can't share a pooled buffer
+	first, _ := test.MarshalJSON()
+	expected := string(first)
+	test.Set(0, &Plain{"changed"})
+	test.MarshalJSON()
+	if string(first) != expected {
+		t.Fatal("list changed")
+	}
+
+	buffer := getBuffer(10)
+	buffer.WriteString("data")
+	putBuffer(buffer)
+	if buffer = getBuffer(10); buffer.Len() != 0 || buffer.Cap() < 10 {
+		t.Fatal("bad buffer")
+	}
+}
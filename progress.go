@@ -0,0 +1,146 @@
+package dump
+
+import (
+	"os"
+)
+
+// Progress describes how far along a save or load is. It is passed to the
+// function provided to WithProgress().
+type Progress struct {
+	// Op is "save" or "load".
+	Op string
+
+	// Items is the number of items (including the items of collections)
+	// encoded or decoded so far, out of TotalItems. Items are encoded and
+	// decoded all at once, so while loading both are 0 until the whole file
+	// has been read.
+	Items      int
+	TotalItems int
+
+	// Bytes is the number of bytes of the dump file written or read so far,
+	// out of TotalBytes.
+	Bytes      int64
+	TotalBytes int64
+}
+
+// progressChunk is how many bytes are written or read between two calls of
+// the progress function.
+const progressChunk = 1 << 20
+
+// WithProgress is an option that calls f as the dump file is saved and
+// loaded, so long saves and loads of large dumps can be followed. Bytes are
+// only reported as they are written or read when the dump is stored on the
+// local file system; other storages report them once the whole file was
+// written or read. Progress isn't reported for dumps with a record store.
+//
+// f is called while the dump is locked, so it can't call methods of the
+// dump.
+func WithProgress(f func(p Progress)) Option {
+	return func(d *Dump) error {
+		d.progress = f
+		return nil
+	}
+}
+
+// count returns the number of items of the dump and its collections.
+//
+// no mutex
+func (d *Dump) count() int {
+	n := len(d.items)
+	for _, c := range d.collections {
+		n += len(c.items)
+	}
+	return n
+}
+
+// writeFile writes the named file of the dump, reporting the progress.
+//
+// no mutex
+func (d *Dump) writeFile(name string, data []byte) error {
+	if d.progress == nil {
+		return d.storage.Write(name, data)
+	}
+
+	p := Progress{Op: "save", TotalBytes: int64(len(data))}
+	p.Items = d.count()
+	p.TotalItems = p.Items
+	d.progress(p)
+
+	if _, ok := d.storage.(fileStorage); !ok {
+		if err := d.storage.Write(name, data); err != nil {
+			return err
+		}
+		p.Bytes = p.TotalBytes
+		d.progress(p)
+		return nil
+	}
+
+	return writeChunks(name, data, func(n int64) {
+		p.Bytes = n
+		d.progress(p)
+	})
+}
+
+// decoded reports that the file of the dump was read and decoded.
+//
+// no mutex
+func (d *Dump) decoded(size int) {
+	if d.progress == nil {
+		return
+	}
+
+	n := d.count()
+	d.progress(Progress{
+		Op:         "load",
+		Items:      n,
+		TotalItems: n,
+		Bytes:      int64(size),
+		TotalBytes: int64(size),
+	})
+}
+
+// writeChunks writes data to the named file in chunks of progressChunk
+// bytes, calling progress with the number of bytes written after each one.
+// Like fileStorage.Write(), it replaces the file atomically.
+func writeChunks(name string, data []byte, progress func(n int64)) error {
+	return writeAtomic(name, func(file *os.File) error {
+		for written := 0; written < len(data); {
+			end := written + progressChunk
+			if end > len(data) {
+				end = len(data)
+			}
+
+			n, err := file.Write(data[written:end])
+			if written += n; err != nil {
+				return err
+			}
+			progress(int64(written))
+		}
+		return nil
+	})
+}
+
+// progressReader reports the progress of reading a dump file.
+type progressReader struct {
+	file     *os.File
+	total    int64
+	read     int64
+	reported int64
+	progress func(p Progress)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.file.Read(p)
+	r.read += int64(n)
+
+	if r.read-r.reported >= progressChunk || (r.read == r.total && r.read > r.reported) {
+		r.reported = r.read
+		r.progress(Progress{Op: "load", Bytes: r.read, TotalBytes: r.total})
+	}
+
+	return n, err
+}
+
+func (r *progressReader) Close() error {
+	return r.file.Close()
+}
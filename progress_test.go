@@ -0,0 +1,55 @@
+package dump
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	defer os.Remove("progress.db")
+
+	var reports []Progress
+	options := []Option{WithProgress(func(p Progress) { reports = append(reports, p) })}
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	test, _ := New("progress.db", PERSIST_MANUAL, types, options...)
+
+	// large enough to be written in several chunks
+	name := strings.Repeat("x", progressChunk)
+	test.AddAll(&Plain{name}, &Plain{name}, &Plain{"c"})
+
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, _ := os.Stat("progress.db")
+	if len(reports) < 3 {
+		t.Fatal("expected several reports", reports)
+	}
+	for i, p := range reports {
+		if p.Op != "save" || p.Items != 3 || p.TotalItems != 3 || p.TotalBytes != info.Size() {
+			t.Fatal("bad save progress", p)
+		}
+		if i > 0 && p.Bytes <= reports[i-1].Bytes {
+			t.Fatal("bytes didn't increase", reports)
+		}
+	}
+	if last := reports[len(reports)-1]; last.Bytes != last.TotalBytes {
+		t.Fatal("save didn't finish", last)
+	}
+
+	reports = nil
+	other, _ := New("progress.db", PERSIST_MANUAL, types, options...)
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reports) < 3 || reports[0].Op != "load" || reports[0].Items != 0 {
+		t.Fatal("bad load progress", reports)
+	}
+	last := reports[len(reports)-1]
+	if last.Items != 3 || last.TotalItems != 3 || last.Bytes != info.Size() || last.TotalBytes != info.Size() {
+		t.Fatal("load didn't finish", last)
+	}
+}
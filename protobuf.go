@@ -0,0 +1,322 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+)
+
+// WithProtobuf is an option that saves the items of the dump as protobuf
+// messages instead of gob, for items of types generated from .proto files.
+// Since protobuf identifies fields by number rather than by name, renaming a
+// field of a type doesn't break loading the dump, and the items can be read
+// by programs written in other languages.
+//
+// The dump doesn't depend on a protobuf library: marshal encodes an item
+// (such as with proto.Marshal()), and unmarshal decodes data into item,
+// which is a pointer to a new value of the type the item was registered
+// with (such as with proto.Unmarshal()).
+//
+// The payload of the dump file is the rest of the dump (the metadata of the
+// items, their revisions, ...) gob encoded, preceded by its length as a
+// varint, followed by the items of the dump and then of its collections (by
+// name) as varint length-prefixed messages laid out like google.protobuf.Any:
+// the name the type was registered under is field 1 and the item is field 2.
+// Dump files saved without it can still be loaded, and are written with
+// protobuf from the next save. It can't be combined with WithSegments(),
+// WithRecordStore() or WithTimeSeries(), which write items to files of their
+// own.
+func WithProtobuf(marshal func(item Item) ([]byte, error), unmarshal func(data []byte, item Item) error) Option {
+	return func(d *Dump) error {
+		if marshal == nil || unmarshal == nil {
+			return ErrInvalidProtobuf
+		}
+		d.protobuf = &protobuf{marshal: marshal, unmarshal: unmarshal}
+		return nil
+	}
+}
+
+// protobuf holds the functions passed to WithProtobuf().
+type protobuf struct {
+	marshal   func(item Item) ([]byte, error)
+	unmarshal func(data []byte, item Item) error
+}
+
+// encodeProtobuf writes the payload of a protobuf encoded dump file to w,
+// where f is the file struct of the dump without its items. It returns the
+// number of bytes written.
+//
+// no mutex
+func (d *Dump) encodeProtobuf(w io.Writer, f file, items []Item) (int, error) {
+	var (
+		counter = &countingWriter{w: w}
+		buffer  = getBuffer(0)
+		names   = make(map[reflect.Type]string, len(d.types))
+	)
+	defer putBuffer(buffer)
+
+	for _, t := range d.types {
+		names[reflect.TypeOf(t.Value)] = t.Name
+	}
+
+	// the items of the collections follow the ones of the dump
+	var (
+		collections = make([]string, 0, len(f.Collections))
+		collected   = make(map[string][]Item, len(f.Collections))
+	)
+	for name, c := range f.Collections {
+		collections = append(collections, name)
+		collected[name] = c.Items
+		c.Items, c.Count = nil, len(c.Items)
+		f.Collections[name] = c
+	}
+	sort.Strings(collections)
+
+	if err := gob.NewEncoder(buffer).Encode(&f); err != nil {
+		return 0, err
+	}
+	if err := writeMessage(counter, buffer.Bytes()); err != nil {
+		return 0, err
+	}
+
+	write := func(items []Item) error {
+		for _, item := range items {
+			name, ok := names[reflect.TypeOf(item)]
+			if !ok {
+				return &EncodeError{Type: fmt.Sprintf("%T", item), Err: ErrNotRegistered}
+			}
+
+			data, err := d.protobuf.marshal(item)
+			if err != nil {
+				return &EncodeError{Type: fmt.Sprintf("%T", item), Err: err}
+			}
+
+			message := appendField(appendField(nil, 1, []byte(name)), 2, data)
+			if err := writeMessage(counter, message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := write(items); err != nil {
+		return 0, err
+	}
+	for _, name := range collections {
+		if err := write(collected[name]); err != nil {
+			return 0, err
+		}
+	}
+
+	return counter.n, nil
+}
+
+// decodeProtobuf decodes the payload of a protobuf encoded dump file read
+// from r.
+//
+// no mutex
+func (d *Dump) decodeProtobuf(r io.Reader) (file, error) {
+	var (
+		f      file
+		reader = bufio.NewReader(r)
+		values = make(map[string]Item, len(d.types))
+	)
+
+	for _, t := range d.types {
+		values[t.Name] = t.Value
+	}
+
+	data, err := readMessage(reader)
+	if err != nil {
+		return f, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&f); err != nil {
+		return f, decodeError(err)
+	}
+
+	// items of unknown types are skipped so every unknown type is found
+	var unknown *UnknownTypeError
+
+	read := func(count int) ([]Item, map[int]bool, error) {
+		var (
+			items   = make([]Item, 0, preallocated(count))
+			skipped = make(map[int]bool)
+		)
+
+		for i := 0; i < count; i++ {
+			items = append(items, nil)
+
+			message, err := readMessage(reader)
+			if err != nil {
+				return nil, nil, err
+			}
+			name, data, err := parseAny(message)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			value, ok := values[name]
+			if !ok {
+				if unknown == nil {
+					unknown = &UnknownTypeError{Types: []string{name}}
+				} else {
+					unknown.add(name)
+				}
+				skipped[i] = true
+				continue
+			}
+
+			if items[i], err = d.unmarshalItem(value, data); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		return items, skipped, nil
+	}
+
+	items, skipped, err := read(f.Count)
+	if err != nil {
+		return f, err
+	}
+	f.Items, f.Meta = dropItems(items, f.Meta, skipped)
+	f.skipped = len(skipped)
+
+	collections := make([]string, 0, len(f.Collections))
+	for name := range f.Collections {
+		collections = append(collections, name)
+	}
+	sort.Strings(collections)
+
+	for _, name := range collections {
+		c := f.Collections[name]
+		items, skipped, err := read(c.Count)
+		if err != nil {
+			return f, err
+		}
+		c.Items, c.Meta = dropItems(items, c.Meta, skipped)
+		f.Collections[name] = c
+	}
+
+	if unknown != nil && !d.skipUnknown {
+		return f, unknown
+	}
+	return f, nil
+}
+
+// unmarshalItem decodes data into a new item of the type of value.
+func (d *Dump) unmarshalItem(value Item, data []byte) (Item, error) {
+	t := reflect.TypeOf(value)
+	if t.Kind() == reflect.Ptr {
+		item := reflect.New(t.Elem()).Interface()
+		return item, d.protobuf.unmarshal(data, item)
+	}
+
+	item := reflect.New(t)
+	if err := d.protobuf.unmarshal(data, item.Interface()); err != nil {
+		return nil, err
+	}
+	return item.Elem().Interface(), nil
+}
+
+// writeMessage writes message to w preceded by its length as a varint.
+func writeMessage(w io.Writer, message []byte) error {
+	var length [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(length[:], uint64(len(message)))
+
+	if _, err := w.Write(length[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(message)
+	return err
+}
+
+// readMessage reads a message written by writeMessage(). It returns
+// ErrCorrupt if the message is truncated.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+
+	// the length isn't trusted to allocate the message, as the checksum of
+	// the payload is only verified once it was read
+	message, err := ioutil.ReadAll(io.LimitReader(r, int64(length)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(message)) != length {
+		return nil, ErrCorrupt
+	}
+	return message, nil
+}
+
+// appendField appends value to message as the length-delimited protobuf
+// field with the provided number.
+func appendField(message []byte, field int, value []byte) []byte {
+	var varint [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(varint[:], uint64(field)<<3|2)
+	message = append(message, varint[:n]...)
+	n = binary.PutUvarint(varint[:], uint64(len(value)))
+	message = append(message, varint[:n]...)
+	return append(message, value...)
+}
+
+// parseAny returns the type name (field 1) and the item (field 2) of a
+// message written by encodeProtobuf(), skipping any other field. It returns
+// ErrCorrupt if the message isn't valid protobuf.
+func parseAny(message []byte) (name string, item []byte, err error) {
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return "", nil, ErrCorrupt
+		}
+		message = message[n:]
+
+		var size uint64
+		switch tag & 7 {
+		case 0: // varint
+			if _, n = binary.Uvarint(message); n <= 0 {
+				return "", nil, ErrCorrupt
+			}
+			size = uint64(n)
+		case 1: // 64-bit
+			size = 8
+		case 2: // length-delimited
+			length, n := binary.Uvarint(message)
+			if n <= 0 {
+				return "", nil, ErrCorrupt
+			}
+			message = message[n:]
+			size = length
+		case 5: // 32-bit
+			size = 4
+		default:
+			return "", nil, ErrCorrupt
+		}
+
+		if size > uint64(len(message)) {
+			return "", nil, ErrCorrupt
+		}
+		if tag&7 == 2 {
+			switch tag >> 3 {
+			case 1:
+				name = string(message[:size])
+			case 2:
+				item = message[:size]
+			}
+		}
+		message = message[size:]
+	}
+
+	if name == "" {
+		return "", nil, ErrCorrupt
+	}
+	return name, item, nil
+}
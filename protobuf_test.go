@@ -0,0 +1,118 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// Point marshals itself like code generated for
+// message Point { int64 x = 1; int64 y = 2; }.
+type Point struct {
+	X, Y int64
+}
+
+func (p *Point) Marshal() ([]byte, error) {
+	var data []byte
+	for field, value := range []int64{p.X, p.Y} {
+		data = binary.AppendUvarint(data, uint64(field+1)<<3)
+		data = binary.AppendUvarint(data, uint64(value))
+	}
+	return data, nil
+}
+
+func (p *Point) Unmarshal(data []byte) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		value, m := binary.Uvarint(data[n:])
+		if n <= 0 || m <= 0 {
+			return errors.New("bad point")
+		}
+		data = data[n+m:]
+
+		switch tag >> 3 {
+		case 1:
+			p.X = int64(value)
+		case 2:
+			p.Y = int64(value)
+		}
+	}
+	return nil
+}
+
+func TestProtobuf(t *testing.T) {
+	defer os.Remove("protobuf.db")
+
+	types := []Type{{"dump.Point", &Point{}}}
+	marshal := func(item Item) ([]byte, error) {
+		return item.(*Point).Marshal()
+	}
+	unmarshal := func(data []byte, item Item) error {
+		return item.(*Point).Unmarshal(data)
+	}
+
+	if _, err := New("protobuf.db", PERSIST_MANUAL, types, WithProtobuf(nil, unmarshal)); err != ErrInvalidProtobuf {
+		t.Fatal("accepted a nil marshal")
+	}
+	if _, err := New("protobuf.db", PERSIST_MANUAL, types, WithProtobuf(marshal, unmarshal), WithSegments(2)); err != ErrInvalidProtobuf {
+		t.Fatal("accepted segments")
+	}
+
+	// a gob encoded dump file is converted on the next save
+	plain, _ := New("protobuf.db", PERSIST_MANUAL, types)
+	plain.Add(&Point{1, 2})
+	plain.Save()
+
+	test, _ := New("protobuf.db", PERSIST_MANUAL, types, WithProtobuf(marshal, unmarshal))
+	if err := test.Load(); err != nil || test.Len() != 1 {
+		t.Fatal("didn't load the gob encoded file", err)
+	}
+	test.Add(&Point{3, -4})
+	lines, _ := test.Collection("lines")
+	lines.Add(&Point{5, 6})
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, _ := Inspect("protobuf.db"); !info.Protobuf {
+		t.Fatal("not protobuf encoded", info)
+	}
+	if err := plain.Load(); err != ErrProtobuf {
+		t.Fatal("expected ErrProtobuf", err)
+	}
+
+	// the items can be read without gob, by skipping the rest of the dump
+	data, _ := os.ReadFile("protobuf.db")
+	reader := bufio.NewReader(bytes.NewReader(data[headerSize:]))
+	readMessage(reader)
+	message, _ := readMessage(reader)
+	name, value, err := parseAny(message)
+	if err != nil || name != "dump.Point" {
+		t.Fatal("bad message", name, err)
+	}
+	point := &Point{}
+	if point.Unmarshal(value); *point != (Point{1, 2}) {
+		t.Fatal("bad item", point)
+	}
+
+	other, _ := New("protobuf.db", PERSIST_MANUAL, types, WithProtobuf(marshal, unmarshal))
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := other.Get(1); *item.(*Point) != (Point{3, -4}) {
+		t.Fatal("bad item", item)
+	}
+	lines, _ = other.Collection("lines")
+	if item, _ := lines.Get(0); item == nil || *item.(*Point) != (Point{5, 6}) {
+		t.Fatal("bad collection item", item)
+	}
+
+	// unknown types are reported like with gob
+	unknown, _ := New("protobuf.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}}, WithProtobuf(marshal, unmarshal))
+	if err := unknown.Load(); !errors.Is(err, ErrUnknownType) {
+		t.Fatal("expected ErrUnknownType", err)
+	}
+}
@@ -0,0 +1,170 @@
+package dump
+
+import "sort"
+
+// Filter returns every item in the dump for which pred returns true. The
+// returned items are the same values held by the dump, so they shouldn't be
+// modified outside of Update() (see FilterCopies()).
+func (d *Dump) Filter(pred func(item Item) bool) []Item {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	return d.filter(pred)
+}
+
+// FilterCopies works like Filter() but returns deep copies of the items,
+// which are safe to use and modify after the call returns. It returns an
+// error if one of the items can't be copied (see Type).
+func (d *Dump) FilterCopies(pred func(item Item) bool) ([]Item, error) {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	return copyItems(d.filter(pred))
+}
+
+// no mutex
+func (d *Dump) filter(pred func(item Item) bool) []Item {
+	found := make([]Item, 0)
+	for _, item := range d.items {
+		if pred(item) {
+			found = append(found, item)
+		}
+	}
+	return found
+}
+
+// FindFirst returns the id of the first item in the dump for which pred
+// returns true, along with the item itself. It returns ErrNotFound if pred
+// doesn't return true for any item.
+func (d *Dump) FindFirst(pred func(item Item) bool) (int, Item, error) {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	for id, item := range d.items {
+		if pred(item) {
+			return id, item, nil
+		}
+	}
+
+	return -1, nil, ErrNotFound
+}
+
+// Query is used to build a query over the items in a dump. It is created with
+// Query() and executed with Run(), for example:
+//
+//	ids, items, err := d.Query().
+//		Index("email", "karl@example.com").
+//		Where(func(item dump.Item) bool { return item.(*User).Active }).
+//		Sort(func(a, b dump.Item) bool { return a.(*User).Name < b.(*User).Name }).
+//		Offset(10).
+//		Limit(10).
+//		Run()
+type Query struct {
+	dump   *Dump
+	preds  []func(item Item) bool
+	index  string
+	value  string
+	less   func(a, b Item) bool
+	offset int
+	limit  int
+}
+
+// Query returns a new query over the items in the dump. Without any
+// conditions the query returns every item in id order.
+func (d *Dump) Query() *Query {
+	return &Query{dump: d, limit: -1}
+}
+
+// Where only includes items for which pred returns true. Calling Where more
+// than once requires items to match every pred.
+func (q *Query) Where(pred func(item Item) bool) *Query {
+	q.preds = append(q.preds, pred)
+	return q
+}
+
+// Index only includes items with the provided value in the named index
+// (registered with WithIndex()), using the index instead of scanning the
+// dump.
+func (q *Query) Index(name, value string) *Query {
+	q.index, q.value = name, value
+	return q
+}
+
+// Sort orders the matching items using less. Items that are equal keep their
+// id order.
+func (q *Query) Sort(less func(a, b Item) bool) *Query {
+	q.less = less
+	return q
+}
+
+// Offset skips the first n matching items.
+func (q *Query) Offset(n int) *Query {
+	q.offset = n
+	return q
+}
+
+// Limit returns at most n matching items. A negative n means no limit.
+func (q *Query) Limit(n int) *Query {
+	q.limit = n
+	return q
+}
+
+// Run executes the query and returns the ids and items that match it. It
+// returns ErrNoIndex if Index() was used with the name of an index that
+// doesn't exist.
+func (q *Query) Run() ([]int, []Item, error) {
+	d := q.dump
+
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	var candidates []int
+
+	if q.index != "" {
+		idx, ok := d.indexes[q.index]
+		if !ok {
+			return nil, nil, ErrNoIndex
+		}
+		candidates = idx.ids[q.value]
+	} else {
+		candidates = make([]int, len(d.items))
+		for id := range candidates {
+			candidates[id] = id
+		}
+	}
+
+	ids := make([]int, 0)
+
+next:
+	for _, id := range candidates {
+		for _, pred := range q.preds {
+			if !pred(d.items[id]) {
+				continue next
+			}
+		}
+		ids = append(ids, id)
+	}
+
+	if q.less != nil {
+		sort.SliceStable(ids, func(i, j int) bool {
+			return q.less(d.items[ids[i]], d.items[ids[j]])
+		})
+	}
+
+	if q.offset > len(ids) {
+		ids = ids[:0]
+	} else if q.offset > 0 {
+		ids = ids[q.offset:]
+	}
+
+	if q.limit >= 0 && q.limit < len(ids) {
+		ids = ids[:q.limit]
+	}
+
+	items := make([]Item, len(ids))
+	for i, id := range ids {
+		items[i] = d.items[id]
+	}
+
+	return ids, items, nil
+}
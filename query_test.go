@@ -0,0 +1,123 @@
+package dump
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	test, _ := NewDump("query.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	test.AddAll(&Blob{"apple"}, &Blob{"banana"}, &Blob{"avocado"})
+
+	startsWithA := func(item Item) bool {
+		return strings.HasPrefix(item.(*Blob).Data, "a")
+	}
+
+	found := test.Filter(startsWithA)
+	if len(found) != 2 || found[1].(*Blob).Data != "avocado" {
+		t.Fatal("bad filter", found)
+	}
+
+	if found = test.Filter(func(Item) bool { return false }); found == nil || len(found) != 0 {
+		t.Fatal("expected empty filter result")
+	}
+
+	copies, err := test.FilterCopies(startsWithA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copies[0].(*Blob).Data = "changed"
+	if item, _ := test.Get(0); item.(*Blob).Data != "apple" {
+		t.Fatal("copy shares memory with the dump")
+	}
+
+	unregistered, _ := NewDump("query.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	unregistered.Add(&Unregistered{})
+	if _, err = unregistered.FilterCopies(func(Item) bool { return true }); err == nil {
+		t.Fatal("copied unregistered type")
+	}
+}
+
+func TestFindFirst(t *testing.T) {
+	test, _ := NewDump("query.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	test.AddAll(&Blob{"apple"}, &Blob{"banana"}, &Blob{"blueberry"})
+
+	id, item, err := test.FindFirst(func(item Item) bool {
+		return strings.HasPrefix(item.(*Blob).Data, "b")
+	})
+	if err != nil || id != 1 || item.(*Blob).Data != "banana" {
+		t.Fatal("bad find first")
+	}
+
+	if id, item, err = test.FindFirst(func(Item) bool { return false }); err != ErrNotFound ||
+		id != -1 || item != nil {
+		t.Fatal("expected ErrNotFound")
+	}
+}
+
+// Unregistered is never registered with gob.
+type Unregistered struct {
+	Data string
+}
+
+func TestQuery(t *testing.T) {
+	test, _ := New("query.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}},
+		WithIndex("first", func(item Item) string {
+			return item.(*Blob).Data[:1]
+		}))
+	test.AddAll(
+		&Blob{"banana"},
+		&Blob{"apple"},
+		&Blob{"blueberry"},
+		&Blob{"cherry"},
+		&Blob{"avocado"},
+		&Blob{"blackberry"},
+	)
+
+	check := func(q *Query, expected ...int) {
+		ids, items, err := q.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != len(expected) || len(items) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, ids)
+		}
+		for i := range ids {
+			if ids[i] != expected[i] {
+				t.Fatalf("expected %v, got %v", expected, ids)
+			}
+			if item, _ := test.Get(ids[i]); item != items[i] {
+				t.Fatal("ids and items don't match")
+			}
+		}
+	}
+
+	byData := func(a, b Item) bool {
+		return a.(*Blob).Data < b.(*Blob).Data
+	}
+
+	long := func(item Item) bool {
+		return len(item.(*Blob).Data) > 6
+	}
+
+	check(test.Query(), 0, 1, 2, 3, 4, 5)
+	check(test.Query().Where(long), 2, 4, 5)
+	check(test.Query().Where(long).Where(func(item Item) bool {
+		return item.(*Blob).Data[0] == 'b'
+	}), 2, 5)
+	check(test.Query().Index("first", "b"), 0, 2, 5)
+	check(test.Query().Index("first", "b").Where(long), 2, 5)
+	check(test.Query().Index("first", "z"))
+	check(test.Query().Sort(byData), 1, 4, 0, 5, 2, 3)
+	check(test.Query().Sort(byData).Offset(2).Limit(3), 0, 5, 2)
+	check(test.Query().Offset(5).Limit(3), 5)
+	check(test.Query().Offset(10))
+	check(test.Query().Limit(0))
+	check(test.Query().Limit(-1), 0, 1, 2, 3, 4, 5)
+
+	if _, _, err := test.Query().Index("missing", "b").Run(); err != ErrNoIndex {
+		t.Fatal("expected ErrNoIndex")
+	}
+}
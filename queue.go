@@ -0,0 +1,79 @@
+package dump
+
+// Push adds the items to the end of the dump, so a dump can be used as a
+// FIFO queue with Push(), Pop() and Peek(). It works like AddAll().
+func (d *Dump) Push(items ...Item) error {
+	_, err := d.AddAll(items...)
+	return err
+}
+
+// Pop removes the first item of the dump (the oldest one, or the least one
+// if WithOrder() is enabled) and returns it, in a single step, so items
+// popped by concurrent callers are never handed out twice. It returns
+// ErrNotFound if the dump is empty, and an error if there was a problem
+// persisting the dump on the disk (if PERSIST_WRITES is enabled), in which
+// case the item is removed from the dump in memory and returned anyway.
+func (d *Dump) Pop() (Item, error) {
+	return d.pop(false)
+}
+
+// Peek returns the first item of the dump without removing it. It returns
+// ErrNotFound if the dump is empty.
+func (d *Dump) Peek() (Item, error) {
+	items, err := d.PeekN(1)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+	return items[0], nil
+}
+
+// PeekN returns up to n items from the start of the dump without removing
+// them. Like Get(), it returns the items held by the dump unless
+// WithCopyOnRead() is enabled.
+func (d *Dump) PeekN(n int) ([]Item, error) {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	if n > len(d.items) {
+		n = len(d.items)
+	}
+	if n < 0 {
+		n = 0
+	}
+	return d.reading(append([]Item{}, d.items[:n]...))
+}
+
+// pop removes the first (or last) item and returns it.
+func (d *Dump) pop(last bool) (Item, error) {
+	if err := d.lock(); err != nil {
+		return nil, err
+	}
+	defer d.mutex.Unlock()
+
+	// expired items are never popped
+	if d.ttl != nil {
+		d.expire()
+	}
+
+	if len(d.items) == 0 {
+		return nil, ErrNotFound
+	}
+
+	id := 0
+	if last {
+		id = len(d.items) - 1
+	}
+	item := d.items[id]
+	if _, err := d.remove(func(other int) bool { return other == id }); err != nil {
+		return nil, err
+	}
+
+	if d.autosave() {
+		return item, d.save()
+	}
+
+	return item, nil
+}
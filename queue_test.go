@@ -0,0 +1,71 @@
+package dump
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	test, _ := New("queue.db", PERSIST_WRITES, []Type{{"dump.Task", &Task{}}})
+
+	if _, err := test.Pop(); err != ErrNotFound {
+		t.Fatal("popped from an empty queue")
+	}
+	if _, err := test.Peek(); err != ErrNotFound {
+		t.Fatal("peeked into an empty queue")
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := test.Push(&Task{i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if item, _ := test.Peek(); item.(*Task).Priority != 0 || test.Len() != 100 {
+		t.Fatal("bad peek")
+	}
+	if items, _ := test.PeekN(3); len(items) != 3 || items[2].(*Task).Priority != 2 {
+		t.Fatal("bad PeekN")
+	}
+	if items, _ := test.PeekN(1000); len(items) != 100 {
+		t.Fatal("bad PeekN past the end")
+	}
+
+	// every item is popped once, in order
+	var (
+		popped = make([][]int, 4)
+		wg     sync.WaitGroup
+	)
+	for w := range popped {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for {
+				item, err := test.Pop()
+				if err == ErrNotFound {
+					return
+				}
+				popped[w] = append(popped[w], item.(*Task).Priority)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool)
+	for _, priorities := range popped {
+		for i, p := range priorities {
+			if seen[p] || (i > 0 && p < priorities[i-1]) {
+				t.Fatal("popped out of order or twice", priorities)
+			}
+			seen[p] = true
+		}
+	}
+	if len(seen) != 100 {
+		t.Fatalf("popped %d items", len(seen))
+	}
+
+	loaded, _ := New("queue.db", PERSIST_MANUAL, []Type{{"dump.Task", &Task{}}})
+	if loaded.Load(); loaded.Len() != 0 {
+		t.Fatal("didn't persist the pops")
+	}
+}
@@ -0,0 +1,912 @@
+// Package raft replicates a dump across several nodes using the Raft
+// consensus algorithm, so the dump stays available as long as a majority of
+// the nodes are.
+//
+// Every change goes through a Node: it is appended to the replicated log by
+// the leader (followers forward it), and applied to the dump of every node
+// once a majority of them stored it. Reads through Node.View() are
+// linearizable: they see every change that completed before they started.
+//
+// The dump of a node should start empty and only be changed through the node,
+// since it is rebuilt by applying the log, which is what is persisted (in
+// Config.StateFile). The state file is appended to as the log grows and
+// rewritten when the node starts, but the log is never compacted, so it grows
+// with every change.
+package raft
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/karlmcguire/dump"
+)
+
+var (
+	// ErrInvalidConfig is thrown by New() when the id of the node isn't one of
+	// the peers.
+	ErrInvalidConfig = errors.New("invalid raft config")
+
+	// ErrNoLeader is thrown when there is currently no leader to forward a
+	// change or read to, usually during an election.
+	ErrNoLeader = errors.New("no raft leader")
+
+	// ErrNotLeader is thrown by a node asked to act as the leader when it
+	// isn't anymore.
+	ErrNotLeader = errors.New("not the raft leader")
+
+	// ErrTimeout is thrown when a change or read doesn't complete within
+	// Config.Timeout. A change that timed out may still be applied later.
+	ErrTimeout = errors.New("raft timeout")
+
+	// ErrClosed is thrown after the node was closed.
+	ErrClosed = errors.New("raft node closed")
+)
+
+// Config configures a Node.
+type Config struct {
+	// ID is the id of the node, which has to be one of Peers.
+	ID string
+
+	// Peers maps the id of every node in the cluster (including this one) to
+	// the URL its Handler() is served at, such as "http://10.0.0.1:8080/raft".
+	Peers map[string]string
+
+	// StateFile is where the node persists its log and vote. If it is empty
+	// nothing is persisted, which is only safe for testing.
+	StateFile string
+
+	// HeartbeatInterval is how often the leader contacts the followers (50ms
+	// by default).
+	HeartbeatInterval time.Duration
+
+	// ElectionTimeout is how long a follower waits without hearing from a
+	// leader before starting an election, randomized up to twice as long
+	// (500ms by default).
+	ElectionTimeout time.Duration
+
+	// Timeout limits how long changes and reads wait to complete (5s by
+	// default).
+	Timeout time.Duration
+
+	// Client is used to contact the other nodes (http.DefaultClient with
+	// ElectionTimeout as its timeout by default).
+	Client *http.Client
+}
+
+const (
+	follower = iota
+	candidate
+	leader
+)
+
+// maxEntries is the maximum number of entries sent to a follower at once.
+const maxEntries = 256
+
+// entry is an entry of the replicated log. Entries without a command are
+// appended by new leaders to commit the entries of previous terms.
+type entry struct {
+	Term    uint64
+	Command []byte
+}
+
+// result is the outcome of applying a command to the dump.
+type result struct {
+	id  int
+	err error
+}
+
+// Node is a member of a cluster replicating a dump.
+type Node struct {
+	dump *dump.Dump
+	cfg  Config
+
+	mutex       sync.Mutex
+	applied     *sync.Cond
+	state       int
+	term        uint64
+	votedFor    string
+	log         []entry
+	commitIndex uint64
+	lastApplied uint64
+	leader      string
+	deadline    time.Time
+	nextIndex   map[string]uint64
+	matchIndex  map[string]uint64
+	results     map[uint64]chan result
+	triggers    map[string]chan struct{}
+	file        *os.File
+	encoder     *gob.Encoder
+	persisted   uint64
+
+	closed chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New starts a node replicating d (which should be empty, see the package
+// documentation) and restores its log from cfg.StateFile. The node has to be
+// served with Handler() for the other nodes to reach it.
+func New(d *dump.Dump, cfg Config) (*Node, error) {
+	if _, ok := cfg.Peers[cfg.ID]; !ok || d == nil {
+		return nil, ErrInvalidConfig
+	}
+
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = 50 * time.Millisecond
+	}
+	if cfg.ElectionTimeout <= 0 {
+		cfg.ElectionTimeout = 500 * time.Millisecond
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: cfg.ElectionTimeout}
+	}
+
+	n := &Node{
+		dump:       d,
+		cfg:        cfg,
+		log:        []entry{{}},
+		nextIndex:  make(map[string]uint64),
+		matchIndex: make(map[string]uint64),
+		results:    make(map[uint64]chan result),
+		triggers:   make(map[string]chan struct{}),
+		closed:     make(chan struct{}),
+	}
+	n.applied = sync.NewCond(&n.mutex)
+
+	if err := n.restore(); err != nil {
+		return nil, err
+	}
+
+	n.resetDeadline()
+
+	for id := range cfg.Peers {
+		if id == cfg.ID {
+			continue
+		}
+		n.triggers[id] = make(chan struct{}, 1)
+	}
+
+	for id, trigger := range n.triggers {
+		n.wg.Add(1)
+		go n.replicator(id, trigger)
+	}
+
+	n.wg.Add(2)
+	go n.ticker()
+	go n.applier()
+
+	return n, nil
+}
+
+// Close stops the node. It doesn't close the dump.
+func (n *Node) Close() error {
+	n.mutex.Lock()
+	select {
+	case <-n.closed:
+		n.mutex.Unlock()
+		return ErrClosed
+	default:
+	}
+	close(n.closed)
+	n.applied.Broadcast()
+	n.mutex.Unlock()
+
+	n.wg.Wait()
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.file != nil {
+		n.file.Close()
+		n.file, n.encoder = nil, nil
+	}
+	return nil
+}
+
+// Leader returns the id of the current leader, or an empty string if there
+// isn't one.
+func (n *Node) Leader() string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.leader
+}
+
+// Add adds the item to the replicated dump, like dump.Dump.Add().
+func (n *Node) Add(item dump.Item) (int, error) {
+	return n.Apply(dump.Command{Kind: dump.CommandAdd, Item: item})
+}
+
+// Set replaces the item with the provided id, like dump.Dump.Set().
+func (n *Node) Set(id int, item dump.Item) error {
+	_, err := n.Apply(dump.Command{Kind: dump.CommandSet, ID: id, Item: item})
+	return err
+}
+
+// Remove removes the item with the provided id, like dump.Dump.Remove().
+func (n *Node) Remove(id int) error {
+	_, err := n.Apply(dump.Command{Kind: dump.CommandRemove, ID: id})
+	return err
+}
+
+// Apply replicates the command and returns the result of applying it to the
+// dump (see dump.Dump.Apply()) once it was applied on this node. Followers
+// forward the command to the leader.
+func (n *Node) Apply(c dump.Command) (int, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(c); err != nil {
+		return 0, err
+	}
+
+	n.mutex.Lock()
+	if n.state != leader {
+		leaderID := n.leader
+		n.mutex.Unlock()
+
+		if leaderID == "" {
+			return 0, ErrNoLeader
+		}
+
+		var reply applyReply
+		if err := n.call(leaderID, "/apply", applyArgs{Command: buffer.Bytes()}, &reply); err != nil {
+			return 0, err
+		}
+		if reply.Error != "" {
+			return reply.ID, replyError(reply.Error)
+		}
+
+		// wait for the change to reach this node, so it can be read here
+		return reply.ID, n.waitApplied(reply.Index)
+	}
+
+	n.mutex.Unlock()
+
+	_, id, err := n.apply(buffer.Bytes())
+	return id, err
+}
+
+// apply proposes a command on the leader and waits for it to be applied.
+func (n *Node) apply(command []byte) (uint64, int, error) {
+	n.mutex.Lock()
+	if n.state != leader {
+		n.mutex.Unlock()
+		return 0, 0, ErrNotLeader
+	}
+	index, ch, err := n.propose(command)
+	n.mutex.Unlock()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	select {
+	case r := <-ch:
+		return index, r.id, r.err
+	case <-time.After(n.cfg.Timeout):
+		return index, 0, ErrTimeout
+	case <-n.closed:
+		return index, 0, ErrClosed
+	}
+}
+
+// propose appends a command to the log of the leader. It returns an error
+// (and drops the command) if the log couldn't be persisted.
+//
+// no mutex (the node has to be locked)
+func (n *Node) propose(command []byte) (uint64, chan result, error) {
+	n.log = append(n.log, entry{Term: n.term, Command: command})
+	index := n.lastIndex()
+
+	if err := n.persist(); err != nil {
+		n.log = n.log[:index]
+		return 0, nil, err
+	}
+
+	ch := make(chan result, 1)
+	n.results[index] = ch
+
+	n.advanceCommit()
+	n.triggerAll()
+
+	return index, ch, nil
+}
+
+// View calls f with the items of the dump once every change that completed
+// before View was called was applied on this node, so f never sees stale
+// items.
+func (n *Node) View(f func(items []dump.Item) error) error {
+	index, err := n.readIndex()
+	if err != nil {
+		return err
+	}
+
+	if err = n.waitApplied(index); err != nil {
+		return err
+	}
+
+	return n.dump.View(f)
+}
+
+// readIndex returns the commit index of the leader, after the leader made
+// sure it still is the leader.
+func (n *Node) readIndex() (uint64, error) {
+	n.mutex.Lock()
+	if n.state != leader {
+		leaderID := n.leader
+		n.mutex.Unlock()
+
+		if leaderID == "" {
+			return 0, ErrNoLeader
+		}
+
+		var reply readReply
+		if err := n.call(leaderID, "/read", struct{}{}, &reply); err != nil {
+			return 0, err
+		}
+		if reply.Error != "" {
+			return 0, replyError(reply.Error)
+		}
+		return reply.Index, nil
+	}
+
+	// the commit index is only known to be up to date once an entry of the
+	// current term was committed
+	timeout := time.Now().Add(n.cfg.Timeout)
+	for n.log[n.commitIndex].Term != n.term {
+		if n.state != leader {
+			n.mutex.Unlock()
+			return 0, ErrNotLeader
+		}
+		if time.Now().After(timeout) {
+			n.mutex.Unlock()
+			return 0, ErrTimeout
+		}
+		n.mutex.Unlock()
+		time.Sleep(n.cfg.HeartbeatInterval / 4)
+		n.mutex.Lock()
+	}
+
+	index, term := n.commitIndex, n.term
+	n.mutex.Unlock()
+
+	if !n.confirm(term) {
+		return 0, ErrNotLeader
+	}
+
+	return index, nil
+}
+
+// confirm reports whether a majority of the cluster still accepts this node
+// as the leader of term.
+func (n *Node) confirm(term uint64) bool {
+	var (
+		acks  = 1
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+
+	for id := range n.triggers {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if n.replicate(id, term) {
+				mutex.Lock()
+				acks++
+				mutex.Unlock()
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	return acks > len(n.cfg.Peers)/2
+}
+
+// waitApplied waits until the entry at index was applied on this node.
+func (n *Node) waitApplied(index uint64) error {
+	timeout := time.AfterFunc(n.cfg.Timeout, func() {
+		n.mutex.Lock()
+		n.applied.Broadcast()
+		n.mutex.Unlock()
+	})
+	defer timeout.Stop()
+
+	deadline := time.Now().Add(n.cfg.Timeout)
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for n.lastApplied < index {
+		select {
+		case <-n.closed:
+			return ErrClosed
+		default:
+		}
+		if time.Now().After(deadline) {
+			return ErrTimeout
+		}
+		n.applied.Wait()
+	}
+	return nil
+}
+
+// ticker starts elections when the leader is silent for too long.
+func (n *Node) ticker() {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(n.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.closed:
+			return
+		case <-ticker.C:
+		}
+
+		n.mutex.Lock()
+		if n.state == leader {
+			n.triggerAll()
+		} else if time.Now().After(n.deadline) {
+			n.startElection()
+		}
+		n.mutex.Unlock()
+	}
+}
+
+// resetDeadline pushes back the next election.
+//
+// no mutex (the node has to be locked)
+func (n *Node) resetDeadline() {
+	timeout := n.cfg.ElectionTimeout
+	n.deadline = time.Now().Add(timeout + time.Duration(rand.Int63n(int64(timeout))))
+}
+
+// startElection makes the node a candidate and asks the other nodes for their
+// votes.
+//
+// no mutex (the node has to be locked)
+func (n *Node) startElection() {
+	term, votedFor := n.term, n.votedFor
+
+	n.state = candidate
+	n.term++
+	n.votedFor = n.cfg.ID
+	n.leader = ""
+	n.resetDeadline()
+
+	if err := n.persist(); err != nil {
+		// try again once the election times out
+		n.state, n.term, n.votedFor = follower, term, votedFor
+		return
+	}
+
+	args := voteArgs{
+		Term:         n.term,
+		CandidateID:  n.cfg.ID,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.log[n.lastIndex()].Term,
+	}
+
+	votes := 1
+	if votes > len(n.cfg.Peers)/2 {
+		n.becomeLeader()
+		return
+	}
+
+	for id := range n.triggers {
+		go func(id string) {
+			var reply voteReply
+			if n.call(id, "/vote", args, &reply) != nil {
+				return
+			}
+
+			n.mutex.Lock()
+			defer n.mutex.Unlock()
+
+			if reply.Term > n.term {
+				n.stepDown(reply.Term)
+				return
+			}
+
+			if n.state != candidate || n.term != args.Term || !reply.Granted {
+				return
+			}
+
+			if votes++; votes > len(n.cfg.Peers)/2 {
+				n.becomeLeader()
+			}
+		}(id)
+	}
+}
+
+// becomeLeader makes the node the leader of the current term.
+//
+// no mutex (the node has to be locked)
+func (n *Node) becomeLeader() {
+	n.state = leader
+	n.leader = n.cfg.ID
+
+	for id := range n.triggers {
+		n.nextIndex[id] = n.lastIndex() + 1
+		n.matchIndex[id] = 0
+	}
+
+	// committing an entry of the new term also commits the previous ones
+	n.log = append(n.log, entry{Term: n.term})
+	if err := n.persist(); err != nil {
+		n.log = n.log[:len(n.log)-1]
+		n.state, n.leader = follower, ""
+		n.resetDeadline()
+		return
+	}
+	n.advanceCommit()
+	n.triggerAll()
+}
+
+// stepDown makes the node a follower of term. It returns an error if the new
+// term couldn't be persisted, in which case the node stays in its current
+// term.
+//
+// no mutex (the node has to be locked)
+func (n *Node) stepDown(term uint64) error {
+	n.state = follower
+	n.resetDeadline()
+
+	if term > n.term {
+		previous, votedFor := n.term, n.votedFor
+		n.term, n.votedFor, n.leader = term, "", ""
+
+		if err := n.persist(); err != nil {
+			n.term, n.votedFor = previous, votedFor
+			return err
+		}
+	}
+	return nil
+}
+
+// triggerAll makes the replicators contact their followers.
+//
+// no mutex (the node has to be locked)
+func (n *Node) triggerAll() {
+	for _, trigger := range n.triggers {
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// replicator sends entries (or heartbeats) to a follower whenever triggered.
+func (n *Node) replicator(id string, trigger chan struct{}) {
+	defer n.wg.Done()
+
+	for {
+		select {
+		case <-n.closed:
+			return
+		case <-trigger:
+		}
+
+		n.mutex.Lock()
+		isLeader, term := n.state == leader, n.term
+		n.mutex.Unlock()
+
+		if isLeader {
+			n.replicate(id, term)
+		}
+	}
+}
+
+// replicate sends the follower the entries it is missing (if any) and reports
+// whether it accepted this node as the leader of term.
+func (n *Node) replicate(id string, term uint64) bool {
+	n.mutex.Lock()
+	if n.state != leader || n.term != term {
+		n.mutex.Unlock()
+		return false
+	}
+
+	next := n.nextIndex[id]
+	entries := n.log[next:]
+	if len(entries) > maxEntries {
+		entries = entries[:maxEntries]
+	}
+
+	args := appendArgs{
+		Term:         term,
+		LeaderID:     n.cfg.ID,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  n.log[next-1].Term,
+		Entries:      append([]entry{}, entries...),
+		LeaderCommit: n.commitIndex,
+	}
+	n.mutex.Unlock()
+
+	var reply appendReply
+	if n.call(id, "/append", args, &reply) != nil {
+		return false
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if reply.Term > n.term {
+		n.stepDown(reply.Term)
+		return false
+	}
+
+	if n.state != leader || n.term != term {
+		return false
+	}
+
+	if !reply.Success {
+		n.nextIndex[id] = reply.ConflictIndex
+		if n.nextIndex[id] < 1 {
+			n.nextIndex[id] = 1
+		}
+		n.trigger(id)
+		return true
+	}
+
+	if match := args.PrevLogIndex + uint64(len(args.Entries)); match > n.matchIndex[id] {
+		n.matchIndex[id] = match
+		n.nextIndex[id] = match + 1
+	}
+
+	n.advanceCommit()
+	if n.nextIndex[id] <= n.lastIndex() {
+		n.trigger(id)
+	}
+
+	return true
+}
+
+// no mutex (the node has to be locked)
+func (n *Node) trigger(id string) {
+	select {
+	case n.triggers[id] <- struct{}{}:
+	default:
+	}
+}
+
+// advanceCommit commits the newest entry of the current term stored by a
+// majority of the cluster.
+//
+// no mutex (the node has to be locked)
+func (n *Node) advanceCommit() {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		if n.log[index].Term != n.term {
+			break
+		}
+
+		stored := 1
+		for _, match := range n.matchIndex {
+			if match >= index {
+				stored++
+			}
+		}
+
+		if stored > len(n.cfg.Peers)/2 {
+			n.commitIndex = index
+			n.applied.Broadcast()
+			return
+		}
+	}
+}
+
+// applier applies committed entries to the dump.
+func (n *Node) applier() {
+	defer n.wg.Done()
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for {
+		for n.lastApplied >= n.commitIndex {
+			select {
+			case <-n.closed:
+				return
+			default:
+			}
+			n.applied.Wait()
+		}
+
+		index := n.lastApplied + 1
+		e := n.log[index]
+		n.mutex.Unlock()
+
+		var r result
+		if e.Command != nil {
+			var c dump.Command
+			if r.err = gob.NewDecoder(bytes.NewReader(e.Command)).Decode(&c); r.err == nil {
+				r.id, r.err = n.dump.Apply(c)
+			}
+		}
+
+		n.mutex.Lock()
+		n.lastApplied = index
+		if ch, ok := n.results[index]; ok {
+			ch <- r
+			delete(n.results, index)
+		}
+		n.applied.Broadcast()
+	}
+}
+
+// no mutex (the node has to be locked)
+func (n *Node) lastIndex() uint64 {
+	return uint64(len(n.log) - 1)
+}
+
+// persistent is a change of the state of a node. Config.StateFile is a gob
+// stream of them, starting with the whole state of the node.
+type persistent struct {
+	Term     uint64
+	VotedFor string
+
+	// Index is where Log is appended, dropping the entries from there on.
+	Index uint64
+	Log   []entry
+}
+
+// persist appends the changes of the state of the node since it was last
+// persisted to Config.StateFile, and syncs it. If that fails, the file is
+// rewritten the next time.
+//
+// no mutex (the node has to be locked)
+func (n *Node) persist() error {
+	if n.cfg.StateFile == "" {
+		return nil
+	}
+	if n.encoder == nil {
+		return n.rewrite()
+	}
+
+	err := n.encoder.Encode(persistent{
+		Term:     n.term,
+		VotedFor: n.votedFor,
+		Index:    n.persisted,
+		Log:      n.log[n.persisted:],
+	})
+	if err == nil {
+		err = n.file.Sync()
+	}
+	if err != nil {
+		// the file may end with part of the change
+		n.file.Close()
+		n.file, n.encoder = nil, nil
+		return err
+	}
+
+	n.persisted = uint64(len(n.log))
+	return nil
+}
+
+// rewrite replaces Config.StateFile with the whole state of the node, and
+// keeps it open to append the next changes to.
+//
+// no mutex (the node has to be locked)
+func (n *Node) rewrite() error {
+	tmp := n.cfg.StateFile + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	encoder := gob.NewEncoder(file)
+	err = encoder.Encode(persistent{Term: n.term, VotedFor: n.votedFor, Log: n.log})
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, n.cfg.StateFile)
+	}
+	if err == nil {
+		err = syncDir(filepath.Dir(n.cfg.StateFile))
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	n.file, n.encoder, n.persisted = file, encoder, uint64(len(n.log))
+	return nil
+}
+
+// restore reads the state of the node from Config.StateFile, replaying the
+// changes appended to it, then rewrites it.
+func (n *Node) restore() error {
+	if n.cfg.StateFile == "" {
+		return nil
+	}
+
+	file, err := os.Open(n.cfg.StateFile)
+	if os.IsNotExist(err) {
+		return n.rewrite()
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := gob.NewDecoder(bufio.NewReader(file))
+	for {
+		var p persistent
+		err = decoder.Decode(&p)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// a change cut short was never acknowledged
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if p.Index > uint64(len(n.log)) {
+			return errors.New("raft: invalid state file")
+		}
+		n.term, n.votedFor = p.Term, p.VotedFor
+		n.log = append(n.log[:p.Index], p.Log...)
+	}
+
+	return n.rewrite()
+}
+
+// syncDir syncs a directory, so the files renamed into it stay there.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return file.Sync()
+}
+
+// call sends a request to another node.
+func (n *Node) call(id, path string, args, reply interface{}) error {
+	url, ok := n.cfg.Peers[id]
+	if !ok {
+		return ErrNoLeader
+	}
+
+	body, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+
+	response, err := n.cfg.Client.Post(url+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return errors.New("raft: " + response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(reply)
+}
+
+// replyError returns the error named in a reply, which is one of the errors
+// of the dump or raft packages when possible.
+func replyError(message string) error {
+	for _, err := range []error{
+		dump.ErrNotFound, dump.ErrDuplicate, dump.ErrInvalidCommand,
+		ErrNoLeader, ErrNotLeader, ErrTimeout, ErrClosed,
+	} {
+		if err.Error() == message {
+			return err
+		}
+	}
+	return errors.New(message)
+}
@@ -0,0 +1,300 @@
+package raft
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/karlmcguire/dump"
+)
+
+type Post struct {
+	Title string
+}
+
+var types = []dump.Type{{Name: "raft.Post", Value: &Post{}}}
+
+// cluster runs nodes on test servers, which keep their URLs when a node is
+// restarted.
+type cluster struct {
+	t       *testing.T
+	mutex   sync.Mutex
+	nodes   map[string]*Node
+	dumps   map[string]*dump.Dump
+	servers []*httptest.Server
+	peers   map[string]string
+}
+
+func newCluster(t *testing.T, size int) *cluster {
+	c := &cluster{
+		t:     t,
+		nodes: make(map[string]*Node),
+		dumps: make(map[string]*dump.Dump),
+		peers: make(map[string]string),
+	}
+
+	for i := 0; i < size; i++ {
+		id := fmt.Sprintf("node%d", i)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.mutex.Lock()
+			node := c.nodes[id]
+			c.mutex.Unlock()
+
+			if node == nil {
+				http.Error(w, "not started", http.StatusServiceUnavailable)
+				return
+			}
+			node.Handler().ServeHTTP(w, r)
+		}))
+		c.servers = append(c.servers, server)
+		c.peers[id] = server.URL
+	}
+
+	for id := range c.peers {
+		c.start(id)
+	}
+
+	return c
+}
+
+// start starts (or restarts) a node with an empty dump.
+func (c *cluster) start(id string) {
+	d, err := dump.New("raft-"+id+".db", dump.PERSIST_MANUAL, types)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	node, err := New(d, Config{
+		ID:                id,
+		Peers:             c.peers,
+		StateFile:         "raft-" + id + ".state",
+		HeartbeatInterval: 10 * time.Millisecond,
+		ElectionTimeout:   100 * time.Millisecond,
+		Timeout:           2 * time.Second,
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	c.mutex.Lock()
+	c.nodes[id], c.dumps[id] = node, d
+	c.mutex.Unlock()
+}
+
+// stop closes a node, which stops answering the others.
+func (c *cluster) stop(id string) {
+	c.mutex.Lock()
+	node := c.nodes[id]
+	delete(c.nodes, id)
+	c.mutex.Unlock()
+
+	node.Close()
+}
+
+func (c *cluster) close() {
+	for id := range c.peers {
+		c.mutex.Lock()
+		_, ok := c.nodes[id]
+		c.mutex.Unlock()
+
+		if ok {
+			c.stop(id)
+		}
+		os.Remove("raft-" + id + ".state")
+	}
+	for _, server := range c.servers {
+		server.Close()
+	}
+}
+
+// leader waits for the running nodes to agree on a leader.
+func (c *cluster) leader() string {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		leaders := make(map[string]bool)
+
+		c.mutex.Lock()
+		for _, node := range c.nodes {
+			leaders[node.Leader()] = true
+		}
+		for id := range leaders {
+			if _, running := c.nodes[id]; running && len(leaders) == 1 {
+				c.mutex.Unlock()
+				return id
+			}
+		}
+		c.mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.t.Fatal("no leader elected")
+	return ""
+}
+
+// follower returns a running node other than the leader.
+func (c *cluster) follower(leader string) *Node {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for id, node := range c.nodes {
+		if id != leader {
+			return node
+		}
+	}
+	return nil
+}
+
+// converge waits for the dumps of the running nodes to hold the titles.
+func (c *cluster) converge(titles ...string) {
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		matching := true
+
+		c.mutex.Lock()
+		for id := range c.nodes {
+			c.dumps[id].View(func(items []dump.Item) error {
+				if len(items) != len(titles) {
+					matching = false
+					return nil
+				}
+				for i, item := range items {
+					if item.(*Post).Title != titles[i] {
+						matching = false
+					}
+				}
+				return nil
+			})
+		}
+		c.mutex.Unlock()
+
+		if matching {
+			return
+		}
+		if time.Now().After(deadline) {
+			c.t.Fatal("dumps didn't converge")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	d, _ := dump.New("raft.db", dump.PERSIST_MANUAL, types)
+
+	if _, err := New(d, Config{ID: "a", Peers: map[string]string{"b": ""}}); err != ErrInvalidConfig {
+		t.Fatal("accepted a node that isn't a peer")
+	}
+}
+
+func TestSingleNode(t *testing.T) {
+	c := newCluster(t, 1)
+	defer c.close()
+
+	node := c.nodes[c.leader()]
+
+	if id, err := node.Add(&Post{"one"}); err != nil || id != 0 {
+		t.Fatal("expected id 0", err)
+	}
+
+	c.converge("one")
+}
+
+func TestCluster(t *testing.T) {
+	c := newCluster(t, 3)
+	defer c.close()
+
+	leader := c.leader()
+	node := c.follower(leader)
+
+	// changes made through a follower are forwarded to the leader
+	if id, err := node.Add(&Post{"one"}); err != nil || id != 0 {
+		t.Fatal("expected id 0", err)
+	}
+	if _, err := c.nodes[leader].Add(&Post{"two"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := node.Set(0, &Post{"uno"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// errors of the dump are passed back
+	if err := node.Set(5, &Post{"five"}); err != dump.ErrNotFound {
+		t.Fatal("expected dump.ErrNotFound", err)
+	}
+
+	err := node.View(func(items []dump.Item) error {
+		if len(items) != 2 || items[0].(*Post).Title != "uno" {
+			t.Fatal("read stale items")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.converge("uno", "two")
+
+	if err = node.Remove(0); err != nil {
+		t.Fatal(err)
+	}
+	c.converge("two")
+}
+
+func TestFailover(t *testing.T) {
+	c := newCluster(t, 3)
+	defer c.close()
+
+	old := c.leader()
+	if _, err := c.nodes[old].Add(&Post{"one"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.stop(old)
+
+	leader := c.leader()
+	if leader == old {
+		t.Fatal("stopped node still leader")
+	}
+
+	if _, err := c.nodes[leader].Add(&Post{"two"}); err != nil {
+		t.Fatal(err)
+	}
+	c.converge("one", "two")
+
+	// the restarted node restores its log and catches up
+	c.start(old)
+	c.converge("one", "two")
+}
+
+func TestPersistError(t *testing.T) {
+	c := newCluster(t, 1)
+	defer c.close()
+
+	id := c.leader()
+	node := c.nodes[id]
+
+	// changes are appended to the state file, which fails once it's closed
+	node.mutex.Lock()
+	node.file.Close()
+	node.mutex.Unlock()
+
+	if _, err := node.Add(&Post{"lost"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// the state file is rewritten by the next change
+	if _, err := node.Add(&Post{"one"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node.Add(&Post{"two"}); err != nil {
+		t.Fatal(err)
+	}
+	c.converge("one", "two")
+
+	c.stop(id)
+	c.start(id)
+	c.leader()
+	c.converge("one", "two")
+}
@@ -0,0 +1,262 @@
+package raft
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type voteArgs struct {
+	Term         uint64
+	CandidateID  string
+	LastLogIndex uint64
+	LastLogTerm  uint64
+}
+
+type voteReply struct {
+	Term    uint64
+	Granted bool
+}
+
+type appendArgs struct {
+	Term         uint64
+	LeaderID     string
+	PrevLogIndex uint64
+	PrevLogTerm  uint64
+	Entries      []entry
+	LeaderCommit uint64
+}
+
+type appendReply struct {
+	Term    uint64
+	Success bool
+
+	// ConflictIndex is where the leader should continue from when Success is
+	// false.
+	ConflictIndex uint64
+}
+
+type applyArgs struct {
+	Command []byte
+}
+
+type applyReply struct {
+	Index uint64
+	ID    int
+	Error string
+}
+
+type readReply struct {
+	Index uint64
+	Error string
+}
+
+// Handler returns the handler the other nodes of the cluster contact this
+// node through, to be served at the URL of the node in Config.Peers.
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/vote", func(w http.ResponseWriter, r *http.Request) {
+		var args voteArgs
+		if decode(w, r, &args) {
+			reply, err := n.vote(args)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			respond(w, reply)
+		}
+	})
+
+	mux.HandleFunc("/append", func(w http.ResponseWriter, r *http.Request) {
+		var args appendArgs
+		if decode(w, r, &args) {
+			reply, err := n.append(args)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			respond(w, reply)
+		}
+	})
+
+	mux.HandleFunc("/apply", func(w http.ResponseWriter, r *http.Request) {
+		var args applyArgs
+		if !decode(w, r, &args) {
+			return
+		}
+
+		var reply applyReply
+		index, id, err := n.apply(args.Command)
+		reply.Index, reply.ID = index, id
+		if err != nil {
+			reply.Error = err.Error()
+		}
+		respond(w, reply)
+	})
+
+	mux.HandleFunc("/read", func(w http.ResponseWriter, r *http.Request) {
+		var reply readReply
+		n.mutex.Lock()
+		isLeader := n.state == leader
+		n.mutex.Unlock()
+
+		if !isLeader {
+			reply.Error = ErrNotLeader.Error()
+		} else if index, err := n.readIndex(); err != nil {
+			reply.Error = err.Error()
+		} else {
+			reply.Index = index
+		}
+		respond(w, reply)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-n.closed:
+			http.Error(w, ErrClosed.Error(), http.StatusServiceUnavailable)
+			return
+		default:
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// vote answers a candidate asking for this node's vote. It returns an error
+// if the vote couldn't be persisted, in which case it isn't granted.
+func (n *Node) vote(args voteArgs) (voteReply, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if args.Term > n.term {
+		if err := n.stepDown(args.Term); err != nil {
+			return voteReply{}, err
+		}
+	}
+
+	var (
+		lastIndex = n.lastIndex()
+		lastTerm  = n.log[lastIndex].Term
+
+		// the candidate's log has to be at least as up to date as ours
+		upToDate = args.LastLogTerm > lastTerm ||
+			(args.LastLogTerm == lastTerm && args.LastLogIndex >= lastIndex)
+	)
+
+	granted := args.Term == n.term && upToDate &&
+		(n.votedFor == "" || n.votedFor == args.CandidateID)
+
+	if granted {
+		votedFor := n.votedFor
+		n.votedFor = args.CandidateID
+		if err := n.persist(); err != nil {
+			n.votedFor = votedFor
+			return voteReply{}, err
+		}
+		n.resetDeadline()
+	}
+
+	return voteReply{Term: n.term, Granted: granted}, nil
+}
+
+// append stores the entries sent by the leader. It returns an error if they
+// couldn't be persisted, in which case the leader sends them again.
+func (n *Node) append(args appendArgs) (appendReply, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if args.Term < n.term {
+		return appendReply{Term: n.term}, nil
+	}
+
+	if args.Term > n.term || n.state != follower {
+		if err := n.stepDown(args.Term); err != nil {
+			return appendReply{}, err
+		}
+	}
+	n.leader = args.LeaderID
+	n.resetDeadline()
+
+	if args.PrevLogIndex > n.lastIndex() {
+		return appendReply{Term: n.term, ConflictIndex: n.lastIndex() + 1}, nil
+	}
+
+	if term := n.log[args.PrevLogIndex].Term; term != args.PrevLogTerm {
+		// skip back over the whole conflicting term at once
+		index := args.PrevLogIndex
+		for index > n.commitIndex+1 && n.log[index-1].Term == term {
+			index--
+		}
+		return appendReply{Term: n.term, ConflictIndex: index}, nil
+	}
+
+	changed := false
+	for i, e := range args.Entries {
+		index := args.PrevLogIndex + 1 + uint64(i)
+
+		if index <= n.lastIndex() {
+			if n.log[index].Term == e.Term {
+				continue
+			}
+			n.truncate(index)
+		}
+
+		n.log = append(n.log, args.Entries[i:]...)
+		changed = true
+		break
+	}
+
+	if changed {
+		if err := n.persist(); err != nil {
+			n.log = n.log[:n.persisted]
+			return appendReply{}, err
+		}
+	}
+
+	commit := args.LeaderCommit
+	if last := args.PrevLogIndex + uint64(len(args.Entries)); last < commit {
+		commit = last
+	}
+	if commit > n.commitIndex {
+		n.commitIndex = commit
+		n.applied.Broadcast()
+	}
+
+	return appendReply{Term: n.term, Success: true}, nil
+}
+
+// truncate drops the entries from index on, which were never committed,
+// failing the changes waiting for them.
+//
+// no mutex (the node has to be locked)
+func (n *Node) truncate(index uint64) {
+	for i := index; i <= n.lastIndex(); i++ {
+		if ch, ok := n.results[i]; ok {
+			ch <- result{err: ErrNotLeader}
+			delete(n.results, i)
+		}
+	}
+	n.log = n.log[:index]
+	if n.persisted > index {
+		n.persisted = index
+	}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func respond(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,126 @@
+package dump
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit limits how often each client can change the dump through
+// Handler() (see HandlerOptions.RateLimit). Every client has a bucket of
+// Burst tokens refilled at Rate tokens per second, and every POST, PUT or
+// DELETE request takes one. Requests finding the bucket empty are refused
+// with 429 Too Many Requests and a Retry-After header.
+type RateLimit struct {
+	// Rate is the number of writes allowed per second (1 if it isn't
+	// positive), such as 0.5 for one every two seconds.
+	Rate float64
+
+	// Burst is the number of writes allowed at once (Rate rounded up if it
+	// isn't positive).
+	Burst int
+
+	// Key returns the key identifying the client of a request. By default
+	// clients are identified by the IP address of the connection: behind a
+	// proxy, it should return the address the proxy forwards instead, or the
+	// token the client is authenticated with. Requests with the same key
+	// share a bucket.
+	Key func(r *http.Request) string
+}
+
+// limiter holds the buckets of the clients of a handler.
+type limiter struct {
+	RateLimit
+
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// sweepInterval is how often the buckets that are full again are forgotten.
+const sweepInterval = time.Minute
+
+func newLimiter(l RateLimit) *limiter {
+	if l.Rate <= 0 {
+		l.Rate = 1
+	}
+	if l.Burst <= 0 {
+		l.Burst = int(math.Ceil(l.Rate))
+	}
+	if l.Key == nil {
+		l.Key = remoteIP
+	}
+
+	return &limiter{RateLimit: l, buckets: make(map[string]*bucket), swept: time.Now()}
+}
+
+// remoteIP returns the IP address of the client of a request.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// take takes a token from the bucket of key. If the bucket is empty, it
+// returns false and how long until it holds a token again.
+func (l *limiter) take(key string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.swept) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.updated).Seconds()*l.Rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets the buckets that are full again, which are the same as new
+// ones.
+//
+// no mutex
+func (l *limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.Rate >= float64(l.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
+
+// allow reports whether the client of the request may change the dump,
+// responding to it if it may not.
+func (h *handler) allow(w http.ResponseWriter, r *http.Request) bool {
+	if h.limiter == nil {
+		return true
+	}
+
+	ok, wait := h.limiter.take(h.limiter.Key(r), time.Now())
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	}
+	return ok
+}
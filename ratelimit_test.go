@@ -0,0 +1,64 @@
+package dump
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(RateLimit{Rate: 2, Burst: 3})
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.take("a", now); !ok {
+			t.Fatal("refused a request within the burst", i)
+		}
+	}
+	if ok, wait := l.take("a", now); ok || wait != 500*time.Millisecond {
+		t.Fatal("allowed a request over the burst", wait)
+	}
+	if ok, _ := l.take("b", now); !ok {
+		t.Fatal("clients share a bucket")
+	}
+
+	if ok, _ := l.take("a", now.Add(500*time.Millisecond)); !ok {
+		t.Fatal("didn't refill the bucket")
+	}
+
+	// full buckets are forgotten
+	l.take("c", now.Add(sweepInterval))
+	if len(l.buckets) != 1 {
+		t.Fatal("didn't sweep the buckets", len(l.buckets))
+	}
+}
+
+func TestHandlerRateLimit(t *testing.T) {
+	types := []Type{{"dump.Plain", &Plain{}}}
+	test, _ := New("test.db", PERSIST_MANUAL, types, WithFactory(func() Item { return &Plain{} }))
+
+	h := Handler(test, HandlerOptions{RateLimit: &RateLimit{Rate: 0.1}})
+	request := func(method, path, addr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(`{"name":"a"}`))
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("POST", "/", "10.0.0.1:1234"); w.Code != http.StatusCreated {
+		t.Fatal("refused a write", w.Code)
+	}
+	w := request("PUT", "/0", "10.0.0.1:5678")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "10" {
+		t.Fatal("allowed a write over the limit", w.Code, w.Header())
+	}
+	if w := request("GET", "/0", "10.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Fatal("limited a read", w.Code)
+	}
+	if w := request("DELETE", "/0", "10.0.0.2:1234"); w.Code != http.StatusNoContent {
+		t.Fatal("limited another client", w.Code)
+	}
+}
@@ -0,0 +1,296 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"sort"
+)
+
+// RecordStore persists each item of a dump as a separate record instead of
+// writing the whole dump as one file, so saving only has to write the items
+// that changed. Records are keyed by the stable id of the item (see
+// Meta.ID).
+//
+// LogStore is the RecordStore provided by this package. Embedded databases
+// such as bbolt map onto this interface directly (one bucket, big-endian
+// keys, Commit in a single read-write transaction).
+type RecordStore interface {
+	// Load calls f for every record in the store in ascending key order. It
+	// returns the first error returned by f.
+	Load(f func(key uint64, data []byte) error) error
+
+	// Commit atomically writes the records in puts and removes the records
+	// with the keys in deletes.
+	Commit(puts map[uint64][]byte, deletes []uint64) error
+}
+
+// WithRecordStore is an option that persists the dump to rs, one record per
+// item, instead of a single dump file. Saving the dump only writes the items
+// that changed since the last save. The filename of the dump is unused and
+// file options such as WithCompression() and WithBackups() have no effect.
+func WithRecordStore(rs RecordStore) Option {
+	return func(d *Dump) error {
+		if rs == nil {
+			return ErrInvalidStorage
+		}
+		d.records = rs
+		return nil
+	}
+}
+
+// record is how an item and its metadata are stored in a RecordStore.
+type record struct {
+	Item Item
+	Meta meta
+}
+
+func encodeRecord(item Item, m meta) ([]byte, error) {
+	buffer := getBuffer(0)
+	defer putBuffer(buffer)
+
+	if err := gob.NewEncoder(buffer).Encode(&record{item, m}); err != nil {
+		return nil, encodeError(err, item)
+	}
+	return append([]byte{}, buffer.Bytes()...), nil
+}
+
+func decodeRecord(data []byte) (Item, meta, error) {
+	var r record
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&r); err != nil {
+		return nil, meta{}, decodeError(err)
+	}
+	return r.Item, r.Meta, nil
+}
+
+// orderKey is the key of the record holding the stable ids of the items in
+// order, which is only stored when they aren't in ascending order (such as
+// after Sort()).
+const orderKey = math.MaxUint64
+
+// saveRecords commits the items that changed since the last save to the
+// record store and returns the total size of the records. Records are keyed
+// by the stable ids of the items, so removing or moving items doesn't change
+// the records of the others. Items marked as stale by dirty() are compared
+// against their last committed encoding, the others are known to be
+// unchanged.
+//
+// no mutex (only the record state is locked)
+func (d *Dump) saveRecords() (int, error) {
+	d.recordMutex.Lock()
+	defer d.recordMutex.Unlock()
+
+	var (
+		puts    = make(map[uint64][]byte)
+		deletes []uint64
+		kept    int
+	)
+
+	for i, m := range d.meta {
+		if _, ok := d.committed[m.ID]; ok {
+			kept++
+		}
+		if !d.allStale && !d.stale[m.ID] {
+			continue
+		}
+
+		item, err := d.encodeItems(d.items[i : i+1])
+		if err != nil {
+			return 0, err
+		}
+
+		data, err := encodeRecord(item[0], m)
+		if err != nil {
+			return 0, err
+		}
+
+		if !bytes.Equal(d.committed[m.ID], data) {
+			puts[m.ID] = data
+		}
+	}
+
+	// the order record isn't counted as kept
+	if _, ok := d.committed[orderKey]; ok {
+		kept++
+	}
+	if kept < len(d.committed) {
+		live := make(map[uint64]bool, len(d.meta))
+		for _, m := range d.meta {
+			live[m.ID] = true
+		}
+		for key := range d.committed {
+			if key != orderKey && !live[key] {
+				deletes = append(deletes, key)
+			}
+		}
+		sort.Slice(deletes, func(i, j int) bool { return deletes[i] < deletes[j] })
+	}
+
+	if d.unordered {
+		order, err := encodeOrder(d.stables(idsFrom(0, len(d.meta))))
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.Equal(d.committed[orderKey], order) {
+			puts[orderKey] = order
+		}
+	} else if _, ok := d.committed[orderKey]; ok {
+		deletes = append(deletes, orderKey)
+	}
+
+	if len(puts) > 0 || len(deletes) > 0 {
+		if err := d.records.Commit(puts, deletes); err != nil {
+			return 0, err
+		}
+	}
+
+	if d.committed == nil {
+		d.committed = make(map[uint64][]byte, len(puts))
+	}
+	for key, data := range puts {
+		d.committed[key] = data
+	}
+	for _, key := range deletes {
+		delete(d.committed, key)
+	}
+	d.stale, d.allStale = nil, false
+	d.clean = len(d.items)
+
+	return recordsSize(d.committed), nil
+}
+
+func recordsSize(records map[uint64][]byte) int {
+	size := 0
+	for _, record := range records {
+		size += len(record)
+	}
+	return size
+}
+
+func encodeOrder(stables []uint64) ([]byte, error) {
+	buffer := getBuffer(0)
+	defer putBuffer(buffer)
+
+	if err := gob.NewEncoder(buffer).Encode(stables); err != nil {
+		return nil, err
+	}
+	return append([]byte{}, buffer.Bytes()...), nil
+}
+
+// loadRecords replaces the items with the ones in the record store and
+// returns the total size of the records. It returns ErrCorrupt if a record
+// isn't keyed by the stable id of its item, or if the order record doesn't
+// match the items.
+//
+// no mutex
+func (d *Dump) loadRecords() (int, error) {
+	d.recordMutex.Lock()
+	defer d.recordMutex.Unlock()
+
+	var (
+		items     = make([]Item, 0)
+		metas     = make([]meta, 0)
+		order     []uint64
+		committed = make(map[uint64][]byte)
+	)
+
+	if err := d.records.Load(func(key uint64, data []byte) error {
+		committed[key] = data
+
+		if key == orderKey {
+			if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&order); err != nil {
+				return ErrCorrupt
+			}
+			return nil
+		}
+
+		item, m, err := decodeRecord(data)
+		if err != nil {
+			return err
+		}
+		if m.ID != key {
+			return ErrCorrupt
+		}
+
+		items = append(items, item)
+		metas = append(metas, m)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	if order != nil {
+		if len(order) != len(items) {
+			return 0, ErrCorrupt
+		}
+
+		positions := make(map[uint64]int, len(metas))
+		for i, m := range metas {
+			positions[m.ID] = i
+		}
+
+		ordered, orderedMetas := make([]Item, len(items)), make([]meta, len(metas))
+		for i, stable := range order {
+			p, ok := positions[stable]
+			if !ok {
+				return 0, ErrCorrupt
+			}
+			ordered[i], orderedMetas[i] = items[p], metas[p]
+		}
+		items, metas = ordered, orderedMetas
+	}
+
+	if err := d.decodeItems(items); err != nil {
+		return 0, err
+	}
+
+	d.items = items
+	d.restore(metas, 0)
+	d.committed = committed
+	d.stale, d.allStale = nil, false
+	d.clean = len(items)
+
+	return recordsSize(committed), nil
+}
+
+// touch marks every item as possibly changed since the last save.
+//
+// no mutex
+func (d *Dump) touch() {
+	d.recordMutex.Lock()
+	d.clean = 0
+	d.allStale = true
+	d.recordMutex.Unlock()
+}
+
+// dirty marks the item with the provided id as possibly changed since the
+// last save. The chunks of WithTimeSeries() are positional, so every item
+// after it is marked for them as well (see shifted()).
+//
+// no mutex
+func (d *Dump) dirty(id int) {
+	d.recordMutex.Lock()
+	if id < d.clean {
+		d.clean = id
+	}
+	if d.records != nil {
+		if d.stale == nil {
+			d.stale = make(map[uint64]bool)
+		}
+		d.stale[d.meta[id].ID] = true
+	}
+	d.recordMutex.Unlock()
+}
+
+// shifted marks the items starting at the provided id as moved since the last
+// save, which only matters to the chunks of WithTimeSeries(), since records
+// are keyed by stable ids.
+//
+// no mutex
+func (d *Dump) shifted(id int) {
+	d.recordMutex.Lock()
+	if id < d.clean {
+		d.clean = id
+	}
+	d.recordMutex.Unlock()
+}
@@ -0,0 +1,116 @@
+package dump
+
+import (
+	"os"
+	"testing"
+)
+
+// countingStore wraps a RecordStore and remembers the last commit.
+type countingStore struct {
+	RecordStore
+	puts    map[uint64][]byte
+	deletes []uint64
+}
+
+func (c *countingStore) Commit(puts map[uint64][]byte, deletes []uint64) error {
+	c.puts, c.deletes = puts, deletes
+	return c.RecordStore.Commit(puts, deletes)
+}
+
+func TestRecordStore(t *testing.T) {
+	defer os.Remove("records.log")
+
+	if _, err := New("records.db", PERSIST_WRITES,
+		[]Type{{"dump.Blob", &Blob{}}}, WithRecordStore(nil)); err != ErrInvalidStorage {
+		t.Fatal("accepted nil record store")
+	}
+
+	log, err := OpenLogStore("records.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &countingStore{RecordStore: log}
+
+	test, err := New("records.db", PERSIST_WRITES,
+		[]Type{{"dump.Blob", &Blob{}}}, WithRecordStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"one", "two", "three"} {
+		if _, err = test.Add(&Blob{data}); err != nil {
+			t.Fatal(err)
+		}
+		if len(store.puts) != 1 {
+			t.Fatal("add wrote more than one record")
+		}
+	}
+
+	if err = test.Update(func(items []Item) error {
+		items[1].(*Blob).Data = "changed"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.puts[1]; !ok || len(store.puts) != 1 {
+		t.Fatal("update didn't write only the changed record")
+	}
+
+	// records are keyed by stable ids, so the others don't shift
+	if err = test.Remove(0); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.puts) != 0 || len(store.deletes) != 1 || store.deletes[0] != 0 {
+		t.Fatal("remove didn't delete only the removed record", store.puts, store.deletes)
+	}
+
+	test.Sort(func(a, b Item) bool { return a.(*Blob).Data > b.(*Blob).Data })
+	if _, ok := store.puts[orderKey]; !ok || len(store.puts) != 1 {
+		t.Fatal("sort didn't write only the order", store.puts)
+	}
+
+	if err = log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if log, err = OpenLogStore("records.log"); err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	other, _ := New("records.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithRecordStore(log))
+	if err = other.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	other.View(func(items []Item) error {
+		if len(items) != 2 || items[0].(*Blob).Data != "three" || items[1].(*Blob).Data != "changed" {
+			t.Fatal("records didn't load")
+		}
+		return nil
+	})
+
+	misplaced, _ := encodeRecord(&Blob{"misplaced"}, meta{ID: 3})
+	if err = log.Commit(map[uint64][]byte{7: misplaced}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = other.Load(); err != ErrCorrupt {
+		t.Fatal("loaded a record under another key")
+	}
+
+	if err = log.Commit(map[uint64][]byte{0: []byte("garbage")}, []uint64{7}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = other.Load(); err == nil {
+		t.Fatal("decoded garbage record")
+	}
+
+	if err = other.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
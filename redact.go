@@ -0,0 +1,219 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// redactedValue replaces the value of the fields tagged redact:"mask".
+const redactedValue = `"[redacted]"`
+
+// WithRedaction is an option that redacts the exported fields of the items
+// tagged "redact" when the dump is written as JSON, so fields that are only
+// meant to be persisted aren't served:
+//
+//	type User struct {
+//		Name     string
+//		Email    string `redact:"mask"`
+//		Password []byte `redact:"omit"`
+//	}
+//
+// Fields tagged redact:"omit" are left out, and fields tagged
+// redact:"mask" are written as "[redacted]". Only the fields of the item
+// itself (and of the structs it embeds) are redacted, not the fields of the
+// structs it holds. New() returns ErrInvalidRedaction if a tag can't be
+// parsed.
+//
+// The items are redacted by MarshalJSON(), WriteJSONTo(), RedactJSON(), the
+// Data of changes and everything served over HTTP (Handler(),
+// ChangesHandler(), SyncHandler(), webhooks and the graphql package), but are
+// persisted (and exported by ExportJSONL() and replicated) as they are.
+// Collections are redacted like the dump they belong to.
+func WithRedaction() Option {
+	return func(d *Dump) error {
+		for _, t := range d.types {
+			typ := reflect.TypeOf(t.Value)
+			if typ.Kind() == reflect.Ptr {
+				typ = typ.Elem()
+			}
+			if typ.Kind() != reflect.Struct {
+				continue
+			}
+
+			var fields []redacted
+			if err := parseRedaction(typ, &fields); err != nil {
+				return err
+			}
+			if len(fields) == 0 {
+				continue
+			}
+
+			r := d.redacting()
+			for _, v := range []reflect.Type{typ, reflect.PtrTo(typ)} {
+				r.fields[v] = fields
+			}
+		}
+		return nil
+	}
+}
+
+// WithMask is an option that writes the items of the type of value (such as
+// &User{}) as JSON by marshaling what mask returns for them instead, such as
+// a copy with fields cleared or encrypted, or a struct of the fields that are
+// public. It is used where WithRedaction() redacts items, and takes
+// precedence over the tags of the type.
+func WithMask(value Item, mask func(item Item) (interface{}, error)) Option {
+	return func(d *Dump) error {
+		if value == nil || mask == nil {
+			return ErrInvalidRedaction
+		}
+		d.redacting().masks[reflect.TypeOf(value)] = mask
+		return nil
+	}
+}
+
+// redaction holds the redacted fields and the masks of the types of the
+// dump.
+type redaction struct {
+	fields map[reflect.Type][]redacted
+	masks  map[reflect.Type]func(item Item) (interface{}, error)
+}
+
+// redacted is a field tagged "redact", by its JSON name.
+type redacted struct {
+	name string
+	omit bool
+}
+
+// redacting returns the redaction of the dump, creating it if needed.
+func (d *Dump) redacting() *redaction {
+	if d.redaction == nil {
+		d.redaction = &redaction{
+			fields: make(map[reflect.Type][]redacted),
+			masks:  make(map[reflect.Type]func(item Item) (interface{}, error)),
+		}
+	}
+	return d.redaction
+}
+
+// parseRedaction appends the fields of the struct typ tagged "redact" to
+// fields, including the fields of embedded structs.
+func parseRedaction(typ reflect.Type, fields *[]redacted) error {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if err := parseRedaction(embedded, fields); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		redact, ok := field.Tag.Lookup("redact")
+		if !ok || field.PkgPath != "" {
+			continue
+		}
+		if redact != "omit" && redact != "mask" {
+			return ErrInvalidRedaction
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		*fields = append(*fields, redacted{name: name, omit: redact == "omit"})
+	}
+	return nil
+}
+
+// RedactJSON returns the JSON encoding of item as the dump serves it, with
+// its fields redacted (see WithRedaction()). Packages serving the items of the
+// dump use it.
+func (d *Dump) RedactJSON(item Item) ([]byte, error) {
+	return d.marshalJSON(item)
+}
+
+// marshalJSON returns the JSON encoding of item as the dump serves it, with
+// its fields redacted (see WithRedaction()).
+func (d *Dump) marshalJSON(item Item) ([]byte, error) {
+	r := d.root().redaction
+	if r == nil {
+		return marshalItem(item)
+	}
+
+	typ := reflect.TypeOf(item)
+	if mask, ok := r.masks[typ]; ok {
+		masked, err := mask(item)
+		if err != nil {
+			return nil, err
+		}
+		return marshalItem(masked)
+	}
+
+	data, err := marshalItem(item)
+	if err != nil || len(r.fields[typ]) == 0 {
+		return data, err
+	}
+	return redactFields(data, r.fields[typ])
+}
+
+// redactFields returns the JSON object data with fields redacted, keeping
+// the order of its keys. Values that aren't objects are returned as is.
+func redactFields(data []byte, fields []redacted) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return data, nil
+	}
+
+	buffer := bytes.NewBuffer(make([]byte, 0, len(data)))
+	buffer.WriteByte('{')
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		key := token.(string)
+		for _, f := range fields {
+			if f.name == key {
+				if f.omit {
+					value = nil
+				} else {
+					value = json.RawMessage(redactedValue)
+				}
+				break
+			}
+		}
+		if value == nil {
+			continue
+		}
+
+		if buffer.Len() > 1 {
+			buffer.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
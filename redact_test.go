@@ -0,0 +1,67 @@
+package dump
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+type Account struct {
+	Name     string `json:"name"`
+	Email    string `json:"email" redact:"mask"`
+	Password string `redact:"omit"`
+}
+
+type Leaky struct {
+	Token string `redact:"hide"`
+}
+
+func TestRedaction(t *testing.T) {
+	defer os.Remove("redact.db")
+
+	if _, err := New("redact.db", PERSIST_MANUAL, []Type{{"dump.Leaky", &Leaky{}}}, WithRedaction()); err != ErrInvalidRedaction {
+		t.Fatal("accepted an invalid tag", err)
+	}
+
+	types := []Type{{"dump.Account", &Account{}}, {"dump.Plain", &Plain{}}}
+	test, _ := New("redact.db", PERSIST_MANUAL, types, WithRedaction())
+	test.AddAll(&Account{"ann", "ann@example.com", "hunter2"}, &Plain{"plain"})
+
+	const redacted = `[{"name":"ann","email":"[redacted]"},{"name":"plain"}]`
+	if data, err := test.MarshalJSON(); err != nil || string(data) != redacted {
+		t.Fatal("bad JSON", string(data), err)
+	}
+
+	var buffer bytes.Buffer
+	if err := test.WriteJSONTo(&buffer); err != nil || buffer.String() != redacted {
+		t.Fatal("bad JSON", buffer.String(), err)
+	}
+
+	r := httptest.NewRecorder()
+	Handler(test, HandlerOptions{}).ServeHTTP(r, httptest.NewRequest("GET", "/0", nil))
+	if r.Body.String() != `{"name":"ann","email":"[redacted]"}` {
+		t.Fatal("bad response", r.Body.String())
+	}
+
+	// the items are persisted as they are
+	test.Save()
+	other, _ := New("redact.db", PERSIST_MANUAL, types)
+	other.Load()
+	if item, _ := other.Get(0); *item.(*Account) != (Account{"ann", "ann@example.com", "hunter2"}) {
+		t.Fatal("bad item", item)
+	}
+
+	masked, _ := New("redact.db", PERSIST_MANUAL, types, WithRedaction(),
+		WithMask(&Account{}, func(item Item) (interface{}, error) {
+			return map[string]string{"user": item.(*Account).Name}, nil
+		}))
+	masked.Load()
+	if data, _ := masked.MarshalJSON(); string(data) != `[{"user":"ann"},{"name":"plain"}]` {
+		t.Fatal("bad JSON", string(data))
+	}
+
+	if _, err := New("redact.db", PERSIST_MANUAL, types, WithMask(&Account{}, nil)); err != ErrInvalidRedaction {
+		t.Fatal("accepted a nil mask")
+	}
+}
@@ -0,0 +1,255 @@
+package dump
+
+import (
+	"sort"
+)
+
+// DeleteAction is what happens to the items referencing an item when it is
+// deleted, see Reference.
+type DeleteAction int
+
+const (
+	// CascadeDelete deletes the items referencing a deleted item.
+	CascadeDelete DeleteAction = iota + 1
+
+	// SetNull clears the reference of the items referencing a deleted item
+	// with Reference.Clear().
+	SetNull
+)
+
+// Reference declares that the items of a dump reference items of the dump
+// itself, of its dump or of one of its collections by their stable id (see
+// Meta), registered with WithReference().
+type Reference struct {
+	// Collection is the name of the collection holding the referenced items,
+	// or "" for the dump the collections belong to (which is the dump itself
+	// when the reference isn't declared on a collection).
+	Collection string
+
+	// Get returns the stable id referenced by item, or false if it doesn't
+	// reference an item (such as items of another type, or items whose
+	// reference is null).
+	Get func(item Item) (uint64, bool)
+
+	// Clear clears the reference of item, so Get() returns false. It is only
+	// needed by SetNull.
+	Clear func(item Item)
+
+	// OnDelete is what happens to the items referencing an item when it is
+	// deleted.
+	OnDelete DeleteAction
+}
+
+// WithReference is an option that makes the dump enforce the reference r:
+// items referencing an item that doesn't exist are rejected with
+// ErrDangling when they are added or changed (by the methods validating items,
+// see WithValidator()), and deleting a referenced item (by Remove(),
+// DeleteWhere(), Clear(), expiry or eviction) deletes the items referencing
+// it or clears their references, as r.OnDelete says. Deleted items can
+// themselves be referenced, so deletes cascade as far as the references go.
+// If an item whose reference has to be cleared can't be copied away from a
+// frozen view (see Freeze()), the delete fails before changing anything.
+//
+// Like hooks, references are enforced when items are changed by the methods
+// of the dump, not when the dump is loaded or commands are replayed. It
+// returns ErrInvalidReference if r.Get is nil, r.OnDelete isn't one of the
+// DeleteAction constants, or r.Clear is nil with SetNull.
+func WithReference(r Reference) Option {
+	return func(d *Dump) error {
+		if r.Get == nil ||
+			(r.OnDelete != CascadeDelete && r.OnDelete != SetNull) ||
+			(r.OnDelete == SetNull && r.Clear == nil) {
+			return ErrInvalidReference
+		}
+
+		d.references = append(d.references, r)
+		return nil
+	}
+}
+
+// root returns the dump the collections belong to.
+func (d *Dump) root() *Dump {
+	if d.parent != nil {
+		return d.parent
+	}
+	return d
+}
+
+// referenced returns the dump holding the items referenced by r, or nil if
+// it's a collection that doesn't exist yet (and so holds no items).
+//
+// no mutex
+func (d *Dump) referenced(r Reference) *Dump {
+	if r.Collection == "" {
+		return d.root()
+	}
+	return d.root().collections[r.Collection]
+}
+
+// checkReferences returns ErrDangling if item references an item that
+// doesn't exist.
+//
+// no mutex
+func (d *Dump) checkReferences(item Item) error {
+	for _, r := range d.references {
+		id, ok := r.Get(item)
+		if !ok {
+			continue
+		}
+
+		target := d.referenced(r)
+		if target == nil || target.find(id) < 0 {
+			return ErrDangling
+		}
+	}
+	return nil
+}
+
+// find returns the position of the item with the provided stable id, or -1
+// if there is no such item.
+//
+// no mutex
+func (d *Dump) find(id uint64) int {
+	if !d.unordered {
+		i := sort.Search(len(d.meta), func(i int) bool {
+			return d.meta[i].ID >= id
+		})
+		if i < len(d.meta) && d.meta[i].ID == id {
+			return i
+		}
+		return -1
+	}
+
+	for i := range d.meta {
+		if d.meta[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// dereference deletes the items referencing the deleted items, or clears
+// their references, in the dump and every collection of its dump.
+//
+// no mutex
+func (d *Dump) dereference(deleted []meta) {
+	ids := make(map[uint64]bool, len(deleted))
+	for _, m := range deleted {
+		ids[m.ID] = true
+	}
+
+	d.eachReference(func(other *Dump, r Reference) error {
+		other.dereferenceBy(r, ids)
+		return nil
+	})
+}
+
+// eachReference calls f with the references to the items of d and the dump
+// (or collection) holding them, until f returns an error.
+//
+// no mutex
+func (d *Dump) eachReference(f func(other *Dump, r Reference) error) error {
+	root := d.root()
+	if len(root.references) == 0 && len(root.collections) == 0 {
+		return nil
+	}
+
+	dumps := []*Dump{root}
+	for _, c := range root.collections {
+		dumps = append(dumps, c)
+	}
+
+	for _, other := range dumps {
+		for _, r := range other.references {
+			if other.referenced(r) != d {
+				continue
+			}
+			if err := f(other, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// thawReferencing thaws (see thaw()) the items whose references
+// dereference() will clear once the items with the provided metadata are
+// deleted, following cascading deletes, so the delete fails before changing
+// anything if one of them can't be copied.
+//
+// no mutex
+func (d *Dump) thawReferencing(deleted []meta) error {
+	ids := make(map[uint64]bool, len(deleted))
+	for _, m := range deleted {
+		ids[m.ID] = true
+	}
+	return d.thawReferences(ids, make(map[*Dump]map[uint64]bool))
+}
+
+// thawReferences thaws the items referencing the items with the provided
+// stable ids, skipping the ids in seen, which cascading deletes could lead
+// back to.
+//
+// no mutex
+func (d *Dump) thawReferences(ids map[uint64]bool, seen map[*Dump]map[uint64]bool) error {
+	if seen[d] == nil {
+		seen[d] = make(map[uint64]bool)
+	}
+	for id := range ids {
+		if seen[d][id] {
+			delete(ids, id)
+		}
+		seen[d][id] = true
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return d.eachReference(func(other *Dump, r Reference) error {
+		cascaded := make(map[uint64]bool)
+		for id, item := range other.items {
+			if target, ok := r.Get(item); !ok || !ids[target] {
+				continue
+			}
+
+			if r.OnDelete == CascadeDelete {
+				cascaded[other.meta[id].ID] = true
+			} else if err := other.thaw(id); err != nil {
+				return err
+			}
+		}
+		return other.thawReferences(cascaded, seen)
+	})
+}
+
+// dereferenceBy applies r.OnDelete to the items referencing the items with
+// the provided stable ids, which were thawed by thawReferencing() before they
+// were deleted.
+//
+// no mutex
+func (d *Dump) dereferenceBy(r Reference, ids map[uint64]bool) {
+	references := func(id int) bool {
+		target, ok := r.Get(d.items[id])
+		return ok && ids[target]
+	}
+
+	if r.OnDelete == CascadeDelete {
+		// the items can be removed, since thawReferencing() thawed the
+		// items referencing them too
+		d.remove(references)
+		return
+	}
+
+	var cleared []int
+	for id := range d.items {
+		if !references(id) {
+			continue
+		}
+		r.Clear(d.items[id])
+		d.replaced(id)
+		cleared = append(cleared, id)
+	}
+	if len(cleared) > 0 {
+		d.afterUpdate(cleared...)
+	}
+}
@@ -0,0 +1,207 @@
+package dump
+
+import (
+	"errors"
+	"testing"
+)
+
+type Writer struct {
+	Name string
+}
+
+type Story struct {
+	Title  string
+	Author uint64
+}
+
+// byAuthor is the reference of articles to their author, 0 being null.
+func byAuthor(onDelete DeleteAction) Reference {
+	return Reference{
+		Collection: "authors",
+		Get: func(item Item) (uint64, bool) {
+			article, ok := item.(*Story)
+			if !ok || article.Author == 0 {
+				return 0, false
+			}
+			return article.Author, true
+		},
+		Clear: func(item Item) {
+			item.(*Story).Author = 0
+		},
+		OnDelete: onDelete,
+	}
+}
+
+func TestReferences(t *testing.T) {
+	types := []Type{{"dump.Writer", &Writer{}}, {"dump.Story", &Story{}}}
+
+	if _, err := New("references.db", PERSIST_MANUAL, types,
+		WithReference(Reference{OnDelete: CascadeDelete})); err != ErrInvalidReference {
+		t.Fatal("accepted a reference without Get")
+	}
+
+	for _, onDelete := range []DeleteAction{CascadeDelete, SetNull} {
+		test, err := New("references.db", PERSIST_MANUAL, types,
+			WithCollection("authors"),
+			WithCollection("articles", WithReference(byAuthor(onDelete))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		authors, _ := test.Collection("authors")
+		articles, _ := test.Collection("articles")
+
+		// the first author is id 1, so 0 can be null
+		authors.Add(&Writer{"nobody"})
+		authors.Remove(0)
+		authors.Add(&Writer{"karl"})
+		authors.Add(&Writer{"carl"})
+		karl, _ := authors.GetMeta(0)
+		carl, _ := authors.GetMeta(1)
+
+		if _, err = articles.Add(&Story{"dangling", 100}); err != ErrDangling {
+			t.Fatal("added a dangling reference")
+		}
+		if _, err = articles.AddAll(
+			&Story{"one", karl.ID},
+			&Story{"two", carl.ID},
+			&Story{"three", karl.ID},
+			&Story{"anonymous", 0},
+		); err != nil {
+			t.Fatal(err)
+		}
+		if err = articles.UpdateAt(1, func(item Item) error {
+			item.(*Story).Author = 100
+			return nil
+		}); err != ErrDangling {
+			t.Fatal("changed to a dangling reference")
+		}
+
+		if err = authors.Remove(0); err != nil {
+			t.Fatal(err)
+		}
+
+		switch onDelete {
+		case CascadeDelete:
+			if articles.Len() != 2 {
+				t.Fatalf("kept %d articles", articles.Len())
+			}
+			if item, _ := articles.Get(0); item.(*Story).Title != "two" {
+				t.Fatal("deleted the wrong articles")
+			}
+		case SetNull:
+			if articles.Len() != 4 {
+				t.Fatalf("kept %d articles", articles.Len())
+			}
+			articles.View(func(items []Item) error {
+				for _, item := range items {
+					if a := item.(*Story); a.Author == karl.ID {
+						t.Fatalf("kept the reference of %s", a.Title)
+					}
+				}
+				return nil
+			})
+			if item, _ := articles.Get(1); item.(*Story).Author != carl.ID {
+				t.Fatal("cleared the wrong reference")
+			}
+		}
+	}
+}
+
+// Comment replies to another comment, 0 being none.
+type Comment struct {
+	ReplyTo uint64
+}
+
+func TestReferencesCascade(t *testing.T) {
+	test, err := New("cascade.db", PERSIST_MANUAL, []Type{{"dump.Comment", &Comment{}}},
+		WithReference(Reference{
+			Get: func(item Item) (uint64, bool) {
+				c := item.(*Comment)
+				return c.ReplyTo, c.ReplyTo != 0
+			},
+			OnDelete: CascadeDelete,
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.Add(&Comment{})
+	test.Remove(0)
+
+	// a thread of replies, and another comment
+	for i := 0; i < 5; i++ {
+		var replyTo uint64
+		if i > 0 {
+			m, _ := test.GetMeta(i - 1)
+			replyTo = m.ID
+		}
+		if _, err = test.Add(&Comment{replyTo}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	test.Add(&Comment{})
+
+	if err = test.Remove(1); err != nil {
+		t.Fatal(err)
+	}
+	if test.Len() != 2 {
+		t.Fatalf("kept %d comments", test.Len())
+	}
+}
+
+// Memo can't be copied, so it can't be thawed while its dump is frozen.
+type Memo struct {
+	Author uint64
+}
+
+var errNoCopy = errors.New("can't be copied")
+
+func (m *Memo) GobEncode() ([]byte, error) {
+	return nil, errNoCopy
+}
+
+func (m *Memo) GobDecode([]byte) error {
+	return errNoCopy
+}
+
+func TestReferencesThaw(t *testing.T) {
+	test, err := New("references.db", PERSIST_MANUAL,
+		[]Type{{"dump.Writer", &Writer{}}, {"dump.Memo", &Memo{}}},
+		WithCollection("authors"),
+		WithCollection("memos", WithReference(Reference{
+			Collection: "authors",
+			Get: func(item Item) (uint64, bool) {
+				return item.(*Memo).Author, item.(*Memo).Author != 0
+			},
+			Clear:    func(item Item) { item.(*Memo).Author = 0 },
+			OnDelete: SetNull,
+		})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authors, _ := test.Collection("authors")
+	memos, _ := test.Collection("memos")
+
+	authors.Add(&Writer{"nobody"})
+	authors.Remove(0)
+	authors.Add(&Writer{"karl"})
+	karl, _ := authors.GetMeta(0)
+	memos.Add(&Memo{karl.ID})
+
+	// the memo can't be cleared without changing the frozen view
+	frozen := memos.Freeze()
+	if err = authors.Remove(0); err == nil {
+		t.Fatal("removed an author whose memo can't be thawed")
+	}
+	if item, _ := memos.Get(0); authors.Len() != 1 || item.(*Memo).Author != karl.ID {
+		t.Fatal("changed the dump before failing")
+	}
+
+	frozen.Release()
+	if err = authors.Remove(0); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := memos.Get(0); item.(*Memo).Author != 0 {
+		t.Fatal("didn't clear the reference")
+	}
+}
@@ -0,0 +1,100 @@
+package dump
+
+import (
+	"os"
+	"time"
+)
+
+// WithReload is an option for dumps that another process writes to: the dump
+// file is checked every interval and loaded again (with Load()) whenever it
+// changed, replacing the items in memory. Readers see either the old or the
+// new items, never a mix of both. If reloaded isn't nil, it is called after
+// every reload with its error (nil if it succeeded); Hooks.OnLoad is called
+// as well.
+//
+// Changes are detected from the size and modification time of the file, so
+// WithReload() only works with the local file system. Changes made to the
+// dump in memory are lost on reload, so it is meant for read-only dumps. A
+// file that is still being written fails to load, so a failed reload is
+// tried again on the next check, and only reported if that fails too.
+func WithReload(interval time.Duration, reloaded func(err error)) Option {
+	return func(d *Dump) error {
+		if interval <= 0 {
+			return ErrInvalidReload
+		}
+
+		d.reload = &reloader{interval: interval, reloaded: reloaded}
+		return nil
+	}
+}
+
+// reloader holds the reload settings of a dump created with WithReload().
+type reloader struct {
+	interval time.Duration
+	reloaded func(err error)
+
+	// size and modified describe the file as of the last check
+	size     int64
+	modified time.Time
+
+	// failed is whether the last reload failed
+	failed bool
+}
+
+// changed returns whether the file changed since the last check.
+func (r *reloader) changed(filename string) bool {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return false
+	}
+
+	if info.Size() == r.size && info.ModTime().Equal(r.modified) {
+		return false
+	}
+
+	r.size, r.modified = info.Size(), info.ModTime()
+	return true
+}
+
+func (d *Dump) startReloader() {
+	if d.reload == nil {
+		return
+	}
+
+	// the file as it is now is either loaded already or about to be
+	d.reload.changed(d.filename)
+
+	go func() {
+		ticker := time.NewTicker(d.reload.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.closed:
+				return
+			case <-ticker.C:
+			}
+
+			if !d.reload.changed(d.filename) {
+				continue
+			}
+
+			err := d.Load()
+			if err != nil {
+				// try again on the next check
+				d.reload.size, d.reload.modified = 0, time.Time{}
+			}
+
+			// the file may have been read while it was being written
+			failed := d.reload.failed
+			d.reload.failed = err != nil
+			if err != nil && !failed {
+				continue
+			}
+
+			if d.reload.reloaded != nil {
+				d.reload.reloaded(err)
+			}
+		}
+	}()
+}
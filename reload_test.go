@@ -0,0 +1,50 @@
+package dump
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	defer os.Remove("reload.db")
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	if _, err := New("reload.db", PERSIST_MANUAL, types, WithReload(0, nil)); err != ErrInvalidReload {
+		t.Fatal("expected ErrInvalidReload")
+	}
+
+	writer, _ := New("reload.db", PERSIST_WRITES, types)
+	writer.Add(&Plain{"karl"})
+
+	reloaded := make(chan error, 10)
+	reader, _ := New("reload.db", PERSIST_MANUAL, types,
+		WithReload(time.Millisecond*5, func(err error) { reloaded <- err }))
+	defer reader.Close()
+	reader.Load()
+
+	// the file hasn't changed since it was loaded
+	select {
+	case <-reloaded:
+		t.Fatal("reloaded unchanged file")
+	case <-time.After(time.Millisecond * 30):
+	}
+
+	// modification times can be coarse
+	time.Sleep(time.Millisecond * 10)
+	writer.Add(&Plain{"carl"})
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("didn't reload")
+	}
+
+	if item, _ := reader.Get(1); reader.Len() != 2 || item.(*Plain).Name != "carl" {
+		t.Fatal("bad reload")
+	}
+}
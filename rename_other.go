@@ -0,0 +1,28 @@
+//go:build !windows
+
+package dump
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// rename replaces newname with oldname, which rename(2) does atomically, and
+// syncs the directory of newname so the rename is on the disk once it
+// returns.
+func rename(oldname, newname string) error {
+	if err := os.Rename(oldname, newname); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(newname))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	if err = dir.Sync(); err != nil {
+		return &os.PathError{Op: "sync", Path: dir.Name(), Err: err}
+	}
+	return nil
+}
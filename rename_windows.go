@@ -0,0 +1,53 @@
+//go:build windows
+
+package dump
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var moveFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("MoveFileExW")
+
+const (
+	movefileReplaceExisting = 0x1
+	movefileWriteThrough    = 0x8
+
+	// errorSharingViolation is ERROR_SHARING_VIOLATION, which syscall
+	// doesn't define.
+	errorSharingViolation syscall.Errno = 32
+)
+
+// rename replaces newname with oldname using MoveFileEx() with
+// MOVEFILE_REPLACE_EXISTING, and MOVEFILE_WRITE_THROUGH so the rename is on
+// the disk once it returns. It fails while another process (such as a
+// reader of the dump, a virus scanner or the search indexer) has newname
+// open, so it is retried for about a second before giving up.
+func rename(oldname, newname string) error {
+	from, err := syscall.UTF16PtrFromString(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	to, err := syscall.UTF16PtrFromString(newname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	for delay := time.Millisecond; ; delay *= 2 {
+		r, _, e := moveFileEx.Call(
+			uintptr(unsafe.Pointer(from)),
+			uintptr(unsafe.Pointer(to)),
+			movefileReplaceExisting|movefileWriteThrough,
+		)
+		if r != 0 {
+			return nil
+		}
+
+		if (e != errorSharingViolation && e != syscall.ERROR_ACCESS_DENIED) || delay > time.Second/2 {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: e}
+		}
+		time.Sleep(delay)
+	}
+}
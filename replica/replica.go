@@ -0,0 +1,296 @@
+// Package replica keeps an eventually consistent, read-only copy of a dump
+// served remotely by dump.Handler(), for services that only need to read it.
+//
+// A Replica polls the list endpoint of the handler every interval. Polls are
+// cheap while the dump doesn't change, since the handler responds with 304
+// Not Modified to a matching If-None-Match header. When it did change, the
+// items are fetched page by page into a new snapshot, which replaces the
+// previous one at once: readers see either snapshot, never a mix of the two.
+package replica
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/karlmcguire/dump"
+)
+
+var (
+	// ErrInvalidConfig is thrown by New() when the url can't be parsed or the
+	// interval isn't positive.
+	ErrInvalidConfig = errors.New("invalid replica config")
+
+	// ErrChanged is thrown by Refresh() when the dump changed while its pages
+	// were fetched. The replica keeps its snapshot and tries again on the
+	// next poll.
+	ErrChanged = errors.New("dump changed while fetching it")
+
+	// ErrClosed is thrown after the replica was closed.
+	ErrClosed = errors.New("replica closed")
+)
+
+// Config configures a Replica.
+type Config struct {
+	// Factory returns the item the JSON of every item is decoded into, such
+	// as &Post{}. By default items are decoded into interface{} values
+	// (map[string]interface{} for objects).
+	Factory func() dump.Item
+
+	// Client is used to poll the dump (http.DefaultClient by default).
+	Client *http.Client
+
+	// PageSize is the number of items requested at a time (1000 by default).
+	// The handler may send fewer, see dump.HandlerOptions.Limit.
+	PageSize int
+}
+
+// Replica is a read-only copy of a remote dump.
+type Replica struct {
+	url      *url.URL
+	interval time.Duration
+	cfg      Config
+
+	// mutex guards the snapshot, which is replaced rather than modified
+	mutex    sync.RWMutex
+	snapshot *snapshot
+
+	// refresh serializes the polls
+	refresh sync.Mutex
+	ctx     context.Context
+	cancel  func()
+	wg      sync.WaitGroup
+}
+
+// snapshot holds the items of the dump as of a poll.
+type snapshot struct {
+	etag    string
+	items   []dump.Item
+	raw     []json.RawMessage
+	fetched time.Time
+}
+
+// New returns a replica of the dump served by dump.Handler() at rawurl (such
+// as "http://primary:8080/posts/"), polled every interval. The first
+// snapshot is fetched before New() returns, which returns an error if it
+// can't be; later polls that fail keep the previous snapshot.
+func New(rawurl string, interval time.Duration, cfg Config) (*Replica, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || interval <= 0 {
+		return nil, ErrInvalidConfig
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = 1000
+	}
+
+	r := &Replica{
+		url:      u,
+		interval: interval,
+		cfg:      cfg,
+		snapshot: &snapshot{items: []dump.Item{}, raw: []json.RawMessage{}},
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	if err := r.Refresh(); err != nil {
+		r.cancel()
+		return nil, err
+	}
+
+	r.wg.Add(1)
+	go r.run()
+
+	return r, nil
+}
+
+func (r *Replica) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			r.Refresh()
+		}
+	}
+}
+
+// Close stops polling. The replica keeps serving its last snapshot.
+func (r *Replica) Close() error {
+	select {
+	case <-r.ctx.Done():
+		return ErrClosed
+	default:
+	}
+
+	r.cancel()
+	r.wg.Wait()
+	return nil
+}
+
+// current returns the current snapshot.
+func (r *Replica) current() *snapshot {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.snapshot
+}
+
+// View calls f with the items of the current snapshot, like
+// dump.Dump.View(). The items must not be modified.
+func (r *Replica) View(f func(items []dump.Item) error) error {
+	return f(r.current().items)
+}
+
+// Len returns the number of items in the current snapshot.
+func (r *Replica) Len() int {
+	return len(r.current().items)
+}
+
+// Get returns the item with the provided id in the current snapshot. It
+// returns dump.ErrNotFound if there is no item with that id.
+func (r *Replica) Get(id int) (dump.Item, error) {
+	items := r.current().items
+	if id < 0 || id >= len(items) {
+		return nil, dump.ErrNotFound
+	}
+	return items[id], nil
+}
+
+// MarshalJSON returns the items of the current snapshot as a JSON list, as
+// they were sent by the handler.
+func (r *Replica) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.current().raw)
+}
+
+// ETag returns the ETag of the dump as of the current snapshot.
+func (r *Replica) ETag() string {
+	return r.current().etag
+}
+
+// Fetched returns when the current snapshot was last confirmed up to date.
+func (r *Replica) Fetched() time.Time {
+	return r.current().fetched
+}
+
+// Refresh polls the dump right away, replacing the snapshot if the dump
+// changed.
+func (r *Replica) Refresh() error {
+	r.refresh.Lock()
+	defer r.refresh.Unlock()
+
+	current := r.current()
+	next := &snapshot{items: []dump.Item{}, raw: []json.RawMessage{}}
+
+	for offset := 0; ; {
+		page, etag, total, err := r.page(offset, current.etag)
+		if err != nil {
+			return err
+		}
+
+		// unchanged since the current snapshot
+		if page == nil {
+			r.mutex.Lock()
+			r.snapshot = &snapshot{current.etag, current.items, current.raw, time.Now()}
+			r.mutex.Unlock()
+			return nil
+		}
+
+		if offset == 0 {
+			next.etag = etag
+		} else if etag != next.etag {
+			return ErrChanged
+		}
+
+		for _, raw := range page {
+			item, err := r.decode(raw)
+			if err != nil {
+				return fmt.Errorf("item %d: %w", len(next.items), err)
+			}
+			next.items, next.raw = append(next.items, item), append(next.raw, raw)
+		}
+
+		offset += len(page)
+		if len(page) == 0 || offset >= total {
+			break
+		}
+	}
+
+	next.fetched = time.Now()
+	r.mutex.Lock()
+	r.snapshot = next
+	r.mutex.Unlock()
+	return nil
+}
+
+// page fetches the items from offset on. It returns a nil page if the dump
+// still has the ETag etag, which is only sent with the first page.
+func (r *Replica) page(offset int, etag string) ([]json.RawMessage, string, int, error) {
+	u := *r.url
+	query := u.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(r.cfg.PageSize))
+	u.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(r.ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if offset == 0 && etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+
+	response, err := r.cfg.Client.Do(request)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified {
+		return nil, "", 0, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, "", 0, fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	total, err := strconv.Atoi(response.Header.Get("X-Total-Count"))
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("invalid X-Total-Count: %w", err)
+	}
+
+	page := make([]json.RawMessage, 0)
+	if err := json.NewDecoder(response.Body).Decode(&page); err != nil {
+		return nil, "", 0, err
+	}
+	return page, response.Header.Get("ETag"), total, nil
+}
+
+// decode decodes the JSON of an item.
+func (r *Replica) decode(raw json.RawMessage) (dump.Item, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if r.cfg.Factory == nil {
+		var item interface{}
+		if err := decoder.Decode(&item); err != nil {
+			return nil, err
+		}
+		return item, nil
+	}
+
+	item := r.cfg.Factory()
+	return item, decoder.Decode(item)
+}
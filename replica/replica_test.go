@@ -0,0 +1,81 @@
+package replica
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/karlmcguire/dump"
+)
+
+type Post struct {
+	Title string `json:"title"`
+}
+
+func TestReplica(t *testing.T) {
+	defer os.Remove("posts.db")
+
+	if _, err := New("http://localhost", 0, Config{}); err != ErrInvalidConfig {
+		t.Fatal("accepted an invalid interval", err)
+	}
+
+	posts, _ := dump.New("posts.db", dump.PERSIST_MANUAL, []dump.Type{{Name: "replica.Post", Value: &Post{}}})
+	posts.AddAll(&Post{"a"}, &Post{"b"}, &Post{"c"})
+
+	var requests int32
+	handler := dump.Handler(posts, dump.HandlerOptions{Limit: 2})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	r, err := New(server.URL, time.Hour, Config{Factory: func() dump.Item { return &Post{} }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// the items are fetched two at a time
+	if r.Len() != 3 || atomic.LoadInt32(&requests) != 2 {
+		t.Fatal("bad snapshot", r.Len(), requests)
+	}
+	if item, _ := r.Get(2); item.(*Post).Title != "c" {
+		t.Fatal("bad item", item)
+	}
+	if data, _ := r.MarshalJSON(); string(data) != `[{"title":"a"},{"title":"b"},{"title":"c"}]` {
+		t.Fatal("bad json", string(data))
+	}
+
+	// unchanged dumps aren't fetched again
+	if err := r.Refresh(); err != nil || atomic.LoadInt32(&requests) != 3 || r.Len() != 3 {
+		t.Fatal("fetched an unchanged dump", err, requests)
+	}
+
+	posts.Remove(0)
+	if err := r.Refresh(); err != nil || r.Len() != 2 || r.ETag() != posts.ETag() {
+		t.Fatal("didn't refresh", err, r.Len())
+	}
+	r.View(func(items []dump.Item) error {
+		if items[0].(*Post).Title != "b" {
+			t.Fatal("bad snapshot", items[0])
+		}
+		return nil
+	})
+
+	generic, err := New(server.URL, time.Hour, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer generic.Close()
+	if item, _ := generic.Get(0); item.(map[string]interface{})["title"] != "b" {
+		t.Fatal("bad item", item)
+	}
+
+	if err := generic.Close(); err != nil || generic.Close() != ErrClosed {
+		t.Fatal("closed twice", err)
+	}
+}
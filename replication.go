@@ -0,0 +1,393 @@
+package dump
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ReplicationHandler returns an http.Handler streaming the changes made to the
+// dump (the primary) to replicas following it with Replicate(). Each line of
+// the response is a JSON message in the format used by SyncHandler(), starting
+// with a snapshot of the items unless the replica resumes with ?since= from a
+// change that is still kept (see WithChanges()).
+//
+// The dump has to be created with WithChanges(), otherwise the handler
+// responds with 500 Internal Server Error.
+func ReplicationHandler(d *Dump) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		if d.feed == nil {
+			http.Error(w, ErrNoFeed.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var since uint64
+		if value := r.URL.Query().Get("since"); value != "" {
+			var err error
+			if since, err = strconv.ParseUint(value, 10, 64); err != nil {
+				http.Error(w, "invalid since", http.StatusBadRequest)
+				return
+			}
+		}
+
+		snapshot, changes, cancel, err := d.follow(since)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer cancel()
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		encoder := json.NewEncoder(w)
+		if snapshot != nil {
+			if err = encoder.Encode(snapshot); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case change, ok := <-changes:
+				if !ok {
+					return
+				}
+				if err = encoder.Encode(syncMessage{
+					Seq:  change.Seq,
+					Op:   change.Op,
+					ID:   change.StableID,
+					Data: json.RawMessage(change.raw),
+				}); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// follow subscribes to the changes after since, or returns a snapshot of
+// every item and subscribes to the changes made after it if the changes after
+// since aren't kept anymore.
+func (d *Dump) follow(since uint64) (*syncMessage, <-chan Change, func(), error) {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	resumable, seq := d.feed.resume(since)
+	if resumable {
+		changes, cancel, err := d.feed.subscribe(since, nil)
+		return nil, changes, cancel, err
+	}
+
+	snapshot := &syncMessage{Seq: seq, Op: "snapshot", Items: []syncItem{}}
+	for id, item := range d.items {
+		data, err := marshalItem(item)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		snapshot.Items = append(snapshot.Items, syncItem{ID: d.meta[id].ID, Data: data})
+	}
+
+	// changes are published while the dump is locked for writing, so none
+	// can be missed between the snapshot and subscribing
+	changes, cancel, err := d.feed.subscribe(0, nil)
+	return snapshot, changes, cancel, err
+}
+
+// errResync is returned by Replica.stream() when the replica has to start over
+// from a snapshot.
+var errResync = errors.New("replica has to resync")
+
+// ReplicaOptions configures Replicate().
+type ReplicaOptions struct {
+	// Client is used to connect to the primary (http.DefaultClient by
+	// default).
+	Client *http.Client
+
+	// Retry is how long to wait before reconnecting after the connection to
+	// the primary was lost (1s by default).
+	Retry time.Duration
+}
+
+// Replica keeps a dump in sync with a primary dump served by
+// ReplicationHandler().
+type Replica struct {
+	d       *Dump
+	url     string
+	options ReplicaOptions
+
+	// order holds the stable ids the items of the replica have on the
+	// primary, by id, and versions the versions the items had when they
+	// were last changed by the replica
+	order    []uint64
+	versions []uint64
+
+	mutex  sync.Mutex
+	seq    uint64
+	closed chan struct{}
+	cancel func()
+	wg     sync.WaitGroup
+}
+
+// Replicate makes d a read-only replica of the primary dump served by
+// ReplicationHandler() at url. The items of d are replaced by a snapshot of
+// the primary's, after which the changes made to the primary are applied to
+// d in the same order, reconnecting whenever the connection is lost.
+//
+// Items are decoded with the factory set with WithFactory() (it returns
+// ErrNoFactory otherwise). Nothing else should change d while it replicates
+// the primary, but if an item is changed anyway and then changed by the
+// primary, the ConflictResolver of d (see WithConflictResolver()) decides
+// which version is kept (the primary's if there is none).
+func Replicate(d *Dump, url string, options ReplicaOptions) (*Replica, error) {
+	if d.factory == nil {
+		return nil, ErrNoFactory
+	}
+
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.Retry <= 0 {
+		options.Retry = time.Second
+	}
+
+	r := &Replica{
+		d:       d,
+		url:     url,
+		options: options,
+		closed:  make(chan struct{}),
+		cancel:  func() {},
+	}
+
+	r.wg.Add(1)
+	go r.run()
+
+	return r, nil
+}
+
+// Seq returns the number of the latest change of the primary applied to the
+// replica, which can be compared with the primary's to measure the lag.
+func (r *Replica) Seq() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.seq
+}
+
+// Close stops replicating. The dump keeps the items it had.
+func (r *Replica) Close() error {
+	r.mutex.Lock()
+	select {
+	case <-r.closed:
+	default:
+		close(r.closed)
+		r.cancel()
+	}
+	r.mutex.Unlock()
+
+	r.wg.Wait()
+	return nil
+}
+
+// run follows the primary until the replica is closed.
+func (r *Replica) run() {
+	defer r.wg.Done()
+
+	for {
+		err := r.stream()
+		if err != nil {
+			// start over from a snapshot if the replica may have diverged
+			r.mutex.Lock()
+			r.seq = 0
+			r.mutex.Unlock()
+		}
+
+		retry := r.options.Retry
+		if err == errResync {
+			retry = 0
+		}
+
+		select {
+		case <-r.closed:
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// stream applies the messages sent by the primary until the connection is
+// lost. It returns an error if the replica has to start over from a snapshot.
+func (r *Replica) stream() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	request, err := http.NewRequest("GET", r.url, nil)
+	if err != nil {
+		return nil
+	}
+	request = request.WithContext(ctx)
+
+	r.mutex.Lock()
+	select {
+	case <-r.closed:
+		r.mutex.Unlock()
+		return nil
+	default:
+	}
+
+	query := url.Values{}
+	query.Set("since", strconv.FormatUint(r.seq, 10))
+	request.URL.RawQuery = query.Encode()
+	r.cancel = cancel
+	r.mutex.Unlock()
+
+	response, err := r.options.Client.Do(request)
+	if err != nil {
+		return nil
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(nil, 1<<30)
+
+	for scanner.Scan() {
+		var message syncMessage
+		if err = json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			return err
+		}
+
+		if message.Op == "reset" {
+			return errResync
+		}
+
+		if err = r.apply(message); err != nil {
+			return err
+		}
+
+		r.mutex.Lock()
+		r.seq = message.Seq
+		r.mutex.Unlock()
+	}
+
+	return nil
+}
+
+// apply applies a message sent by the primary to the dump.
+func (r *Replica) apply(message syncMessage) error {
+	if message.Op == "snapshot" {
+		items := make([]Item, len(message.Items))
+		order := make([]uint64, len(message.Items))
+		for i, s := range message.Items {
+			items[i] = r.d.factory()
+			if err := json.Unmarshal(s.Data, items[i]); err != nil {
+				return err
+			}
+			order[i] = s.ID
+		}
+
+		r.d.mutex.Lock()
+		err := r.d.replace(items)
+		versions := make([]uint64, len(r.d.meta))
+		for i, m := range r.d.meta {
+			versions[i] = m.Version
+		}
+		r.d.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+
+		r.order, r.versions = order, versions
+		return nil
+	}
+
+	id := -1
+	for i, stable := range r.order {
+		if stable == message.ID {
+			id = i
+			break
+		}
+	}
+
+	var item Item
+	if message.Op != "delete" {
+		item = r.d.factory()
+		if err := json.Unmarshal(message.Data, item); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case message.Op == "add" && id == -1:
+		if _, err := r.d.Add(item); err != nil {
+			return err
+		}
+		r.order = append(r.order, message.ID)
+		r.versions = append(r.versions, r.version(len(r.order)-1))
+	case message.Op == "update" && id != -1:
+		return r.update(id, item)
+	case message.Op == "delete" && id != -1:
+		if err := r.d.Remove(id); err != nil {
+			return err
+		}
+		r.order = append(r.order[:id], r.order[id+1:]...)
+		r.versions = append(r.versions[:id], r.versions[id+1:]...)
+	default:
+		return errResync
+	}
+
+	return nil
+}
+
+// update replaces the item with the provided id by the primary's, resolving
+// the conflict if the item was changed locally since the replica last
+// changed it.
+func (r *Replica) update(id int, item Item) error {
+	if r.d.resolver != nil && r.version(id) != r.versions[id] {
+		existing, err := r.d.Get(id)
+		if err != nil {
+			return err
+		}
+		meta, _ := r.d.GetMeta(id)
+
+		if item, err = r.d.resolver.Resolve(Conflict{
+			Existing:     existing,
+			Incoming:     item,
+			ExistingMeta: meta,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := r.d.Set(id, item); err != nil {
+		return err
+	}
+	r.versions[id] = r.version(id)
+	return nil
+}
+
+// version returns the version of the item with the provided id.
+func (r *Replica) version(id int) uint64 {
+	m, _ := r.d.GetMeta(id)
+	return m.Version
+}
@@ -0,0 +1,80 @@
+package dump
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReplicate(t *testing.T) {
+	types := []Type{{"dump.Plain", &Plain{}}}
+	factory := WithFactory(func() Item { return &Plain{} })
+
+	primary, _ := New("primary.db", PERSIST_MANUAL, types, WithChanges(2))
+	primary.AddAll(&Plain{"a"}, &Plain{"b"}, &Plain{"c"})
+
+	server := httptest.NewServer(ReplicationHandler(primary))
+	defer server.Close()
+
+	if _, err := Replicate(primary, server.URL, ReplicaOptions{}); err != ErrNoFactory {
+		t.Fatal("expected ErrNoFactory")
+	}
+
+	replica, _ := New("replica.db", PERSIST_MANUAL, types, factory)
+	r, err := Replicate(replica, server.URL, ReplicaOptions{Retry: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	expect := func(names ...string) {
+		for deadline := time.Now().Add(5 * time.Second); ; {
+			var got []string
+			replica.View(func(items []Item) error {
+				for _, item := range items {
+					got = append(got, item.(*Plain).Name)
+				}
+				return nil
+			})
+
+			if len(got) == len(names) {
+				matching := true
+				for i := range got {
+					matching = matching && got[i] == names[i]
+				}
+				if matching {
+					return
+				}
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatal("replica didn't catch up", got, names)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// bootstraps from a snapshot
+	expect("a", "b", "c")
+
+	primary.Set(1, &Plain{"B"})
+	primary.Add(&Plain{"d"})
+	primary.DeleteWhere(func(item Item) bool {
+		name := item.(*Plain).Name
+		return name == "a" || name == "c"
+	})
+	expect("B", "d")
+
+	// reordering makes the replica start over
+	primary.Sort(func(a, b Item) bool { return a.(*Plain).Name > b.(*Plain).Name })
+	expect("d", "B")
+
+	// reconnecting resumes from the last change applied
+	server.CloseClientConnections()
+	primary.Add(&Plain{"e"})
+	expect("d", "B", "e")
+
+	if r.Seq() == 0 {
+		t.Fatal("expected seq")
+	}
+}
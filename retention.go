@@ -0,0 +1,72 @@
+package dump
+
+import (
+	"time"
+)
+
+// WithMaxItems is an option that caps the dump at n items, like a ring
+// buffer: when adding items grows the dump beyond n, the oldest items (the
+// first ones in the dump) are removed. Like DeleteWhere(), removing items
+// shifts the ids of the remaining ones down.
+func WithMaxItems(n int) Option {
+	return func(d *Dump) error {
+		if n <= 0 {
+			return ErrInvalidRetention
+		}
+		d.maxItems = n
+		return nil
+	}
+}
+
+// WithMaxAge is an option that removes items once they are older than age.
+// It works like WithTTL(age, 0), but expired items are also removed whenever
+// items are added, not only before the dump is read. It can't be combined
+// with WithTTL() (New() returns ErrInvalidRetention).
+func WithMaxAge(age time.Duration) Option {
+	return func(d *Dump) error {
+		if age <= 0 {
+			return ErrInvalidRetention
+		}
+		d.maxAge = age
+		return nil
+	}
+}
+
+// retain sets up the expiry of the items for WithMaxAge(), once every option
+// was applied.
+func (d *Dump) retain() error {
+	if d.maxAge == 0 {
+		return nil
+	}
+	if d.ttl != nil {
+		return ErrInvalidRetention
+	}
+
+	d.ttl = &expiry{ttl: d.maxAge}
+	return nil
+}
+
+// evict removes the items that don't fit the retention options (or
+// WithLRU()) after items were added, and returns the number of items removed
+// before the new ones (by WithMaxItems() or WithLRU()), which the ids of the
+// new items shift down by.
+//
+// no mutex
+func (d *Dump) evict() int {
+	removed := d.prune()
+	if d.maxItems > 0 && len(d.items) > d.maxItems {
+		excess := len(d.items) - d.maxItems
+		// items that can't be removed yet are evicted the next time
+		removed, _ = d.remove(func(id int) bool { return id < excess })
+	}
+
+	if d.lru != nil {
+		removed += d.evictLRU()
+	}
+
+	if d.ttl != nil {
+		d.expire()
+	}
+
+	return removed
+}
@@ -0,0 +1,62 @@
+package dump
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaxItems(t *testing.T) {
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	if _, err := New("capped.db", PERSIST_MANUAL, types, WithMaxItems(0)); err != ErrInvalidRetention {
+		t.Fatal("accepted 0 items")
+	}
+
+	test, _ := New("capped.db", PERSIST_MANUAL, types, WithMaxItems(3))
+	test.AddAll(&Plain{"a"}, &Plain{"b"})
+
+	if id, _ := test.Add(&Plain{"c"}); id != 2 {
+		t.Fatal("expected id 2")
+	}
+	if id, _ := test.Add(&Plain{"d"}); id != 2 {
+		t.Fatal("expected id 2 after evicting one item")
+	}
+
+	ids, _ := test.AddAll(&Plain{"e"}, &Plain{"f"}, &Plain{"g"}, &Plain{"h"})
+	if ids[0] != -1 || ids[1] != 0 || ids[3] != 2 {
+		t.Fatal("bad ids", ids)
+	}
+
+	test.View(func(items []Item) error {
+		if len(items) != 3 || items[0].(*Plain).Name != "f" {
+			t.Fatal("expected the last 3 items", items)
+		}
+		return nil
+	})
+}
+
+func TestMaxAge(t *testing.T) {
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	if _, err := New("aged.db", PERSIST_MANUAL, types, WithMaxAge(0)); err != ErrInvalidRetention {
+		t.Fatal("accepted 0 age")
+	}
+
+	if _, err := New("aged.db", PERSIST_MANUAL, types, WithTTL(time.Hour, 0),
+		WithMaxAge(time.Minute)); err != ErrInvalidRetention {
+		t.Fatal("combined with WithTTL()")
+	}
+	if _, err := New("aged.db", PERSIST_MANUAL, types, WithMaxAge(time.Minute),
+		WithTTL(time.Hour, 0)); err != ErrInvalidRetention {
+		t.Fatal("overwritten by WithTTL()")
+	}
+
+	test, _ := New("aged.db", PERSIST_MANUAL, types, WithMaxAge(30*time.Millisecond))
+	test.Add(&Plain{"old"})
+
+	time.Sleep(50 * time.Millisecond)
+
+	if id, _ := test.Add(&Plain{"new"}); id != 0 {
+		t.Fatal("old item wasn't evicted")
+	}
+}
@@ -0,0 +1,341 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WithRevisions is an option that keeps the n most recent revisions of every
+// item (including its current one), so they can be read with GetRevision(),
+// and the dump can be read as it was at some point with ViewAt(). The
+// revisions of deleted items are kept as well.
+//
+// If maxAge is positive, revisions older than maxAge are pruned whenever the
+// dump is saved (along with deleted items that were deleted before then), so
+// only reads within the last maxAge are guaranteed to find what they need.
+// Revisions are persisted in the dump file; they aren't persisted by record
+// stores.
+func WithRevisions(n int, maxAge time.Duration) Option {
+	return func(d *Dump) error {
+		if n <= 0 || maxAge < 0 {
+			return ErrInvalidRetention
+		}
+
+		d.history = &history{
+			max:       n,
+			maxAge:    maxAge,
+			revisions: make(map[uint64][]revision),
+			deleted:   make(map[uint64]int64),
+		}
+		return nil
+	}
+}
+
+// history holds the revisions of the items of a dump created with
+// WithRevisions(). It has its own mutex since it is pruned while saving, when
+// the dump is only locked for reading.
+type history struct {
+	max    int
+	maxAge time.Duration
+	mutex  sync.Mutex
+
+	// revisions maps the stable id of an item to its revisions, oldest first
+	revisions map[uint64][]revision
+
+	// deleted maps the stable id of a deleted item to when it was deleted, in
+	// Unix nanoseconds
+	deleted map[uint64]int64
+}
+
+// revision is an item as it was at some point. Items are kept encoded, since
+// they can be changed in place (by UpdateAt(), for example).
+type revision struct {
+	Version uint64
+	At      int64
+	Item    []byte
+}
+
+// GetRevision returns the item with the provided id as it was at the
+// provided version (see Version()). It returns ErrNotFound if there is no
+// item with that id, ErrNoRevision if that revision isn't kept, and
+// ErrNoHistory if the dump wasn't created with WithRevisions().
+func (d *Dump) GetRevision(id int, version uint64) (Item, error) {
+	if d.history == nil {
+		return nil, ErrNoHistory
+	}
+
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	if id < 0 || id >= len(d.items) {
+		return nil, ErrNotFound
+	}
+
+	d.history.mutex.Lock()
+	defer d.history.mutex.Unlock()
+
+	for _, r := range d.history.revisions[d.meta[id].ID] {
+		if r.Version == version {
+			item, err := decodeRevision(r)
+			if err != nil {
+				return nil, err
+			}
+			items := []Item{item}
+			if err := d.decodeItems(items); err != nil {
+				return nil, err
+			}
+			return items[0], nil
+		}
+	}
+
+	return nil, ErrNoRevision
+}
+
+// ViewAt works like View() but calls f with the items as they were at t,
+// including the items deleted since then. The items are copies, ordered by
+// when they were added (which is their order in the dump unless it was
+// sorted since). It returns ErrNoRevision if an item was changed since t and
+// its revision at t isn't kept anymore, and ErrNoHistory if the dump wasn't
+// created with WithRevisions().
+func (d *Dump) ViewAt(t time.Time, f func(items []Item) error) error {
+	if d.history == nil {
+		return ErrNoHistory
+	}
+
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	items, err := d.history.at(t.UnixNano())
+	if err != nil {
+		return err
+	}
+	if err := d.decodeItems(items); err != nil {
+		return err
+	}
+
+	return f(items)
+}
+
+// at returns the items as they were at the provided Unix nanoseconds.
+func (h *history) at(at int64) ([]Item, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	ids := make([]uint64, 0, len(h.revisions))
+	for id := range h.revisions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var items []Item
+	for _, id := range ids {
+		if deleted, ok := h.deleted[id]; ok && deleted <= at {
+			continue
+		}
+
+		revisions := h.revisions[id]
+		if revisions[0].At > at {
+			if revisions[0].Version > 1 {
+				return nil, ErrNoRevision
+			}
+			// added after at
+			continue
+		}
+
+		i := sort.Search(len(revisions), func(i int) bool { return revisions[i].At > at })
+		item, err := decodeRevision(revisions[i-1])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// revise records the current revision of the items with the provided ids.
+//
+// no mutex
+func (d *Dump) revise(ids ...int) {
+	if d.history == nil {
+		return
+	}
+
+	d.history.mutex.Lock()
+	defer d.history.mutex.Unlock()
+
+	for _, id := range ids {
+		d.history.add(d.meta[id], d.persisted(id))
+	}
+}
+
+// add records a revision of an item, dropping its oldest revisions beyond
+// the limit.
+//
+// no mutex (only the history has to be locked)
+func (h *history) add(m meta, item Item) {
+	encoded := encodeItem(item)
+	if encoded == nil {
+		// the item can't be saved either, which returns an *EncodeError
+		return
+	}
+
+	revisions := append(h.revisions[m.ID], revision{
+		Version: m.Version,
+		At:      m.UpdatedAt,
+		Item:    encoded,
+	})
+	if len(revisions) > h.max {
+		revisions = append(revisions[:0], revisions[len(revisions)-h.max:]...)
+	}
+	h.revisions[m.ID] = revisions
+}
+
+// unrevise records that the items with the provided metadata were deleted.
+//
+// no mutex
+func (d *Dump) unrevise(metas []meta) {
+	if d.history == nil {
+		return
+	}
+
+	d.history.mutex.Lock()
+	defer d.history.mutex.Unlock()
+
+	now := time.Now().UnixNano()
+	for _, m := range metas {
+		if _, ok := d.history.revisions[m.ID]; ok {
+			d.history.deleted[m.ID] = now
+		}
+	}
+}
+
+// reconcile brings the history up to date after the items were replaced as a
+// whole (by Load(), Merge() and so on): items that are gone are recorded as
+// deleted, and items whose current revision isn't recorded get it recorded.
+//
+// no mutex
+func (d *Dump) reconcile() {
+	if d.history == nil {
+		return
+	}
+
+	d.history.mutex.Lock()
+	defer d.history.mutex.Unlock()
+
+	var (
+		now  = time.Now().UnixNano()
+		live = make(map[uint64]bool, len(d.meta))
+	)
+
+	for id, m := range d.meta {
+		live[m.ID] = true
+
+		// items can come back, such as by loading an older file
+		delete(d.history.deleted, m.ID)
+
+		revisions := d.history.revisions[m.ID]
+		if n := len(revisions); n > 0 && revisions[n-1].Version == m.Version &&
+			revisions[n-1].At == m.UpdatedAt {
+			continue
+		}
+
+		// items loaded from files written before they had timestamps
+		if m.UpdatedAt == 0 {
+			d.meta[id].UpdatedAt = now
+		}
+		d.history.add(d.meta[id], d.persisted(id))
+	}
+
+	for id := range d.history.revisions {
+		if _, ok := d.history.deleted[id]; !ok && !live[id] {
+			d.history.deleted[id] = now
+		}
+	}
+}
+
+// prune drops the revisions older than the maximum age of the history,
+// except for the last revision of the items that weren't changed since, and
+// the items deleted before then.
+func (h *history) prune() {
+	if h.maxAge == 0 {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	cutoff := time.Now().Add(-h.maxAge).UnixNano()
+	for id, deleted := range h.deleted {
+		if deleted < cutoff {
+			delete(h.revisions, id)
+			delete(h.deleted, id)
+		}
+	}
+
+	for id, revisions := range h.revisions {
+		i := sort.Search(len(revisions), func(i int) bool { return revisions[i].At > cutoff })
+		if i > 1 {
+			h.revisions[id] = append(revisions[:0], revisions[i-1:]...)
+		}
+	}
+}
+
+// persisted returns the history as it is persisted in the dump file.
+func (h *history) persisted() (map[uint64][]revision, map[uint64]int64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	revisions := make(map[uint64][]revision, len(h.revisions))
+	for id, r := range h.revisions {
+		revisions[id] = append([]revision{}, r...)
+	}
+	deleted := make(map[uint64]int64, len(h.deleted))
+	for id, at := range h.deleted {
+		deleted[id] = at
+	}
+	return revisions, deleted
+}
+
+// restore replaces the history with the one persisted in the dump file.
+func (h *history) restore(revisions map[uint64][]revision, deleted map[uint64]int64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.revisions, h.deleted = revisions, deleted
+	if h.revisions == nil {
+		h.revisions = make(map[uint64][]revision)
+	}
+	if h.deleted == nil {
+		h.deleted = make(map[uint64]int64)
+	}
+
+	for id, r := range h.revisions {
+		if len(r) > h.max {
+			h.revisions[id] = r[len(r)-h.max:]
+		}
+	}
+}
+
+func decodeRevision(r revision) (Item, error) {
+	var item Item
+	if err := gob.NewDecoder(bytes.NewReader(r.Item)).Decode(&item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// persisted returns the item with the provided id as it is persisted (see
+// WithItemCodec()), or nil if it can't be encoded.
+//
+// no mutex
+func (d *Dump) persisted(id int) Item {
+	items, err := d.encodeItems(d.items[id : id+1])
+	if err != nil {
+		return nil
+	}
+	return items[0]
+}
@@ -0,0 +1,101 @@
+package dump
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRevisions(t *testing.T) {
+	defer os.Remove("revisions.db")
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+	if _, err := New("revisions.db", PERSIST_MANUAL, types, WithRevisions(0, 0)); err != ErrInvalidRetention {
+		t.Fatal("accepted 0 revisions")
+	}
+
+	test, _ := New("revisions.db", PERSIST_MANUAL, types, WithRevisions(2, 0))
+
+	names := func(at time.Time) string {
+		var names []string
+		err := test.ViewAt(at, func(items []Item) error {
+			for _, item := range items {
+				names = append(names, item.(*Plain).Name)
+			}
+			return nil
+		})
+		if err != nil {
+			return err.Error()
+		}
+		return strings.Join(names, ",")
+	}
+
+	// sleeps so the changes are at distinct times
+	tick := func() time.Time {
+		time.Sleep(2 * time.Millisecond)
+		return time.Now()
+	}
+
+	before := tick()
+	test.AddAll(&Plain{"a"}, &Plain{"b"})
+	added := tick()
+	test.UpdateAt(0, func(item Item) error {
+		item.(*Plain).Name = "a2"
+		return nil
+	})
+	updated := tick()
+	test.Remove(1)
+	removed := tick()
+	test.Add(&Plain{"c"})
+
+	if item, err := test.GetRevision(0, 1); err != nil || item.(*Plain).Name != "a" {
+		t.Fatal("bad revision", item, err)
+	}
+	if _, err := test.GetRevision(0, 3); err != ErrNoRevision {
+		t.Fatal("expected ErrNoRevision", err)
+	}
+
+	for at, expected := range map[time.Time]string{
+		before:     "",
+		added:      "a,b",
+		updated:    "a2,b",
+		removed:    "a2",
+		time.Now(): "a2,c",
+	} {
+		if got := names(at); got != expected {
+			t.Fatalf("expected %q, got %q", expected, got)
+		}
+	}
+
+	// only 2 revisions are kept
+	test.Set(0, &Plain{"a3"})
+	if _, err := test.GetRevision(0, 1); err != ErrNoRevision {
+		t.Fatal("kept too many revisions")
+	}
+	if got := names(added); got != ErrNoRevision.Error() {
+		t.Fatal("expected ErrNoRevision", got)
+	}
+
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := New("revisions.db", PERSIST_MANUAL, types, WithRevisions(2, time.Millisecond))
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if item, err := other.GetRevision(0, 2); err != nil || item.(*Plain).Name != "a2" {
+		t.Fatal("didn't persist revisions", err)
+	}
+
+	// saving prunes the old revisions and the deleted items
+	time.Sleep(2 * time.Millisecond)
+	other.Save()
+	if _, err := other.GetRevision(0, 2); err != ErrNoRevision {
+		t.Fatal("didn't prune revisions")
+	}
+	if len(other.history.revisions) != 2 {
+		t.Fatal("didn't prune deleted items", other.history.revisions)
+	}
+}
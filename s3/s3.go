@@ -0,0 +1,284 @@
+// Package s3 provides a dump.Storage that persists dumps to Amazon S3 or any
+// S3-compatible object storage (MinIO, Ceph, R2, etc.).
+package s3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidConfig is thrown by New() when the endpoint, region, bucket
+	// or credentials are missing from the Config.
+	ErrInvalidConfig = errors.New("invalid s3 config")
+)
+
+// Config describes the bucket a Storage persists to.
+type Config struct {
+	// Endpoint is the base URL of the object storage service, for example
+	// "https://s3.us-east-1.amazonaws.com". Requests use path-style
+	// addressing ("Endpoint/Bucket/Key").
+	Endpoint string
+
+	// Region is the region the bucket is in, for example "us-east-1".
+	Region string
+
+	// Bucket is the name of the bucket.
+	Bucket string
+
+	// Prefix is prepended to every dump filename to form the object key, for
+	// example "dumps/".
+	Prefix string
+
+	// AccessKey, SecretKey and SessionToken are the credentials used to sign
+	// requests. SessionToken is only required for temporary credentials.
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// ServerSideEncryption is sent as the x-amz-server-side-encryption header
+	// when writing objects. It is usually "AES256" or "aws:kms", leave it
+	// empty to use the bucket default.
+	ServerSideEncryption string
+
+	// KMSKeyID is the KMS key used when ServerSideEncryption is "aws:kms".
+	KMSKeyID string
+
+	// Retries is the number of times a request is retried after a network
+	// error or a 5xx/429 response, with exponential backoff starting at
+	// Backoff.
+	Retries int
+	Backoff time.Duration
+
+	// Client is the http.Client used for requests. http.DefaultClient is used
+	// if it is nil.
+	Client *http.Client
+}
+
+// Storage is a dump.Storage backed by an S3 bucket.
+type Storage struct {
+	config Config
+	now    func() time.Time
+}
+
+// New returns a Storage for the bucket described by c.
+func New(c Config) (*Storage, error) {
+	if c.Endpoint == "" || c.Region == "" || c.Bucket == "" ||
+		c.AccessKey == "" || c.SecretKey == "" {
+		return nil, ErrInvalidConfig
+	}
+
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+
+	if c.Backoff == 0 {
+		c.Backoff = 100 * time.Millisecond
+	}
+
+	c.Endpoint = strings.TrimRight(c.Endpoint, "/")
+
+	return &Storage{config: c, now: time.Now}, nil
+}
+
+// Read returns the contents of the object for the named dump file. If the
+// object doesn't exist the returned error satisfies os.IsNotExist().
+func (s *Storage) Read(name string) ([]byte, error) {
+	resp, err := s.do("GET", name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("read", name, resp)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Write uploads data as the object for the named dump file.
+func (s *Storage) Write(name string, data []byte) error {
+	header := make(http.Header)
+
+	if s.config.ServerSideEncryption != "" {
+		header.Set("X-Amz-Server-Side-Encryption", s.config.ServerSideEncryption)
+		if s.config.KMSKeyID != "" {
+			header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", s.config.KMSKeyID)
+		}
+	}
+
+	resp, err := s.do("PUT", name, data, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError("write", name, resp)
+	}
+
+	return nil
+}
+
+// Rename copies the object for oldname to newname and deletes the original.
+// S3 has no atomic rename so a failure between the two requests leaves both
+// objects in place.
+func (s *Storage) Rename(oldname, newname string) error {
+	header := make(http.Header)
+	header.Set("X-Amz-Copy-Source", "/"+s.config.Bucket+"/"+escape(s.key(oldname)))
+
+	if s.config.ServerSideEncryption != "" {
+		header.Set("X-Amz-Server-Side-Encryption", s.config.ServerSideEncryption)
+		if s.config.KMSKeyID != "" {
+			header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", s.config.KMSKeyID)
+		}
+	}
+
+	resp, err := s.do("PUT", newname, nil, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return &os.PathError{Op: "rename", Path: oldname, Err: os.ErrNotExist}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError("rename", oldname, resp)
+	}
+
+	if resp, err = s.do("DELETE", oldname, nil, nil); err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError("rename", oldname, resp)
+	}
+
+	return nil
+}
+
+// Remove deletes the object for the named dump file.
+func (s *Storage) Remove(name string) error {
+	resp, err := s.do("DELETE", name, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError("remove", name, resp)
+	}
+	return nil
+}
+
+func (s *Storage) key(name string) string {
+	return s.config.Prefix + name
+}
+
+// do sends a signed request for the named object, retrying on network errors
+// and retryable status codes.
+func (s *Storage) do(method, name string, body []byte, header http.Header) (*http.Response, error) {
+	var (
+		resp    *http.Response
+		err     error
+		backoff = s.config.Backoff
+	)
+
+	for attempt := 0; ; attempt++ {
+		var req *http.Request
+		if req, err = s.request(method, name, body, header); err != nil {
+			return nil, err
+		}
+
+		resp, err = s.config.Client.Do(req)
+		if err == nil && !retryable(resp.StatusCode) {
+			return resp, nil
+		}
+
+		if attempt >= s.config.Retries {
+			return resp, err
+		}
+
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (s *Storage) request(method, name string, body []byte, header http.Header) (*http.Request, error) {
+	u, err := url.Parse(s.config.Endpoint + "/" + s.config.Bucket + "/" + escape(s.key(name)))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	if s.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.config.SessionToken)
+	}
+
+	sum := sha256.Sum256(body)
+	sign(req, hex.EncodeToString(sum[:]), s.config, s.now())
+
+	return req, nil
+}
+
+func retryable(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+func responseError(op, name string, resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("s3: %s %s: %s: %s", op, name, resp.Status, bytes.TrimSpace(body))
+}
+
+// escape URI encodes each segment of an object key, as required by the AWS
+// signature.
+func escape(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
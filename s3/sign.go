@@ -0,0 +1,80 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm  = "AWS4-HMAC-SHA256"
+	service    = "s3"
+	timeFormat = "20060102T150405Z"
+	dateFormat = "20060102"
+)
+
+// sign adds the AWS Signature Version 4 headers to req. Every header already
+// set on req is signed, along with the host.
+func sign(req *http.Request, payloadHash string, c Config, now time.Time) {
+	now = now.UTC()
+
+	req.Header.Set("X-Amz-Date", now.Format(timeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	var (
+		names   = []string{"host"}
+		values  = map[string]string{"host": req.URL.Host}
+		headers strings.Builder
+	)
+
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		names = append(names, name)
+		values[name] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		headers.WriteString(name + ":" + values[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		headers.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+
+	scope := now.Format(dateFormat) + "/" + c.Region + "/" + service + "/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := algorithm + "\n" + now.Format(timeFormat) + "\n" + scope + "\n" +
+		hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretKey), now.Format(dateFormat))
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", algorithm+
+		" Credential="+c.AccessKey+"/"+scope+
+		", SignedHeaders="+signed+
+		", Signature="+hex.EncodeToString(hmacSHA256(key, toSign)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
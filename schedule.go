@@ -0,0 +1,125 @@
+package dump
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// backupTime is the format of the time in the names of scheduled backups,
+// which sorts in chronological order.
+const backupTime = "20060102T150405.000000000Z"
+
+// WithScheduledBackups is an option that writes a copy of the dump every
+// interval, independently of its persist mode, to dir (through the Storage of
+// the dump). Copies are named after the dump file and the time they were
+// taken, such as "backups/users.db.20240102T150405.000000000Z", and only the
+// newest keep copies are kept (all of them if keep is 0).
+//
+// Copies are snapshots of the items in memory, taken with the dump locked
+// for reading, and are complete dump files that can be loaded directly. On
+// the local file system dir is created if needed and older copies found in
+// it are pruned too. Other storages only prune the copies written since the
+// dump was created, and only if they implement Remover.
+func WithScheduledBackups(every time.Duration, dir string, keep int) Option {
+	return func(d *Dump) error {
+		if every <= 0 || keep < 0 {
+			return ErrInvalidBackups
+		}
+
+		d.schedule = &schedule{every: every, dir: dir, keep: keep}
+		return nil
+	}
+}
+
+// schedule holds the settings of a dump created with WithScheduledBackups().
+type schedule struct {
+	every time.Duration
+	dir   string
+	keep  int
+
+	// names are the copies, oldest first
+	names []string
+}
+
+func (d *Dump) startSchedule() {
+	if d.schedule == nil {
+		return
+	}
+
+	if _, ok := d.storage.(fileStorage); ok {
+		names, _ := filepath.Glob(d.scheduledName("*"))
+		for _, name := range names {
+			// skip other files, such as the backups of WithBackups()
+			at := name[len(d.scheduledName("")):]
+			if _, err := time.Parse(backupTime, at); err == nil {
+				d.schedule.names = append(d.schedule.names, name)
+			}
+		}
+		sort.Strings(d.schedule.names)
+	}
+
+	go func() {
+		ticker := time.NewTicker(d.schedule.every)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.closed:
+				return
+			case <-ticker.C:
+			}
+
+			if err := d.scheduledBackup(); err != nil {
+				println(err.Error())
+			}
+		}
+	}()
+}
+
+// scheduledName returns the name of the copy taken at the provided time.
+func (d *Dump) scheduledName(at string) string {
+	return filepath.Join(d.schedule.dir, filepath.Base(d.filename)+"."+at)
+}
+
+// scheduledBackup writes a copy of the dump and prunes the oldest copies.
+func (d *Dump) scheduledBackup() error {
+	d.rlock()
+	buffer, _, err := d.encode(nil)
+	d.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer putBuffer(buffer)
+
+	if _, ok := d.storage.(fileStorage); ok && d.schedule.dir != "" {
+		if err := os.MkdirAll(d.schedule.dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	name := d.scheduledName(time.Now().UTC().Format(backupTime))
+	if err := d.storage.Write(name, buffer.Bytes()); err != nil {
+		return err
+	}
+	d.schedule.names = append(d.schedule.names, name)
+
+	if d.schedule.keep == 0 || len(d.schedule.names) <= d.schedule.keep {
+		return nil
+	}
+
+	pruned := d.schedule.names[:len(d.schedule.names)-d.schedule.keep]
+	d.schedule.names = d.schedule.names[len(pruned):]
+
+	r, ok := d.remover()
+	if !ok {
+		return nil
+	}
+	for _, name := range pruned {
+		if err := r.Remove(name); err != nil && !os.IsNotExist(err) {
+			return pathError("remove", name, err)
+		}
+	}
+	return nil
+}
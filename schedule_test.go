@@ -0,0 +1,51 @@
+package dump
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScheduledBackups(t *testing.T) {
+	defer os.RemoveAll("scheduled")
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	if _, err := New("scheduled.db", PERSIST_MANUAL, types,
+		WithScheduledBackups(0, "scheduled", 1)); err != ErrInvalidBackups {
+		t.Fatal("expected ErrInvalidBackups")
+	}
+
+	// an older copy and an unrelated file
+	os.MkdirAll("scheduled", 0755)
+	os.WriteFile("scheduled/scheduled.db.20000101T000000.000000000Z", nil, 0644)
+	os.WriteFile("scheduled/scheduled.db.1", nil, 0644)
+
+	test, _ := New("scheduled.db", PERSIST_MANUAL, types,
+		WithScheduledBackups(time.Millisecond*5, "scheduled", 2))
+	test.Add(&Plain{"karl"})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		names, _ := filepath.Glob("scheduled/scheduled.db.2*")
+		if len(names) == 2 && names[0] != "scheduled/scheduled.db.20000101T000000.000000000Z" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("didn't prune", names)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	test.Close()
+
+	if _, err := os.Stat("scheduled/scheduled.db.1"); err != nil {
+		t.Fatal("removed unrelated file")
+	}
+
+	names, _ := filepath.Glob("scheduled/scheduled.db.2*")
+	copied, _ := New(names[1], PERSIST_MANUAL, types)
+	if err := copied.Load(); err != nil || copied.Len() != 1 {
+		t.Fatal("bad copy", err)
+	}
+}
@@ -0,0 +1,165 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"sync"
+)
+
+// WithSegments is an option that splits the items of the dump across n
+// segment files next to the dump file, which are encoded and decoded in
+// parallel (one goroutine per segment) to speed up saving and loading large
+// dumps. The dump file keeps everything else, along with the checksums of
+// the segments.
+//
+// There are two sets of segment files (such as users.db.a0 to users.db.a3
+// and users.db.b0 to users.db.b3), which are written to in turn: the dump
+// file is only written after the new segments were, so a crash while saving
+// leaves the previous version of the dump intact. It can't be combined with
+// WithRecordStore() or WithBackups().
+func WithSegments(n int) Option {
+	return func(d *Dump) error {
+		if n <= 0 {
+			return ErrInvalidSegments
+		}
+		d.segments = n
+		return nil
+	}
+}
+
+// segmented describes the segment files holding the items of a dump.
+type segmented struct {
+	// Slot is the set of segment files the items were written to.
+	Slot int
+
+	// Sums are the checksums of the segment files.
+	Sums []uint32
+
+	// Chunks describe the chunk files holding the items instead when
+	// WithTimeSeries() is enabled.
+	Chunks []chunk
+}
+
+// segmentName returns the filename of the ith segment of a slot.
+func (d *Dump) segmentName(slot, i int) string {
+	return fmt.Sprintf("%s.%c%d", d.filename, 'a'+slot, i)
+}
+
+// writeSegments encodes the items into segments in parallel and writes them
+// to the slot that isn't used by the dump file.
+//
+// no mutex (the slot has to be locked)
+func (d *Dump) writeSegments() (*segmented, error) {
+	var (
+		seg  = &segmented{Slot: 1 - d.slot, Sums: make([]uint32, d.segments)}
+		data = make([][]byte, d.segments)
+		errs = make([]error, d.segments)
+		wait sync.WaitGroup
+	)
+
+	for i := 0; i < d.segments; i++ {
+		from, to := len(d.items)*i/d.segments, len(d.items)*(i+1)/d.segments
+
+		wait.Add(1)
+		go func(i int, items []Item) {
+			defer wait.Done()
+
+			buffer := getBuffer(0)
+			defer putBuffer(buffer)
+
+			encoded, err := d.encodeItems(items)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if err := gob.NewEncoder(buffer).Encode(&encoded); err != nil {
+				errs[i] = encodeError(err, items...)
+				return
+			}
+			data[i], errs[i] = d.pack(buffer.Bytes())
+		}(i, d.items[from:to])
+	}
+	wait.Wait()
+
+	for i := range data {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if err := d.storage.Write(d.segmentName(seg.Slot, i), data[i]); err != nil {
+			return nil, err
+		}
+		seg.Sums[i] = crc32.Checksum(data[i], crc)
+	}
+
+	return seg, nil
+}
+
+// readSegments reads the segments described by seg and decodes them in
+// parallel. It returns ErrCorrupt if a segment doesn't match its checksum.
+//
+// no mutex
+func (d *Dump) readSegments(seg *segmented) ([]Item, error) {
+	if len(seg.Chunks) > 0 {
+		return d.readChunks(seg.Chunks)
+	}
+
+	var (
+		segments = make([][]Item, len(seg.Sums))
+		errs     = make([]error, len(seg.Sums))
+		wait     sync.WaitGroup
+	)
+
+	for i, sum := range seg.Sums {
+		data, err := d.storage.Read(d.segmentName(seg.Slot, i))
+		if err != nil {
+			return nil, err
+		}
+		if crc32.Checksum(data, crc) != sum {
+			return nil, ErrCorrupt
+		}
+
+		wait.Add(1)
+		go func(i int, data []byte) {
+			defer wait.Done()
+			segments[i], errs[i] = d.decodeSegment(data)
+		}(i, data)
+	}
+	wait.Wait()
+
+	var items []Item
+	for i := range segments {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		items = append(items, segments[i]...)
+	}
+
+	d.slot = seg.Slot
+	return items, nil
+}
+
+// decodeSegment decodes the items of a segment file.
+func (d *Dump) decodeSegment(data []byte) ([]Item, error) {
+	h, payload, legacy, err := decodeFile(data)
+	if err != nil {
+		return nil, err
+	}
+	if legacy {
+		return nil, ErrCorrupt
+	}
+	if err := d.verify(h, data); err != nil {
+		return nil, err
+	}
+
+	if payload, err = d.unpack(h, payload); err != nil {
+		return nil, err
+	}
+
+	var items []Item
+	if err = gob.NewDecoder(bytes.NewReader(payload)).Decode(&items); err != nil {
+		return nil, decodeError(err)
+	}
+	return items, nil
+}
@@ -0,0 +1,78 @@
+package dump
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestSegments(t *testing.T) {
+	defer os.Remove("segments.db")
+	for _, slot := range "ab" {
+		for i := 0; i < 4; i++ {
+			defer os.Remove(fmt.Sprintf("segments.db.%c%d", slot, i))
+		}
+	}
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+	if _, err := New("segments.db", PERSIST_MANUAL, types, WithSegments(0)); err != ErrInvalidSegments {
+		t.Fatal("accepted 0 segments")
+	}
+	if _, err := New("segments.db", PERSIST_MANUAL, types, WithSegments(2), WithBackups(1)); err != ErrInvalidSegments {
+		t.Fatal("accepted backups")
+	}
+
+	options := []Option{WithSegments(4), WithCompression(GzipLevel(1))}
+	test, _ := New("segments.db", PERSIST_MANUAL, types, options...)
+
+	// fewer items than segments
+	test.AddAll(&Plain{"a"}, &Plain{"b"})
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 7; i++ {
+		test.Add(&Plain{fmt.Sprint(i)})
+	}
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"segments.db.a3", "segments.db.b3"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Fatal("missing segment", name)
+		}
+	}
+
+	other, _ := New("segments.db", PERSIST_MANUAL, types, options...)
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var names string
+	other.View(func(items []Item) error {
+		for _, item := range items {
+			names += item.(*Plain).Name
+		}
+		return nil
+	})
+	if names != "ab0123456" {
+		t.Fatal("bad items", names)
+	}
+
+	// the next save writes to the other slot
+	other.Add(&Plain{"c"})
+	other.storage.Write("segments.db.b0", []byte("garbage"))
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.Load(); err != nil || test.Len() != 10 {
+		t.Fatal("bad load of the other slot", err)
+	}
+
+	// a segment that doesn't match the dump file
+	test.storage.Write("segments.db.b1", []byte("garbage"))
+	if err := test.Load(); err != ErrCorrupt {
+		t.Fatal("expected ErrCorrupt", err)
+	}
+}
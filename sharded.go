@@ -0,0 +1,175 @@
+package dump
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Sharded spreads its items across several dumps (shards), each with its own
+// lock and its own dump file, so writes to items in different shards don't
+// wait for each other. It is created with NewSharded().
+//
+// Ids are interleaved across the shards: the item with id i is the item with
+// id i / n of shard i % n, where n is the number of shards. Like the ids of
+// a dump, removing an item shifts the ids of the items after it, but only
+// within its shard.
+type Sharded struct {
+	shards []*Dump
+	next   uint32
+}
+
+// NewSharded returns a Sharded with n shards, created with New() from the
+// provided persist setting, types and options. Options apply to each shard
+// separately, so WithMaxItems(100) keeps up to 100 items per shard. The
+// shards are persisted to filename with the number of the shard inserted
+// before the extension ("users.db" becomes "users.0.db", "users.1.db" and so
+// on). It returns ErrInvalidShards if n isn't positive.
+func NewSharded(filename string, n int, persist int, types []Type, options ...Option) (*Sharded, error) {
+	if n <= 0 {
+		return nil, ErrInvalidShards
+	}
+
+	s := &Sharded{shards: make([]*Dump, n)}
+	for i := range s.shards {
+		d, err := New(shardName(filename, i), persist, types, options...)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.shards[i] = d
+	}
+
+	return s, nil
+}
+
+// shardName returns the filename of the ith shard.
+func shardName(filename string, i int) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "." + strconv.Itoa(i) + ext
+}
+
+// Shard returns the ith shard, for using the methods of Dump that Sharded
+// doesn't provide. Ids of the shard are local to it.
+func (s *Sharded) Shard(i int) *Dump {
+	return s.shards[i]
+}
+
+// Shards returns the number of shards.
+func (s *Sharded) Shards() int {
+	return len(s.shards)
+}
+
+// locate returns the shard of an id along with the id within the shard.
+func (s *Sharded) locate(id int) (*Dump, int, error) {
+	if id < 0 {
+		return nil, 0, ErrNotFound
+	}
+	return s.shards[id%len(s.shards)], id / len(s.shards), nil
+}
+
+// Add adds the item to the next shard (in turn) and returns its id.
+func (s *Sharded) Add(item Item) (int, error) {
+	i := int(atomic.AddUint32(&s.next, 1)-1) % len(s.shards)
+
+	id, err := s.shards[i].Add(item)
+	if id < 0 {
+		return id, err
+	}
+	return id*len(s.shards) + i, err
+}
+
+// Get returns the item with the provided id, see Dump.Get().
+func (s *Sharded) Get(id int) (Item, error) {
+	d, id, err := s.locate(id)
+	if err != nil {
+		return nil, err
+	}
+	return d.Get(id)
+}
+
+// Set replaces the item with the provided id, see Dump.Set().
+func (s *Sharded) Set(id int, item Item) error {
+	d, id, err := s.locate(id)
+	if err != nil {
+		return err
+	}
+	return d.Set(id, item)
+}
+
+// UpdateAt calls f with the item with the provided id, only locking its
+// shard. See Dump.UpdateAt().
+func (s *Sharded) UpdateAt(id int, f func(item Item) error) error {
+	d, id, err := s.locate(id)
+	if err != nil {
+		return err
+	}
+	return d.UpdateAt(id, f)
+}
+
+// Remove removes the item with the provided id, see Dump.Remove().
+func (s *Sharded) Remove(id int) error {
+	d, id, err := s.locate(id)
+	if err != nil {
+		return err
+	}
+	return d.Remove(id)
+}
+
+// Len returns the number of items in every shard.
+func (s *Sharded) Len() int {
+	var n int
+	for _, d := range s.shards {
+		n += d.Len()
+	}
+	return n
+}
+
+// View calls f with the items of each shard in turn, along with the number
+// of the shard. Each shard is locked for reading while f runs, but the
+// shards aren't locked together, so writes can happen between two calls. It
+// returns the first error returned by f.
+func (s *Sharded) View(f func(shard int, items []Item) error) error {
+	for i, d := range s.shards {
+		err := d.View(func(items []Item) error {
+			return f(i, items)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save saves every shard. It returns the first error, after trying to save
+// the other shards.
+func (s *Sharded) Save() error {
+	return s.each((*Dump).Save)
+}
+
+// Load loads every shard. It returns the first error, after trying to load
+// the other shards.
+func (s *Sharded) Load() error {
+	return s.each((*Dump).Load)
+}
+
+// Close closes every shard, see Dump.Close(). It returns the first error,
+// after trying to close the other shards.
+func (s *Sharded) Close() error {
+	return s.each((*Dump).Close)
+}
+
+// each calls f with every shard and returns the first error.
+func (s *Sharded) each(f func(d *Dump) error) error {
+	var first error
+	for _, d := range s.shards {
+		if d == nil {
+			continue
+		}
+		if err := f(d); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
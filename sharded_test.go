@@ -0,0 +1,84 @@
+package dump
+
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestSharded(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		defer os.Remove(shardName("sharded.db", i))
+	}
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+	if _, err := NewSharded("sharded.db", 0, PERSIST_MANUAL, types); err != ErrInvalidShards {
+		t.Fatal("accepted 0 shards")
+	}
+
+	test, _ := NewSharded("sharded.db", 3, PERSIST_MANUAL, types)
+	if shardName("sharded.db", 1) != "sharded.1.db" {
+		t.Fatal("bad shard name", shardName("sharded.db", 1))
+	}
+
+	for i, name := range []string{"a", "b", "c", "d"} {
+		if id, _ := test.Add(&Plain{name}); id != i {
+			t.Fatal("expected id", i, id)
+		}
+	}
+
+	if item, _ := test.Get(3); item.(*Plain).Name != "d" || test.Shard(0).Len() != 2 {
+		t.Fatal("bad shard")
+	}
+	if _, err := test.Get(-1); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound")
+	}
+
+	// updates to different shards run in parallel
+	var (
+		wait    sync.WaitGroup
+		started = make(chan struct{}, 2)
+		release = make(chan struct{})
+	)
+	for _, id := range []int{1, 2} {
+		wait.Add(1)
+		go func(id int) {
+			defer wait.Done()
+			test.UpdateAt(id, func(item Item) error {
+				started <- struct{}{}
+				<-release
+				item.(*Plain).Name += "!"
+				return nil
+			})
+		}(id)
+	}
+	<-started
+	<-started
+	close(release)
+	wait.Wait()
+
+	test.Remove(0)
+	if item, _ := test.Get(0); item.(*Plain).Name != "d" || test.Len() != 3 {
+		t.Fatal("bad remove", item)
+	}
+
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := NewSharded("sharded.db", 3, PERSIST_MANUAL, types)
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	other.View(func(shard int, items []Item) error {
+		for _, item := range items {
+			names = append(names, item.(*Plain).Name)
+		}
+		return nil
+	})
+	if len(names) != 3 || names[0] != "d" || names[1] != "b!" || names[2] != "c!" {
+		t.Fatal("bad load", names)
+	}
+}
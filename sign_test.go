@@ -0,0 +1,86 @@
+package dump
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSigning(t *testing.T) {
+	defer func() {
+		names, _ := filepath.Glob("signed.db*")
+		for _, name := range names {
+			os.Remove(name)
+		}
+	}()
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+	if _, err := New("signed.db", PERSIST_MANUAL, types, WithSigning(nil)); err != ErrInvalidSigning {
+		t.Fatal("accepted an empty key")
+	}
+
+	key := WithSigning([]byte("secret"))
+	test, _ := New("signed.db", PERSIST_MANUAL, types, key)
+	test.AddAll(&Plain{"a"}, &Plain{"b"})
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := Inspect("signed.db"); !info.Signed {
+		t.Fatal("not signed", info)
+	}
+
+	other, _ := New("signed.db", PERSIST_MANUAL, types, key)
+	if err := other.Load(); err != nil || other.Len() != 2 {
+		t.Fatal("didn't load the signed file", err)
+	}
+
+	// dumps without the key load the file without verifying it
+	plain, _ := New("signed.db", PERSIST_MANUAL, types)
+	if err := plain.Load(); err != nil || plain.Len() != 2 {
+		t.Fatal("didn't load the signed file without a key", err)
+	}
+
+	wrong, _ := New("signed.db", PERSIST_MANUAL, types, WithSigning([]byte("other")))
+	if err := wrong.Load(); err != ErrBadSignature {
+		t.Fatal("expected ErrBadSignature", err)
+	}
+
+	// a change with a valid checksum is still caught
+	data, _ := os.ReadFile("signed.db")
+	h, payload, _, _ := decodeFile(data)
+	payload = bytes.Replace(payload, []byte("Name"), []byte("Nama"), 1)
+	tampered := append(encodeFile(h, payload), data[len(data)-signatureSize:]...)
+	os.WriteFile("signed.db", tampered, 0644)
+	if err := other.Load(); err != ErrBadSignature {
+		t.Fatal("expected ErrBadSignature", err)
+	}
+
+	plain.Save()
+	if err := other.Load(); err != ErrBadSignature {
+		t.Fatal("loaded an unsigned file", err)
+	}
+
+	// backups and segments are signed with the key too
+	var backup bytes.Buffer
+	test.Backup(&backup)
+	if err := other.Restore(&backup); err != nil || other.Len() != 2 {
+		t.Fatal("didn't restore the backup", err)
+	}
+
+	segmented, _ := New("signed.db", PERSIST_MANUAL, types, key, WithSegments(2))
+	segmented.AddAll(&Plain{"a"}, &Plain{"b"})
+	if err := segmented.Save(); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := filepath.Glob("signed.db.?0")
+	if len(names) != 1 {
+		t.Fatal("bad segments", names)
+	}
+	if info, _ := Inspect(names[0]); !info.Signed {
+		t.Fatal("segment not signed", info)
+	}
+	if err := segmented.Load(); err != nil || segmented.Len() != 2 {
+		t.Fatal("didn't load the signed segments", err)
+	}
+}
@@ -0,0 +1,54 @@
+package dump
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// HandleSignals closes the dump (see Close()) when the process receives one of
+// the provided signals (os.Interrupt and SIGTERM if none are provided), so
+// it is saved one last time before the process exits. Dumps using
+// PERSIST_MANUAL are saved as well. The signal is then raised again with
+// the handling stopped, so the process terminates the way it would have.
+//
+// The returned function stops handling the signals.
+func HandleSignals(d *Dump, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	received := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(received, signals...)
+
+	go func() {
+		select {
+		case <-done:
+			return
+		case sig := <-received:
+			signal.Stop(received)
+
+			err := d.Close()
+			if err == nil && d.persist == PERSIST_MANUAL {
+				err = d.Save()
+			}
+			if err != nil {
+				println(err.Error())
+			}
+
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				p.Signal(sig)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(received)
+			close(done)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+//go:build !windows
+
+package dump
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleSignals(t *testing.T) {
+	defer os.Remove("signal.db")
+
+	test, _ := New("signal.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}})
+	test.Add(&Plain{"karl"})
+
+	// SIGWINCH is ignored by default, so raising it again is harmless
+	HandleSignals(test, syscall.SIGWINCH)
+
+	raised := make(chan os.Signal, 2)
+	signal.Notify(raised, syscall.SIGWINCH)
+	defer signal.Stop(raised)
+
+	syscall.Kill(os.Getpid(), syscall.SIGWINCH)
+
+	// the signal is received, then raised again once the dump was saved
+	for i := 0; i < 2; i++ {
+		select {
+		case <-raised:
+		case <-time.After(time.Second):
+			t.Fatal("signal wasn't raised again")
+		}
+	}
+
+	if _, err := os.Stat("signal.db"); err != nil {
+		t.Fatal("didn't save")
+	}
+
+	if _, err := test.Add(&Plain{"carl"}); err != ErrClosed {
+		t.Fatal("expected closed dump", err)
+	}
+
+	stopped, _ := New("stopped.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}})
+	stop := HandleSignals(stopped, syscall.SIGWINCH)
+	stop()
+	stop()
+
+	syscall.Kill(os.Getpid(), syscall.SIGWINCH)
+	time.Sleep(time.Millisecond * 20)
+	if _, err := stopped.Add(&Plain{"karl"}); err != nil {
+		t.Fatal("handled after stop", err)
+	}
+}
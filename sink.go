@@ -0,0 +1,169 @@
+package dump
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// EventSink publishes the changes made to a dump to another system, such as
+// a message broker, so downstream systems can react to them without polling
+// the dump. The nats and kafka packages provide sinks for NATS and Kafka.
+type EventSink interface {
+	// Publish publishes a change. If it returns an error, the change is
+	// published again later, so a change may be published more than once.
+	Publish(c Change) error
+}
+
+// MarshalJSON encodes the change as a JSON object, such as:
+//
+//	{"seq":1,"op":"add","id":0,"stable_id":1,"data":{"name":"karl"}}
+//
+// Resets have no data.
+func (c Change) MarshalJSON() ([]byte, error) {
+	var data json.RawMessage
+	if c.Data != nil {
+		data = json.RawMessage(c.Data)
+	}
+
+	return json.Marshal(struct {
+		Seq      uint64          `json:"seq"`
+		Op       string          `json:"op"`
+		ID       int             `json:"id"`
+		StableID uint64          `json:"stable_id"`
+		Data     json.RawMessage `json:"data,omitempty"`
+	}{c.Seq, c.Op, c.ID, c.StableID, data})
+}
+
+// PublishOptions configures Publish().
+type PublishOptions struct {
+	// Retry is how long to wait before publishing a change again after the
+	// sink returned an error (1s by default).
+	Retry time.Duration
+
+	// OnError is called with every error returned by the sink, if it isn't
+	// nil.
+	OnError func(c Change, err error)
+}
+
+// Publisher publishes the changes made to a dump to an EventSink, see
+// Publish().
+type Publisher struct {
+	d       *Dump
+	sink    EventSink
+	options PublishOptions
+
+	mutex  sync.Mutex
+	seq    uint64
+	closed chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Publish publishes every change made to d from now on to sink, in order,
+// from a goroutine so the dump isn't slowed down by the sink. A change the
+// sink fails to publish is retried until it succeeds, while the following
+// changes wait.
+//
+// The dump has to be created with WithChanges() (it returns ErrNoFeed
+// otherwise), which should keep enough changes to cover the time the sink
+// may be unavailable: changes the dump stopped keeping by the time the sink
+// catches up are skipped. Resets (see Change) are published too, after which
+// downstream systems have to read the dump again.
+func Publish(d *Dump, sink EventSink, options PublishOptions) (*Publisher, error) {
+	if d.feed == nil {
+		return nil, ErrNoFeed
+	}
+
+	if options.Retry <= 0 {
+		options.Retry = time.Second
+	}
+
+	// the publisher starts after the latest change, so if it falls behind
+	// before publishing one it still resumes where it started
+	changes, cancel, seq := d.feed.tail()
+
+	p := &Publisher{
+		d:       d,
+		sink:    sink,
+		options: options,
+		seq:     seq,
+		closed:  make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.run(changes, cancel)
+
+	return p, nil
+}
+
+// Seq returns the number of the last change published, or of the latest
+// change made before Publish() was called if none was published yet.
+func (p *Publisher) Seq() uint64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.seq
+}
+
+// Close stops publishing changes. Changes not published yet are dropped.
+func (p *Publisher) Close() error {
+	p.mutex.Lock()
+	select {
+	case <-p.closed:
+	default:
+		close(p.closed)
+	}
+	p.mutex.Unlock()
+
+	p.wg.Wait()
+	return nil
+}
+
+func (p *Publisher) run(changes <-chan Change, cancel func()) {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.closed:
+			cancel()
+			return
+		case change, ok := <-changes:
+			if ok {
+				if !p.publish(change) {
+					cancel()
+					return
+				}
+				continue
+			}
+
+			// the publisher fell behind, it resumes after the last change
+			// published
+			changes, cancel = p.d.feed.after(p.Seq())
+		}
+	}
+}
+
+// publish publishes change until it succeeds. It returns false if the
+// publisher was closed first.
+func (p *Publisher) publish(change Change) bool {
+	for {
+		err := p.sink.Publish(change)
+		if err == nil {
+			break
+		}
+		if p.options.OnError != nil {
+			p.options.OnError(change, err)
+		}
+
+		select {
+		case <-p.closed:
+			return false
+		case <-time.After(p.options.Retry):
+		}
+	}
+
+	p.mutex.Lock()
+	p.seq = change.Seq
+	p.mutex.Unlock()
+	return true
+}
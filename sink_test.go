@@ -0,0 +1,137 @@
+package dump
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakySink records the changes it publishes, failing every other attempt.
+type flakySink struct {
+	mutex     sync.Mutex
+	attempts  int
+	published []Change
+}
+
+func (s *flakySink) Publish(c Change) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.attempts++; s.attempts%2 == 1 {
+		return errors.New("unavailable")
+	}
+	s.published = append(s.published, c)
+	return nil
+}
+
+func TestPublish(t *testing.T) {
+	types := []Type{{"dump.Plain", &Plain{}}}
+	if _, err := Publish(&Dump{}, &flakySink{}, PublishOptions{}); err != ErrNoFeed {
+		t.Fatal("expected ErrNoFeed", err)
+	}
+
+	test, _ := New("test.db", PERSIST_MANUAL, types, WithChanges(100))
+	sink := &flakySink{}
+	var failed int
+	p, err := Publish(test, sink, PublishOptions{
+		Retry:   time.Millisecond,
+		OnError: func(c Change, err error) { failed++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	test.Add(&Plain{"a"})
+	test.Set(0, &Plain{"b"})
+	test.Remove(0)
+
+	for deadline := time.Now().Add(time.Second); p.Seq() < 3; {
+		if time.Now().After(deadline) {
+			t.Fatal("didn't publish the changes", p.Seq())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if len(sink.published) != 3 || failed != 3 {
+		t.Fatal("bad changes", sink.published, failed)
+	}
+	for i, op := range []string{"add", "update", "delete"} {
+		if sink.published[i].Op != op {
+			t.Fatal("bad change", sink.published[i])
+		}
+	}
+
+	data, _ := sink.published[1].MarshalJSON()
+	if string(data) != `{"seq":2,"op":"update","id":0,"stable_id":0,"data":{"name":"b"}}` {
+		t.Fatal("bad json", string(data))
+	}
+	if data, _ := (Change{Seq: 4, Op: "reset", ID: -1}).MarshalJSON(); string(data) != `{"seq":4,"op":"reset","id":-1,"stable_id":0}` {
+		t.Fatal("bad json", string(data))
+	}
+}
+
+// downSink fails to publish changes until it is up.
+type downSink struct {
+	mutex     sync.Mutex
+	up        bool
+	published []Change
+}
+
+func (s *downSink) Publish(c Change) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.up {
+		return errors.New("unavailable")
+	}
+	s.published = append(s.published, c)
+	return nil
+}
+
+func TestPublishBehind(t *testing.T) {
+	types := []Type{{"dump.Plain", &Plain{}}}
+	test, _ := New("test.db", PERSIST_MANUAL, types, WithChanges(1000))
+	test.Add(&Plain{"a"})
+
+	sink := &downSink{}
+	p, err := Publish(test, sink, PublishOptions{Retry: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if p.Seq() != 1 {
+		t.Fatal("bad seq", p.Seq())
+	}
+
+	// the publisher falls behind before publishing its first change
+	n := subscriberBuffer + 44
+	for i := 0; i < n; i++ {
+		test.Add(&Plain{"b"})
+	}
+
+	sink.mutex.Lock()
+	sink.up = true
+	sink.mutex.Unlock()
+
+	for deadline := time.Now().Add(time.Second); p.Seq() < uint64(n+1); {
+		if time.Now().After(deadline) {
+			t.Fatal("didn't publish the changes", p.Seq())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if len(sink.published) != n {
+		t.Fatal("bad changes", len(sink.published))
+	}
+	for i, change := range sink.published {
+		if change.Seq != uint64(i+2) {
+			t.Fatal("bad change", i, change.Seq)
+		}
+	}
+}
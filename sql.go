@@ -0,0 +1,129 @@
+package dump
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SQLiteDriver is the name of the database/sql driver used by ExportSQLite().
+// The driver itself has to be imported by the application, for example
+// github.com/mattn/go-sqlite3 ("sqlite3") or modernc.org/sqlite ("sqlite").
+var SQLiteDriver = "sqlite3"
+
+// Mapper maps the items of a dump to the columns of a SQL table.
+type Mapper struct {
+	// Columns are the names of the table columns.
+	Columns []string
+
+	// Values returns the column values for the item with the provided id, in
+	// the same order as Columns.
+	Values func(id int, item Item) ([]interface{}, error)
+}
+
+// ImportRows reads every row of rows (such as the result of
+// "SELECT * FROM users") and appends to the dump the item scan returns for
+// each, which reads the current row with rows.Scan(). The items are added at
+// once like with AddAll(), and the dump is saved once when PERSIST_WRITES is
+// enabled.
+//
+// Nothing is added to the dump if scan returns an error for any row, or if
+// rows.Err() does. The rows are closed once they're read.
+func (d *Dump) ImportRows(rows *sql.Rows, scan func(rows *sql.Rows) (Item, error)) error {
+	defer rows.Close()
+
+	var items []Item
+	for n := 1; rows.Next(); n++ {
+		item, err := scan(rows)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", n, err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return d.importItems(items)
+}
+
+// ExportSQLite writes every item in the dump to the table in the SQLite
+// database at path (see SQLiteDriver), creating the database and table if
+// they don't exist. The rows of the table are replaced by the items.
+func (d *Dump) ExportSQLite(path, table string, m Mapper) error {
+	db, err := sql.Open(SQLiteDriver, path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return d.ExportSQL(db, table, m)
+}
+
+// ExportSQL writes every item in the dump to the table in db using a single
+// transaction. The table is created (with untyped columns) if it doesn't
+// exist and its existing rows are deleted first, so exporting again replaces
+// the previous export.
+func (d *Dump) ExportSQL(db *sql.DB, table string, m Mapper) error {
+	if len(m.Columns) == 0 || m.Values == nil {
+		return ErrInvalidMapper
+	}
+
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	var (
+		columns      = make([]string, len(m.Columns))
+		placeholders = make([]string, len(m.Columns))
+		name         = quoteIdentifier(table)
+	)
+
+	for i, column := range m.Columns {
+		columns[i] = quoteIdentifier(column)
+		placeholders[i] = "?"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("CREATE TABLE IF NOT EXISTS " + name +
+		" (" + strings.Join(columns, ", ") + ")"); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM " + name); err != nil {
+		return err
+	}
+
+	insert, err := tx.Prepare("INSERT INTO " + name +
+		" (" + strings.Join(columns, ", ") + ") VALUES (" +
+		strings.Join(placeholders, ", ") + ")")
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for id, item := range d.items {
+		values, err := m.Values(id, item)
+		if err != nil {
+			return err
+		}
+
+		if len(values) != len(columns) {
+			return ErrInvalidMapper
+		}
+
+		if _, err = insert.Exec(values...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
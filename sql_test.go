@@ -0,0 +1,195 @@
+package dump
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingDriver is a database/sql driver that records every executed
+// statement.
+type recordingDriver struct {
+	statements []string
+	args       [][]driver.Value
+	rows       [][]driver.Value
+	fail       string
+	mutex      sync.Mutex
+}
+
+func (r *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{r}, nil
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{c.driver, query}, nil
+}
+
+func (c *recordingConn) Close() error { return nil }
+
+func (c *recordingConn) Begin() (driver.Tx, error) { return c, nil }
+
+func (c *recordingConn) Commit() error { return nil }
+
+func (c *recordingConn) Rollback() error { return nil }
+
+type recordingStmt struct {
+	driver *recordingDriver
+	query  string
+}
+
+func (s *recordingStmt) Close() error { return nil }
+
+func (s *recordingStmt) NumInput() int { return -1 }
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.mutex.Lock()
+	defer s.driver.mutex.Unlock()
+
+	if s.driver.fail != "" && strings.HasPrefix(s.query, s.driver.fail) {
+		return nil, errors.New("exec")
+	}
+
+	s.driver.statements = append(s.driver.statements, s.query)
+	s.driver.args = append(s.driver.args, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.driver.rows == nil {
+		return nil, errors.New("not implemented")
+	}
+	return &recordingRows{s.driver.rows}, nil
+}
+
+// recordingRows returns the rows set on the driver, with a single column.
+type recordingRows struct {
+	rows [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string { return []string{"data"} }
+
+func (r *recordingRows) Close() error { return nil }
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var recorder = &recordingDriver{}
+
+func init() {
+	sql.Register("dumptest", recorder)
+}
+
+func TestExportSQLite(t *testing.T) {
+	SQLiteDriver = "dumptest"
+	defer func() { SQLiteDriver = "sqlite3" }()
+
+	test, _ := NewDump("sql.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	test.Add(&Blob{"one"})
+	test.Add(&Blob{"two"})
+
+	mapper := Mapper{
+		Columns: []string{"id", `da"ta`},
+		Values: func(id int, item Item) ([]interface{}, error) {
+			return []interface{}{id, item.(*Blob).Data}, nil
+		},
+	}
+
+	if err := test.ExportSQLite("export.sqlite", `po"sts`, mapper); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`CREATE TABLE IF NOT EXISTS "po""sts" ("id", "da""ta")`,
+		`DELETE FROM "po""sts"`,
+		`INSERT INTO "po""sts" ("id", "da""ta") VALUES (?, ?)`,
+		`INSERT INTO "po""sts" ("id", "da""ta") VALUES (?, ?)`,
+	}
+
+	if strings.Join(recorder.statements, "\n") != strings.Join(expected, "\n") {
+		t.Fatal("unexpected statements", recorder.statements)
+	}
+
+	if recorder.args[3][0].(int64) != 1 || recorder.args[3][1].(string) != "two" {
+		t.Fatal("unexpected values", recorder.args[3])
+	}
+
+	if err := test.ExportSQLite("export.sqlite", "posts", Mapper{}); err != ErrInvalidMapper {
+		t.Fatal("accepted empty mapper")
+	}
+
+	if err := test.ExportSQLite("export.sqlite", "posts", Mapper{
+		Columns: []string{"id"},
+		Values: func(id int, item Item) ([]interface{}, error) {
+			return []interface{}{id, id}, nil
+		},
+	}); err != ErrInvalidMapper {
+		t.Fatal("accepted wrong number of values")
+	}
+
+	errValues := errors.New("values")
+	if err := test.ExportSQLite("export.sqlite", "posts", Mapper{
+		Columns: []string{"id"},
+		Values: func(id int, item Item) ([]interface{}, error) {
+			return nil, errValues
+		},
+	}); err != errValues {
+		t.Fatal("ignored values error")
+	}
+
+	for _, fail := range []string{"CREATE", "DELETE", "INSERT"} {
+		recorder.fail = fail
+		if err := test.ExportSQLite("export.sqlite", "posts", mapper); err == nil {
+			t.Fatal("ignored exec error for", fail)
+		}
+	}
+	recorder.fail = ""
+
+	SQLiteDriver = "missing"
+	if err := test.ExportSQLite("export.sqlite", "posts", mapper); err == nil {
+		t.Fatal("opened unregistered driver")
+	}
+}
+
+func TestImportRows(t *testing.T) {
+	recorder.rows = [][]driver.Value{{"one"}, {"two"}}
+	defer func() { recorder.rows = nil }()
+
+	db, _ := sql.Open("dumptest", "")
+	defer db.Close()
+
+	scan := func(rows *sql.Rows) (Item, error) {
+		blob := &Blob{}
+		return blob, rows.Scan(&blob.Data)
+	}
+
+	test, _ := NewDump("sql.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	rows, _ := db.Query("SELECT data FROM blobs")
+	if err := test.ImportRows(rows, scan); err != nil || test.Len() != 2 {
+		t.Fatal("didn't import the rows", err)
+	}
+	if item, _ := test.Get(1); item.(*Blob).Data != "two" {
+		t.Fatal("bad item", item)
+	}
+
+	errScan := errors.New("scan")
+	rows, _ = db.Query("SELECT data FROM blobs")
+	if err := test.ImportRows(rows, func(rows *sql.Rows) (Item, error) {
+		return nil, errScan
+	}); !errors.Is(err, errScan) || test.Len() != 2 {
+		t.Fatal("ignored scan error", err)
+	}
+}
@@ -0,0 +1,106 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ChangesHandler returns an http.Handler streaming the changes made to the
+// dump as Server-Sent Events. Every event is named after the Op of the change
+// ("add", "update", "delete" or "reset"), has the Seq of the change as its id
+// and the JSON encoding of the item as its data. Clients reconnecting with a
+// Last-Event-ID header receive the changes they missed, or a "reset" event
+// if those aren't kept anymore (see WithChanges()), after which they have to
+// read the dump again.
+//
+// The dump has to be created with WithChanges(), otherwise the handler
+// responds with 500 Internal Server Error.
+func ChangesHandler(d *Dump) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		var since uint64
+		if last := r.Header.Get("Last-Event-ID"); last != "" {
+			var err error
+			if since, err = strconv.ParseUint(last, 10, 64); err != nil {
+				http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if d.feed == nil {
+			http.Error(w, ErrNoFeed.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// clients resuming after changes that aren't kept anymore are sent a
+		// reset first, after which they have to read the dump again
+		d.rlock()
+		resumable, seq := d.feed.resume(since)
+		reset := since > 0 && !resumable
+		if reset {
+			since = 0
+		}
+		changes, cancel, err := d.feed.subscribe(since, nil)
+		d.mutex.RUnlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		var buffer bytes.Buffer
+		if reset {
+			if err = writeEvent(w, &buffer, Change{Seq: seq, Op: "reset", ID: -1}); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case change, ok := <-changes:
+				if !ok {
+					return
+				}
+				if err = writeEvent(w, &buffer, change); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// writeEvent writes change to w as an event. Items are free to marshal
+// across multiple lines, which would end the event early, so the data is
+// compacted into buffer first.
+func writeEvent(w io.Writer, buffer *bytes.Buffer, change Change) error {
+	data := change.Data
+	if len(data) == 0 {
+		data = []byte("null")
+	}
+
+	buffer.Reset()
+	if err := json.Compact(buffer, data); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", change.Seq, change.Op, buffer.Bytes())
+	return err
+}
@@ -0,0 +1,148 @@
+package dump
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChangesHandler(t *testing.T) {
+	test, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}},
+		WithChanges(10))
+	test.Add(&Blob{"a"})
+
+	server := httptest.NewServer(ChangesHandler(test))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	request.Header.Set("Last-Event-ID", "0")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal("bad content type")
+	}
+
+	test.Set(0, &Blob{"b"})
+
+	reader := bufio.NewReader(response.Body)
+	var lines []string
+	for len(lines) < 4 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+
+	if strings.Join(lines, "|") != `id: 2|event: update|data: {"data":"b"}|` {
+		t.Fatal("bad event", lines)
+	}
+
+	request.Header.Set("Last-Event-ID", "1")
+	resumed, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Body.Close()
+
+	if line, _ := bufio.NewReader(resumed.Body).ReadString('\n'); line != "id: 2\n" {
+		t.Fatal("didn't resume", line)
+	}
+
+	request.Header.Set("Last-Event-ID", "nope")
+	if bad, _ := http.DefaultClient.Do(request); bad.StatusCode != http.StatusBadRequest {
+		t.Fatal("accepted invalid Last-Event-ID")
+	}
+
+	plain, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	recorder := httptest.NewRecorder()
+	ChangesHandler(plain).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatal("served changes that aren't tracked")
+	}
+}
+
+func TestChangesHandlerRedaction(t *testing.T) {
+	test, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Account", &Account{}}},
+		WithChanges(10), WithRedaction())
+
+	server := httptest.NewServer(ChangesHandler(test))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	test.Add(&Account{"ann", "ann@example.com", "hunter2"})
+
+	reader := bufio.NewReader(response.Body)
+	for i := 0; i < 3; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(line, "data: ") && line != `data: {"name":"ann","email":"[redacted]"}`+"\n" {
+			t.Fatal("bad event", line)
+		}
+	}
+}
+
+// Indented marshals itself across multiple lines.
+type Indented struct {
+	Name string
+}
+
+func (i *Indented) MarshalJSON() ([]byte, error) {
+	return json.MarshalIndent(map[string]string{"name": i.Name}, "", "  ")
+}
+
+func TestChangesHandlerEvents(t *testing.T) {
+	test, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Indented", &Indented{}}},
+		WithChanges(1))
+	for _, name := range []string{"a", "b", "c"} {
+		test.Add(&Indented{name})
+	}
+
+	server := httptest.NewServer(ChangesHandler(test))
+	defer server.Close()
+
+	read := func(last string) []string {
+		request, _ := http.NewRequest("GET", server.URL, nil)
+		request.Header.Set("Last-Event-ID", last)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+
+		reader := bufio.NewReader(response.Body)
+		var lines []string
+		for len(lines) < 4 {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+		return lines
+	}
+
+	if lines := strings.Join(read("2"), "|"); lines != `id: 3|event: add|data: {"name":"c"}|` {
+		t.Fatal("bad event", lines)
+	}
+
+	// the first change isn't kept anymore
+	if lines := strings.Join(read("1"), "|"); lines != `id: 3|event: reset|data: null|` {
+		t.Fatal("didn't reset", lines)
+	}
+}
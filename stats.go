@@ -0,0 +1,153 @@
+package dump
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds information about a dump, as returned by Stats().
+type Stats struct {
+	// Items is the number of items in the dump.
+	Items int
+
+	// MemorySize is the approximate size of the items in bytes. It is the
+	// size of the encoded (uncompressed) items as of the last save or load.
+	MemorySize int
+
+	// DiskSize is the size of the dump file in bytes as of the last
+	// successful save or load.
+	DiskSize int
+
+	// LastSave is the time of the last successful save. It is the zero time
+	// if the dump hasn't been saved.
+	LastSave time.Time
+
+	// LastSaveError is the error returned by the most recent save, or nil if
+	// it succeeded.
+	LastSaveError error
+
+	// Saves and SaveErrors are the number of successful and failed saves
+	// since the dump was created.
+	Saves      int
+	SaveErrors int
+
+	// EmergencySaves is the number of saves written to the emergency file
+	// because writing the dump file failed (see WithEmergencyFile()). They
+	// count as successful saves.
+	EmergencySaves int
+
+	// BytesWritten is the sum of DiskSize over every successful save.
+	BytesWritten int64
+
+	// Skipped is the number of items of unknown types dropped by the last
+	// load (see WithSkipUnknown()).
+	Skipped int
+}
+
+// Len returns the number of items in the dump.
+func (d *Dump) Len() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return len(d.items)
+}
+
+// Stats returns information about the dump for dashboards and capacity
+// planning.
+func (d *Dump) Stats() Stats {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	d.statsMutex.Lock()
+	defer d.statsMutex.Unlock()
+
+	stats := d.stats
+	stats.Items = len(d.items)
+	return stats
+}
+
+// publishMutex makes checking for a published variable and publishing one a
+// single step, since expvar.Publish() panics if the name is taken.
+var publishMutex sync.Mutex
+
+// Publish publishes the stats of the dump with the expvar package under the
+// provided name, so they are served by /debug/vars along with the other
+// variables of the program. It returns ErrPublished if a variable with the
+// same name was already published.
+func (d *Dump) Publish(name string) error {
+	publishMutex.Lock()
+	defer publishMutex.Unlock()
+
+	if expvar.Get(name) != nil {
+		return ErrPublished
+	}
+
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		stats := d.Stats()
+
+		var lastSave, lastSaveError interface{}
+		if !stats.LastSave.IsZero() {
+			lastSave = stats.LastSave.Format(time.RFC3339Nano)
+		}
+		if stats.LastSaveError != nil {
+			lastSaveError = stats.LastSaveError.Error()
+		}
+
+		return map[string]interface{}{
+			"items":           stats.Items,
+			"memory_size":     stats.MemorySize,
+			"disk_size":       stats.DiskSize,
+			"saves":           stats.Saves,
+			"save_errors":     stats.SaveErrors,
+			"bytes_written":   stats.BytesWritten,
+			"skipped":         stats.Skipped,
+			"last_save":       lastSave,
+			"last_save_error": lastSaveError,
+		}
+	}))
+	return nil
+}
+
+// saved records the outcome of a save.
+//
+// no mutex (only the stats are locked)
+func (d *Dump) saved(memory, disk int, err error) {
+	d.statsMutex.Lock()
+	d.stats.LastSaveError = err
+	if err == nil {
+		atomic.StoreInt64(&d.unsaved, 0)
+		d.stats.MemorySize = memory
+		d.stats.DiskSize = disk
+		d.stats.LastSave = time.Now()
+		d.stats.Saves++
+		d.stats.BytesWritten += int64(disk)
+	} else {
+		d.stats.SaveErrors++
+	}
+	d.statsMutex.Unlock()
+
+	d.afterSave(err)
+}
+
+// skipped records the number of items dropped by the last load.
+//
+// no mutex (only the stats are locked)
+func (d *Dump) skipped(n int) {
+	d.statsMutex.Lock()
+	defer d.statsMutex.Unlock()
+
+	d.stats.Skipped = n
+}
+
+// loaded records the sizes of a successfully loaded dump.
+//
+// no mutex (only the stats are locked)
+func (d *Dump) loaded(memory, disk int) {
+	d.statsMutex.Lock()
+	defer d.statsMutex.Unlock()
+
+	d.stats.MemorySize = memory
+	d.stats.DiskSize = disk
+}
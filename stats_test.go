@@ -0,0 +1,119 @@
+package dump
+
+import (
+	"encoding/json"
+	"expvar"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	test, _ := NewDump("stats.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+
+	if test.Len() != 0 || !test.Stats().LastSave.IsZero() {
+		t.Fatal("bad empty stats")
+	}
+
+	before := time.Now()
+	test.Add(&Blob{"one"})
+	test.Add(&Blob{"two"})
+
+	stats := test.Stats()
+	info, _ := os.Stat("stats.db")
+
+	if test.Len() != 2 || stats.Items != 2 {
+		t.Fatal("bad item count")
+	}
+
+	if stats.DiskSize != int(info.Size()) || stats.MemorySize != stats.DiskSize-headerSize {
+		t.Fatal("bad sizes", stats)
+	}
+
+	if stats.LastSave.Before(before) || stats.LastSaveError != nil {
+		t.Fatal("bad last save", stats)
+	}
+
+	if stats.Saves != 2 || stats.SaveErrors != 0 || stats.BytesWritten <= int64(stats.DiskSize) {
+		t.Fatal("bad save counters", stats)
+	}
+
+	if err := test.Publish("stats"); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.Publish("stats"); err != ErrPublished {
+		t.Fatal("published twice")
+	}
+
+	var published map[string]interface{}
+	if err := json.Unmarshal([]byte(expvar.Get("stats").String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	if published["items"] != 2.0 || published["saves"] != 2.0 || published["last_save_error"] != nil {
+		t.Fatal("bad published stats", published)
+	}
+
+	other, _ := NewDump("stats.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if other.Stats().DiskSize != stats.DiskSize || other.Stats().MemorySize != stats.MemorySize {
+		t.Fatal("bad sizes after load", other.Stats())
+	}
+
+	os.Mkdir("stats.db.dir", 0755)
+	defer os.Remove("stats.db.dir")
+
+	broken, _ := NewDump("stats.db.dir", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	if err := broken.Save(); err == nil || broken.Stats().LastSaveError != err {
+		t.Fatal("didn't record save error")
+	}
+	if broken.Stats().SaveErrors != 1 {
+		t.Fatal("didn't count save error")
+	}
+
+	log, err := OpenLogStore("stats.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("stats.log")
+	defer log.Close()
+
+	records, _ := New("stats.db", PERSIST_WRITES,
+		[]Type{{"dump.Blob", &Blob{}}}, WithRecordStore(log))
+	records.Add(&Blob{"one"})
+
+	if size := records.Stats().DiskSize; size == 0 {
+		t.Fatal("bad record size")
+	}
+
+	if err = records.Load(); err != nil || records.Stats().DiskSize == 0 {
+		t.Fatal("bad record size after load")
+	}
+}
+
+func TestPublishConcurrently(t *testing.T) {
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			test, _ := NewDump("stats.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+			done <- test.Publish("concurrent")
+		}()
+	}
+
+	published := 0
+	for i := 0; i < 8; i++ {
+		switch err := <-done; err {
+		case nil:
+			published++
+		case ErrPublished:
+		default:
+			t.Fatal(err)
+		}
+	}
+
+	if published != 1 {
+		t.Fatal("published", published, "times")
+	}
+}
@@ -0,0 +1,205 @@
+package dump
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Storage is where a dump persists its file (and backups). By default dumps
+// are stored on the local file system, WithStorage() can be used to persist
+// them somewhere else.
+//
+// Read should return an error satisfying os.IsNotExist() when the named file
+// doesn't exist.
+type Storage interface {
+	// Read returns the contents of the named file.
+	Read(name string) ([]byte, error)
+
+	// Write replaces the contents of the named file with data, creating it if
+	// it doesn't exist. data is reused once Write returns, so it mustn't be
+	// kept.
+	Write(name string, data []byte) error
+
+	// Rename renames the file oldname to newname, replacing newname if it
+	// already exists.
+	Rename(oldname, newname string) error
+}
+
+// Remover is implemented by storages that can remove files, which lets
+// WithScheduledBackups() prune old copies.
+type Remover interface {
+	// Remove removes the named file.
+	Remove(name string) error
+}
+
+// Linker is implemented by storages that can make hard links, which lets
+// WithBackups() keep the previous version of the dump file without copying
+// it.
+type Linker interface {
+	// Link makes newname a hard link to oldname, replacing newname if it
+	// already exists.
+	Link(oldname, newname string) error
+}
+
+// WithStorage is an option that persists the dump to s instead of the local
+// file system. The filename provided when creating the dump is used as the
+// name of the file within s.
+func WithStorage(s Storage) Option {
+	return func(d *Dump) error {
+		if s == nil {
+			return ErrInvalidStorage
+		}
+		d.storage = pathStorage{s}
+		return nil
+	}
+}
+
+// fileStorage is the default Storage, using the local file system.
+type fileStorage struct{}
+
+func (fileStorage) Read(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (fileStorage) Write(name string, data []byte) error {
+	return writeAtomic(name, func(file *os.File) error {
+		_, err := file.Write(data)
+		return err
+	})
+}
+
+func (fileStorage) Rename(oldname, newname string) error {
+	return rename(oldname, newname)
+}
+
+func (fileStorage) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (fileStorage) Link(oldname, newname string) error {
+	if err := os.Remove(newname); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Link(oldname, newname)
+}
+
+// writeAtomic replaces the named file with what write writes to a temporary
+// file next to it. The temporary file is synced before being renamed over
+// the named file, so a crash leaves either the old or the new version of it,
+// never a mix of both. Every write gets its own temporary file, so writes
+// racing each other don't mix either.
+func writeAtomic(name string, write func(file *os.File) error) error {
+	file, err := createTemp(name)
+	if err != nil {
+		return err
+	}
+	tmp := file.Name()
+
+	err = write(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	if e := file.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// createTemp creates a new temporary file next to the named file (creating
+// the directories of its path if they don't exist), to be renamed over it.
+func createTemp(name string) (*os.File, error) {
+	dir, pattern := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+
+	file, err := ioutil.TempFile(dir, pattern+".*.tmp")
+	if os.IsNotExist(err) {
+		if err = os.MkdirAll(dir, 0755); err == nil {
+			file, err = ioutil.TempFile(dir, pattern+".*.tmp")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// temporary files are only readable by their owner
+	if err = file.Chmod(0644); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// createFile opens the named file with the provided flags, creating it (and
+// the directories of its path) if it doesn't exist.
+func createFile(name string, flag int) (*os.File, error) {
+	file, err := os.OpenFile(name, flag|os.O_CREATE, 0644)
+	if os.IsNotExist(err) {
+		if err = os.MkdirAll(filepath.Dir(name), 0755); err == nil {
+			file, err = os.OpenFile(name, flag|os.O_CREATE, 0644)
+		}
+	}
+	return file, err
+}
+
+// pathStorage adds the name of the file to the errors returned by a Storage,
+// as an *os.PathError (or *os.LinkError for Rename()) unless they already are
+// one. Both wrap the error, so errors.Is() and os.IsNotExist() still match it.
+type pathStorage struct {
+	Storage
+}
+
+func (s pathStorage) Read(name string) ([]byte, error) {
+	data, err := s.Storage.Read(name)
+	return data, pathError("read", name, err)
+}
+
+func (s pathStorage) Write(name string, data []byte) error {
+	return pathError("write", name, s.Storage.Write(name, data))
+}
+
+func (s pathStorage) Rename(oldname, newname string) error {
+	err := s.Storage.Rename(oldname, newname)
+	switch err.(type) {
+	case nil, *os.LinkError, *os.PathError:
+		return err
+	}
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+}
+
+// remover returns the storage of the dump as a Remover, if it is one.
+func (d *Dump) remover() (Remover, bool) {
+	s := d.storage
+	if p, ok := s.(pathStorage); ok {
+		s = p.Storage
+	}
+	r, ok := s.(Remover)
+	return r, ok
+}
+
+// linker returns the storage of the dump as a Linker, if it is one.
+func (d *Dump) linker() (Linker, bool) {
+	s := d.storage
+	if p, ok := s.(pathStorage); ok {
+		s = p.Storage
+	}
+	l, ok := s.(Linker)
+	return l, ok
+}
+
+func pathError(op, name string, err error) error {
+	switch err.(type) {
+	case nil, *os.PathError:
+		return err
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
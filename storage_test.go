@@ -0,0 +1,163 @@
+package dump
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// memoryStorage is a Storage keeping files in a map.
+type memoryStorage struct {
+	files map[string][]byte
+	mutex sync.Mutex
+}
+
+func (m *memoryStorage) Read(name string) ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	}
+	return data, nil
+}
+
+func (m *memoryStorage) Write(name string, data []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.files[name] = append([]byte{}, data...)
+	return nil
+}
+
+func (m *memoryStorage) Rename(oldname, newname string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, ok := m.files[oldname]
+	if !ok {
+		return &os.PathError{Op: "rename", Path: oldname, Err: os.ErrNotExist}
+	}
+	delete(m.files, oldname)
+	m.files[newname] = data
+	return nil
+}
+
+func TestStorage(t *testing.T) {
+	if _, err := New("storage.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithStorage(nil)); err != ErrInvalidStorage {
+		t.Fatal("accepted nil storage")
+	}
+
+	storage := &memoryStorage{files: make(map[string][]byte)}
+
+	test, err := New("storage.db", PERSIST_WRITES,
+		[]Type{{"dump.Blob", &Blob{}}}, WithStorage(storage), WithBackups(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"one", "two"} {
+		if _, err = test.Add(&Blob{data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = os.Stat("storage.db"); !os.IsNotExist(err) {
+		t.Fatal("wrote to the file system")
+	}
+
+	if len(storage.files) != 2 {
+		t.Fatal("expected dump and one backup in storage")
+	}
+
+	other, _ := New("storage.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithStorage(storage))
+	if err = other.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	other.View(func(items []Item) error {
+		if len(items) != 2 {
+			t.Fatal("didn't load from storage")
+		}
+		return nil
+	})
+}
+
+func TestStorageErrors(t *testing.T) {
+	test, _ := New("storage.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}},
+		WithStorage(&failingStorage{memoryStorage{files: make(map[string][]byte)}}))
+	test.Add(&Blob{"one"})
+
+	err := test.Save()
+	if e, ok := err.(*os.PathError); !ok || e.Op != "write" || e.Path != "storage.db" {
+		t.Fatal("expected path error", err)
+	}
+
+	// errors that already have the path aren't wrapped again
+	if err = test.Load(); !os.IsNotExist(err) {
+		t.Fatal("expected not exist", err)
+	}
+	if e, ok := err.(*os.PathError); !ok || e.Op != "read" {
+		t.Fatal("expected storage's own path error", err)
+	}
+}
+
+func TestStorageDirectories(t *testing.T) {
+	defer os.RemoveAll("nested")
+
+	types := []Type{{"dump.Blob", &Blob{}}}
+	test, _ := New("nested/dump/storage.db", PERSIST_MANUAL, types)
+	test.Add(&Blob{"one"})
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is written in chunks when reporting the progress
+	progress, _ := New("nested/progress/storage.db", PERSIST_MANUAL, types, WithProgress(func(Progress) {}))
+	progress.Add(&Blob{"two"})
+	if err := progress.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := New("nested/dump/storage.db", PERSIST_MANUAL, types)
+	if err := other.Load(); err != nil || other.Len() != 1 {
+		t.Fatal("didn't load the dump", err)
+	}
+}
+
+func TestWriteAtomic(t *testing.T) {
+	defer os.Remove("atomic.db")
+
+	if err := (fileStorage{}).Write("atomic.db", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed write leaves the file as it was
+	failed := errors.New("failed")
+	err := writeAtomic("atomic.db", func(file *os.File) error {
+		file.Write([]byte("tw"))
+		return failed
+	})
+	if err != failed {
+		t.Fatal("expected the error of the write", err)
+	}
+	if data, _ := ioutil.ReadFile("atomic.db"); string(data) != "one" {
+		t.Fatal("changed the file", string(data))
+	}
+	if tmp, _ := filepath.Glob("atomic.db.*.tmp"); len(tmp) != 0 {
+		t.Fatal("left the temporary file behind", tmp)
+	}
+
+	if err = writeChunks("atomic.db", []byte("two"), func(int64) {}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile("atomic.db"); string(data) != "two" {
+		t.Fatal("didn't replace the file", string(data))
+	}
+}
@@ -0,0 +1,15 @@
+package dump
+
+// Storer is the part of Dump most code reading and writing items needs. Code
+// taking a Storer instead of a *Dump can be tested with the in-memory fake of
+// the dumptest package.
+type Storer interface {
+	Add(item Item) (int, error)
+	View(f func(items []Item) error) error
+	Update(f func(items []Item) error) error
+	Map(f func(item Item) error) error
+	Save() error
+	Load() error
+}
+
+var _ Storer = (*Dump)(nil)
@@ -0,0 +1,28 @@
+package dump
+
+import (
+	"os"
+	"testing"
+)
+
+func TestStorer(t *testing.T) {
+	defer os.Remove("storer.db")
+
+	var s Storer
+	s, _ = New("storer.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}})
+
+	s.Add(&Plain{"karl"})
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.View(func(items []Item) error {
+		if len(items) != 1 || items[0].(*Plain).Name != "karl" {
+			t.Fatal("bad items")
+		}
+		return nil
+	})
+}
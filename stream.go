@@ -0,0 +1,492 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// encodePayload writes the payload of a dump file to w: the file struct
+// followed by every item as a separate gob message (or as protobuf, see
+// WithProtobuf()). seg describes the segments the items were written to, if
+// they were. It returns the number of bytes written.
+//
+// no mutex
+func (d *Dump) encodePayload(w io.Writer, seg *segmented) (int, error) {
+	var (
+		counter = &countingWriter{w: w}
+		encoder = gob.NewEncoder(counter)
+		f       = d.file()
+		items   = f.Items
+	)
+
+	if len(d.collections) > 0 {
+		f.Collections = make(map[string]file, len(d.collections))
+		for name, c := range d.collections {
+			f.Collections[name] = c.file()
+		}
+	}
+
+	if seg != nil {
+		items, f.Segmented = nil, seg
+	}
+	f.Items, f.Count = nil, len(items)
+
+	if d.protobuf != nil {
+		return d.encodeProtobuf(w, f, items)
+	}
+
+	items, err := d.encodeItems(items)
+	if err != nil {
+		return 0, err
+	}
+	for name := range d.collections {
+		collection := f.Collections[name]
+		if collection.Items, err = d.encodeItems(collection.Items); err != nil {
+			return 0, err
+		}
+		f.Collections[name] = collection
+	}
+
+	if err := encoder.Encode(&f); err != nil {
+		// the items of the collections are encoded with the file
+		for _, c := range d.collections {
+			err = encodeError(err, c.items...)
+		}
+		return 0, err
+	}
+
+	for i := range items {
+		if err := encoder.Encode(&items[i]); err != nil {
+			return 0, encodeError(err, items[i])
+		}
+	}
+
+	return counter.n, nil
+}
+
+// streams reports whether the dump file can be encoded straight into the
+// file on the disk by writeStream(), rather than in memory first: the dump
+// has to be stored on the local file system, without a signature (which
+// covers the header, written last), a compression that can't stream, progress
+// reporting (which needs the size of the file up front) or AfterWrite hooks
+// (which need its contents).
+//
+// no mutex
+func (d *Dump) streams() bool {
+	if _, ok := d.storage.(fileStorage); !ok || d.signing != nil || d.progress != nil {
+		return false
+	}
+	if _, ok := d.compression.(streamCompression); d.compression != nil && !ok {
+		return false
+	}
+	for _, h := range d.hooks {
+		if h.AfterWrite != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// writeStream encodes the dump file into a temporary file next to it, one
+// item at a time, and renames it over the dump file once it is complete (see
+// promote()). It returns the size of the uncompressed payload and of the
+// file.
+//
+// no mutex
+func (d *Dump) writeStream(seg *segmented) (int, int, error) {
+	tmp := d.filename + ".tmp"
+
+	file, err := createFile(tmp, os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	memory, size, err := d.encodeTo(file, seg)
+	if err == nil {
+		err = file.Sync()
+	}
+	if e := file.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, 0, err
+	}
+
+	if err := d.promote(tmp); err != nil {
+		return 0, 0, err
+	}
+
+	atomic.StoreInt64(&d.fileSize, int64(size))
+	return memory, size, nil
+}
+
+// encodeTo writes the dump file to file. Room is left for the header, which
+// is written last, once the length and checksum of the payload are known. It
+// returns the size of the uncompressed payload and of the file.
+func (d *Dump) encodeTo(file *os.File, seg *segmented) (int, int, error) {
+	if _, err := file.Write(make([]byte, headerSize)); err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		h        = header{version: formatVersion}
+		buffered = bufio.NewWriter(file)
+		hash     = crc32.New(crc)
+		counter  = &countingWriter{w: io.MultiWriter(buffered, hash)}
+		memory   int
+		err      error
+	)
+
+	if c, ok := d.compression.(streamCompression); ok {
+		h.flags |= flagCompressed
+
+		var w io.WriteCloser
+		if w, err = c.writer(counter); err == nil {
+			if memory, err = d.encodePayload(w, seg); err == nil {
+				err = w.Close()
+			}
+		}
+	} else {
+		memory, err = d.encodePayload(counter, seg)
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if d.protobuf != nil {
+		h.flags |= flagProtobuf
+	}
+
+	data := make([]byte, headerSize)
+	writeHeader(h, data, uint64(counter.n), hash.Sum32())
+	if _, err := file.WriteAt(data, 0); err != nil {
+		return 0, 0, err
+	}
+
+	return memory, headerSize + counter.n, nil
+}
+
+// encodeError returns an *EncodeError naming the type of the first of items
+// that can't be encoded, or err if they all can (or err already names one).
+func encodeError(err error, items ...Item) error {
+	if _, ok := err.(*EncodeError); ok {
+		return err
+	}
+
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		if e := gob.NewEncoder(ioutil.Discard).Encode(&item); e != nil {
+			return &EncodeError{Type: fmt.Sprintf("%T", item), Err: e}
+		}
+	}
+	return err
+}
+
+// notRegistered returns whether err is a gob error about a type that wasn't
+// registered.
+func notRegistered(err error) bool {
+	return strings.Contains(err.Error(), "not registered")
+}
+
+// decodeError returns err as an *UnknownTypeError if it is about a type that
+// wasn't registered.
+func decodeError(err error) error {
+	if !notRegistered(err) {
+		return err
+	}
+
+	// gob quotes the name: name not registered for interface: "main.User"
+	name := err.Error()
+	name = name[strings.LastIndex(name, ": ")+2:]
+	if unquoted, e := strconv.Unquote(name); e == nil {
+		name = unquoted
+	}
+	return &UnknownTypeError{Types: []string{name}}
+}
+
+// dropItems removes the items with the provided ids, along with their
+// metadata.
+func dropItems(items []Item, metas []meta, ids map[int]bool) ([]Item, []meta) {
+	var (
+		kept     = items[:0]
+		keptMeta []meta
+	)
+
+	for id, item := range items {
+		if ids[id] {
+			continue
+		}
+		kept = append(kept, item)
+		if len(metas) == len(items) {
+			keptMeta = append(keptMeta, metas[id])
+		}
+	}
+
+	return kept, keptMeta
+}
+
+// decodeFrom replaces the items of the dump with the ones in the dump file
+// read from r, decoding the items one at a time as they are read when the
+// file is in the current format. It returns the size of the uncompressed
+// payload, and ErrCorrupt if the file is truncated or fails its checksum.
+//
+// no mutex
+func (d *Dump) decodeFrom(r io.Reader) (int, error) {
+	reader := bufio.NewReader(r)
+
+	data, _ := reader.Peek(headerSize)
+	if !bytes.HasPrefix(data, magic) {
+		return d.decodeAll(reader)
+	}
+
+	h, length, sum, err := parseHeader(data)
+	if err != nil {
+		return 0, err
+	}
+	if h.version < formatVersion {
+		return d.decodeAll(reader)
+	}
+	if h.flags&flagCompressed != 0 && d.compression == nil {
+		return 0, ErrCompressed
+	}
+	if h.flags&flagProtobuf != 0 && d.protobuf == nil {
+		return 0, ErrProtobuf
+	}
+	if d.signing != nil && h.flags&flagSigned == 0 {
+		return 0, ErrBadSignature
+	}
+
+	mac := d.signer(data)
+	reader.Discard(headerSize)
+
+	var (
+		hash    = crc32.New(crc)
+		limited = &countingReader{r: io.LimitReader(reader, int64(length))}
+		hashed  = io.Writer(hash)
+	)
+	if mac != nil {
+		hashed = io.MultiWriter(hash, mac)
+	}
+	payload := io.TeeReader(limited, hashed)
+
+	f, memory, err := d.decodePayload(h, payload)
+
+	// the checksum can only be verified once the whole payload was read, and
+	// a corrupt payload is likely to fail decoding first
+	io.Copy(ioutil.Discard, payload)
+	if uint64(limited.n) != length || hash.Sum32() != sum {
+		return 0, ErrCorrupt
+	}
+	if mac != nil {
+		signature := make([]byte, signatureSize)
+		if _, e := io.ReadFull(reader, signature); e != nil {
+			return 0, ErrCorrupt
+		}
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return 0, ErrBadSignature
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err = d.decodeFile(f); err != nil {
+		return 0, err
+	}
+	d.skipped(f.skipped)
+
+	return memory, d.loadCollections(f.Collections)
+}
+
+// decodeAll reads all of r and decodes it as a whole, for files in the
+// legacy or a previous format.
+//
+// no mutex
+func (d *Dump) decodeAll(r io.Reader) (int, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	return d.decode(data)
+}
+
+// decodePayload decodes the file struct and the items following it from the
+// payload of a dump file. It returns the size of the uncompressed payload.
+func (d *Dump) decodePayload(h header, payload io.Reader) (file, int, error) {
+	var f file
+
+	if h.flags&flagCompressed != 0 {
+		var err error
+		if payload, err = d.decompressor(payload); err != nil {
+			return f, 0, err
+		}
+	}
+
+	counter := &countingReader{r: payload}
+	if h.flags&flagProtobuf != 0 {
+		f, err := d.decodeProtobuf(counter)
+		return f, counter.n, err
+	}
+
+	decoder := gob.NewDecoder(counter)
+
+	if err := decoder.Decode(&f); err != nil {
+		return f, 0, decodeError(err)
+	}
+
+	// each item is a message of its own, so decoding can go on after an
+	// item of an unknown type to find every unknown type (or skip them)
+	var (
+		unknown *UnknownTypeError
+		skipped = make(map[int]bool)
+	)
+
+	// the count is read before the checksum can be verified, so a corrupt
+	// count only fails decoding rather than allocating that many items
+	f.Items = make([]Item, 0, preallocated(f.Count))
+	for i := 0; i < f.Count; i++ {
+		var item Item
+		err := decoder.Decode(&item)
+		if err != nil && skipped[i-1] {
+			// gob leaves part of the first item of each unknown type
+			// (which carries the type's definition) to be read next
+			if _, ok := decodeError(err).(*UnknownTypeError); !ok {
+				err = decoder.Decode(&item)
+			}
+		}
+		f.Items = append(f.Items, item)
+
+		if err != nil {
+			e, ok := decodeError(err).(*UnknownTypeError)
+			if !ok {
+				return f, 0, err
+			}
+			if unknown == nil {
+				unknown = e
+			} else {
+				unknown.add(e.Types[0])
+			}
+			skipped[i] = true
+		}
+	}
+
+	if unknown != nil && !d.skipUnknown {
+		return f, 0, unknown
+	}
+
+	if len(skipped) > 0 {
+		f.Items, f.Meta = dropItems(f.Items, f.Meta, skipped)
+		f.skipped = len(skipped)
+	}
+
+	return f, counter.n, nil
+}
+
+// maxPreallocated is the largest number of items allocated up front when
+// decoding a dump file.
+const maxPreallocated = 1 << 16
+
+// preallocated returns how many of count items to allocate up front.
+func preallocated(count int) int {
+	if count < 0 {
+		return 0
+	}
+	if count > maxPreallocated {
+		return maxPreallocated
+	}
+	return count
+}
+
+// decompressor returns a reader decompressing r, which is streamed if the
+// compression of the dump supports it.
+func (d *Dump) decompressor(r io.Reader) (io.Reader, error) {
+	if c, ok := d.compression.(streamCompression); ok {
+		return c.reader(r)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = d.compression.Decompress(data); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// openFile opens the named file of the dump for reading, and returns its
+// size. Files on the local file system are streamed, other storages read the
+// whole file first.
+//
+// no mutex
+func (d *Dump) openFile(name string) (io.ReadCloser, int64, error) {
+	if _, ok := d.storage.(fileStorage); !ok {
+		data, err := d.storage.Read(name)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		size := int64(len(data))
+		if d.progress != nil {
+			d.progress(Progress{Op: "load", Bytes: size, TotalBytes: size})
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), size, nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+
+	if d.progress == nil {
+		return file, info.Size(), nil
+	}
+
+	return &progressReader{file: file, total: info.Size(), progress: d.progress}, info.Size(), nil
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
@@ -0,0 +1,115 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+)
+
+// reversed is a Compression that doesn't support streams.
+type reversed struct{}
+
+func (reversed) Compress(data []byte) ([]byte, error) {
+	out := make([]byte, len(data))
+	for i := range data {
+		out[len(data)-1-i] = data[i]
+	}
+	return out, nil
+}
+
+func (r reversed) Decompress(data []byte) ([]byte, error) {
+	return r.Compress(data)
+}
+
+func TestStream(t *testing.T) {
+	defer os.Remove("stream.db")
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	for _, c := range []Compression{nil, Gzip, reversed{}} {
+		var options []Option
+		if c != nil {
+			options = append(options, WithCompression(c))
+		}
+
+		test, _ := New("stream.db", PERSIST_MANUAL, types, options...)
+		for i := 0; i < 1000; i++ {
+			test.Add(&Plain{"item"})
+		}
+		test.Set(999, &Plain{"last"})
+
+		if err := test.Save(); err != nil {
+			t.Fatal(err)
+		}
+
+		other, _ := New("stream.db", PERSIST_MANUAL, types, options...)
+		if err := other.Load(); err != nil {
+			t.Fatal(err)
+		}
+
+		if item, _ := other.Get(999); other.Len() != 1000 || item.(*Plain).Name != "last" {
+			t.Fatal("bad load", c)
+		}
+		if other.Stats().MemorySize != test.Stats().MemorySize {
+			t.Fatal("bad memory size", other.Stats(), test.Stats())
+		}
+	}
+}
+
+func TestStreamVersion1(t *testing.T) {
+	defer os.Remove("stream.db")
+
+	var buffer bytes.Buffer
+	f := file{Items: []Item{&Plain{"a"}, &Plain{"b"}}, NextID: 2}
+	gob.NewEncoder(&buffer).Encode(&f)
+	ioutil.WriteFile("stream.db", encodeFile(header{version: 1}, buffer.Bytes()), 0644)
+
+	test, _ := NewDump("stream.db", PERSIST_MANUAL, Type{"dump.Plain", &Plain{}})
+	if err := test.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := test.Get(1); test.Len() != 2 || item.(*Plain).Name != "b" {
+		t.Fatal("bad version 1 load")
+	}
+}
+
+func TestStreamCorruptCount(t *testing.T) {
+	defer os.Remove("stream.db")
+
+	var buffer bytes.Buffer
+	gob.NewEncoder(&buffer).Encode(&file{Count: math.MaxInt32})
+	data := encodeFile(header{version: formatVersion}, buffer.Bytes())
+	data[headerSize-1]++
+	ioutil.WriteFile("stream.db", data, 0644)
+
+	test, _ := NewDump("stream.db", PERSIST_MANUAL, Type{"dump.Plain", &Plain{}})
+	if err := test.Load(); err != ErrCorrupt {
+		t.Fatal("expected ErrCorrupt", err)
+	}
+}
+
+func TestStreamWrite(t *testing.T) {
+	defer os.Remove("stream.db")
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+	test, _ := New("stream.db", PERSIST_MANUAL, types)
+	if !test.streams() {
+		t.Fatal("didn't stream the dump file")
+	}
+	test.AddAll(&Plain{"a"}, &Plain{"b"})
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer, _, _ := test.encode(nil)
+	defer putBuffer(buffer)
+	if data, _ := ioutil.ReadFile("stream.db"); !bytes.Equal(data, buffer.Bytes()) {
+		t.Fatal("streamed file differs from the encoded one")
+	}
+	if _, err := os.Stat("stream.db.tmp"); !os.IsNotExist(err) {
+		t.Fatal("left the temporary file", err)
+	}
+}
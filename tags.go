@@ -0,0 +1,246 @@
+package dump
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WithTagValidation is an option that validates the items of every type of
+// the dump against the constraints declared in the "validate" tag of their
+// exported fields, as a validator registered with WithValidator() would:
+//
+//	type User struct {
+//		Name  string `validate:"required,max=64"`
+//		Age   int    `validate:"min=0,max=150"`
+//		Email string `validate:"pattern=^[^@]+@[^@]+$"`
+//	}
+//
+// The constraints are separated by commas:
+//
+//	required   the field isn't the zero value of its type
+//	min=N      numbers are at least N, and strings, slices and maps have at
+//	           least N elements (runes for strings)
+//	max=N      numbers are at most N, and strings, slices and maps have at
+//	           most N elements
+//	pattern=RE strings match the regular expression RE, which takes the rest
+//	           of the tag (so it must come last, and may contain commas)
+//
+// Every field of an item is checked, and an item breaking any constraint is
+// rejected with a *ValidationError listing all of them. Only the fields of
+// the item itself are checked, not the fields of the structs it holds. New()
+// returns ErrInvalidTag if a tag can't be parsed.
+func WithTagValidation() Option {
+	return func(d *Dump) error {
+		for _, t := range d.types {
+			typ := reflect.TypeOf(t.Value)
+			if typ.Kind() == reflect.Ptr {
+				typ = typ.Elem()
+			}
+
+			rules, err := parseRules(typ)
+			if err != nil {
+				return err
+			}
+			if len(rules) == 0 {
+				continue
+			}
+
+			if d.validators == nil {
+				d.validators = make(map[reflect.Type][]func(Item) error)
+			}
+			validate := rules.validate
+			for _, v := range []reflect.Type{typ, reflect.PtrTo(typ)} {
+				d.validators[v] = append(d.validators[v], validate)
+			}
+		}
+		return nil
+	}
+}
+
+// ValidationError is returned when an item breaks constraints declared in
+// the tags of its fields (see WithTagValidation()).
+type ValidationError struct {
+	// Type is the type of the item, such as "*main.User".
+	Type string
+
+	// Fields are the constraints the item breaks, in the order of its
+	// fields.
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.Error()
+	}
+	return fmt.Sprintf("invalid %s: %s", e.Type, strings.Join(fields, "; "))
+}
+
+// FieldError is a constraint a field of an item breaks.
+type FieldError struct {
+	// Field is the name of the field.
+	Field string
+
+	// Rule is the constraint as declared in the tag, such as "max=64".
+	Rule string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " breaks " + e.Rule
+}
+
+// rule is a constraint on a field.
+type rule struct {
+	field   int
+	name    string
+	text    string
+	limit   float64
+	pattern *regexp.Regexp
+}
+
+type rules []rule
+
+// parseRules returns the constraints declared in the tags of the fields of
+// typ (if it's a struct).
+func parseRules(typ reflect.Type) (rules, error) {
+	if typ.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	var parsed rules
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok || field.PkgPath != "" {
+			continue
+		}
+
+		for tag != "" {
+			var text string
+			if strings.HasPrefix(tag, "pattern=") {
+				text, tag = tag, ""
+			} else if comma := strings.IndexByte(tag, ','); comma >= 0 {
+				text, tag = tag[:comma], tag[comma+1:]
+			} else {
+				text, tag = tag, ""
+			}
+
+			r, err := parseRule(field, text)
+			if err != nil {
+				return nil, fmt.Errorf("%v.%s: %w", typ, field.Name, err)
+			}
+			r.field = i
+			parsed = append(parsed, r)
+		}
+	}
+
+	return parsed, nil
+}
+
+// parseRule parses a constraint on field.
+func parseRule(field reflect.StructField, text string) (rule, error) {
+	var (
+		r          = rule{text: text}
+		name, arg  = text, ""
+		kind       = field.Type.Kind()
+		lengthKind = kind == reflect.String || kind == reflect.Slice ||
+			kind == reflect.Map || kind == reflect.Array
+	)
+
+	if eq := strings.IndexByte(text, '='); eq >= 0 {
+		name, arg = text[:eq], text[eq+1:]
+	}
+	r.name = name
+
+	var err error
+	switch name {
+	case "required":
+		if arg != "" {
+			return r, ErrInvalidTag
+		}
+	case "min", "max":
+		if !lengthKind && !numeric(kind) {
+			return r, ErrInvalidTag
+		}
+		if r.limit, err = strconv.ParseFloat(arg, 64); err != nil {
+			return r, ErrInvalidTag
+		}
+	case "pattern":
+		if kind != reflect.String {
+			return r, ErrInvalidTag
+		}
+		if r.pattern, err = regexp.Compile(arg); err != nil {
+			return r, ErrInvalidTag
+		}
+	default:
+		return r, ErrInvalidTag
+	}
+
+	return r, nil
+}
+
+// validate returns a *ValidationError listing the constraints item breaks.
+func (rs rules) validate(item Item) error {
+	v := reflect.ValueOf(item)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	var e *ValidationError
+	for _, r := range rs {
+		field := v.Field(r.field)
+		if r.check(field) {
+			continue
+		}
+
+		if e == nil {
+			e = &ValidationError{Type: fmt.Sprintf("%T", item)}
+		}
+		e.Fields = append(e.Fields, FieldError{Field: v.Type().Field(r.field).Name, Rule: r.text})
+	}
+
+	if e == nil {
+		return nil
+	}
+	return e
+}
+
+// check reports whether the value of a field meets the constraint.
+func (r rule) check(v reflect.Value) bool {
+	switch r.name {
+	case "required":
+		return !v.IsZero()
+	case "pattern":
+		return r.pattern.MatchString(v.String())
+	}
+
+	var n float64
+	switch kind := v.Kind(); {
+	case kind == reflect.String:
+		n = float64(len([]rune(v.String())))
+	case kind == reflect.Slice || kind == reflect.Map || kind == reflect.Array:
+		n = float64(v.Len())
+	case kind >= reflect.Int && kind <= reflect.Int64:
+		n = float64(v.Int())
+	case kind >= reflect.Uint && kind <= reflect.Uintptr:
+		n = float64(v.Uint())
+	default:
+		n = v.Float()
+	}
+
+	if r.name == "min" {
+		return n >= r.limit
+	}
+	return n <= r.limit
+}
+
+// numeric reports whether values of kind are numbers.
+func numeric(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
@@ -0,0 +1,63 @@
+package dump
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type Member struct {
+	Name  string   `validate:"required,max=8"`
+	Age   int      `validate:"min=0,max=150"`
+	Email string   `validate:"pattern=^[^@,]+@[^@,]+$"`
+	Tags  []string `validate:"max=2"`
+}
+
+type Typo struct {
+	Name string `validate:"requird"`
+}
+
+func TestTagValidation(t *testing.T) {
+	if _, err := New("typo.db", PERSIST_MANUAL,
+		[]Type{{"dump.Typo", &Typo{}}}, WithTagValidation()); !errors.Is(err, ErrInvalidTag) {
+		t.Fatalf("expected ErrInvalidTag, got %v", err)
+	}
+
+	test, err := New("tags.db", PERSIST_MANUAL,
+		[]Type{{"dump.Member", &Member{}}}, WithTagValidation())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = test.Add(&Member{Name: "karl", Age: 30, Email: "karl@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = test.Add(&Member{Age: -1, Email: "karl", Tags: []string{"a", "b", "c"}})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a *ValidationError, got %v", err)
+	}
+	if invalid.Type != "*dump.Member" {
+		t.Fatalf("bad type %s", invalid.Type)
+	}
+	expected := []FieldError{
+		{Field: "Name", Rule: "required"},
+		{Field: "Age", Rule: "min=0"},
+		{Field: "Email", Rule: "pattern=^[^@,]+@[^@,]+$"},
+		{Field: "Tags", Rule: "max=2"},
+	}
+	if !reflect.DeepEqual(invalid.Fields, expected) {
+		t.Fatalf("bad fields %v", invalid.Fields)
+	}
+
+	if err = test.UpdateAt(0, func(item Item) error {
+		item.(*Member).Name = "karlmcguire"
+		return nil
+	}); !errors.As(err, &invalid) || invalid.Fields[0].Rule != "max=8" {
+		t.Fatalf("expected max=8 to be broken, got %v", err)
+	}
+	if item, _ := test.Get(0); item.(*Member).Name != "karl" {
+		t.Fatal("applied an invalid change")
+	}
+}
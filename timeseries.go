@@ -0,0 +1,269 @@
+package dump
+
+import (
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"time"
+)
+
+// WithTimeSeries is an option for dumps of items carrying a timestamp, such
+// as events or measurements. The items are kept in time order (like
+// WithOrder() does), so Range() finds the items of a time range without
+// going over the others, and they are saved in one chunk file per time
+// window (such as events.db.t1700000000000000000.3f2a9c1e, named after the
+// start of the window and the checksum of the chunk) next to the dump file.
+//
+// Saving only writes the chunks that changed since the last save, which for
+// items appended in time order is the chunk of the latest window. Chunks of
+// windows that ended are compressed if WithCompression() is enabled, and
+// the chunk of the current window isn't, so appending stays cheap. If
+// retention isn't 0, the items of the windows that ended more than
+// retention ago are removed whenever items are added.
+//
+// The dump file is written after the chunks, and chunks are never
+// overwritten (a changed chunk has a new name), so a crash while saving
+// leaves the previous version of the dump intact. Chunks that are no longer
+// used are removed if the storage implements Remover. It can't be combined
+// with WithSegments(), WithRecordStore() or WithBackups().
+func WithTimeSeries(timestamp func(item Item) time.Time, window, retention time.Duration) Option {
+	return func(d *Dump) error {
+		if timestamp == nil || window <= 0 || retention < 0 {
+			return ErrInvalidTimeSeries
+		}
+
+		d.series = &series{timestamp: timestamp, window: window, retention: retention}
+		d.order = func(a, b Item) bool {
+			return timestamp(a).Before(timestamp(b))
+		}
+		return nil
+	}
+}
+
+// series holds the settings of a dump created with WithTimeSeries().
+type series struct {
+	timestamp func(item Item) time.Time
+	window    time.Duration
+	retention time.Duration
+
+	// chunks are the chunk files as of the last save, by the start of their
+	// window
+	chunks map[int64]chunk
+}
+
+// start returns the start of the window of item, in Unix nanoseconds.
+func (s *series) start(item Item) int64 {
+	return s.timestamp(item).Truncate(s.window).UnixNano()
+}
+
+// chunk describes a chunk file, which holds the items of a time window.
+type chunk struct {
+	// Start is the start of the window, in Unix nanoseconds.
+	Start int64
+
+	// Count is the number of items in the chunk.
+	Count int
+
+	// Sum is the checksum of the chunk file.
+	Sum uint32
+
+	// from is the id of the first item of the chunk, and closed whether the
+	// window had ended when the chunk was written; gob ignores unexported
+	// fields
+	from   int
+	closed bool
+}
+
+// Range calls f with the id and item of every item with a timestamp from
+// from up to (but not including) to, in time order, under a single read
+// lock. It returns ErrNoTimeSeries if the dump wasn't created with
+// WithTimeSeries(), and the first error returned by f (which stops the
+// range).
+func (d *Dump) Range(from, to time.Time, f func(id int, item Item) error) error {
+	if d.series == nil {
+		return ErrNoTimeSeries
+	}
+
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	timestamp := d.series.timestamp
+	start := sort.Search(len(d.items), func(id int) bool {
+		return !timestamp(d.items[id]).Before(from)
+	})
+
+	for id := start; id < len(d.items) && timestamp(d.items[id]).Before(to); id++ {
+		if err := f(id, d.items[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkName returns the filename of a chunk.
+func (d *Dump) chunkName(c chunk) string {
+	return fmt.Sprintf("%s.t%d.%08x", d.filename, c.Start, c.Sum)
+}
+
+// writeChunks writes the chunks that changed since the last save, and
+// returns the chunks holding the items.
+//
+// no mutex (the slot has to be locked)
+func (d *Dump) writeChunks() (*segmented, error) {
+	d.recordMutex.Lock()
+	clean := d.clean
+	d.recordMutex.Unlock()
+
+	var (
+		seg = &segmented{Chunks: make([]chunk, 0)}
+		now = time.Now().UnixNano()
+	)
+
+	for from := 0; from < len(d.items); {
+		start := d.series.start(d.items[from])
+		to := from + 1
+		for to < len(d.items) && d.series.start(d.items[to]) == start {
+			to++
+		}
+
+		c := chunk{
+			Start:  start,
+			Count:  to - from,
+			from:   from,
+			closed: start+int64(d.series.window) <= now,
+		}
+
+		// unchanged chunks are only written again to be compressed
+		prev, ok := d.series.chunks[start]
+		if ok && to <= clean && prev.from == from && prev.Count == c.Count &&
+			(prev.closed || !c.closed) {
+			seg.Chunks = append(seg.Chunks, prev)
+			from = to
+			continue
+		}
+
+		data, err := d.packChunk(d.items[from:to], c.closed)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Sum = crc32.Checksum(data, crc)
+		if !ok || d.chunkName(prev) != d.chunkName(c) {
+			if err := d.storage.Write(d.chunkName(c), data); err != nil {
+				return nil, err
+			}
+		}
+
+		seg.Chunks = append(seg.Chunks, c)
+		from = to
+	}
+
+	return seg, nil
+}
+
+// packChunk encodes items as a chunk file, compressed if closed is true and
+// WithCompression() is enabled.
+func (d *Dump) packChunk(items []Item, closed bool) ([]byte, error) {
+	buffer := getBuffer(0)
+	defer putBuffer(buffer)
+
+	encoded, err := d.encodeItems(items)
+	if err != nil {
+		return nil, err
+	}
+	if err := gob.NewEncoder(buffer).Encode(&encoded); err != nil {
+		return nil, encodeError(err, items...)
+	}
+	if closed {
+		return d.pack(buffer.Bytes())
+	}
+	return d.seal(header{version: formatVersion}, buffer.Bytes()), nil
+}
+
+// wroteChunks records the chunks written by a save once the dump file
+// refers to them, and removes the chunk files it no longer refers to.
+//
+// no mutex (the slot has to be locked)
+func (d *Dump) wroteChunks(seg *segmented) {
+	chunks := make(map[int64]chunk, len(seg.Chunks))
+	used := make(map[string]bool, len(seg.Chunks))
+	for _, c := range seg.Chunks {
+		chunks[c.Start] = c
+		used[d.chunkName(c)] = true
+	}
+
+	if r, ok := d.remover(); ok {
+		for _, c := range d.series.chunks {
+			if name := d.chunkName(c); !used[name] {
+				r.Remove(name)
+			}
+		}
+	}
+
+	d.series.chunks = chunks
+
+	d.recordMutex.Lock()
+	d.clean = len(d.items)
+	d.recordMutex.Unlock()
+}
+
+// readChunks reads the chunks and decodes their items. It returns ErrCorrupt
+// if a chunk doesn't match its checksum.
+//
+// no mutex
+func (d *Dump) readChunks(chunks []chunk) ([]Item, error) {
+	var (
+		items   = make([]Item, 0)
+		written = make(map[int64]chunk, len(chunks))
+	)
+
+	for _, c := range chunks {
+		data, err := d.storage.Read(d.chunkName(c))
+		if err != nil {
+			return nil, err
+		}
+		if crc32.Checksum(data, crc) != c.Sum {
+			return nil, ErrCorrupt
+		}
+
+		decoded, err := d.decodeSegment(data)
+		if err != nil {
+			return nil, err
+		}
+
+		// whether the chunk is compressed isn't known, so it's written again
+		// once it's closed
+		c.from = len(items)
+		written[c.Start] = c
+		items = append(items, decoded...)
+	}
+
+	if d.series != nil {
+		d.series.chunks = written
+	}
+	return items, nil
+}
+
+// prune removes the items of the windows that ended more than the retention
+// ago, and returns the number of items removed.
+//
+// no mutex
+func (d *Dump) prune() int {
+	if d.series == nil || d.series.retention == 0 {
+		return 0
+	}
+
+	// the windows starting before the one that ended retention ago
+	cutoff := time.Now().Add(-d.series.retention - d.series.window).
+		Truncate(d.series.window).Add(d.series.window)
+	expired := sort.Search(len(d.items), func(id int) bool {
+		return !d.series.timestamp(d.items[id]).Before(cutoff)
+	})
+	if expired == 0 {
+		return 0
+	}
+	// windows that can't be removed yet are pruned the next time
+	removed, _ := d.remove(func(id int) bool { return id < expired })
+	return removed
+}
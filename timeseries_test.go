@@ -0,0 +1,109 @@
+package dump
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type Reading struct {
+	At    time.Time
+	Value int
+}
+
+func TestTimeSeries(t *testing.T) {
+	types := []Type{{"dump.Reading", &Reading{}}}
+	at := func(item Item) time.Time { return item.(*Reading).At }
+
+	if _, err := New("series.db", PERSIST_MANUAL, types, WithTimeSeries(nil, time.Hour, 0)); err != ErrInvalidTimeSeries {
+		t.Fatal("accepted a nil timestamp")
+	}
+	if _, err := New("series.db", PERSIST_MANUAL, types, WithTimeSeries(at, time.Hour, 0), WithSegments(2)); err != ErrInvalidTimeSeries {
+		t.Fatal("accepted segments")
+	}
+	plain, _ := New("series.db", PERSIST_MANUAL, types)
+	if err := plain.Range(time.Time{}, time.Now(), nil); err != ErrNoTimeSeries {
+		t.Fatal("ranged over a dump that isn't a time series")
+	}
+
+	defer func() {
+		names, _ := filepath.Glob("series.db*")
+		for _, name := range names {
+			os.Remove(name)
+		}
+	}()
+
+	hour := time.Now().Truncate(time.Hour)
+	options := []Option{WithTimeSeries(at, time.Hour, 0), WithCompression(GzipLevel(1))}
+	test, err := New("series.db", PERSIST_MANUAL, types, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// added out of order, in three windows
+	test.AddAll(
+		&Reading{hour.Add(-90 * time.Minute), 1},
+		&Reading{hour.Add(time.Minute), 3},
+		&Reading{hour.Add(-3 * time.Hour), 0},
+		&Reading{hour.Add(-80 * time.Minute), 2},
+	)
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := func() int {
+		names, _ := filepath.Glob("series.db.t*")
+		return len(names)
+	}
+	if n := chunks(); n != 3 {
+		t.Fatal("bad number of chunks", n)
+	}
+
+	values := func(d *Dump, from, to time.Time) []int {
+		var v []int
+		err := d.Range(from, to, func(id int, item Item) error {
+			v = append(v, item.(*Reading).Value)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	if v := values(test, hour.Add(-2*time.Hour), hour.Add(time.Minute)); len(v) != 2 || v[0] != 1 || v[1] != 2 {
+		t.Fatal("bad range", v)
+	}
+
+	// appending to the current window only replaces its chunk
+	old := test.series.chunks[hour.Add(-2*time.Hour).UnixNano()]
+	test.Add(&Reading{hour.Add(2 * time.Minute), 4})
+	if err := test.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if n := chunks(); n != 3 {
+		t.Fatal("the replaced chunk wasn't removed", n)
+	}
+	if c := test.series.chunks[hour.Add(-2*time.Hour).UnixNano()]; c.Sum != old.Sum {
+		t.Fatal("an unchanged chunk was written again")
+	}
+
+	other, _ := New("series.db", PERSIST_MANUAL, types, options...)
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if v := values(other, time.Time{}, hour.Add(time.Hour)); len(v) != 5 || v[0] != 0 || v[4] != 4 {
+		t.Fatal("bad items after loading", v)
+	}
+
+	// items of windows that ended more than the retention ago are removed
+	retained, _ := New("series.db", PERSIST_MANUAL, types,
+		WithTimeSeries(at, time.Hour, time.Hour), WithCompression(GzipLevel(1)))
+	if err := retained.Load(); err != nil {
+		t.Fatal(err)
+	}
+	retained.Add(&Reading{hour.Add(3 * time.Minute), 5})
+	if v := values(retained, time.Time{}, hour.Add(time.Hour)); len(v) != 3 || v[0] != 3 {
+		t.Fatal("bad retention", v)
+	}
+}
@@ -0,0 +1,46 @@
+package dump
+
+// Tracer starts a Span for every traced operation of a dump (Add(), AddAll(),
+// Get(), Set(), Remove(), UpdateAt(), Update(), Map(), View(), Save() and
+// Load()). It can be implemented on top of any tracing library, such as
+// OpenTelemetry. Operations don't take a context, so it is up to the Tracer
+// to decide what the parent of a span is, if any.
+type Tracer interface {
+	// Start is called with the name of the operation (such as "Save") before
+	// the dump is locked.
+	Start(operation string) Span
+}
+
+// Span is a single traced operation.
+type Span interface {
+	// Locked is called once the operation has acquired the lock of the dump,
+	// so the time spent waiting for it (for example while another goroutine
+	// is saving) can be told apart from the time spent holding it.
+	Locked()
+
+	// End is called when the operation returns, with the error it returned.
+	End(err error)
+}
+
+// WithTracer is an option that traces the operations of the dump with t.
+func WithTracer(t Tracer) Option {
+	return func(d *Dump) error {
+		d.tracer = t
+		return nil
+	}
+}
+
+// noSpan is the Span of operations of dumps without a Tracer.
+type noSpan struct{}
+
+func (noSpan) Locked()       {}
+func (noSpan) End(err error) {}
+
+// trace starts a span for the operation, or returns noSpan if the dump has no
+// Tracer.
+func (d *Dump) trace(operation string) Span {
+	if d.tracer == nil {
+		return noSpan{}
+	}
+	return d.tracer.Start(operation)
+}
@@ -0,0 +1,60 @@
+package dump
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordedSpan struct {
+	operation string
+	locked    bool
+	err       error
+}
+
+type recordingTracer struct {
+	mutex sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(operation string) Span {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	span := &recordedSpan{operation: operation}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func (s *recordedSpan) Locked()       { s.locked = true }
+func (s *recordedSpan) End(err error) { s.err = err }
+
+func TestTracer(t *testing.T) {
+	defer os.Remove("tracing.db")
+
+	tracer := &recordingTracer{}
+	test, _ := New("tracing.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}},
+		WithTracer(tracer))
+
+	test.Add(&Plain{"a"})
+	test.Get(0)
+	test.Get(1)
+	test.View(func(items []Item) error { return nil })
+	test.Save()
+
+	var operations []string
+	for _, span := range tracer.spans {
+		operations = append(operations, span.operation)
+		if !span.locked {
+			t.Fatal("span wasn't locked", span.operation)
+		}
+	}
+	if strings.Join(operations, ",") != "Add,Get,Get,View,Save" {
+		t.Fatal("unexpected spans", operations)
+	}
+
+	if tracer.spans[1].err != nil || tracer.spans[2].err != ErrNotFound {
+		t.Fatal("expected the error of Get")
+	}
+}
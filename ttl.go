@@ -0,0 +1,158 @@
+package dump
+
+import (
+	"time"
+)
+
+// WithTTL is an option that makes items expire ttl after they are added (if
+// ttl isn't 0; the expiry of each item can also be set with ExpireAt()). It
+// can't be combined with WithMaxAge() (New() returns ErrInvalidRetention).
+// Expired items are removed from the dump before it is read, so View(),
+// Get(), MarshalJSON() and the other ways of reading the dump never see them,
+// and by a background sweeper running every sweep (if sweep isn't 0) until
+// the dump is closed. Like DeleteWhere(), removing expired items shifts the
+// ids of the items after them, and the dump is saved if PERSIST_WRITES is
+// enabled.
+func WithTTL(ttl, sweep time.Duration) Option {
+	return func(d *Dump) error {
+		if ttl < 0 || sweep < 0 {
+			return ErrInvalidTTL
+		}
+
+		d.ttl = &expiry{ttl: ttl, sweep: sweep}
+		return nil
+	}
+}
+
+// expiry holds the expiry settings of a dump created with WithTTL().
+type expiry struct {
+	ttl   time.Duration
+	sweep time.Duration
+
+	// next is the earliest time an item may expire at, in Unix nanoseconds,
+	// or 0 if no item expires
+	next int64
+}
+
+// expires returns the expiry of an item added now.
+func (t *expiry) expires() int64 {
+	if t.ttl == 0 {
+		return 0
+	}
+	return time.Now().Add(t.ttl).UnixNano()
+}
+
+// schedule makes sure the dump is swept once an item expiring at expires
+// expired.
+func (t *expiry) schedule(expires int64) {
+	if expires != 0 && (t.next == 0 || expires < t.next) {
+		t.next = expires
+	}
+}
+
+// due reports whether items may have expired.
+func (t *expiry) due() bool {
+	return t.next != 0 && time.Now().UnixNano() >= t.next
+}
+
+// ExpireAt sets when the item with the provided id expires, or makes it never
+// expire if t is the zero time. It returns ErrNoTTL if the dump wasn't created
+// with WithTTL(), ErrNotFound if there is no item with that id, and an error
+// if there was a problem persisting the dump on the disk (if PERSIST_WRITES is
+// enabled).
+func (d *Dump) ExpireAt(id int, t time.Time) error {
+	if d.ttl == nil {
+		return ErrNoTTL
+	}
+
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer d.mutex.Unlock()
+
+	if id < 0 || id >= len(d.items) {
+		return ErrNotFound
+	}
+
+	d.meta[id].Expires = 0
+	if !t.IsZero() {
+		d.meta[id].Expires = t.UnixNano()
+	}
+	d.ttl.schedule(d.meta[id].Expires)
+	d.dirty(id)
+
+	if d.autosave() {
+		return d.save()
+	}
+
+	return nil
+}
+
+// rlock locks the dump for reading, after removing the expired items.
+func (d *Dump) rlock() {
+	if d.ttl != nil {
+		d.mutex.RLock()
+		due := d.ttl.due()
+		d.mutex.RUnlock()
+
+		// a closed dump is read as it is, without removing or saving anything
+		if due && d.lock() == nil {
+			d.expire()
+			d.mutex.Unlock()
+		}
+	}
+
+	d.mutex.RLock()
+}
+
+// expire removes the expired items.
+//
+// no mutex
+func (d *Dump) expire() {
+	if !d.ttl.due() {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	// items that can't be removed yet expire the next time
+	removed, _ := d.remove(func(id int) bool {
+		return d.meta[id].Expires != 0 && d.meta[id].Expires <= now
+	})
+
+	d.ttl.next = 0
+	for _, m := range d.meta {
+		d.ttl.schedule(m.Expires)
+	}
+
+	if removed > 0 && d.autosave() {
+		// errors are reported to the AfterSave hooks
+		d.save()
+	}
+}
+
+// startSweeper starts removing the expired items in the background, if
+// WithTTL() asks for it.
+func (d *Dump) startSweeper() {
+	if d.ttl == nil || d.ttl.sweep == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(d.ttl.sweep)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.closed:
+				return
+			case <-ticker.C:
+			}
+
+			if d.lock() != nil {
+				return
+			}
+			d.expire()
+			d.mutex.Unlock()
+		}
+	}()
+}
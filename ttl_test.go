@@ -0,0 +1,90 @@
+package dump
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTTL(t *testing.T) {
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	if _, err := New("ttl.db", PERSIST_MANUAL, types, WithTTL(-time.Second, 0)); err != ErrInvalidTTL {
+		t.Fatal("accepted negative ttl")
+	}
+
+	plain, _ := New("ttl.db", PERSIST_MANUAL, types)
+	if plain.ExpireAt(0, time.Now()) != ErrNoTTL {
+		t.Fatal("expected ErrNoTTL")
+	}
+
+	test, _ := New("ttl.db", PERSIST_MANUAL, types, WithTTL(50*time.Millisecond, 0))
+	test.AddAll(&Plain{"session"}, &Plain{"forever"}, &Plain{"later"})
+
+	if test.ExpireAt(3, time.Time{}) != ErrNotFound {
+		t.Fatal("expected ErrNotFound")
+	}
+	test.ExpireAt(1, time.Time{})
+	test.ExpireAt(2, time.Now().Add(time.Hour))
+
+	time.Sleep(80 * time.Millisecond)
+
+	test.View(func(items []Item) error {
+		if len(items) != 2 || items[0].(*Plain).Name != "forever" {
+			t.Fatal("expired item not removed", items)
+		}
+		return nil
+	})
+
+	if item, err := test.Get(1); err != nil || item.(*Plain).Name != "later" {
+		t.Fatal("ids didn't shift", err)
+	}
+}
+
+func TestTTLClosed(t *testing.T) {
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	test, _ := New("ttl.db", PERSIST_WRITES, types, WithTTL(20*time.Millisecond, 0))
+	test.Add(&Plain{"session"})
+	test.Close()
+
+	info, _ := os.Stat("ttl.db")
+	time.Sleep(40 * time.Millisecond)
+
+	test.View(func(items []Item) error {
+		if len(items) != 1 {
+			t.Fatal("expired item removed after close")
+		}
+		return nil
+	})
+
+	if after, _ := os.Stat("ttl.db"); !after.ModTime().Equal(info.ModTime()) {
+		t.Fatal("saved after close")
+	}
+}
+
+func TestTTLSweeper(t *testing.T) {
+	defer os.Remove("sweep.db")
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+
+	test, _ := New("sweep.db", PERSIST_WRITES, types,
+		WithTTL(20*time.Millisecond, 10*time.Millisecond))
+	defer test.Close()
+
+	test.Add(&Plain{"session"})
+
+	time.Sleep(100 * time.Millisecond)
+
+	// the purge was persisted without reading the dump
+	other, _ := New("sweep.db", PERSIST_MANUAL, types)
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+	other.View(func(items []Item) error {
+		if len(items) != 0 {
+			t.Fatal("expired item not swept")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,190 @@
+package dump
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Txn updates several dumps atomically, for example a dump of users and a
+// dump of their sessions. It is created with NewTxn().
+type Txn struct {
+	dumps []*Dump
+}
+
+// NewTxn returns a Txn over the provided dumps. It returns ErrInvalidTxn if
+// no dumps are provided, a dump is nil or provided twice, or a dump was
+// created with WithRecordStore(), WithCommandLog() or WithSegments() (record
+// stores, command logs and segments can't take part in the two phases of a
+// commit).
+func NewTxn(dumps ...*Dump) (*Txn, error) {
+	if len(dumps) == 0 {
+		return nil, ErrInvalidTxn
+	}
+
+	seen := make(map[*Dump]bool, len(dumps))
+	for _, d := range dumps {
+		if d == nil || seen[d] || d.records != nil || d.events != nil || d.segments > 0 {
+			return nil, ErrInvalidTxn
+		}
+		seen[d] = true
+	}
+
+	return &Txn{dumps: dumps}, nil
+}
+
+// Update works like Dump.Update() across every dump of the transaction. The
+// dumps are locked for writing and f is given deep copies of their items, in
+// the order the dumps were passed to NewTxn(). The changes are applied to all
+// of the dumps only if f returns nil and no unique index is violated.
+//
+// The dumps with PERSIST_WRITES enabled are then persisted in two phases:
+// every dump file is first written to a temporary file, and only once all of
+// them were written are they renamed over the dump files. If writing any of
+// them fails, none of the dump files are touched and the changes are undone
+// in memory too. Renaming is atomic for each file but not across files, so a
+// failed rename or a crash between two renames can still leave only some of
+// the dump files updated (the changes are kept in memory in that case).
+func (t *Txn) Update(f func(items [][]Item) error) error {
+	// collections of the same dump share a lock, which is only locked once
+	var locked []*sync.RWMutex
+	seen := make(map[*sync.RWMutex]bool, len(t.dumps))
+	for _, d := range t.dumps {
+		if !seen[d.mutex] {
+			seen[d.mutex] = true
+			locked = append(locked, d.mutex)
+		}
+	}
+
+	sort.Slice(locked, func(i, j int) bool {
+		// a consistent locking order prevents deadlocks between transactions
+		return reflect.ValueOf(locked[i]).Pointer() <
+			reflect.ValueOf(locked[j]).Pointer()
+	})
+
+	for _, mutex := range locked {
+		mutex.Lock()
+		defer mutex.Unlock()
+	}
+
+	for _, d := range t.dumps {
+		if d.isClosed() {
+			return ErrClosed
+		}
+	}
+
+	var (
+		copied = make([][]Item, len(t.dumps))
+		err    error
+	)
+
+	for i, d := range t.dumps {
+		if copied[i], err = copyItems(d.items); err != nil {
+			return err
+		}
+	}
+
+	if err = f(copied); err != nil {
+		return err
+	}
+
+	var (
+		ids    = make([][]int, len(t.dumps))
+		items  = make([][]Item, len(t.dumps))
+		metas  = make([][]meta, len(t.dumps))
+		undone bool
+	)
+
+	undo := func() {
+		for i, d := range t.dumps {
+			if items[i] != nil {
+				d.items, d.meta = items[i], metas[i]
+				d.changed()
+			}
+		}
+		undone = true
+	}
+
+	for i, d := range t.dumps {
+		items[i] = append([]Item{}, d.items...)
+		metas[i] = append([]meta{}, d.meta...)
+
+		if ids[i], err = d.swap(copied[i]); err != nil {
+			undo()
+			return err
+		}
+	}
+
+	err = t.commit(undo)
+
+	if !undone {
+		for i, d := range t.dumps {
+			d.afterUpdate(ids[i]...)
+		}
+	}
+
+	return err
+}
+
+// commit persists the dumps with PERSIST_WRITES enabled (or that are due a
+// save with PERSIST_BATCH()) in two phases,
+// calling undo if the first phase fails.
+//
+// no mutex
+func (t *Txn) commit(undo func()) error {
+	var (
+		persisted []*Dump
+		memory    []int
+		buffers   []*bytes.Buffer
+	)
+	defer func() {
+		for _, buffer := range buffers {
+			putBuffer(buffer)
+		}
+	}()
+
+	seen := make(map[*Dump]bool, len(t.dumps))
+	for _, d := range t.dumps {
+		// collections are persisted by their dump, once
+		if d.parent != nil {
+			d = d.parent
+		}
+
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		if !d.autosave() {
+			continue
+		}
+
+		buffer, size, err := d.encode(nil)
+		if err == nil {
+			buffers = append(buffers, buffer)
+			err = d.writeFile(d.filename+".tmp", buffer.Bytes())
+		}
+
+		if err != nil {
+			d.saved(0, 0, err)
+			undo()
+			return err
+		}
+
+		persisted = append(persisted, d)
+		memory = append(memory, size)
+	}
+
+	for i, d := range persisted {
+		err := d.promote(d.filename + ".tmp")
+		if err == nil {
+			d.afterWrite(d.filename, buffers[i].Bytes())
+		}
+		d.saved(memory[i], buffers[i].Len(), err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
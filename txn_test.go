@@ -0,0 +1,110 @@
+package dump
+
+import (
+	"errors"
+	"testing"
+)
+
+// failingStorage is a Storage that can't be written to.
+type failingStorage struct {
+	memoryStorage
+}
+
+func (f *failingStorage) Write(name string, data []byte) error {
+	return errors.New("read only")
+}
+
+func TestNewTxn(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+
+	for _, dumps := range [][]*Dump{nil, {nil}, {test, test}} {
+		if _, err := NewTxn(dumps...); err != ErrInvalidTxn {
+			t.Fatal("expected ErrInvalidTxn")
+		}
+	}
+}
+
+func TestTxn(t *testing.T) {
+	var (
+		storage = &memoryStorage{files: make(map[string][]byte)}
+		types   = []Type{{"dump.Blob", &Blob{}}}
+	)
+
+	users, _ := New("users.db", PERSIST_WRITES, types, WithStorage(storage))
+	sessions, _ := New("sessions.db", PERSIST_WRITES, types, WithStorage(storage),
+		WithUniqueIndex("data", func(item Item) string { return item.(*Blob).Data }))
+
+	users.Add(&Blob{"karl"})
+	sessions.AddAll(&Blob{"one"}, &Blob{"two"})
+
+	txn, err := NewTxn(users, sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = txn.Update(func(items [][]Item) error {
+		items[0][0].(*Blob).Data = "santa"
+		items[1][0].(*Blob).Data = "three"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string]string{"users.db": "santa", "sessions.db": "three"} {
+		other, _ := New(name, PERSIST_MANUAL, types, WithStorage(storage))
+		if err = other.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if item, _ := other.Get(0); item.(*Blob).Data != data {
+			t.Fatal("transaction didn't persist", name)
+		}
+	}
+
+	var errTest = errors.New("txn")
+	if err = txn.Update(func(items [][]Item) error {
+		items[0][0].(*Blob).Data = "partial"
+		return errTest
+	}); err != errTest {
+		t.Fatal("bad error")
+	}
+
+	if err = txn.Update(func(items [][]Item) error {
+		items[0][0].(*Blob).Data = "partial"
+		items[1][0].(*Blob).Data = "two"
+		return nil
+	}); err != ErrDuplicate {
+		t.Fatal("expected ErrDuplicate")
+	}
+
+	if item, _ := users.Get(0); item.(*Blob).Data != "santa" {
+		t.Fatal("failed transaction wasn't rolled back")
+	}
+
+	// the second dump can't be written, so neither is persisted
+	failing, _ := New("failing.db", PERSIST_WRITES, types,
+		WithStorage(&failingStorage{memoryStorage{files: make(map[string][]byte)}}))
+	failing.items = append(failing.items, &Blob{"failing"})
+	failing.appended(0)
+
+	if txn, err = NewTxn(users, failing); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = txn.Update(func(items [][]Item) error {
+		items[0][0].(*Blob).Data = "partial"
+		items[1][0].(*Blob).Data = "partial"
+		return nil
+	}); err == nil {
+		t.Fatal("ignored write error")
+	}
+
+	if item, _ := users.Get(0); item.(*Blob).Data != "santa" {
+		t.Fatal("failed commit wasn't rolled back")
+	}
+
+	other, _ := New("users.db", PERSIST_MANUAL, types, WithStorage(storage))
+	other.Load()
+	if item, _ := other.Get(0); item.(*Blob).Data != "santa" {
+		t.Fatal("failed commit was persisted")
+	}
+}
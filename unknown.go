@@ -0,0 +1,57 @@
+package dump
+
+import (
+	"sort"
+	"strings"
+)
+
+// UnknownTypeError is returned by Load() when the dump file holds items whose
+// types weren't registered with the dump (or with gob), usually because a
+// type was renamed or removed. It matches ErrUnknownType and
+// ErrNotRegistered.
+type UnknownTypeError struct {
+	// File is the name of the dump file.
+	File string
+
+	// Types are the names the unknown types were registered under, such as
+	// "main.User", sorted.
+	Types []string
+}
+
+func (e *UnknownTypeError) Error() string {
+	message := "unknown types " + strings.Join(e.Types, ", ")
+	if e.File != "" {
+		message = e.File + ": " + message
+	}
+	return message
+}
+
+func (e *UnknownTypeError) Is(target error) bool {
+	return target == ErrUnknownType || target == ErrNotRegistered
+}
+
+// add adds a type to the list of unknown types, unless it's already there.
+func (e *UnknownTypeError) add(name string) {
+	i := sort.SearchStrings(e.Types, name)
+	if i < len(e.Types) && e.Types[i] == name {
+		return
+	}
+	e.Types = append(e.Types, "")
+	copy(e.Types[i+1:], e.Types[i:])
+	e.Types[i] = name
+}
+
+// WithSkipUnknown is an option that makes Load() drop the items of unknown
+// types instead of returning an *UnknownTypeError, so a dump can still be
+// loaded after a type was removed. The number of items dropped by the last
+// load is reported by Stats().
+//
+// Only items can be skipped, and only in files written since items are
+// encoded one by one: an unknown type in an older file, in a segment file (see
+// WithSegments()) or in a collection still fails the load.
+func WithSkipUnknown() Option {
+	return func(d *Dump) error {
+		d.skipUnknown = true
+		return nil
+	}
+}
@@ -0,0 +1,64 @@
+package dump
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// Alien and Ghost are only registered by TestUnknownType.
+type Alien struct {
+	Data string
+}
+
+type Ghost struct {
+	Data string
+}
+
+func TestUnknownType(t *testing.T) {
+	defer os.Remove("unknown.db")
+
+	test, _ := New("unknown.db", PERSIST_MANUAL, []Type{
+		{"dump.Plain", &Plain{}},
+		{"dump.Alien", &Alien{}},
+		{"dump.Ghost", &Ghost{}},
+	})
+	test.AddAll(&Plain{"a"}, &Alien{"x"}, &Plain{"b"}, &Ghost{"y"}, &Alien{"z"})
+	test.Save()
+
+	// rename the types in the file to names nothing registered
+	data, _ := os.ReadFile("unknown.db")
+	payload := bytes.Replace(data[headerSize:], []byte("dump.Alien"), []byte("dump.Xlien"), -1)
+	payload = bytes.Replace(payload, []byte("dump.Ghost"), []byte("dump.Xhost"), -1)
+	os.WriteFile("unknown.db", encodeFile(header{version: formatVersion}, payload), 0644)
+
+	other, _ := New("unknown.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}})
+	err := other.Load()
+
+	var unknown *UnknownTypeError
+	if !errors.As(err, &unknown) || !errors.Is(err, ErrUnknownType) || !errors.Is(err, ErrNotRegistered) {
+		t.Fatal("expected UnknownTypeError", err)
+	}
+	if unknown.File != "unknown.db" || !reflect.DeepEqual(unknown.Types, []string{"dump.Xhost", "dump.Xlien"}) {
+		t.Fatal("bad error", unknown)
+	}
+	if other.Len() != 0 {
+		t.Fatal("loaded items")
+	}
+
+	skipping, _ := New("unknown.db", PERSIST_MANUAL, []Type{{"dump.Plain", &Plain{}}}, WithSkipUnknown())
+	if err := skipping.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if skipping.Len() != 2 || skipping.Stats().Skipped != 3 {
+		t.Fatal("bad skip", skipping.Len(), skipping.Stats().Skipped)
+	}
+	if item, _ := skipping.Get(1); item.(*Plain).Name != "b" {
+		t.Fatal("bad items")
+	}
+	if version, err := skipping.Version(1); err != nil || version != 1 {
+		t.Fatal("bad metadata", version, err)
+	}
+}
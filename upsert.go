@@ -0,0 +1,84 @@
+package dump
+
+// WithKey is an option that registers a unique index (see WithUniqueIndex())
+// with the provided name and uses it as the key of the items for Upsert().
+func WithKey(name string, key func(item Item) string) Option {
+	return func(d *Dump) error {
+		if d.key != "" {
+			return ErrInvalidIndex
+		}
+		if err := withIndex(name, key, true)(d); err != nil {
+			return err
+		}
+		d.key = name
+		return nil
+	}
+}
+
+// Upsert replaces the item with the provided key (see WithKey()) or appends
+// the item on the end of the dump if there isn't one. It returns the id of the
+// item, whether it was appended, and an error if there was a problem
+// persisting the dump on the disk (if PERSIST_WRITES is enabled).
+//
+// Upsert returns ErrNoKey if the dump wasn't created with WithKey(),
+// ErrInvalidKey if key isn't the key of item, and ErrDuplicate if the item
+// would violate another unique index.
+func (d *Dump) Upsert(key string, item Item) (int, bool, error) {
+	if err := d.lock(); err != nil {
+		return -1, false, err
+	}
+	defer d.mutex.Unlock()
+
+	idx, ok := d.indexes[d.key]
+	if !ok {
+		return -1, false, ErrNoKey
+	}
+
+	if idx.key(item) != key {
+		return -1, false, ErrInvalidKey
+	}
+
+	var (
+		id      int
+		stable  uint64
+		created = len(idx.ids[key]) == 0
+	)
+
+	if created {
+		if err := d.beforeAdd([]Item{item}); err != nil {
+			return -1, false, err
+		}
+
+		if err := d.checkAppend([]Item{item}); err != nil {
+			return -1, false, err
+		}
+
+		id = len(d.items)
+		d.items = append(d.items, item)
+		stable = d.meta[d.appended(id)[0]].ID
+		id -= d.evict()
+	} else {
+		id = idx.ids[key][0]
+		if err := d.validate(item); err != nil {
+			return -1, false, err
+		}
+		if err := d.checkSet(id, item); err != nil {
+			return -1, false, err
+		}
+
+		d.items[id] = item
+		d.replaced(id)
+		stable = d.meta[id].ID
+		d.afterUpdate(id)
+	}
+
+	if d.order != nil {
+		id = d.positions([]uint64{stable})[0]
+	}
+
+	if d.autosave() {
+		return id, created, d.save()
+	}
+
+	return id, created, nil
+}
@@ -0,0 +1,51 @@
+package dump
+
+import "testing"
+
+func TestUpsert(t *testing.T) {
+	data := func(item Item) string { return item.(*Blob).Data }
+
+	if _, err := New("test.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}},
+		WithKey("one", data), WithKey("two", data)); err != ErrInvalidIndex {
+		t.Fatal("accepted two keys")
+	}
+
+	test, _ := New("test.db", PERSIST_WRITES, []Type{{"dump.Blob", &Blob{}}},
+		WithKey("data", data))
+
+	id, created, err := test.Upsert("a", &Blob{"a"})
+	if err != nil || !created || id != 0 {
+		t.Fatal("bad insert", id, created, err)
+	}
+
+	test.Add(&Blob{"b"})
+
+	replacement := &Blob{"a"}
+	if id, created, err = test.Upsert("a", replacement); err != nil || created || id != 0 {
+		t.Fatal("bad replace", id, created, err)
+	}
+
+	if item, _ := test.Get(0); item != replacement || test.Len() != 2 {
+		t.Fatal("item wasn't replaced")
+	}
+
+	other, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}},
+		WithKey("data", data))
+	other.Load()
+	if id, created, _ = other.Upsert("b", &Blob{"b"}); created || id != 1 {
+		t.Fatal("key wasn't loaded")
+	}
+
+	if _, _, err = test.Upsert("c", &Blob{"d"}); err != ErrInvalidKey {
+		t.Fatal("expected ErrInvalidKey")
+	}
+
+	if _, err = test.Add(&Blob{"a"}); err != ErrDuplicate {
+		t.Fatal("key isn't unique")
+	}
+
+	plain, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	if _, _, err = plain.Upsert("a", &Blob{"a"}); err != ErrNoKey {
+		t.Fatal("expected ErrNoKey")
+	}
+}
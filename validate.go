@@ -0,0 +1,92 @@
+package dump
+
+import (
+	"reflect"
+)
+
+// Validator is implemented by items that can check themselves. The dump
+// calls Validate() before an item is added or changed, and the change is
+// rejected with its error if it returns one.
+type Validator interface {
+	Validate() error
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+// WithValidator is an option that registers validate as the validator of the
+// items of the type of value (such as &User{}), for types that don't
+// implement Validator. It can be used more than once; the validators of a
+// type are called in the order they were registered, after its Validate()
+// method.
+//
+// Items are validated when they are added by Add(), AddAll(), Upsert(),
+// ImportJSONL() or MergeFile(), and when they are changed by Set(),
+// Update(), Map(), UpdateAt(), UpdateWhere() or a Txn. A change that fails
+// validation isn't applied (and isn't saved), and the error of the validator
+// is returned. Items replaced as a whole (by Load(), LoadJSON() or
+// Restore()) aren't validated.
+func WithValidator(value Item, validate func(item Item) error) Option {
+	return func(d *Dump) error {
+		if value == nil || validate == nil {
+			return ErrInvalidValidator
+		}
+
+		if d.validators == nil {
+			d.validators = make(map[reflect.Type][]func(Item) error)
+		}
+		t := reflect.TypeOf(value)
+		d.validators[t] = append(d.validators[t], validate)
+		return nil
+	}
+}
+
+// check validates item (see validate()) under the read lock.
+func (d *Dump) check(item Item) error {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	return d.validate(item)
+}
+
+// validate returns the first error returned by the validators of items.
+//
+// no mutex
+func (d *Dump) validate(items ...Item) error {
+	for _, item := range items {
+		if v, ok := item.(Validator); ok {
+			if err := v.Validate(); err != nil {
+				return err
+			}
+		}
+
+		for _, validate := range d.validators[reflect.TypeOf(item)] {
+			if err := validate(item); err != nil {
+				return err
+			}
+		}
+
+		if err := d.checkReferences(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validating reports whether items of any of the types of the dump may be
+// validated, in which case items changed in place are copied first so the
+// changes can be undone.
+//
+// no mutex
+func (d *Dump) validating() bool {
+	if len(d.validators) > 0 || len(d.references) > 0 {
+		return true
+	}
+
+	for _, t := range d.types {
+		v := reflect.TypeOf(t.Value)
+		if v.Implements(validatorType) || reflect.PtrTo(v).Implements(validatorType) {
+			return true
+		}
+	}
+	return false
+}
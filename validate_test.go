@@ -0,0 +1,119 @@
+package dump
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+var errNegative = errors.New("negative age")
+
+type Age struct {
+	Years int
+}
+
+func (a *Age) Validate() error {
+	if a.Years < 0 {
+		return errNegative
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	defer os.Remove("validate.db")
+
+	test, err := New("validate.db", PERSIST_WRITES, []Type{{"dump.Age", &Age{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = test.Add(&Age{-1}); err != errNegative {
+		t.Fatal("added an invalid item")
+	}
+	if _, err = os.Stat("validate.db"); !os.IsNotExist(err) {
+		t.Fatal("saved an invalid item")
+	}
+	if _, err = test.AddAll(&Age{1}, &Age{-1}); err != errNegative || test.Len() != 0 {
+		t.Fatal("added invalid items")
+	}
+
+	test.AddAll(&Age{1}, &Age{2})
+
+	if err = test.Set(0, &Age{-1}); err != errNegative {
+		t.Fatal("set an invalid item")
+	}
+
+	err = test.Update(func(items []Item) error {
+		items[0].(*Age).Years = 10
+		items[1].(*Age).Years = -1
+		return nil
+	})
+	if err != errNegative {
+		t.Fatal("updated an invalid item")
+	}
+
+	err = test.UpdateAt(1, func(item Item) error {
+		item.(*Age).Years = -1
+		return nil
+	})
+	if err != errNegative {
+		t.Fatal("updated an invalid item in place")
+	}
+
+	updated, err := test.UpdateWhere(func(Item) bool { return true }, func(item Item) error {
+		item.(*Age).Years -= 2
+		return nil
+	})
+	if err != errNegative || updated != 1 {
+		t.Fatalf("updated %d items, got %v", updated, err)
+	}
+
+	test.View(func(items []Item) error {
+		if items[0].(*Age).Years != 1 || items[1].(*Age).Years != 2 {
+			t.Fatal("applied an invalid change")
+		}
+		return nil
+	})
+
+	if err = test.UpdateAt(1, func(item Item) error {
+		item.(*Age).Years = 3
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	if _, err := New("validator.db", PERSIST_MANUAL,
+		[]Type{{"dump.Blob", &Blob{}}}, WithValidator(&Blob{}, nil)); err != ErrInvalidValidator {
+		t.Fatal("accepted a nil validator")
+	}
+
+	errEmpty := errors.New("empty blob")
+	test, err := New("validator.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}},
+		WithValidator(&Blob{}, func(item Item) error {
+			if item.(*Blob).Data == "" {
+				return errEmpty
+			}
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = test.Add(&Blob{}); err != errEmpty {
+		t.Fatal("added an invalid item")
+	}
+	if _, err = test.Add(&Blob{"full"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = test.Map(func(item Item) error {
+		item.(*Blob).Data = ""
+		return nil
+	}); err != errEmpty {
+		t.Fatal("mapped to an invalid item")
+	}
+	if item, _ := test.Get(0); item.(*Blob).Data != "full" {
+		t.Fatal("applied an invalid change")
+	}
+}
@@ -0,0 +1,49 @@
+package dump
+
+// Version returns the version of the item with the provided id, which starts
+// at 1 and is incremented every time the item is changed (by Set(), Update(),
+// UpdateAt() and so on). It returns ErrNotFound if there is no item with that
+// id.
+//
+// Update() and Map() only increment the versions of the items that f changed,
+// which they find by comparing the encoding of every item before and after.
+func (d *Dump) Version(id int) (uint64, error) {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	if id < 0 || id >= len(d.items) {
+		return 0, ErrNotFound
+	}
+
+	return d.meta[id].Version, nil
+}
+
+// CompareAndUpdate works like UpdateAt() but only calls f if the version of
+// the item with the provided id is still version (see Version()). It returns
+// ErrConflict if the item was changed in the meantime.
+func (d *Dump) CompareAndUpdate(id int, version uint64, f func(item Item) error) error {
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer d.mutex.Unlock()
+
+	if id < 0 || id >= len(d.items) {
+		return ErrNotFound
+	}
+
+	if d.meta[id].Version != version {
+		return ErrConflict
+	}
+
+	if err := d.updateAt(id, f); err != nil {
+		return err
+	}
+
+	d.afterUpdate(id)
+
+	if d.autosave() {
+		return d.save()
+	}
+
+	return nil
+}
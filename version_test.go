@@ -0,0 +1,129 @@
+package dump
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+	ids, _ := test.AddAll(&Blob{"a"}, &Blob{"b"})
+
+	version := func(d *Dump, id int) uint64 {
+		v, err := d.Version(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	if version(test, ids[0]) != 1 {
+		t.Fatal("new items should start at version 1")
+	}
+
+	test.Set(ids[0], &Blob{"c"})
+	test.UpdateAt(ids[0], func(Item) error { return nil })
+	if version(test, ids[0]) != 3 || version(test, ids[1]) != 1 {
+		t.Fatal("versions weren't incremented")
+	}
+
+	test.Update(func(items []Item) error {
+		items[ids[1]].(*Blob).Data = "d"
+		return nil
+	})
+	if version(test, ids[0]) != 3 || version(test, ids[1]) != 2 {
+		t.Fatal("update didn't increment only the changed version")
+	}
+
+	test.Map(func(item Item) error {
+		item.(*Blob).Data += "!"
+		return nil
+	})
+	if version(test, ids[0]) != 4 || version(test, ids[1]) != 3 {
+		t.Fatal("map didn't increment every changed version")
+	}
+
+	test.Sort(func(a, b Item) bool { return a.(*Blob).Data < b.(*Blob).Data })
+	if version(test, 0) != 4 {
+		t.Fatal("sort changed versions")
+	}
+
+	other, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	other.Load()
+	if version(other, 1) != 3 {
+		t.Fatal("versions weren't persisted")
+	}
+
+	if _, err := test.Version(2); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound")
+	}
+}
+
+func TestCompareAndUpdate(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_WRITES, Type{"dump.Blob", &Blob{}})
+	id, _ := test.Add(&Blob{"a"})
+
+	rename := func(data string) func(Item) error {
+		return func(item Item) error {
+			item.(*Blob).Data = data
+			return nil
+		}
+	}
+
+	if err := test.CompareAndUpdate(id, 1, rename("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := test.CompareAndUpdate(id, 1, rename("c")); err != ErrConflict {
+		t.Fatal("expected ErrConflict")
+	}
+
+	if item, _ := test.Get(id); item.(*Blob).Data != "b" {
+		t.Fatal("conflicting update was applied")
+	}
+
+	var errTest = errors.New("compare")
+	if err := test.CompareAndUpdate(id, 2, func(Item) error { return errTest }); err != errTest {
+		t.Fatal("bad error")
+	}
+
+	if err := test.CompareAndUpdate(id+1, 1, rename("d")); err != ErrNotFound {
+		t.Fatal("expected ErrNotFound")
+	}
+}
+
+// Tagged has fields gob doesn't encode the same way every time or copy as
+// they are.
+type Tagged struct {
+	Tags  map[string]int
+	Names []string
+}
+
+func TestVersionUnchanged(t *testing.T) {
+	test, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Tagged", &Tagged{}})
+	tags := make(map[string]int)
+	for i := 0; i < 20; i++ {
+		tags[string(rune('a'+i))] = i
+	}
+	id, _ := test.Add(&Tagged{Tags: tags, Names: []string{}})
+
+	for i := 0; i < 10; i++ {
+		test.Update(func(items []Item) error { return nil })
+		test.Map(func(item Item) error { return nil })
+	}
+	if v, _ := test.Version(id); v != 1 {
+		t.Fatal("untouched item looks changed", v)
+	}
+
+	if err := test.CompareAndUpdate(id, 1, func(Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	test.Map(func(item Item) error {
+		item.(*Tagged).Tags["a"] = 100
+		return nil
+	})
+	if v, _ := test.Version(id); v != 3 {
+		t.Fatal("changed item looks unchanged", v)
+	}
+}
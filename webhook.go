@@ -0,0 +1,239 @@
+package dump
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Webhook describes an endpoint notified of the changes made to a dump, see
+// WithWebhook().
+type Webhook struct {
+	// URL is the URL the changes are POSTed to.
+	URL string
+
+	// Template renders the body of the request from the WebhookBatch. By
+	// default the batch is sent as JSON: {"changes":[...]}, with every change
+	// encoded by Change.MarshalJSON().
+	Template *template.Template
+
+	// ContentType is the Content-Type of the body ("application/json" by
+	// default).
+	ContentType string
+
+	// Secret, if set, signs the body with HMAC-SHA256, sent in the
+	// X-Dump-Signature header as "sha256=" followed by the hex-encoded
+	// signature.
+	Secret []byte
+
+	// Retries is the number of times a request is retried after a network
+	// error or a 5xx or 429 response, with exponential backoff starting at
+	// Backoff (3 times and 1s by default).
+	Retries int
+	Backoff time.Duration
+
+	// Client is used to send the requests (http.DefaultClient by default).
+	Client *http.Client
+
+	// OnError is called with the batches that couldn't be delivered, if it
+	// isn't nil.
+	OnError func(batch WebhookBatch, err error)
+}
+
+// WebhookBatch holds the changes sent in a webhook request.
+type WebhookBatch struct {
+	// Changes are the changes saved by a save, numbered across the batches
+	// sent to the webhook.
+	Changes []Change `json:"changes"`
+}
+
+// webhook holds the changes made to the dump since it was last saved and the
+// batches waiting to be delivered.
+type webhook struct {
+	Webhook
+
+	mutex   sync.Mutex
+	seq     uint64
+	changes []Change
+	queue   []WebhookBatch
+	sending bool
+	wg      sync.WaitGroup
+}
+
+// WithWebhook is an option that notifies w of the changes made to the dump
+// (and to its collections). Changes are batched per save: once a save
+// succeeds, the changes it persisted are POSTed to w.URL in a single
+// request, so with PERSIST_WRITES every change is sent on its own, and with
+// PERSIST_MANUAL every Save() sends the changes made since the last one.
+//
+// Requests are sent in the background, one at a time and in order, and
+// Close() waits for the batches still to be sent. The items are encoded
+// like MarshalJSON() does, so WithRedaction() applies. It returns
+// ErrInvalidWebhook if w.URL isn't an absolute URL. It can be used more than
+// once to notify several webhooks.
+func WithWebhook(w Webhook) Option {
+	return func(d *Dump) error {
+		if u, err := url.Parse(w.URL); err != nil || !u.IsAbs() {
+			return ErrInvalidWebhook
+		}
+
+		if w.ContentType == "" {
+			w.ContentType = "application/json"
+		}
+		if w.Retries <= 0 {
+			w.Retries = 3
+		}
+		if w.Backoff <= 0 {
+			w.Backoff = time.Second
+		}
+		if w.Client == nil {
+			w.Client = http.DefaultClient
+		}
+
+		d.webhooks = append(d.webhooks, &webhook{Webhook: w})
+		return nil
+	}
+}
+
+// notify records a change for the webhooks of the dump.
+//
+// no mutex (the dump has to be locked)
+func (d *Dump) notify(op string, id int, item Item, m meta) {
+	webhooks := d.root().webhooks
+	if len(webhooks) == 0 {
+		return
+	}
+
+	var data []byte
+	if op != "reset" {
+		var err error
+		if data, err = d.marshalJSON(item); err != nil {
+			data = []byte("null")
+		}
+	}
+
+	for _, w := range webhooks {
+		w.record(Change{Op: op, ID: id, StableID: m.ID, Data: data})
+	}
+}
+
+// record records a change, to be sent after the next save.
+func (w *webhook) record(change Change) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.seq++
+	change.Seq = w.seq
+	w.changes = append(w.changes, change)
+}
+
+// flush queues the changes recorded since the last save for delivery, once
+// a save succeeded. Changes stay recorded after a failed save, which the next
+// save retries.
+func (w *webhook) flush(err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err != nil || len(w.changes) == 0 {
+		return
+	}
+
+	w.queue = append(w.queue, WebhookBatch{Changes: w.changes})
+	w.changes = nil
+
+	if !w.sending {
+		w.sending = true
+		w.wg.Add(1)
+		go w.send()
+	}
+}
+
+// send delivers the queued batches until the queue is empty.
+func (w *webhook) send() {
+	defer w.wg.Done()
+
+	for {
+		w.mutex.Lock()
+		if len(w.queue) == 0 {
+			w.sending = false
+			w.mutex.Unlock()
+			return
+		}
+		batch := w.queue[0]
+		w.queue = w.queue[1:]
+		w.mutex.Unlock()
+
+		if err := w.deliver(batch); err != nil && w.OnError != nil {
+			w.OnError(batch, err)
+		}
+	}
+}
+
+// wait waits for the queued batches to be sent.
+func (w *webhook) wait() {
+	w.wg.Wait()
+}
+
+// deliver sends a batch, retrying after network errors and 5xx and 429
+// responses.
+func (w *webhook) deliver(batch WebhookBatch) error {
+	var body bytes.Buffer
+	if w.Template != nil {
+		if err := w.Template.Execute(&body, batch); err != nil {
+			return err
+		}
+	} else if err := json.NewEncoder(&body).Encode(batch); err != nil {
+		return err
+	}
+
+	var signature string
+	if w.Secret != nil {
+		mac := hmac.New(sha256.New, w.Secret)
+		mac.Write(body.Bytes())
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	backoff := w.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(body.Bytes(), signature)
+		if err == nil || !retry || attempt == w.Retries {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends a request with body. It returns whether the request should be
+// retried if it failed.
+func (w *webhook) post(body []byte, signature string) (bool, error) {
+	request, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", w.ContentType)
+	if signature != "" {
+		request.Header.Set("X-Dump-Signature", signature)
+	}
+
+	response, err := w.Client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	retry := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook: unexpected status %s", response.Status)
+}
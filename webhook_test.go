@@ -0,0 +1,92 @@
+package dump
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	defer os.Remove("test.db")
+
+	types := []Type{{"dump.Plain", &Plain{}}}
+	if _, err := New("test.db", PERSIST_MANUAL, types, WithWebhook(Webhook{URL: "/hook"})); err != ErrInvalidWebhook {
+		t.Fatal("accepted a relative url", err)
+	}
+
+	var (
+		mutex      sync.Mutex
+		bodies     = make(map[string]string)
+		signatures = make(map[string]string)
+		failures   = 1
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if r.URL.Path == "/" && failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies[r.URL.Path] += string(body)
+		signatures[r.URL.Path] = r.Header.Get("X-Dump-Signature")
+	}))
+	defer server.Close()
+
+	secret := []byte("secret")
+	test, _ := New("test.db", PERSIST_MANUAL, types, WithWebhook(Webhook{
+		URL:     server.URL + "/",
+		Secret:  secret,
+		Backoff: time.Millisecond,
+	}), WithWebhook(Webhook{
+		URL:      server.URL + "/text",
+		Template: template.Must(template.New("").Parse(`{{range .Changes}}{{.Op}} {{.ID}};{{end}}`)),
+	}))
+
+	test.AddAll(&Plain{"a"}, &Plain{"b"})
+	test.Set(1, &Plain{"c"})
+	test.Remove(0)
+
+	// nothing is sent before the changes are saved
+	time.Sleep(10 * time.Millisecond)
+	mutex.Lock()
+	if len(bodies) != 0 {
+		t.Fatal("sent unsaved changes", bodies)
+	}
+	mutex.Unlock()
+
+	test.Save()
+	test.Add(&Plain{"d"})
+	test.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(bodies) != 2 || bodies["/text"] != "add 0;add 1;update 1;delete 0;" {
+		t.Fatal("bad batches", bodies)
+	}
+	want := `{"changes":[{"seq":1,"op":"add","id":0,"stable_id":0,"data":{"name":"a"}},` +
+		`{"seq":2,"op":"add","id":1,"stable_id":1,"data":{"name":"b"}},` +
+		`{"seq":3,"op":"update","id":1,"stable_id":1,"data":{"name":"c"}},` +
+		`{"seq":4,"op":"delete","id":0,"stable_id":0,"data":{"name":"a"}}]}` + "\n"
+	if bodies["/"] != want {
+		t.Fatal("bad batch", bodies["/"])
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(bodies["/"]))
+	if signatures["/"] != "sha256="+hex.EncodeToString(mac.Sum(nil)) || signatures["/text"] != "" {
+		t.Fatal("bad signature", signatures)
+	}
+}
@@ -0,0 +1,311 @@
+package dump
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// SyncHandler returns an http.Handler that lets browsers keep a mirrored copy
+// of the dump over a WebSocket. Once connected, the client is sent a snapshot
+// of the items:
+//
+//	{"op":"snapshot","items":[{"id":1,"data":{...}},...]}
+//
+// followed by a message for every change:
+//
+//	{"seq":7,"op":"update","id":1,"data":{...}}
+//
+// where op is "add", "update" or "delete" and id is the stable id of the item
+// (which, unlike its position in the dump, never changes).
+//
+// If filter isn't nil it is called with every request and returns the
+// predicate the items sent on that connection have to match. Items that stop
+// matching are sent as deleted, and items that start matching as added.
+//
+// The dump has to be created with WithChanges(), otherwise the handler
+// responds with 500 Internal Server Error. Clients falling too far behind, or
+// connected when the items are replaced as a whole (see Change), are
+// disconnected and have to reconnect for a new snapshot.
+func SyncHandler(d *Dump, filter func(r *http.Request) func(item Item) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.feed == nil {
+			http.Error(w, ErrNoFeed.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		pred := func(Item) bool { return true }
+		if filter != nil {
+			pred = filter(r)
+		}
+
+		conn, err := upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		snapshot, changes, cancel, err := d.subscribe(pred)
+		if err != nil {
+			conn.close()
+			return
+		}
+		defer cancel()
+
+		if err = conn.write(snapshot); err != nil {
+			return
+		}
+
+		closed := make(chan struct{})
+		go func() {
+			conn.read()
+			close(closed)
+		}()
+
+		for {
+			select {
+			case <-closed:
+				return
+			case change, ok := <-changes:
+				if !ok || change.Op == "reset" {
+					conn.close()
+					return
+				}
+
+				message, err := json.Marshal(syncMessage{
+					Seq:  change.Seq,
+					Op:   change.Op,
+					ID:   change.StableID,
+					Data: json.RawMessage(change.Data),
+				})
+				if err == nil {
+					err = conn.write(message)
+				}
+				if err != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+// syncMessage is a message sent by SyncHandler().
+type syncMessage struct {
+	Seq   uint64          `json:"seq,omitempty"`
+	Op    string          `json:"op"`
+	ID    uint64          `json:"id,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Items []syncItem      `json:"items,omitempty"`
+}
+
+type syncItem struct {
+	ID   uint64          `json:"id"`
+	Data json.RawMessage `json:"data"`
+}
+
+// subscribe returns a snapshot message of the items matching pred and
+// subscribes to the changes made after it.
+func (d *Dump) subscribe(pred func(item Item) bool) ([]byte, <-chan Change, func(), error) {
+	d.rlock()
+	defer d.mutex.RUnlock()
+
+	var (
+		s        = &subscriber{pred: pred, visible: make(map[uint64]bool)}
+		snapshot = syncMessage{Op: "snapshot", Items: []syncItem{}}
+	)
+
+	for id, item := range d.items {
+		if !pred(item) {
+			continue
+		}
+
+		data, err := d.marshalJSON(item)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		s.visible[d.meta[id].ID] = true
+		snapshot.Items = append(snapshot.Items, syncItem{ID: d.meta[id].ID, Data: data})
+	}
+
+	message, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// changes are published while the dump is locked for writing, so none
+	// can be missed between the snapshot and subscribing
+	changes, cancel, err := d.feed.subscribe(0, s)
+	return message, changes, cancel, err
+}
+
+// websocketGUID is used to compute Sec-WebSocket-Accept (RFC 6455).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xa
+)
+
+// maxFrame is the largest frame accepted from a client. Clients aren't
+// expected to send anything but control frames.
+const maxFrame = 1 << 16
+
+var errFrame = errors.New("invalid websocket frame")
+
+// wsConn is the server side of a WebSocket connection.
+type wsConn struct {
+	net.Conn
+	reader *bufio.Reader
+	mutex  sync.Mutex
+}
+
+// upgrade performs the WebSocket handshake, responding with 400 Bad Request
+// if r isn't a valid WebSocket request.
+func upgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != "GET" || key == "" ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "websocket request expected", http.StatusBadRequest)
+		return nil, errFrame
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket unsupported", http.StatusInternalServerError)
+		return nil, errFrame
+	}
+
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	if _, err = buffered.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n"); err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{Conn: conn, reader: buffered.Reader}, nil
+}
+
+// headerContains reports whether the comma separated header contains token.
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[name] {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// write sends data as a text message.
+func (c *wsConn) write(data []byte) error {
+	return c.frame(opText, data)
+}
+
+// close sends a close frame.
+func (c *wsConn) close() error {
+	return c.frame(opClose, nil)
+}
+
+func (c *wsConn) frame(op byte, data []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	header := []byte{0x80 | op, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	switch n := len(data); {
+	case n < 126:
+		header[1], header = byte(n), header[:2]
+	case n <= 0xffff:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+		header = header[:4]
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	if _, err := c.Conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.Conn.Write(data)
+	return err
+}
+
+// read reads frames sent by the client until the connection is closed,
+// answering pings and close frames.
+func (c *wsConn) read() error {
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+			return err
+		}
+
+		op, masked, n := header[0]&0x0f, header[1]&0x80 != 0, uint64(header[1]&0x7f)
+		switch n {
+		case 126:
+			var size [2]byte
+			if _, err := io.ReadFull(c.reader, size[:]); err != nil {
+				return err
+			}
+			n = uint64(binary.BigEndian.Uint16(size[:]))
+		case 127:
+			var size [8]byte
+			if _, err := io.ReadFull(c.reader, size[:]); err != nil {
+				return err
+			}
+			n = binary.BigEndian.Uint64(size[:])
+		}
+
+		// clients have to mask their frames
+		if !masked || n > maxFrame {
+			c.close()
+			return errFrame
+		}
+
+		var mask [4]byte
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return err
+		}
+
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(c.reader, payload); err != nil {
+			return err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch op {
+		case opClose:
+			c.frame(opClose, payload)
+			return io.EOF
+		case opPing:
+			if err := c.frame(opPong, payload); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package dump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wsClient is a minimal WebSocket client for testing SyncHandler().
+type wsClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, url string) *wsClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io.WriteString(conn, "GET /?data=a HTTP/1.1\r\n"+
+		"Host: test\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the example from RFC 6455
+	if response.StatusCode != http.StatusSwitchingProtocols ||
+		response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal("bad handshake", response.Status)
+	}
+
+	return &wsClient{conn: conn, reader: reader}
+}
+
+func (c *wsClient) read(t *testing.T) (byte, []byte) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	n := int(header[1] & 0x7f)
+	if n == 126 {
+		var size [2]byte
+		io.ReadFull(c.reader, size[:])
+		n = int(binary.BigEndian.Uint16(size[:]))
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+func (c *wsClient) message(t *testing.T) syncMessage {
+	op, payload := c.read(t)
+	if op != opText {
+		t.Fatal("expected a text frame", op)
+	}
+
+	var message syncMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func (c *wsClient) send(op byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | op, 0x80 | byte(len(payload))}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.conn.Write(frame)
+}
+
+func TestSyncHandler(t *testing.T) {
+	test, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}},
+		WithChanges(0))
+	test.AddAll(&Blob{"a"}, &Blob{"b"}, &Blob{"a"})
+
+	server := httptest.NewServer(SyncHandler(test, func(r *http.Request) func(Item) bool {
+		data := r.URL.Query().Get("data")
+		return func(item Item) bool {
+			return item.(*Blob).Data == data
+		}
+	}))
+	defer server.Close()
+
+	client := dialWebSocket(t, server.URL)
+	defer client.conn.Close()
+
+	snapshot := client.message(t)
+	if snapshot.Op != "snapshot" || len(snapshot.Items) != 2 ||
+		snapshot.Items[0].ID != 0 || snapshot.Items[1].ID != 2 ||
+		string(snapshot.Items[1].Data) != `{"data":"a"}` {
+		t.Fatal("bad snapshot", snapshot)
+	}
+
+	test.Add(&Blob{"b"})
+	test.Set(1, &Blob{"a"})
+	test.Set(0, &Blob{"c"})
+	test.DeleteWhere(func(item Item) bool { return item.(*Blob).Data == "a" })
+
+	for i, expected := range []syncMessage{
+		{Op: "add", ID: 1, Data: json.RawMessage(`{"data":"a"}`)},
+		{Op: "delete", ID: 0, Data: json.RawMessage(`{"data":"c"}`)},
+		{Op: "delete", ID: 1, Data: json.RawMessage(`{"data":"a"}`)},
+		{Op: "delete", ID: 2, Data: json.RawMessage(`{"data":"a"}`)},
+	} {
+		message := client.message(t)
+		if message.Op != expected.Op || message.ID != expected.ID ||
+			string(message.Data) != string(expected.Data) {
+			t.Fatal("bad message", i, message)
+		}
+	}
+
+	client.send(opPing, []byte("ping"))
+	if op, payload := client.read(t); op != opPong || string(payload) != "ping" {
+		t.Fatal("bad pong")
+	}
+
+	client.send(opClose, nil)
+	if op, _ := client.read(t); op != opClose {
+		t.Fatal("close wasn't answered")
+	}
+}
+
+func TestSyncHandlerRedaction(t *testing.T) {
+	test, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Account", &Account{}}},
+		WithChanges(0), WithRedaction())
+	test.Add(&Account{"ann", "ann@example.com", "hunter2"})
+
+	server := httptest.NewServer(SyncHandler(test, func(r *http.Request) func(Item) bool {
+		return func(item Item) bool { return true }
+	}))
+	defer server.Close()
+
+	client := dialWebSocket(t, server.URL)
+	defer client.conn.Close()
+
+	const redacted = `{"name":"ann","email":"[redacted]"}`
+	if snapshot := client.message(t); len(snapshot.Items) != 1 || string(snapshot.Items[0].Data) != redacted {
+		t.Fatal("bad snapshot", snapshot)
+	}
+
+	test.Set(0, &Account{"ann", "ann@example.org", "hunter3"})
+	if message := client.message(t); string(message.Data) != redacted {
+		t.Fatal("bad message", message)
+	}
+}
+
+func TestSyncHandlerErrors(t *testing.T) {
+	plain, _ := NewDump("test.db", PERSIST_MANUAL, Type{"dump.Blob", &Blob{}})
+	recorder := httptest.NewRecorder()
+	SyncHandler(plain, nil).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatal("synced changes that aren't tracked")
+	}
+
+	test, _ := New("test.db", PERSIST_MANUAL, []Type{{"dump.Blob", &Blob{}}},
+		WithChanges(0))
+	recorder = httptest.NewRecorder()
+	SyncHandler(test, nil).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatal("accepted a request that isn't a websocket")
+	}
+}